@@ -0,0 +1,255 @@
+package accdx
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+// Any user can request access and follow own requests, deciding on a request
+// is limited to the admins of the service by the controller
+
+func AccessEndpoints(gtx context.Context) []*httpx.Endpoint {
+	ac := core.AccessCtlr(gtx)
+	return []*httpx.Endpoint{
+		createRequestEp(ac),
+		getRequestEp(ac),
+		getOwnRequestsEp(ac),
+		getServiceRequestsEp(ac),
+		approveRequestEp(ac),
+		denyRequestEp(ac),
+		cancelRequestEp(ac),
+		getRequestHistoryEp(ac),
+	}
+}
+
+func createRequestEp(ac core.AccessRequestController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var req core.AccessRequest
+		if err := etx.Bind(&req); err != nil {
+			return errx.BadReqX(err, "failed to read access request")
+		}
+
+		id, err := ac.Create(etx.Request().Context(), &req)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, data.M{
+			"requestId": id,
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.POST,
+		Path:     "/access/request",
+		Category: "idx.access",
+		Desc:     "Request access to a group",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getRequestEp(ac core.AccessRequestController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		req, err := ac.GetOne(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, req)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/access/request/:id",
+		Category: "idx.access",
+		Desc:     "Get an access request",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getOwnRequestsEp(ac core.AccessRequestController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		state := prmg.QueryStrOr("state", "")
+
+		gtx := etx.Request().Context()
+		user, err := core.GetUser(gtx)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		reqs, err := ac.Get(gtx, &core.AccessRequestFilter{
+			UserId: user.Id(),
+			State:  core.AccessRequestState(state),
+		})
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, reqs)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/access/request/mine",
+		Category: "idx.access",
+		Desc:     "Get access requests of the current user",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getServiceRequestsEp(ac core.AccessRequestController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		state := prmg.QueryStrOr("state", "")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		reqs, err := ac.Get(etx.Request().Context(), &core.AccessRequestFilter{
+			ServiceId: serviceId,
+			State:     core.AccessRequestState(state),
+		})
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, reqs)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/service/:serviceId/access/request",
+		Category: "idx.access",
+		Desc:     "Get access requests for groups of a service",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func approveRequestEp(ac core.AccessRequestController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var decision core.AccessDecision
+		if err := etx.Bind(&decision); err != nil {
+			return errx.BadReqX(err, "failed to read decision from request")
+		}
+
+		if err := ac.Approve(etx.Request().Context(), id, &decision); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/access/request/:id/approve",
+		Category: "idx.access",
+		Desc:     "Approve an access request",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func denyRequestEp(ac core.AccessRequestController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var decision core.AccessDecision
+		if err := etx.Bind(&decision); err != nil {
+			return errx.BadReqX(err, "failed to read decision from request")
+		}
+
+		if err := ac.Deny(etx.Request().Context(), id, &decision); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/access/request/:id/deny",
+		Category: "idx.access",
+		Desc:     "Deny an access request",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func cancelRequestEp(ac core.AccessRequestController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := ac.Cancel(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/access/request/:id/cancel",
+		Category: "idx.access",
+		Desc:     "Cancel own pending access request",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getRequestHistoryEp(ac core.AccessRequestController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		logs, err := ac.History(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, logs)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/access/request/:id/history",
+		Category: "idx.access",
+		Desc:     "Get history of an access request",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
@@ -0,0 +1,118 @@
+package accdx
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+type Client struct {
+	*httpx.Client
+	Timeout time.Duration
+}
+
+func (c *Client) build() *httpx.RequestBuilder {
+	builder := c.Build()
+	if c.Timeout != 0 {
+		builder = builder.WithTimeout(c.Timeout)
+	}
+	return builder
+}
+
+func (c *Client) RequestAccess(
+	gtx context.Context, req *core.AccessRequest) (int64, error) {
+	apiRes := c.build().Path("/api/v1/access/request").Post(gtx, req)
+	res := map[string]int64{"requestId": int64(-1)}
+	if err := apiRes.LoadClose(&res); err != nil {
+		return -1, errx.Errf(err,
+			"failed to request access to group: '%d'", req.GroupId)
+	}
+	return res["requestId"], nil
+}
+
+func (c *Client) GetAccessRequest(
+	gtx context.Context, id int64) (*core.AccessRequest, error) {
+	var req core.AccessRequest
+	apiRes := c.build().Path("/api/v1/access/request", id).Get(gtx)
+	if err := apiRes.LoadClose(&req); err != nil {
+		return nil, errx.Errf(err, "failed to get access request: '%d'", id)
+	}
+	return &req, nil
+}
+
+func (c *Client) GetOwnAccessRequests(
+	gtx context.Context,
+	state core.AccessRequestState) ([]*core.AccessRequest, error) {
+	builder := c.build().Path("/api/v1/access/request/mine")
+	if state != "" {
+		builder = builder.QStr("state", string(state))
+	}
+	reqs := make([]*core.AccessRequest, 0, 20)
+	if err := builder.Get(gtx).LoadClose(&reqs); err != nil {
+		return nil, errx.Errf(err, "failed to get own access requests")
+	}
+	return reqs, nil
+}
+
+func (c *Client) GetServiceAccessRequests(
+	gtx context.Context,
+	serviceId int64,
+	state core.AccessRequestState) ([]*core.AccessRequest, error) {
+	builder := c.build().
+		Path("/api/v1/service", serviceId, "access/request")
+	if state != "" {
+		builder = builder.QStr("state", string(state))
+	}
+	reqs := make([]*core.AccessRequest, 0, 50)
+	if err := builder.Get(gtx).LoadClose(&reqs); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get access requests of service: '%d'", serviceId)
+	}
+	return reqs, nil
+}
+
+func (c *Client) ApproveAccessRequest(
+	gtx context.Context, id int64, decision *core.AccessDecision) error {
+	apiRes := c.build().
+		Path("/api/v1/access/request", id, "approve").
+		Put(gtx, decision)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to approve access request: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) DenyAccessRequest(
+	gtx context.Context, id int64, decision *core.AccessDecision) error {
+	apiRes := c.build().
+		Path("/api/v1/access/request", id, "deny").
+		Put(gtx, decision)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to deny access request: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) CancelAccessRequest(gtx context.Context, id int64) error {
+	apiRes := c.build().
+		Path("/api/v1/access/request", id, "cancel").
+		Put(gtx, nil)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to cancel access request: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) GetAccessRequestHistory(
+	gtx context.Context, id int64) ([]*core.AccessRequestLog, error) {
+	logs := make([]*core.AccessRequestLog, 0, 4)
+	apiRes := c.build().Path("/api/v1/access/request", id, "history").Get(gtx)
+	if err := apiRes.LoadClose(&logs); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get history of access request: '%d'", id)
+	}
+	return logs, nil
+}
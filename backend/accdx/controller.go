@@ -0,0 +1,335 @@
+package accdx
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/idx/mailtmpl"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+type accessCtl struct {
+	astore *PgAccessStorage
+}
+
+func NewAccessController(
+	astore *PgAccessStorage) core.AccessRequestController {
+	return &accessCtl{
+		astore: astore,
+	}
+}
+
+func (ac *accessCtl) Create(
+	gtx context.Context, req *core.AccessRequest) (int64, error) {
+	ev := core.NewEventAdder(gtx, "access.request", data.M{
+		"groupId":    req.GroupId,
+		"validUntil": req.ValidUntil,
+	})
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	req.UserId = user.Id()
+	req.UserName = user.UName
+
+	if req.Justification == "" {
+		return -1, ev.Errf(core.ErrInvalidState,
+			"justification is required to request access")
+	}
+	if req.ValidUntil != nil && !req.ValidUntil.After(time.Now()) {
+		return -1, ev.Errf(core.ErrInvalidState,
+			"access can only be requested till a time in future")
+	}
+
+	group, err := core.GroupCtlr(gtx).GetOne(gtx, req.GroupId)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	if group.JoinPolicy == core.JoinClosed {
+		return -1, ev.Errf(core.ErrInvalidState,
+			"group '%s' does not accept access requests", group.Name)
+	}
+	req.ServiceId = int64(group.ServiceId)
+	req.GroupName = group.Name
+
+	// Users with a time-bound membership can ask for it to be extended
+	membership, err := core.GroupCtlr(gtx).GetMembership(
+		gtx, req.UserId, req.GroupId)
+	if err != nil && !errors.Is(err, core.ErrInvalidState) {
+		return -1, ev.Commit(err)
+	}
+	if membership != nil && membership.ValidUntil == nil {
+		return -1, ev.Errf(core.ErrEntityExists,
+			"user '%s' is already a member of group '%s'",
+			user.UName, group.Name)
+	}
+	if membership == nil && group.JoinPolicy == core.JoinOpen {
+		return -1, ev.Errf(core.ErrInvalidState,
+			"group '%s' is open, join it directly", group.Name)
+	}
+
+	pending, err := ac.astore.HasPending(gtx, req.UserId, req.GroupId)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	if pending {
+		return -1, ev.Errf(core.ErrEntityExists,
+			"user '%s' already has a pending request for group '%s'",
+			user.UName, group.Name)
+	}
+
+	id, err := ac.astore.Create(gtx, req)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	req.Id = id
+
+	// Request stands even if some of the admins could not be notified, it
+	// shows up in the pending requests of the service anyway
+	admins, err := core.ServiceCtlr(gtx).GetAdmins(gtx, req.ServiceId)
+	if err != nil {
+		log.Error().Err(err).Int64("requestId", id).
+			Msg("failed to get admins to notify about access request")
+		return id, ev.Commit(nil)
+	}
+	for _, admin := range admins {
+		err := core.SendSimpleMail(gtx, admin.EmailId,
+			mailtmpl.AccessRequestedTemplate, data.M{
+				"userName":      req.UserName,
+				"groupName":     req.GroupName,
+				"justification": req.Justification,
+				"validUntil":    formatTime(req.ValidUntil),
+			})
+		if err != nil {
+			log.Error().Err(err).
+				Int64("requestId", id).
+				Int64("adminId", admin.Id()).
+				Msg("failed to notify admin about access request")
+		}
+	}
+	return id, ev.Commit(nil)
+}
+
+func (ac *accessCtl) GetOne(
+	gtx context.Context, id int64) (*core.AccessRequest, error) {
+	ev := core.NewEventAdder(gtx, "access.getOne", data.M{
+		"requestId": id,
+	})
+	req, err := ac.astore.GetOne(gtx, id)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if err := checkViewer(gtx, req); err != nil {
+		return nil, ev.Commit(err)
+	}
+	return req, nil
+}
+
+func (ac *accessCtl) Get(
+	gtx context.Context,
+	filter *core.AccessRequestFilter) ([]*core.AccessRequest, error) {
+	ev := core.NewEventAdder(gtx, "access.get", data.M{
+		"filter": filter,
+	})
+
+	if filter.ServiceId != 0 {
+		if err := core.CheckServiceAdmin(gtx, filter.ServiceId); err != nil {
+			return nil, ev.Commit(err)
+		}
+	} else {
+		user, err := core.GetUser(gtx)
+		if err != nil {
+			return nil, ev.Commit(err)
+		}
+		if filter.UserId != user.Id() && user.Role() != auth.Super {
+			return nil, ev.Errf(core.ErrUnauthorized,
+				"user '%s' can only list own access requests", user.UName)
+		}
+	}
+
+	reqs, err := ac.astore.Get(gtx, filter)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return reqs, nil
+}
+
+func (ac *accessCtl) Approve(
+	gtx context.Context, id int64, decision *core.AccessDecision) error {
+	ev := core.NewEventAdder(gtx, "access.approve", data.M{
+		"requestId": id,
+		"decision":  decision,
+	})
+
+	req, approver, err := ac.forDecision(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+
+	if decision.ValidUntil == nil {
+		decision.ValidUntil = req.ValidUntil
+	}
+	if decision.ValidUntil != nil && !decision.ValidUntil.After(time.Now()) {
+		return ev.Errf(core.ErrInvalidState,
+			"access can only be granted till a time in future")
+	}
+
+	if err := ac.astore.Approve(gtx, req, approver.Id(), decision); err != nil {
+		return ev.Commit(err)
+	}
+	core.NotifyProvisioning(gtx, core.ProvUser, req.UserId)
+	core.NotifyProvisioning(gtx, core.ProvGroup, req.GroupId)
+
+	req.State, req.Comment = core.AccessApproved, decision.Comment
+	req.ValidUntil = decision.ValidUntil
+	notifyRequester(gtx, req)
+	return ev.Commit(nil)
+}
+
+func (ac *accessCtl) Deny(
+	gtx context.Context, id int64, decision *core.AccessDecision) error {
+	ev := core.NewEventAdder(gtx, "access.deny", data.M{
+		"requestId": id,
+		"decision":  decision,
+	})
+
+	if decision.Comment == "" {
+		return ev.Errf(core.ErrInvalidState,
+			"comment is required to deny an access request")
+	}
+	req, approver, err := ac.forDecision(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+
+	// Validity is only meaningful for approvals
+	decision.ValidUntil = nil
+	err = ac.astore.Close(gtx, id, core.AccessDenied, approver.Id(), decision)
+	if err != nil {
+		return ev.Commit(err)
+	}
+
+	req.State, req.Comment = core.AccessDenied, decision.Comment
+	notifyRequester(gtx, req)
+	return ev.Commit(nil)
+}
+
+func (ac *accessCtl) Cancel(gtx context.Context, id int64) error {
+	ev := core.NewEventAdder(gtx, "access.cancel", data.M{
+		"requestId": id,
+	})
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	req, err := ac.astore.GetOne(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if req.UserId != user.Id() {
+		return ev.Errf(core.ErrUnauthorized,
+			"only the requester can cancel access request '%d'", id)
+	}
+
+	err = ac.astore.Close(
+		gtx, id, core.AccessCancelled, user.Id(), &core.AccessDecision{})
+	if err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(nil)
+}
+
+func (ac *accessCtl) History(
+	gtx context.Context, id int64) ([]*core.AccessRequestLog, error) {
+	ev := core.NewEventAdder(gtx, "access.history", data.M{
+		"requestId": id,
+	})
+	req, err := ac.astore.GetOne(gtx, id)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if err := checkViewer(gtx, req); err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	logs, err := ac.astore.History(gtx, id)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return logs, nil
+}
+
+// forDecision - pending request that the user in the context is allowed to
+// decide on. Admins cannot decide on their own requests
+func (ac *accessCtl) forDecision(
+	gtx context.Context, id int64) (*core.AccessRequest, *core.User, error) {
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := ac.astore.GetOne(gtx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.State != core.AccessPending {
+		return nil, nil, errx.Errf(core.ErrInvalidState,
+			"access request '%d' is already %s", id, req.State)
+	}
+	if err := core.CheckServiceAdmin(gtx, req.ServiceId); err != nil {
+		return nil, nil, err
+	}
+	if req.UserId == user.Id() {
+		return nil, nil, errx.Errf(core.ErrUnauthorized,
+			"user '%s' cannot decide on own access request", user.UName)
+	}
+	return req, user, nil
+}
+
+// checkViewer - requests are visible to the requester and to the admins of
+// the service
+func checkViewer(gtx context.Context, req *core.AccessRequest) error {
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return err
+	}
+	if req.UserId == user.Id() {
+		return nil
+	}
+	return core.CheckServiceAdmin(gtx, req.ServiceId)
+}
+
+func notifyRequester(gtx context.Context, req *core.AccessRequest) {
+	user, err := core.UserCtlr(gtx).GetOne(gtx, req.UserId)
+	if err != nil {
+		log.Error().Err(err).Int64("requestId", req.Id).
+			Msg("failed to get requester to notify about decision")
+		return
+	}
+
+	err = core.SendSimpleMail(gtx, user.EmailId,
+		mailtmpl.AccessDecidedTemplate, data.M{
+			"userName":   user.UName,
+			"groupName":  req.GroupName,
+			"approved":   req.State == core.AccessApproved,
+			"comment":    req.Comment,
+			"validUntil": formatTime(req.ValidUntil),
+		})
+	if err != nil {
+		log.Error().Err(err).Int64("requestId", req.Id).
+			Msg("failed to notify requester about decision")
+	}
+}
+
+func formatTime(tm *time.Time) string {
+	if tm == nil {
+		return ""
+	}
+	return tm.Format(time.RFC1123)
+}
@@ -0,0 +1,309 @@
+package accdx
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+const maxListed = 1000
+
+// execer - transaction the state changes of requests are written in
+type execer interface {
+	ExecContext(
+		gtx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type PgAccessStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewAccessStorage(gd data.GetterDeleter) *PgAccessStorage {
+	return &PgAccessStorage{
+		gd: gd,
+	}
+}
+
+func (pas *PgAccessStorage) Create(
+	gtx context.Context, req *core.AccessRequest) (int64, error) {
+
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return -1, errx.Errf(err, "failed to initilize DB transaction")
+	}
+	ef := func(err error, fmtStr string, args ...any) error {
+		if e := tx.Rollback(); e != nil {
+			log.Error().Err(e).
+				Msg("transaction rollback failed for access request creation")
+		}
+		return errx.Errf(err, fmtStr, args...)
+	}
+
+	const query = `
+		INSERT INTO idx_access_request (
+			user_id,
+			group_id,
+			service_id,
+			justification,
+			valid_until
+		) VALUES (
+			$1, $2, $3, $4, $5
+		) RETURNING id
+	`
+	var id int64
+	err = tx.GetContext(gtx, &id, query, req.UserId, req.GroupId,
+		req.ServiceId, req.Justification, req.ValidUntil)
+	if err != nil {
+		return -1, ef(err, "failed to create access request of user '%d' "+
+			"for group '%d'", req.UserId, req.GroupId)
+	}
+
+	err = addLog(gtx, tx, id, core.AccessPending, req.UserId, req.Justification)
+	if err != nil {
+		return -1, ef(err, "failed to log creation of access request")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, ef(err, "failed to commit access request creation")
+	}
+	return id, nil
+}
+
+const selectRequests = `
+	SELECT
+		r.*,
+		u.user_name,
+		g.name AS group_name
+	FROM idx_access_request r
+	JOIN idx_user u ON u.id = r.user_id
+	JOIN idx_group g ON g.id = r.group_id
+`
+
+func (pas *PgAccessStorage) GetOne(
+	gtx context.Context, id int64) (*core.AccessRequest, error) {
+	query := selectRequests + `WHERE r.id = $1 AND ` +
+		core.TenantCond(gtx, "g.tenant_id")
+	var req core.AccessRequest
+	if err := pg.Conn().GetContext(gtx, &req, query, id); err != nil {
+		return nil, errx.Errf(err, "failed to get access request '%d'", id)
+	}
+	return &req, nil
+}
+
+func (pas *PgAccessStorage) Get(
+	gtx context.Context,
+	filter *core.AccessRequestFilter) ([]*core.AccessRequest, error) {
+
+	eq := squirrel.Eq{}
+	if filter.ServiceId != 0 {
+		eq["r.service_id"] = filter.ServiceId
+	}
+	if filter.UserId != 0 {
+		eq["r.user_id"] = filter.UserId
+	}
+	if filter.State != "" {
+		eq["r.state"] = filter.State
+	}
+
+	query, args, err := squirrel.StatementBuilder.
+		PlaceholderFormat(squirrel.Dollar).
+		Select("r.*", "u.user_name", "g.name AS group_name").
+		From("idx_access_request r").
+		Join("idx_user u ON u.id = r.user_id").
+		Join("idx_group g ON g.id = r.group_id").
+		Where(eq).
+		Where(core.TenantCond(gtx, "g.tenant_id")).
+		OrderBy("r.created_on DESC").
+		Limit(maxListed).
+		ToSql()
+	if err != nil {
+		return nil, errx.Errf(err, "failed to build access request query")
+	}
+
+	reqs := make([]*core.AccessRequest, 0, 50)
+	if err := pg.Conn().SelectContext(gtx, &reqs, query, args...); err != nil {
+		return nil, errx.Errf(err, "failed to get access requests")
+	}
+	return reqs, nil
+}
+
+func (pas *PgAccessStorage) HasPending(
+	gtx context.Context, userId, groupId int64) (bool, error) {
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM idx_access_request
+			WHERE user_id = $1 AND group_id = $2 AND state = 'pending'
+		)
+	`
+	pending := false
+	err := pg.Conn().GetContext(gtx, &pending, query, userId, groupId)
+	if err != nil {
+		return false, errx.Errf(err, "failed to check pending access requests "+
+			"of user '%d' for group '%d'", userId, groupId)
+	}
+	return pending, nil
+}
+
+// Approve - closes the request and adds the requester to the group in the
+// same transaction. An existing membership is never shortened and starts
+// right away if it was due to start later
+func (pas *PgAccessStorage) Approve(
+	gtx context.Context,
+	req *core.AccessRequest,
+	actorId int64,
+	decision *core.AccessDecision) error {
+
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return errx.Errf(err, "failed to initilize DB transaction")
+	}
+	ef := func(err error, fmtStr string, args ...any) error {
+		if e := tx.Rollback(); e != nil {
+			log.Error().Err(e).
+				Msg("transaction rollback failed for access request approval")
+		}
+		return errx.Errf(err, fmtStr, args...)
+	}
+
+	err = decide(gtx, tx, req.Id, core.AccessApproved, actorId, decision)
+	if err != nil {
+		return ef(err, "failed to approve access request '%d'", req.Id)
+	}
+
+	const query = `
+		INSERT INTO user_to_group (
+			user_id,
+			group_id,
+			valid_until
+		) VALUES (
+			$1, $2, $3
+		) ON CONFLICT (user_id, group_id) DO UPDATE SET
+			valid_from = LEAST(user_to_group.valid_from, EXCLUDED.valid_from),
+			valid_until = CASE
+				WHEN user_to_group.valid_until IS NULL OR
+					EXCLUDED.valid_until IS NULL THEN NULL
+				ELSE GREATEST(user_to_group.valid_until, EXCLUDED.valid_until)
+			END,
+			warned_on = NULL
+	`
+	_, err = tx.ExecContext(
+		gtx, query, req.UserId, req.GroupId, decision.ValidUntil)
+	if err != nil {
+		return ef(err, "failed to add user '%d' to group '%d'",
+			req.UserId, req.GroupId)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ef(err, "failed to commit approval of access request '%d'",
+			req.Id)
+	}
+	return nil
+}
+
+// Close - moves a pending request to a final state without granting access
+func (pas *PgAccessStorage) Close(
+	gtx context.Context,
+	id int64,
+	state core.AccessRequestState,
+	actorId int64,
+	decision *core.AccessDecision) error {
+
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return errx.Errf(err, "failed to initilize DB transaction")
+	}
+	ef := func(err error, fmtStr string, args ...any) error {
+		if e := tx.Rollback(); e != nil {
+			log.Error().Err(e).
+				Msg("transaction rollback failed for access request closure")
+		}
+		return errx.Errf(err, fmtStr, args...)
+	}
+
+	if err := decide(gtx, tx, id, state, actorId, decision); err != nil {
+		return ef(err, "failed to move access request '%d' to '%s'", id, state)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ef(err, "failed to commit closure of access request '%d'", id)
+	}
+	return nil
+}
+
+func (pas *PgAccessStorage) History(
+	gtx context.Context, id int64) ([]*core.AccessRequestLog, error) {
+	query := `
+		SELECT
+			l.*,
+			COALESCE(u.user_name, '') AS actor_name
+		FROM idx_access_request_log l
+		LEFT JOIN idx_user u ON u.id = l.actor_id
+		WHERE l.request_id = $1
+		ORDER BY l.id
+	`
+	logs := make([]*core.AccessRequestLog, 0, 4)
+	if err := pg.Conn().SelectContext(gtx, &logs, query, id); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get history of access request '%d'", id)
+	}
+	return logs, nil
+}
+
+// decide - the update only matches a pending request, so that concurrent
+// decisions on the same request cannot both succeed
+func decide(
+	gtx context.Context,
+	tx execer,
+	id int64,
+	state core.AccessRequestState,
+	actorId int64,
+	decision *core.AccessDecision) error {
+	const query = `
+		UPDATE idx_access_request SET
+			state = $2,
+			decided_by = $3,
+			decided_on = $4,
+			comment = $5,
+			valid_until = COALESCE($6, valid_until),
+			updated_on = $4
+		WHERE id = $1 AND state = 'pending'
+	`
+	res, err := tx.ExecContext(gtx, query, id, state, actorId, time.Now(),
+		decision.Comment, decision.ValidUntil)
+	if err != nil {
+		return err
+	}
+	if num, err := res.RowsAffected(); err != nil || num != 1 {
+		return errx.Errf(core.ErrInvalidState,
+			"access request '%d' is not pending", id)
+	}
+	return addLog(gtx, tx, id, state, actorId, decision.Comment)
+}
+
+func addLog(
+	gtx context.Context,
+	tx execer,
+	id int64,
+	state core.AccessRequestState,
+	actorId int64,
+	comment string) error {
+	const query = `
+		INSERT INTO idx_access_request_log (
+			request_id,
+			state,
+			actor_id,
+			comment
+		) VALUES (
+			$1, $2, $3, $4
+		)
+	`
+	_, err := tx.ExecContext(gtx, query, id, state, actorId, comment)
+	return err
+}
@@ -75,6 +75,11 @@ func (ah *argon2Hasher) Hash(pw string) (string, error) {
 	return hashForStorage, nil
 }
 
+// NeedsRehash implements core.Hasher.
+func (*argon2Hasher) NeedsRehash(hash string) bool {
+	return false
+}
+
 // Verify implements core.Hasher.
 func (*argon2Hasher) Verify(pw string, hashStr string) error {
 	comps := strings.Split(hashStr, "$")
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+const pepperPrefix = "$pepper$k="
+
+// pepperedHasher - applies a HMAC with a server side pepper before hashing,
+// so that the hashes in a database dump cannot be cracked without the master
+// key. The key version of the pepper is kept with the hash
+type pepperedHasher struct {
+	inner core.Hasher
+	keys  core.KeyManager
+}
+
+func NewPepperedHasher(inner core.Hasher, keys core.KeyManager) core.Hasher {
+	return &pepperedHasher{
+		inner: inner,
+		keys:  keys,
+	}
+}
+
+// Hash implements core.Hasher.
+func (ph *pepperedHasher) Hash(pw string) (string, error) {
+	version := ph.keys.CurrentVersion()
+	peppered, err := ph.keys.Pepper(version, pw)
+	if err != nil {
+		return "", errx.Wrap(err)
+	}
+
+	hash, err := ph.inner.Hash(peppered)
+	if err != nil {
+		return "", errx.Wrap(err)
+	}
+	return fmt.Sprintf("%s%d%s", pepperPrefix, version, hash), nil
+}
+
+// NeedsRehash implements core.Hasher. Hashes without pepper or with the
+// pepper of an older key are replaced, so that the older keys can be removed
+func (ph *pepperedHasher) NeedsRehash(hash string) bool {
+	return !strings.HasPrefix(hash, versionPrefix(ph.keys.CurrentVersion()))
+}
+
+// PepperedWithOlderKeys - number of password hashes that still need an older
+// key. Their users have to login once, or reset their password, before the
+// older key is removed
+func PepperedWithOlderKeys(
+	gtx context.Context, currentVersion int) (int, error) {
+	const query = `
+		SELECT COUNT(*) FROM credential
+		WHERE password_hash LIKE $1 AND password_hash NOT LIKE $2
+	`
+	num := 0
+	err := pg.Conn().GetContext(gtx, &num, query,
+		pepperPrefix+"%", versionPrefix(currentVersion)+"%")
+	if err != nil {
+		return 0, errx.Errf(err, "failed to count password hashes to rehash")
+	}
+	return num, nil
+}
+
+func versionPrefix(version int) string {
+	return fmt.Sprintf("%s%d$", pepperPrefix, version)
+}
+
+// Verify implements core.Hasher. Hashes created before the pepper was
+// introduced are verified as they are
+func (ph *pepperedHasher) Verify(pw string, hashStr string) error {
+	if !strings.HasPrefix(hashStr, pepperPrefix) {
+		return ph.inner.Verify(pw, hashStr)
+	}
+
+	rest := strings.TrimPrefix(hashStr, pepperPrefix)
+	idx := strings.Index(rest, "$")
+	if idx < 0 {
+		return errx.Errf(ErrHashVerficationFailed, "invalid peppered hash")
+	}
+	version, err := strconv.Atoi(rest[:idx])
+	if err != nil {
+		return errx.Errf(ErrHashVerficationFailed, "invalid pepper version")
+	}
+
+	peppered, err := ph.keys.Pepper(version, pw)
+	if err != nil {
+		return errx.Wrap(err)
+	}
+	return ph.inner.Verify(peppered, rest[idx:])
+}
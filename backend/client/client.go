@@ -3,8 +3,17 @@ package client
 import (
 	"time"
 
+	"github.com/varunamachi/idx/accdx"
+	"github.com/varunamachi/idx/elevdx"
 	"github.com/varunamachi/idx/grpdx"
+	"github.com/varunamachi/idx/oidcdx"
+	"github.com/varunamachi/idx/provdx"
+	"github.com/varunamachi/idx/reldx"
+	"github.com/varunamachi/idx/revdx"
+	"github.com/varunamachi/idx/samldx"
+	"github.com/varunamachi/idx/scimdx"
 	"github.com/varunamachi/idx/svcdx"
+	"github.com/varunamachi/idx/tenantdx"
 	"github.com/varunamachi/idx/userdx"
 	"github.com/varunamachi/libx/httpx"
 )
@@ -13,12 +22,30 @@ type (
 	UserClient = userdx.Client
 	GrpClient  = grpdx.Client
 	SvcClient  = svcdx.Client
+	OidcClient = oidcdx.Client
+	SamlClient = samldx.Client
+	ScimClient = scimdx.Client
+	ProvClient = provdx.Client
+	RelClient  = reldx.Client
+	AccClient  = accdx.Client
+	ElevClient = elevdx.Client
+	RevClient  = revdx.Client
+	TenClient  = tenantdx.Client
 )
 
 type Client struct {
 	UserClient
 	GrpClient
 	SvcClient
+	OidcClient
+	SamlClient
+	ScimClient
+	ProvClient
+	RelClient
+	AccClient
+	ElevClient
+	RevClient
+	TenClient
 }
 
 func New(address string) *Client {
@@ -34,6 +61,33 @@ func New(address string) *Client {
 		SvcClient: svcdx.Client{
 			Client: hxClient,
 		},
+		OidcClient: oidcdx.Client{
+			Client: hxClient,
+		},
+		SamlClient: samldx.Client{
+			Client: hxClient,
+		},
+		ScimClient: scimdx.Client{
+			Client: hxClient,
+		},
+		ProvClient: provdx.Client{
+			Client: hxClient,
+		},
+		RelClient: reldx.Client{
+			Client: hxClient,
+		},
+		AccClient: accdx.Client{
+			Client: hxClient,
+		},
+		ElevClient: elevdx.Client{
+			Client: hxClient,
+		},
+		RevClient: revdx.Client{
+			Client: hxClient,
+		},
+		TenClient: tenantdx.Client{
+			Client: hxClient,
+		},
 	}
 }
 
@@ -42,5 +96,14 @@ func (c *Client) WithTimeout(timeout time.Duration) *Client {
 	c.UserClient.Timeout = timeout
 	c.GrpClient.Timeout = timeout
 	c.SvcClient.Timeout = timeout
+	c.OidcClient.Timeout = timeout
+	c.SamlClient.Timeout = timeout
+	c.ScimClient.Timeout = timeout
+	c.ProvClient.Timeout = timeout
+	c.RelClient.Timeout = timeout
+	c.AccClient.Timeout = timeout
+	c.ElevClient.Timeout = timeout
+	c.RevClient.Timeout = timeout
+	c.TenClient.Timeout = timeout
 	return c
 }
@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"os"
 
 	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"github.com/varunamachi/idx/accdx"
 	"github.com/varunamachi/idx/auth"
-	idxAuth "github.com/varunamachi/idx/auth"
 	"github.com/varunamachi/idx/cmd"
 	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/idx/elevdx"
 	"github.com/varunamachi/idx/grpdx"
+	"github.com/varunamachi/idx/kms"
+	"github.com/varunamachi/idx/oidcdx"
 	idxpg "github.com/varunamachi/idx/pg"
+	"github.com/varunamachi/idx/provdx"
+	"github.com/varunamachi/idx/reldx"
+	"github.com/varunamachi/idx/revdx"
+	"github.com/varunamachi/idx/samldx"
+	"github.com/varunamachi/idx/scimdx"
 	"github.com/varunamachi/idx/svcdx"
+	"github.com/varunamachi/idx/tenantdx"
 	"github.com/varunamachi/idx/userdx"
 	"github.com/varunamachi/libx"
 	"github.com/varunamachi/libx/data/pg"
@@ -27,6 +38,17 @@ func main() {
 	gtx, cancel := rt.Gtx()
 	defer cancel()
 
+	// Master key is required for everything other than generating the first
+	// one
+	keyring, err := kms.LoadKeyring()
+	if err != nil {
+		if !generatingKey(os.Args) {
+			log.Fatal().Err(err).Msg("master key is not available")
+		}
+		run(gtx, cmd.KeysCommand())
+		return
+	}
+
 	emailProvider, err := email.ProviderFromEnv("IDX")
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed initilize email provider")
@@ -41,32 +63,76 @@ func main() {
 	userStore := userdx.NewUserStorage(gd)
 	serviceStore := svcdx.NewServiceStorage(gd)
 	groupStore := grpdx.NewGroupStorage(gd)
+	upstreamStore := oidcdx.NewUpstreamStorage(gd)
+	samlStore := samldx.NewSamlStorage(gd)
+	scimStore := scimdx.NewScimStorage(gd)
+	provStore := provdx.NewProvStorage(gd)
+	policyStore := svcdx.NewPolicyStorage(gd)
+	sodStore := svcdx.NewSodStorage(gd)
+	relStore := reldx.NewRelStorage(gd)
+	accessStore := accdx.NewAccessStorage(gd)
+	elevationStore := elevdx.NewElevationStorage(gd)
+	reviewStore := revdx.NewReviewStorage(gd)
+	templateStore := grpdx.NewRoleTemplateStorage(gd)
+	tenantStore := tenantdx.NewTenantStorage(gd)
 
-	hasher := auth.NewArgon2Hasher()
+	hasher := auth.NewPepperedHasher(auth.NewArgon2Hasher(), keyring)
 	credStorage := userdx.NewCredentialStorage(hasher)
 
 	uctlr := userdx.NewUserController(userStore, credStorage, emailProvider)
 	sctlr := svcdx.NewServiceController(serviceStore)
 	gctlr := grpdx.NewGroupController(groupStore)
-	authr := idxAuth.NewAuthenticator(uctlr, credStorage)
+	upctlr := oidcdx.NewUpstreamController(upstreamStore)
+	samlctlr := samldx.NewSamlController(samlStore)
+	scimctlr := scimdx.NewScimController(scimStore)
+	provctlr := provdx.NewProvisioningController(provStore)
+	policyctlr := svcdx.NewPolicyController(policyStore)
+	sodctlr := svcdx.NewSodController(sodStore, serviceStore)
+	relctlr := reldx.NewRelationController(relStore)
+	accessctlr := accdx.NewAccessController(accessStore)
+	elevationctlr := elevdx.NewElevationController(elevationStore)
+	reviewctlr := revdx.NewReviewController(reviewStore)
+	templatectlr := grpdx.NewRoleTemplateController(templateStore)
+	tenantctlr := tenantdx.NewTenantController(tenantStore)
+	authr := auth.NewAuthenticator(uctlr, credStorage)
 
 	gtx = core.NewContext(gtx, &core.Services{
-		UserController:    uctlr,
-		ServiceController: sctlr,
-		GroupController:   gctlr,
-		UserAuthenticator: authr,
-		MailProvider:      emailProvider,
-		EventService:      evtSrv,
+		UserController:         uctlr,
+		ServiceController:      sctlr,
+		GroupController:        gctlr,
+		UpstreamController:     upctlr,
+		SamlController:         samlctlr,
+		ScimController:         scimctlr,
+		ProvisioningController: provctlr,
+		PolicyController:       policyctlr,
+		SodController:          sodctlr,
+		RelationController:     relctlr,
+		AccessController:       accessctlr,
+		ElevationController:    elevationctlr,
+		ReviewController:       reviewctlr,
+		RoleTemplateController: templatectlr,
+		TenantController:       tenantctlr,
+		UserAuthenticator:      authr,
+		MailProvider:           emailProvider,
+		EventService:           evtSrv,
+		KeyManager:             keyring,
 	})
 
+	run(gtx, cmd.ServeCommand(), cmd.KeysCommand(), cmd.ServiceCommand())
+}
+
+func run(gtx context.Context, commands ...*cli.Command) {
 	app := libx.NewApp(
 		"idx", "Simple Identity Service", "0.0.1", "varunamachi").
-		WithCommands(cmd.ServeCommand())
+		WithCommands(commands...)
 
 	if err := app.RunContext(gtx, os.Args); err != nil {
 		if !errors.Is(err, http.ErrServerClosed) {
 			log.Fatal().Err(err).Msg("exiting...")
 		}
 	}
+}
 
+func generatingKey(args []string) bool {
+	return len(args) > 2 && args[1] == "keys" && args[2] == "generate"
 }
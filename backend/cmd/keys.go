@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+	"github.com/varunamachi/idx/auth"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/idx/kms"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+func KeysCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "keys",
+		Usage:       "Manage master keys used to protect secrets",
+		Description: "Manage master keys used to protect secrets",
+		Subcommands: []*cli.Command{
+			generateKeyCommand(),
+			reencryptCommand(),
+		},
+	}
+}
+
+func generateKeyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "generate",
+		Usage: "Generate a new master key",
+		Description: "Generate a new master key. Append it to the keys " +
+			"given in IDX_MASTER_KEY_FILE or IDX_MASTER_KEY and run " +
+			"'idx keys reencrypt' to rotate the master key",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "version",
+				Value: 1,
+				Usage: "Version of the key, should be higher than existing ones",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			key, err := kms.GenerateKey(ctx.Int("version"))
+			if err != nil {
+				return errx.Wrap(err)
+			}
+			fmt.Println(key)
+			return nil
+		},
+	}
+}
+
+func reencryptCommand() *cli.Command {
+	return pg.Wrap(&cli.Command{
+		Name:  "reencrypt",
+		Usage: "Re-encrypt secrets with the current master key",
+		Description: "Re-encrypt secrets that are not encrypted or are " +
+			"encrypted with an older master key with the latest one",
+		Action: func(ctx *cli.Context) error {
+			keyring, ok := core.Keys(ctx.Context).(*kms.Keyring)
+			if !ok {
+				return errx.Errf(kms.ErrNoMasterKey,
+					"master key is required to re-encrypt secrets")
+			}
+
+			num, err := kms.Reseal(ctx.Context, keyring)
+			if err != nil {
+				return errx.Wrap(err)
+			}
+			fmt.Printf("re-encrypted %d secrets with key version %d\n",
+				num, keyring.CurrentVersion())
+
+			pending, err := auth.PepperedWithOlderKeys(
+				ctx.Context, keyring.CurrentVersion())
+			if err != nil {
+				return errx.Wrap(err)
+			}
+			if pending != 0 {
+				fmt.Printf("%d password hashes still use older keys, they "+
+					"are updated when their users login. Keep the older "+
+					"keys until then\n", pending)
+				return nil
+			}
+			fmt.Println("older keys are not used anymore and can be removed")
+			return nil
+		},
+	})
+}
@@ -4,12 +4,23 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/varunamachi/idx/accdx"
 	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/idx/elevdx"
 	"github.com/varunamachi/idx/grpdx"
+	"github.com/varunamachi/idx/kms"
+	"github.com/varunamachi/idx/oidcdx"
 	"github.com/varunamachi/idx/pg/schema"
+	"github.com/varunamachi/idx/provdx"
+	"github.com/varunamachi/idx/reldx"
+	"github.com/varunamachi/idx/revdx"
+	"github.com/varunamachi/idx/samldx"
+	"github.com/varunamachi/idx/scimdx"
 	"github.com/varunamachi/idx/svcdx"
+	"github.com/varunamachi/idx/tenantdx"
 	"github.com/varunamachi/idx/userdx"
 	"github.com/varunamachi/libx/auth"
 	"github.com/varunamachi/libx/data/pg"
@@ -32,10 +43,60 @@ func ServeCommand() *cli.Command {
 				Value: 8888,
 				Usage: "Port at which the service has to run",
 			},
+			&cli.DurationFlag{
+				Name:  "prov-push-interval",
+				Value: 10 * time.Second,
+				Usage: "Interval at which changes are pushed to connectors",
+			},
+			&cli.DurationFlag{
+				Name:  "prov-reconcile-interval",
+				Value: 24 * time.Hour,
+				Usage: "Interval at which connectors are reconciled",
+			},
+			&cli.DurationFlag{
+				Name:  "token-purge-interval",
+				Value: time.Hour,
+				Usage: "Interval at which expired tokens are deleted",
+			},
+			&cli.DurationFlag{
+				Name:  "rel-purge-interval",
+				Value: time.Hour,
+				Usage: "Interval at which deleted relation tuples are purged",
+			},
+			&cli.DurationFlag{
+				Name:  "membership-sweep-interval",
+				Value: 10 * time.Minute,
+				Usage: "Interval at which expired group memberships are removed",
+			},
+			&cli.DurationFlag{
+				Name:  "membership-warn-before",
+				Value: 72 * time.Hour,
+				Usage: "Duration before expiry at which members are warned",
+			},
+			&cli.DurationFlag{
+				Name:  "elevation-sweep-interval",
+				Value: time.Minute,
+				Usage: "Interval at which expired elevations are closed",
+			},
+			&cli.DurationFlag{
+				Name:  "review-sweep-interval",
+				Value: 10 * time.Minute,
+				Usage: "Interval at which review campaigns past deadline are closed",
+			},
+			&cli.DurationFlag{
+				Name:  "review-remind-every",
+				Value: 72 * time.Hour,
+				Usage: "Duration after which reviewers are reminded again",
+			},
 		},
 		Action: func(ctx *cli.Context) error {
 
 			gtx := ctx.Context
+			if core.Keys(gtx) == nil {
+				return errx.Errf(kms.ErrNoMasterKey,
+					"master key is required to start the service")
+			}
+
 			// schema.Init(gtx, "onServerStart")
 			app := libx.MustGetApp(ctx).
 				WithServer(
@@ -45,13 +106,40 @@ func ServeCommand() *cli.Command {
 						WithAPIs(userdx.AuthEndpoints(gtx)...).
 						WithAPIs(userdx.UserEndpoints(gtx)...).
 						WithAPIs(grpdx.GroupEndpoints(gtx)...).
-						WithAPIs(svcdx.ServiceEndpoints(gtx)...))
+						WithAPIs(grpdx.RoleTemplateEndpoints(gtx)...).
+						WithAPIs(svcdx.ServiceEndpoints(gtx)...).
+						WithAPIs(svcdx.PolicyEndpoints(gtx)...).
+						WithAPIs(svcdx.SodEndpoints(gtx)...).
+						WithAPIs(reldx.RelationEndpoints(gtx)...).
+						WithAPIs(accdx.AccessEndpoints(gtx)...).
+						WithAPIs(elevdx.ElevationEndpoints(gtx)...).
+						WithAPIs(revdx.ReviewEndpoints(gtx)...).
+						WithAPIs(tenantdx.TenantEndpoints(gtx)...).
+						WithAPIs(oidcdx.UpstreamEndpoints(gtx)...).
+						WithAPIs(samldx.SamlEndpoints(gtx)...).
+						WithAPIs(provdx.ProvisioningEndpoints(gtx)...).
+						WithPages(samldx.SamlPages(gtx)...).
+						WithPages(scimdx.ScimPages(gtx)...))
 
 			// Create schema if required
 			if err := schema.Init(gtx, "test"); err != nil {
 				return errx.Wrap(err)
 			}
 
+			go userdx.RunTokenPurge(gtx, ctx.Duration("token-purge-interval"))
+			go reldx.RunPurge(gtx, ctx.Duration("rel-purge-interval"))
+			go grpdx.RunMembershipSweeper(gtx,
+				ctx.Duration("membership-sweep-interval"),
+				ctx.Duration("membership-warn-before"))
+			go elevdx.RunElevationSweeper(gtx,
+				ctx.Duration("elevation-sweep-interval"))
+			go revdx.RunReviewSweeper(gtx,
+				ctx.Duration("review-sweep-interval"),
+				ctx.Duration("review-remind-every"))
+			go provdx.Run(gtx,
+				ctx.Duration("prov-push-interval"),
+				ctx.Duration("prov-reconcile-interval"))
+
 			go func() {
 				<-gtx.Done()
 				log.Info().Msg("stopping the server")
@@ -73,8 +161,11 @@ type userRetriever struct {
 
 func (ug *userRetriever) GetUser(
 	gtx context.Context, userId string) (auth.User, error) {
-	ctl := core.UserCtlr(gtx)
-	return ctl.ByUsername(gtx, userId)
+	user, err := core.SessionUser(gtx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return core.RouteUser(user), nil
 }
 
 func contextMiddleware(gtx context.Context) echo.MiddlewareFunc {
@@ -83,6 +174,8 @@ func contextMiddleware(gtx context.Context) echo.MiddlewareFunc {
 		return func(etx echo.Context) error {
 			newGtx := etx.Request().Context()
 			newGtx = core.CopyServices(gtx, newGtx)
+			newGtx = core.WithCurrentService(
+				newGtx, etx.Request().Header.Get(core.ServiceHeader))
 
 			etx.SetRequest(etx.Request().WithContext(newGtx))
 			// fmt.Println("set")
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/varunamachi/idx/client"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+)
+
+func ServiceCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "service",
+		Usage:       "Manage services registered with idx",
+		Description: "Manage services registered with idx",
+		Subcommands: []*cli.Command{
+			syncServiceCommand(),
+			explainCommand(),
+			whoHasCommand(),
+		},
+	}
+}
+
+func syncServiceCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "sync",
+		Usage: "Sync a service with its permission manifest",
+		Description: "Create or update a service, its permission tree, its " +
+			"groups and its default groups from a JSON manifest",
+		Flags: withClientFlags(
+			&cli.StringFlag{
+				Name:     "manifest",
+				Aliases:  []string{"f"},
+				Required: true,
+				Usage:    "Path to the JSON manifest of the service",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only show the changes, do not apply them",
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Remove permissions that are not in the manifest",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			manifest, err := readManifest(ctx.String("manifest"))
+			if err != nil {
+				return err
+			}
+
+			cnt, err := loggedInClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			res, err := cnt.SyncService(ctx.Context, manifest, &core.SyncOptions{
+				DryRun: ctx.Bool("dry-run"),
+				Prune:  ctx.Bool("prune"),
+			})
+			if err != nil {
+				return errx.Wrap(err)
+			}
+			printSyncResult(res)
+			return nil
+		},
+	}
+}
+
+func explainCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "explain",
+		Usage: "Explain where the permissions of a user in a service come from",
+		Description: "Show every effective permission of a user in a service " +
+			"along with the groups and the policies behind it",
+		Flags: withClientFlags(
+			&cli.Int64Flag{
+				Name:     "service-id",
+				Required: true,
+				Usage:    "Id of the service",
+			},
+			&cli.Int64Flag{
+				Name:  "user-id",
+				Usage: "Id of the user, defaults to the logged in user",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			cnt, err := loggedInClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			userId := ctx.Int64("user-id")
+			if !ctx.IsSet("user-id") {
+				userId = cnt.CurrentUser().Id()
+			}
+			out, err := cnt.Explain(ctx.Context, ctx.Int64("service-id"), userId)
+			if err != nil {
+				return errx.Wrap(err)
+			}
+
+			if len(out.Perms) == 0 {
+				fmt.Println("user does not have any permission in the service")
+				return nil
+			}
+			for _, pe := range out.Perms {
+				fmt.Println(pe.Perm)
+				printGrants(pe.Grants, pe.Policies)
+			}
+			return nil
+		},
+	}
+}
+
+func whoHasCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "who-has",
+		Usage: "Show the users who have a permission in a service",
+		Description: "Show the users who have a permission in a service " +
+			"along with the groups that give it, the permission can be " +
+			"scoped to a resource as 'perm@resource'",
+		Flags: withClientFlags(
+			&cli.Int64Flag{
+				Name:     "service-id",
+				Required: true,
+				Usage:    "Id of the service",
+			},
+			&cli.StringFlag{
+				Name:     "perm",
+				Required: true,
+				Usage:    "Permission to look for",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			cnt, err := loggedInClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			out, err := cnt.WhoHas(
+				ctx.Context, ctx.Int64("service-id"), ctx.String("perm"))
+			if err != nil {
+				return errx.Wrap(err)
+			}
+
+			if len(out.Holders) == 0 {
+				fmt.Println("no user has the permission")
+				return nil
+			}
+			for _, holder := range out.Holders {
+				fmt.Printf("%s (%d)\n", holder.UserName, holder.UserId)
+				printGrants(holder.Grants, out.Policies)
+			}
+			return nil
+		},
+	}
+}
+
+// withClientFlags - flags to connect to the server followed by the given
+// flags of the command
+func withClientFlags(flags ...cli.Flag) []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "url",
+			Value:   "http://localhost:8888",
+			EnvVars: []string{"IDX_URL"},
+			Usage:   "Address of the idx server",
+		},
+		&cli.StringFlag{
+			Name:     "user",
+			Required: true,
+			EnvVars:  []string{"IDX_USER"},
+			Usage:    "User name of an admin of the service",
+		},
+		&cli.StringFlag{
+			Name:     "password",
+			Required: true,
+			EnvVars:  []string{"IDX_PASSWORD"},
+			Usage:    "Password of the user",
+		},
+	}, flags...)
+}
+
+func loggedInClient(ctx *cli.Context) (*client.Client, error) {
+	cnt := client.New(ctx.String("url")).WithTimeout(time.Minute)
+	_, err := cnt.Login(ctx.Context, ctx.String("user"), ctx.String("password"))
+	if err != nil {
+		return nil, errx.Wrap(err)
+	}
+	return cnt, nil
+}
+
+func printGrants(grants []*core.GrantPath, policies []string) {
+	for _, g := range grants {
+		via := "direct"
+		if len(g.Groups) > 1 {
+			via = "inherited"
+		}
+		fmt.Printf("    %-9s %s (grant %s)\n",
+			via, strings.Join(g.Groups, " -> "), g.Grant)
+	}
+	for _, p := range policies {
+		fmt.Printf("    %-9s %s\n", "policy", p)
+	}
+}
+
+func readManifest(path string) (*core.ServiceManifest, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".json" {
+		return nil, errx.Errf(core.ErrInvalidState,
+			"unsupported manifest format '%s', expected a JSON file", ext)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to open manifest '%s'", path)
+	}
+	defer file.Close()
+
+	var manifest core.ServiceManifest
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, errx.Errf(err, "failed to read manifest '%s'", path)
+	}
+	return &manifest, nil
+}
+
+func printSyncResult(res *core.SyncResult) {
+	if len(res.Changes) == 0 {
+		fmt.Println("service is in sync with the manifest")
+		return
+	}
+	for _, change := range res.Changes {
+		line := fmt.Sprintf("%-7s %-14s %s", change.Op, change.Kind, change.Name)
+		if change.Detail != "" {
+			line += " (" + change.Detail + ")"
+		}
+		fmt.Println(line)
+	}
+	if res.DryRun {
+		fmt.Println("dry run, no changes were applied")
+	}
+}
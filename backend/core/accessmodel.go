@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+type AccessRequestState string
+
+const (
+	AccessPending   AccessRequestState = "pending"
+	AccessApproved  AccessRequestState = "approved"
+	AccessDenied    AccessRequestState = "denied"
+	AccessCancelled AccessRequestState = "cancelled"
+)
+
+// AccessRequest - request from an user to become a member of a group. Admins
+// of the service the group belongs to decide on it. ValidUntil is what the
+// user asks for, the approver can change it
+type AccessRequest struct {
+	Id            int64              `db:"id" json:"id"`
+	CreatedOn     time.Time          `db:"created_on" json:"createdOn"`
+	UpdatedOn     time.Time          `db:"updated_on" json:"updatedOn"`
+	UserId        int64              `db:"user_id" json:"userId"`
+	UserName      string             `db:"user_name" json:"userName"`
+	GroupId       int64              `db:"group_id" json:"groupId"`
+	GroupName     string             `db:"group_name" json:"groupName"`
+	ServiceId     int64              `db:"service_id" json:"serviceId"`
+	Justification string             `db:"justification" json:"justification"`
+	ValidUntil    *time.Time         `db:"valid_until" json:"validUntil"`
+	State         AccessRequestState `db:"state" json:"state"`
+	DecidedBy     *int64             `db:"decided_by" json:"decidedBy"`
+	DecidedOn     *time.Time         `db:"decided_on" json:"decidedOn"`
+	Comment       string             `db:"comment" json:"comment"`
+}
+
+// AccessDecision - decision of an admin on an access request. ValidUntil is
+// only used for approvals, nil keeps what the user asked for
+type AccessDecision struct {
+	Comment    string     `json:"comment"`
+	ValidUntil *time.Time `json:"validUntil"`
+}
+
+// AccessRequestLog - entry in the history of an access request, one is added
+// for the creation and for every change of state
+type AccessRequestLog struct {
+	Id        int64              `db:"id" json:"id"`
+	RequestId int64              `db:"request_id" json:"requestId"`
+	State     AccessRequestState `db:"state" json:"state"`
+	ActorId   int64              `db:"actor_id" json:"actorId"`
+	ActorName string             `db:"actor_name" json:"actorName"`
+	Comment   string             `db:"comment" json:"comment"`
+	CreatedOn time.Time          `db:"created_on" json:"createdOn"`
+}
+
+type AccessRequestFilter struct {
+	ServiceId int64              `json:"serviceId"`
+	UserId    int64              `json:"userId"`
+	State     AccessRequestState `json:"state"`
+}
+
+type AccessRequestController interface {
+	// Create - request from the user in the context, admins of the service
+	// the group belongs to are notified by mail
+	Create(gtx context.Context, req *AccessRequest) (int64, error)
+	GetOne(gtx context.Context, id int64) (*AccessRequest, error)
+	Get(gtx context.Context,
+		filter *AccessRequestFilter) ([]*AccessRequest, error)
+
+	// Approve - adds the requester to the group, memberships that already
+	// exist are only ever extended
+	Approve(gtx context.Context, id int64, decision *AccessDecision) error
+	Deny(gtx context.Context, id int64, decision *AccessDecision) error
+
+	// Cancel - withdraws a pending request, only the requester can cancel
+	Cancel(gtx context.Context, id int64) error
+
+	History(gtx context.Context, id int64) ([]*AccessRequestLog, error)
+}
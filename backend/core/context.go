@@ -12,12 +12,25 @@ import (
 )
 
 type Services struct {
-	EventService      event.Service[int64]
-	MailProvider      email.Provider
-	UserController    UserController
-	UserAuthenticator auth.UserAuthenticator
-	ServiceController ServiceController
-	GroupController   GroupController
+	EventService           event.Service[int64]
+	MailProvider           email.Provider
+	UserController         UserController
+	UserAuthenticator      auth.UserAuthenticator
+	ServiceController      ServiceController
+	GroupController        GroupController
+	UpstreamController     UpstreamController
+	SamlController         SamlController
+	ScimController         ScimController
+	ProvisioningController ProvisioningController
+	PolicyController       PolicyController
+	SodController          SodController
+	RelationController     RelationController
+	AccessController       AccessRequestController
+	RoleTemplateController RoleTemplateController
+	TenantController       TenantController
+	ElevationController    ElevationController
+	ReviewController       ReviewController
+	KeyManager             KeyManager
 }
 
 type serviceHolderKey string
@@ -48,14 +61,31 @@ func EventService(gtx context.Context) event.Service[int64] {
 func NewEventAdder(
 	gtx context.Context, op string, data data.M) *event.Adder[int64] {
 
-	user := httpx.GetUser[auth.User](gtx)
+	user := contextUser(gtx)
 	userId := int64(-1)
 	if user != nil {
 		userId = user.Id()
 	}
 
-	return event.NewAdder(
-		gtx, EventService(gtx), op, userId, data)
+	adder := event.NewAdder(gtx, EventService(gtx), op, userId, data)
+
+	// Actions taken while elevated are tagged with the elevations in effect
+	if user != nil && len(user.Elevations()) != 0 {
+		adder.AddData("elevations", user.Elevations())
+	}
+	if groupIds, ok := gtx.Value(groupOwnerKey{}).([]int64); ok {
+		adder.AddData("asOwnerOf", groupIds)
+	}
+	return adder
+}
+
+type groupOwnerKey struct{}
+
+// AsGroupOwner - marks the actions in the context as taken by an owner of the
+// groups rather than by an user with the permission, events of such actions
+// are tagged with the groups
+func AsGroupOwner(gtx context.Context, groupIds ...int64) context.Context {
+	return context.WithValue(gtx, groupOwnerKey{}, groupIds)
 }
 
 func UserCtlr(gtx context.Context) UserController {
@@ -66,8 +96,19 @@ func Authenticator(gtx context.Context) auth.UserAuthenticator {
 	return srvs(gtx).UserAuthenticator
 }
 
+// contextUser - user in the context, the endpoints get it wrapped by RouteUser
+func contextUser(gtx context.Context) *User {
+	switch user := gtx.Value(httpx.UserKey).(type) {
+	case *User:
+		return user
+	case *routeUser:
+		return user.User
+	}
+	return nil
+}
+
 func MustGetUser(gtx context.Context) *User {
-	user := httpx.GetUser[*User](gtx)
+	user := contextUser(gtx)
 	if user == nil {
 		panic("failed get user from context")
 	}
@@ -75,7 +116,7 @@ func MustGetUser(gtx context.Context) *User {
 }
 
 func GetUser(gtx context.Context) (*User, error) {
-	user := httpx.GetUser[*User](gtx)
+	user := contextUser(gtx)
 	if user == nil {
 		return nil, errx.Fmt("failed get user from context")
 	}
@@ -90,6 +131,54 @@ func GroupCtlr(gtx context.Context) GroupController {
 	return srvs(gtx).GroupController
 }
 
+func UpstreamCtlr(gtx context.Context) UpstreamController {
+	return srvs(gtx).UpstreamController
+}
+
+func SamlCtlr(gtx context.Context) SamlController {
+	return srvs(gtx).SamlController
+}
+
+func ScimCtlr(gtx context.Context) ScimController {
+	return srvs(gtx).ScimController
+}
+
+func ProvisioningCtlr(gtx context.Context) ProvisioningController {
+	return srvs(gtx).ProvisioningController
+}
+
+func PolicyCtlr(gtx context.Context) PolicyController {
+	return srvs(gtx).PolicyController
+}
+
+func SodCtlr(gtx context.Context) SodController {
+	return srvs(gtx).SodController
+}
+
+func RelationCtlr(gtx context.Context) RelationController {
+	return srvs(gtx).RelationController
+}
+
+func AccessCtlr(gtx context.Context) AccessRequestController {
+	return srvs(gtx).AccessController
+}
+
+func RoleTemplateCtlr(gtx context.Context) RoleTemplateController {
+	return srvs(gtx).RoleTemplateController
+}
+
+func TenantCtlr(gtx context.Context) TenantController {
+	return srvs(gtx).TenantController
+}
+
+func ElevationCtlr(gtx context.Context) ElevationController {
+	return srvs(gtx).ElevationController
+}
+
+func ReviewCtlr(gtx context.Context) ReviewController {
+	return srvs(gtx).ReviewController
+}
+
 func CopyServices(source, target context.Context) context.Context {
 	s := srvs(source)
 	return context.WithValue(target, servicesKey, s)
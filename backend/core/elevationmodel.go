@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/libx/auth"
+)
+
+type ElevationKind string
+
+const (
+	// ElevateRole - user gets the role for the duration of the elevation
+	ElevateRole ElevationKind = "role"
+
+	// ElevateGroup - user becomes a member of the group, target is the group
+	ElevateGroup ElevationKind = "group"
+
+	// ElevateServiceAdmin - user becomes an admin of the service, target is
+	// the service
+	ElevateServiceAdmin ElevationKind = "serviceAdmin"
+)
+
+type ElevationState string
+
+const (
+	ElevationPending ElevationState = "pending"
+	ElevationActive  ElevationState = "active"
+	ElevationDenied  ElevationState = "denied"
+
+	// ElevationEnded - ended by the user or an approver before it expired
+	ElevationEnded   ElevationState = "ended"
+	ElevationExpired ElevationState = "expired"
+)
+
+// Eligibility - elevation an user can ask for instead of holding the role,
+// the group or the admin rights all the time. Requests within MaxMinutes are
+// approved without a second admin when AutoApprove is set
+type Eligibility struct {
+	DbItem
+	UserId      int64         `db:"user_id" json:"userId"`
+	Kind        ElevationKind `db:"kind" json:"kind"`
+	Role        auth.Role     `db:"role" json:"role"`
+	TargetId    int64         `db:"target_id" json:"targetId"`
+	MaxMinutes  int           `db:"max_minutes" json:"maxMinutes"`
+	AutoApprove bool          `db:"auto_approve" json:"autoApprove"`
+}
+
+// Elevation - time bound elevation requested by an eligible user. It starts
+// when it is approved and lasts for the requested minutes
+type Elevation struct {
+	Id            int64          `db:"id" json:"id"`
+	CreatedOn     time.Time      `db:"created_on" json:"createdOn"`
+	UpdatedOn     time.Time      `db:"updated_on" json:"updatedOn"`
+	EligibilityId int64          `db:"eligibility_id" json:"eligibilityId"`
+	UserId        int64          `db:"user_id" json:"userId"`
+	UserName      string         `db:"user_name" json:"userName"`
+	Kind          ElevationKind  `db:"kind" json:"kind"`
+	Role          auth.Role      `db:"role" json:"role"`
+	TargetId      int64          `db:"target_id" json:"targetId"`
+	Minutes       int            `db:"minutes" json:"minutes"`
+	Reason        string         `db:"reason" json:"reason"`
+	State         ElevationState `db:"state" json:"state"`
+	DecidedBy     *int64         `db:"decided_by" json:"decidedBy"`
+	DecidedOn     *time.Time     `db:"decided_on" json:"decidedOn"`
+	Comment       string         `db:"comment" json:"comment"`
+	ExpiresOn     *time.Time     `db:"expires_on" json:"expiresOn"`
+}
+
+type ElevationFilter struct {
+	UserId int64          `json:"userId"`
+	State  ElevationState `json:"state"`
+}
+
+type ElevationController interface {
+	// SaveEligibility - only users who can approve the elevation can make an
+	// user eligible for it
+	SaveEligibility(gtx context.Context, el *Eligibility) (int64, error)
+	RemoveEligibility(gtx context.Context, id int64) error
+	GetEligibilities(gtx context.Context, userId int64) ([]*Eligibility, error)
+
+	// Request - elevation for the user in the context, it is active right
+	// away if the eligibility is auto approved
+	Request(gtx context.Context, req *Elevation) (*Elevation, error)
+	GetOne(gtx context.Context, id int64) (*Elevation, error)
+	Get(gtx context.Context, filter *ElevationFilter) ([]*Elevation, error)
+
+	// Approve - activates a pending elevation, the requester cannot approve
+	// own elevation
+	Approve(gtx context.Context, id int64, comment string) error
+	Deny(gtx context.Context, id int64, comment string) error
+
+	// End - ends an active elevation before it expires
+	End(gtx context.Context, id int64) error
+
+	// Active - elevations of the user that are in effect
+	Active(gtx context.Context, userId int64) ([]*Elevation, error)
+
+	// Expire - closes the active elevations that are past their expiry,
+	// memberships given by them expire on their own
+	Expire(gtx context.Context) ([]*Elevation, error)
+}
+
+// LoadElevations - applies the active elevations of the user to the user
+// loaded for the request
+func LoadElevations(gtx context.Context, user *User) error {
+	elevations, err := ElevationCtlr(gtx).Active(gtx, user.Id())
+	if err != nil {
+		return err
+	}
+	for _, el := range elevations {
+		user.Elevate(el)
+	}
+	return nil
+}
@@ -7,4 +7,12 @@ var (
 	ErrInvalidState = errors.New("invalid state")
 	ErrInvalidRole  = errors.New("invalid role")
 	ErrEntityExists = errors.New("entity.exists")
+	ErrGroupCycle   = errors.New("group cycle")
+
+	ErrServiceAccessDenied = errors.New("service access denied")
+	ErrSodViolation        = errors.New("segregation of duties violation")
+
+	ErrTokenUnknown = errors.New("unknown token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenUsed    = errors.New("token already used")
 )
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"github.com/varunamachi/libx/data"
+)
+
+// GrantPath - permission given to an user through a chain of groups. Groups
+// start with the group the user is a member of and end with the group that
+// has the permission, a single group means the grant is direct
+type GrantPath struct {
+	UserId   int64            `db:"user_id" json:"-"`
+	UserName string           `db:"user_name" json:"-"`
+	Grant    string           `db:"perm_id" json:"grant"`
+	Groups   data.Vec[string] `db:"groups" json:"groups"`
+}
+
+// PermExplanation - effective permission along with everything that gives
+// it. Policies are the enabled policies covering the permission, whether they
+// allow it depends on the request
+type PermExplanation struct {
+	Perm     string       `json:"perm"`
+	Grants   []*GrantPath `json:"grants"`
+	Policies []string     `json:"policies,omitempty"`
+}
+
+type Explanation struct {
+	UserId    int64              `json:"userId"`
+	ServiceId int64              `json:"serviceId"`
+	Perms     []*PermExplanation `json:"perms"`
+}
+
+type PermHolder struct {
+	UserId   int64        `json:"userId"`
+	UserName string       `json:"userName"`
+	Grants   []*GrantPath `json:"grants"`
+}
+
+// PermHolders - users who have the permission through their groups
+type PermHolders struct {
+	ServiceId int64         `json:"serviceId"`
+	Perm      string        `json:"perm"`
+	Holders   []*PermHolder `json:"holders"`
+	Policies  []string      `json:"policies,omitempty"`
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+)
+
+// ClaimMapping - maps claims from an upstream ID token to idx user fields.
+// Empty mapping fields fall back to the standard OIDC claim names
+type ClaimMapping struct {
+	UserName  string            `json:"userName"`
+	Email     string            `json:"email"`
+	FirstName string            `json:"firstName"`
+	LastName  string            `json:"lastName"`
+	Title     string            `json:"title"`
+	Props     map[string]string `json:"props"`
+}
+
+func (cm ClaimMapping) Value() (driver.Value, error) {
+	return json.Marshal(cm)
+}
+
+func (cm *ClaimMapping) Scan(value any) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, cm)
+}
+
+// ApprovalRule - a user whose claim has one of the given values is activated
+// immediately with the given role and added to the given groups
+type ApprovalRule struct {
+	Claim  string    `json:"claim"`
+	Values []string  `json:"values"`
+	Role   auth.Role `json:"role"`
+	Groups []int64   `json:"groups"`
+}
+
+func (ar *ApprovalRule) Matches(claims data.M) bool {
+	switch val := claims[ar.Claim].(type) {
+	case string:
+		return slices.Contains(ar.Values, val)
+	case bool:
+		return slices.Contains(ar.Values, data.Qop(val, "true", "false"))
+	case []any:
+		for _, v := range val {
+			if s, ok := v.(string); ok && slices.Contains(ar.Values, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type ApprovalRules []*ApprovalRule
+
+func (ar ApprovalRules) Value() (driver.Value, error) {
+	return json.Marshal(ar)
+}
+
+func (ar *ApprovalRules) Scan(value any) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, ar)
+}
+
+// Match - returns the first rule that matches the given claims, nil if none
+func (ar ApprovalRules) Match(claims data.M) *ApprovalRule {
+	for _, rule := range ar {
+		if rule.Matches(claims) {
+			return rule
+		}
+	}
+	return nil
+}
+
+type UpstreamProvider struct {
+	DbItem
+	Name          string           `db:"name" json:"name"`
+	DisplayName   string           `db:"display_name" json:"displayName"`
+	Issuer        string           `db:"issuer" json:"issuer"`
+	ClientId      string           `db:"client_id" json:"clientId"`
+	ClientSecret  string           `db:"client_secret" json:"clientSecret,omitempty"`
+	Scopes        data.Vec[string] `db:"scopes" json:"scopes"`
+	LinkByName    bool             `db:"link_by_name" json:"linkByName"`
+	Enabled       bool             `db:"enabled" json:"enabled"`
+	ClaimMapping  ClaimMapping     `db:"claim_mapping" json:"claimMapping"`
+	ApprovalRules ApprovalRules    `db:"approval_rules" json:"approvalRules"`
+	TenantId      int64            `db:"tenant_id" json:"tenantId"`
+}
+
+type FederatedIdentity struct {
+	ProviderId int64  `db:"provider_id" json:"providerId"`
+	Subject    string `db:"subject" json:"subject"`
+	UserId     int64  `db:"user_id" json:"userId"`
+}
+
+type UpstreamLogin struct {
+	User  *User  `json:"user"`
+	Token string `json:"token"`
+}
+
+type UpstreamController interface {
+	Save(gtx context.Context, provider *UpstreamProvider) (int64, error)
+	Update(gtx context.Context, provider *UpstreamProvider) error
+	GetOne(gtx context.Context, id int64) (*UpstreamProvider, error)
+	GetByName(gtx context.Context, name string) (*UpstreamProvider, error)
+	Remove(gtx context.Context, id int64) error
+	Get(gtx context.Context,
+		params *data.CommonParams) ([]*UpstreamProvider, error)
+
+	// LoginUrl - url of the upstream provider to login at along with the
+	// binding that ties the login to the browser initiating it
+	LoginUrl(
+		gtx context.Context, providerName string) (string, string, error)
+	CompleteLogin(
+		gtx context.Context,
+		providerName, state, binding, code string) (*UpstreamLogin, error)
+}
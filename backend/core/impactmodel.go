@@ -0,0 +1,50 @@
+package core
+
+import (
+	"github.com/varunamachi/libx/auth"
+)
+
+// AccessChange - change to a group or to the permission tree of a service
+// that is previewed instead of being applied. Parts that are not given are
+// left as they are
+type AccessChange struct {
+	// GroupId - group that is changed, zero when only the tree changes
+	GroupId int64 `json:"groupId"`
+
+	// Perms - new permissions of the group when not nil
+	Perms []string `json:"perms,omitempty"`
+
+	AddedUsers       []int64 `json:"addedUsers,omitempty"`
+	RemovedUsers     []int64 `json:"removedUsers,omitempty"`
+	AddedSubGroups   []int64 `json:"addedSubGroups,omitempty"`
+	RemovedSubGroups []int64 `json:"removedSubGroups,omitempty"`
+
+	// RemoveGroup - the group, its permissions and its memberships are
+	// removed
+	RemoveGroup bool `json:"removeGroup,omitempty"`
+
+	// Tree - new permission tree of the service when not nil
+	Tree *auth.PermissionTree `json:"tree,omitempty"`
+}
+
+// UserImpact - effective permissions the user gains and loses in the service
+type UserImpact struct {
+	UserId   int64    `json:"userId"`
+	UserName string   `json:"userName"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+}
+
+// OrphanedGrant - permission of a group that is not defined by the new
+// permission tree of the service
+type OrphanedGrant struct {
+	GroupId   int64  `json:"groupId"`
+	GroupName string `json:"groupName"`
+	Perm      string `json:"perm"`
+}
+
+type AccessImpact struct {
+	ServiceId int64            `json:"serviceId"`
+	Users     []*UserImpact    `json:"users"`
+	Orphaned  []*OrphanedGrant `json:"orphaned,omitempty"`
+}
@@ -0,0 +1,55 @@
+package core
+
+import "context"
+
+// KeyManager - application level keys. Secrets stored in the database are
+// sealed with a data key of their own which in turn is encrypted with a
+// versioned master key, so only the master key has to be kept outside
+type KeyManager interface {
+	// Seal - encrypts the value with the current master key version
+	Seal(plain string) (string, error)
+
+	// Open - decrypts a sealed value, values that are not sealed yet are
+	// returned as is so that existing data keeps working until re-encrypted
+	Open(sealed string) (string, error)
+
+	// NeedsReseal - checks if the value is plain or sealed with an older key
+	NeedsReseal(sealed string) bool
+
+	// Pepper - HMAC of the value with the pepper of given key version
+	Pepper(version int, value string) (string, error)
+
+	CurrentVersion() int
+}
+
+func Keys(gtx context.Context) KeyManager {
+	return srvs(gtx).KeyManager
+}
+
+// SealAll - seals the given values in place, used by storages before writing
+// a record with secrets
+func SealAll(gtx context.Context, values ...*string) error {
+	for _, val := range values {
+		if *val == "" {
+			continue
+		}
+		sealed, err := Keys(gtx).Seal(*val)
+		if err != nil {
+			return err
+		}
+		*val = sealed
+	}
+	return nil
+}
+
+// OpenAll - opposite of SealAll, used by storages after reading a record
+func OpenAll(gtx context.Context, values ...*string) error {
+	for _, val := range values {
+		plain, err := Keys(gtx).Open(*val)
+		if err != nil {
+			return err
+		}
+		*val = plain
+	}
+	return nil
+}
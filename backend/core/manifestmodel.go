@@ -0,0 +1,64 @@
+package core
+
+import (
+	"github.com/varunamachi/libx/auth"
+)
+
+// ServiceManifest - declarative description of a service's permission model
+// that is owned by the repository of the service and synced to idx
+type ServiceManifest struct {
+	Name        string                 `json:"name"`
+	DisplayName string                 `json:"displayName"`
+	Permissions []*auth.PermissionNode `json:"permissions"`
+	Groups      []*GroupManifest       `json:"groups"`
+}
+
+type GroupManifest struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"displayName"`
+	Description string   `json:"description"`
+	Perms       []string `json:"perms"`
+
+	// Default - every new active user joins the group
+	Default bool `json:"default"`
+}
+
+type SyncOptions struct {
+	DryRun bool `json:"dryRun"`
+
+	// Prune - removes the permissions that are not in the manifest from the
+	// permission tree and from the groups of the service. Without pruning
+	// such permissions are kept and reported as stale
+	Prune bool `json:"prune"`
+}
+
+type SyncOp string
+
+const (
+	SyncCreate SyncOp = "create"
+	SyncUpdate SyncOp = "update"
+	SyncRemove SyncOp = "remove"
+	SyncStale  SyncOp = "stale"
+)
+
+type SyncChange struct {
+	Op     SyncOp `json:"op"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type SyncResult struct {
+	ServiceId int64         `json:"serviceId"`
+	DryRun    bool          `json:"dryRun"`
+	Changes   []*SyncChange `json:"changes"`
+}
+
+func (sr *SyncResult) Add(op SyncOp, kind, name, detail string) {
+	sr.Changes = append(sr.Changes, &SyncChange{
+		Op:     op,
+		Kind:   kind,
+		Name:   name,
+		Detail: detail,
+	})
+}
@@ -2,11 +2,14 @@ package core
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"regexp"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/varunamachi/libx"
 	"github.com/varunamachi/libx/auth"
 	"github.com/varunamachi/libx/data"
@@ -46,12 +49,34 @@ type DbItem struct {
 	UpdatedBy int64     `db:"updated_by" json:"updatedBy"`
 }
 
+const (
+	TokVerifyAccount = "verify_account"
+	TokPasswordReset = "password_reset"
+	TokUpstreamLogin = "oidc_login"
+)
+
+// tokenTTL - validity of the tokens of each operation, operations that are
+// not listed here get the defaultTokenTTL
+var tokenTTL = map[string]time.Duration{
+	TokVerifyAccount: 72 * time.Hour,
+	TokPasswordReset: 30 * time.Minute,
+	TokUpstreamLogin: 10 * time.Minute,
+}
+
+const defaultTokenTTL = time.Hour
+
+// Token - single use token bound to an operation and an user (or other entity
+// given by assoc type). Only the hash of the token is stored, plain token is
+// available only to the creator
 type Token struct {
-	Token      string `db:"token" json:"token"`
-	UniqueName string `db:"unique_name" json:"uniqueName"`
-	AssocType  string `db:"assoc_type" json:"assocType"`
-	Operation  string `db:"operation" json:"operation"`
-	CreatedOn  string `db:"createdOn" json:"created_on"`
+	Token      string     `db:"-" json:"token"`
+	TokenHash  string     `db:"token_hash" json:"-"`
+	UniqueName string     `db:"unique_name" json:"uniqueName"`
+	AssocType  string     `db:"assoc_type" json:"assocType"`
+	Operation  string     `db:"operation" json:"operation"`
+	CreatedOn  time.Time  `db:"created_on" json:"createdOn"`
+	ExpiresOn  time.Time  `db:"expires_on" json:"expiresOn"`
+	UsedOn     *time.Time `db:"used_on" json:"usedOn"`
 }
 
 type AuthEntity string
@@ -78,7 +103,8 @@ type Secret struct {
 }
 
 type CredentialPolicy struct {
-	ItemType       AuthEntity    `db:"itemType" json:"item_type"`
+	TenantId       int64         `db:"tenant_id" json:"tenantId"`
+	ItemType       AuthEntity    `db:"item_type" json:"itemType"`
 	Pattern        string        `db:"pattern" json:"pattern"`
 	Expiry         time.Duration `db:"expiry" json:"expiry"`
 	MaxRetries     int           `db:"max_retries" json:"maxRetries"`
@@ -105,6 +131,10 @@ func (cp *CredentialPolicy) MatchPattern(pw string) error {
 type Hasher interface {
 	Hash(pw string) (string, error)
 	Verify(pw, hash string) error
+
+	// NeedsRehash - checks if a verified hash has to be replaced with a new
+	// hash of the same password, e.g. when it is peppered with an older key
+	NeedsRehash(hash string) bool
 }
 
 type SecretStorage interface {
@@ -113,30 +143,144 @@ type SecretStorage interface {
 	Authenticate(gtx context.Context, creds *Creds) error
 
 	StoreToken(gtx context.Context, token *Token) error
-	VerifyToken(gtx context.Context, id, operation, token string) error
 
+	// ConsumeToken - marks the token as used if it is valid for the given
+	// entity and operation. Fails with ErrTokenUnknown, ErrTokenExpired or
+	// ErrTokenUsed otherwise
+	ConsumeToken(gtx context.Context, id, operation, token string) error
+
+	// PurgeTokens - deletes tokens that expired before the given time,
+	// returns the number of tokens deleted
+	PurgeTokens(gtx context.Context, expiredBefore time.Time) (int64, error)
+
+	// CredentialPolicy - policy of the tenant for the credential type, the
+	// policy of the default tenant is used if the tenant does not have one
 	CredentialPolicy(
-		gtx context.Context, credType AuthEntity) (*CredentialPolicy, error)
+		gtx context.Context,
+		tenantId int64,
+		credType AuthEntity) (*CredentialPolicy, error)
 	SetCredentialPolicy(
 		gtx context.Context, cp *CredentialPolicy) error
 }
 
 func NewToken(uname, operation, assocType string) *Token {
+	ttl, found := tokenTTL[operation]
+	if !found {
+		ttl = defaultTokenTTL
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		panic("failed to generate random token: " + err.Error())
+	}
+	tok := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
 	return &Token{
+		Token:      tok,
+		TokenHash:  HashToken(tok),
 		UniqueName: uname,
 		Operation:  operation,
 		AssocType:  assocType,
-		Token:      uuid.NewString(),
+		CreatedOn:  now,
+		ExpiresOn:  now.Add(ttl),
 	}
 }
 
+// HashToken - tokens are random enough that a plain SHA-256 is sufficient,
+// no salt or slow hash is needed
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// JoinPolicy - how users who are not members can become members of a group
+type JoinPolicy string
+
+const (
+	// JoinClosed - only the admins and the owners add members
+	JoinClosed JoinPolicy = "closed"
+
+	// JoinRequest - users request access and an admin decides on it, groups
+	// without a policy behave this way
+	JoinRequest JoinPolicy = "request"
+
+	// JoinOpen - users join and leave the group on their own
+	JoinOpen JoinPolicy = "open"
+)
+
 type Group struct {
 	DbItem
-	ServiceId   int      `db:"service_id" json:"service_id"`
-	Name        string   `db:"name" json:"name"`
-	DisplayName string   `db:"display_name" json:"displayName"`
-	Description string   `db:"description" json:"description"`
-	Perms       []string `json:"perms"`
+	TenantId    int64      `db:"tenant_id" json:"tenantId"`
+	ServiceId   int        `db:"service_id" json:"service_id"`
+	Name        string     `db:"name" json:"name"`
+	DisplayName string     `db:"display_name" json:"displayName"`
+	Description string     `db:"description" json:"description"`
+	JoinPolicy  JoinPolicy `db:"join_policy" json:"joinPolicy"`
+
+	// NotifyOwners - owners are mailed when users join or leave the group
+	NotifyOwners bool     `db:"notify_owners" json:"notifyOwners"`
+	Perms        []string `json:"perms"`
+
+	// Owners - users who manage the members of the group, they cannot change
+	// the permissions of the group
+	Owners []*GroupOwner `json:"owners"`
+}
+
+type JoinableGroup struct {
+	Group
+	Member bool `db:"member" json:"member"`
+}
+
+type GroupOwner struct {
+	UserId    int64     `db:"owner_id" json:"userId"`
+	UserName  string    `db:"user_name" json:"userName"`
+	CreatedOn time.Time `db:"created_on" json:"createdOn"`
+	CreatedBy int64     `db:"created_by" json:"createdBy"`
+}
+
+// GroupMember - user who belongs to a group either directly or through one of
+// the sub groups of the group
+type GroupMember struct {
+	UserId     int64      `db:"user_id" json:"userId"`
+	UserName   string     `db:"user_name" json:"userName"`
+	ViaGroupId int64      `db:"via_group_id" json:"viaGroupId"`
+	ViaGroup   string     `db:"via_group" json:"viaGroup"`
+	Direct     bool       `db:"direct" json:"direct"`
+	ValidFrom  time.Time  `db:"valid_from" json:"validFrom"`
+	ValidUntil *time.Time `db:"valid_until" json:"validUntil"`
+}
+
+// UserGroup - group the user belongs to either directly or through the
+// group of the user given by ViaGroupId
+type UserGroup struct {
+	GroupId    int64      `db:"group_id" json:"groupId"`
+	GroupName  string     `db:"group_name" json:"groupName"`
+	ServiceId  int64      `db:"service_id" json:"serviceId"`
+	ViaGroupId int64      `db:"via_group_id" json:"viaGroupId"`
+	ViaGroup   string     `db:"via_group" json:"viaGroup"`
+	Direct     bool       `db:"direct" json:"direct"`
+	ValidUntil *time.Time `db:"valid_until" json:"validUntil"`
+}
+
+// ServiceUser - user with access to a service through the groups of the
+// service, the allowlist of the service or by being an admin of the service
+type ServiceUser struct {
+	UserId   int64            `db:"user_id" json:"userId"`
+	UserName string           `db:"user_name" json:"userName"`
+	Groups   data.Vec[string] `db:"groups" json:"groups"`
+	Admin    bool             `db:"admin" json:"admin"`
+	Allowed  bool             `db:"allowed" json:"allowed"`
+}
+
+// Membership - membership of an user in a group. The membership grants the
+// permissions of the group from ValidFrom till ValidUntil, it does not expire
+// if ValidUntil is not set
+type Membership struct {
+	UserId     int64      `db:"user_id" json:"userId"`
+	GroupId    int64      `db:"group_id" json:"groupId"`
+	ValidFrom  time.Time  `db:"valid_from" json:"validFrom"`
+	ValidUntil *time.Time `db:"valid_until" json:"validUntil"`
 }
 
 type GroupController interface {
@@ -145,6 +289,7 @@ type GroupController interface {
 	GetOne(gtx context.Context, id int64) (*Group, error)
 	Remove(gtx context.Context, id int64) error
 	Get(gtx context.Context, params *data.CommonParams) ([]*Group, error)
+	GetForService(gtx context.Context, serviceId int64) ([]*Group, error)
 
 	Exists(gtx context.Context, id int64) (bool, error)
 	Count(gtx context.Context, filter *data.Filter) (int64, error)
@@ -155,17 +300,130 @@ type GroupController interface {
 	AddToGroups(gtx context.Context, userId int64, groupIds ...int64) error
 	RemoveFromGroup(gtx context.Context, userId, groupId int64) error
 
+	// Joinable - groups of the service the user in the context can join or
+	// request to join, Member is set for the groups the user is already in
+	Joinable(gtx context.Context, serviceId int64) ([]*JoinableGroup, error)
+
+	// Join - adds the user in the context to an open group
+	Join(gtx context.Context, groupId int64) error
+
+	// Leave - removes the user in the context from a group the user could
+	// have joined on their own
+	Leave(gtx context.Context, groupId int64) error
+
+	AddOwner(gtx context.Context, groupId, userId int64) error
+	RemoveOwner(gtx context.Context, groupId, userId int64) error
+	GetOwners(gtx context.Context, groupId int64) ([]*GroupOwner, error)
+	IsOwner(gtx context.Context, groupId, userId int64) (bool, error)
+
+	// AddSubGroup - makes the child group a member of the parent group, so
+	// that members of the child get the permissions of the parent. Both the
+	// groups should belong to the same service and the relation should not
+	// form a cycle
+	AddSubGroup(gtx context.Context, parentId, childId int64) error
+	RemoveSubGroup(gtx context.Context, parentId, childId int64) error
+	GetSubGroups(gtx context.Context, groupId int64) ([]*Group, error)
+
+	// PreviewChange - impact of the change to the group on the users of the
+	// service of the group
+	PreviewChange(
+		gtx context.Context, change *AccessChange) (*AccessImpact, error)
+
+	// GetMembers - direct members of the group and the members inherited from
+	// its sub groups at any depth
+	GetMembers(gtx context.Context,
+		groupId int64, params *data.CommonParams) ([]*GroupMember, error)
+
+	// GetUserGroups - groups of the user including the ones inherited through
+	// nested groups, limited to the service unless serviceId is zero
+	GetUserGroups(gtx context.Context,
+		userId, serviceId int64, params *data.CommonParams) ([]*UserGroup, error)
+
+	// GetServiceUsers - users with any access to the service
+	GetServiceUsers(gtx context.Context,
+		serviceId int64, params *data.CommonParams) ([]*ServiceUser, error)
+
+	// AddMembership - adds the user to the group for the validity period of
+	// the membership. Validity is replaced if the user is already a member
+	AddMembership(gtx context.Context, membership *Membership) error
+	GetMembership(
+		gtx context.Context, userId, groupId int64) (*Membership, error)
+
+	// ExtendMembership - moves the end of the membership, nil validUntil makes
+	// the membership permanent
+	ExtendMembership(gtx context.Context,
+		userId, groupId int64, validUntil *time.Time) error
+
+	// ExpireMemberships - removes the memberships that are past their validity
+	ExpireMemberships(gtx context.Context) ([]*Membership, error)
+
+	// WarnExpiring - mails the members and the admins of the services about
+	// memberships expiring within the given duration. Each membership is
+	// warned once unless it is extended
+	WarnExpiring(gtx context.Context, within time.Duration) (int, error)
+
 	// Storage() GroupStorage
 	SaveWithPerms(
 		gtx context.Context, group *Group, perms []string) (int64, error)
 }
 
+type ServiceAccessMode string
+
+const (
+	// ServiceAccessOpen - any user can use the service
+	ServiceAccessOpen ServiceAccessMode = "open"
+
+	// ServiceAccessAllowlist - only the users allowed by the admins of the
+	// service and the admins themselves can use the service
+	ServiceAccessAllowlist ServiceAccessMode = "allowlist"
+)
+
 type Service struct {
 	DbItem
+	TenantId    int64               `db:"tenant_id" json:"tenantId"`
 	Name        string              `db:"name" json:"name"`
 	OwnerId     int64               `db:"owner_id" json:"ownerId"`
 	DisplayName string              `db:"display_name" json:"displayName"`
 	Permissions auth.PermissionTree `db:"permissions" json:"permissions"`
+	AccessMode  ServiceAccessMode   `db:"access_mode" json:"accessMode"`
+
+	// DefaultGroups - groups of the service every new active user joins
+	DefaultGroups data.Vec[int64] `db:"default_groups" json:"defaultGroups"`
+}
+
+// PermCheck - permission to check, optionally on a resource
+type PermCheck struct {
+	Perm     string `json:"perm"`
+	Resource string `json:"resource,omitempty"`
+
+	// Attrs - attributes of the resource used by the policies
+	Attrs data.M `json:"attrs,omitempty"`
+}
+
+type CheckRequest struct {
+	UserId  int64           `json:"userId"`
+	Checks  []*PermCheck    `json:"checks"`
+	Context *RequestContext `json:"context,omitempty"`
+
+	// Explain - include the grant and the groups that allowed each check
+	Explain bool `json:"explain"`
+}
+
+type CheckResult struct {
+	Perm     string   `json:"perm"`
+	Resource string   `json:"resource,omitempty"`
+	Allowed  bool     `json:"allowed"`
+	Grant    string   `json:"grant,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Policy   string   `json:"policy,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// PermGrant - permission given to an user through a group
+type PermGrant struct {
+	GroupId   int64  `db:"group_id" json:"groupId"`
+	GroupName string `db:"group_name" json:"groupName"`
+	Perm      string `db:"perm_id" json:"perm"`
 }
 
 type ServiceController interface {
@@ -182,9 +440,59 @@ type ServiceController interface {
 	RemoveAdmin(gtx context.Context, serviceId, userId int64) error
 	IsAdmin(gtx context.Context, serviceId, userId int64) (bool, error)
 
+	// GrantAccess - allows the user to use the service when access to it is
+	// restricted to an allowlist
+	GrantAccess(gtx context.Context, serviceId, userId int64) error
+	RevokeAccess(gtx context.Context, serviceId, userId int64) error
+	GetAllowedUsers(gtx context.Context, serviceId int64) ([]*User, error)
+
+	// CheckAccess - fails with ErrServiceAccessDenied if the user is not
+	// allowed to use the service
+	CheckAccess(gtx context.Context, serviceId, userId int64) error
+
+	// DefaultGroups - default groups of all the services of the tenant
+	DefaultGroups(gtx context.Context, tenantId int64) ([]int64, error)
+
+	// Explain - effective permissions of the user in the service along with
+	// the groups and the policies behind each of them
+	Explain(
+		gtx context.Context, serviceId, userId int64) (*Explanation, error)
+
+	// WhoHas - users who have the permission in the service, permission can
+	// be scoped to a resource as 'perm@resource'
+	WhoHas(
+		gtx context.Context, serviceId int64, perm string) (*PermHolders, error)
+
+	// PreviewImpact - users whose effective permissions in the service would
+	// change if the change was applied, nothing is modified
+	PreviewImpact(gtx context.Context,
+		serviceId int64, change *AccessChange) (*AccessImpact, error)
+
+	// Sync - brings the service, its groups and its default groups in line
+	// with the manifest, the service is created if it does not exist
+	Sync(gtx context.Context,
+		manifest *ServiceManifest, opts *SyncOptions) (*SyncResult, error)
+
 	Exists(gtx context.Context, name string) (bool, error)
 	Count(gtx context.Context, filter *data.Filter) (int64, error)
 
 	GetPermissionForService(
 		gtx context.Context, userId, serviceId int64) ([]string, error)
+
+	// HasPermission - checks if the user is granted the permission in the
+	// service either directly, through a parent node of the service's
+	// permission tree or through a wildcard grant. Policies of the service are
+	// evaluated at the current time without any request attributes
+	HasPermission(gtx context.Context,
+		userId, serviceId int64, perm string) (bool, error)
+
+	// ValidatePermissions - checks that the permissions are defined in the
+	// permission tree of the service
+	ValidatePermissions(
+		gtx context.Context, serviceId int64, perms []string) error
+
+	// Check - batch version of HasPermission, results are in the order of
+	// the checks in the request
+	Check(gtx context.Context,
+		serviceId int64, req *CheckRequest) ([]*CheckResult, error)
 }
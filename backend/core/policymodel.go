@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/libx/data"
+)
+
+type PolicyEffect string
+
+const (
+	// PolicyAllow - permissions covered by the policy are allowed only when
+	// the condition holds. If more than one allow policy covers a permission
+	// any one of them holding is enough
+	PolicyAllow PolicyEffect = "allow"
+
+	// PolicyDeny - permissions covered by the policy are denied when the
+	// condition holds, deny takes precedence over allow
+	PolicyDeny PolicyEffect = "deny"
+)
+
+// Policy - attribute based condition applied on top of the permissions
+// granted through groups. Perms use the same syntax as group permissions, so
+// a policy on a parent node or with a resource scope covers the matching
+// permissions
+type Policy struct {
+	DbItem
+	ServiceId   int64            `db:"service_id" json:"serviceId"`
+	Name        string           `db:"name" json:"name"`
+	Description string           `db:"description" json:"description"`
+	Effect      PolicyEffect     `db:"effect" json:"effect"`
+	Perms       data.Vec[string] `db:"perms" json:"perms"`
+	Condition   string           `db:"condition" json:"condition"`
+	Enabled     bool             `db:"enabled" json:"enabled"`
+}
+
+// RequestContext - attributes of the request a decision is made for. It is
+// sent by the service asking for the decision since only it sees the
+// request of the end user
+type RequestContext struct {
+	IP   string    `json:"ip"`
+	Time time.Time `json:"time"`
+}
+
+type PolicyDecision struct {
+	Allowed bool   `json:"allowed"`
+	Policy  string `json:"policy,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// DryRunRequest - evaluates the policy against the given input without saving
+// it. Stored policies of the service are evaluated along with the candidate
+// unless Isolated is set
+type DryRunRequest struct {
+	Policy   *Policy         `json:"policy"`
+	UserId   int64           `json:"userId"`
+	Check    *PermCheck      `json:"check"`
+	Context  *RequestContext `json:"context"`
+	Isolated bool            `json:"isolated"`
+}
+
+type DryRunResult struct {
+	// Applies - policy covers the permission being checked
+	Applies bool `json:"applies"`
+
+	// Matched - condition of the policy holds for the input
+	Matched bool `json:"matched"`
+
+	Error    string          `json:"error,omitempty"`
+	Decision *PolicyDecision `json:"decision"`
+}
+
+type PolicyController interface {
+	Save(gtx context.Context, policy *Policy) (int64, error)
+	Update(gtx context.Context, policy *Policy) error
+	GetOne(gtx context.Context, id int64) (*Policy, error)
+	Remove(gtx context.Context, id int64) error
+	GetForService(gtx context.Context, serviceId int64) ([]*Policy, error)
+
+	// Evaluate - applies the enabled policies of the service to the checks,
+	// which should already be allowed by the permissions of the user.
+	// Decisions are in the order of the checks
+	Evaluate(gtx context.Context,
+		serviceId int64,
+		user *User,
+		checks []*PermCheck,
+		rctx *RequestContext) ([]*PolicyDecision, error)
+
+	DryRun(gtx context.Context,
+		serviceId int64, req *DryRunRequest) (*DryRunResult, error)
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/libx/data"
+)
+
+type ConnectorKind string
+
+const (
+	// ScimConnector - pushes users and groups to a SCIM 2.0 endpoint
+	ScimConnector ConnectorKind = "scim"
+
+	// WebhookConnector - posts signed change notifications to an URL
+	WebhookConnector ConnectorKind = "webhook"
+)
+
+type ProvResource string
+
+const (
+	ProvUser  ProvResource = "user"
+	ProvGroup ProvResource = "group"
+)
+
+type SyncState string
+
+const (
+	SyncPending SyncState = "pending"
+	SyncDone    SyncState = "synced"
+	SyncFailed  SyncState = "failed"
+
+	// SyncError - push failed even after all the retries, resource is synced
+	// again only on a manual retry or on reconcile
+	SyncError SyncState = "error"
+)
+
+// ProvisioningConnector - pushes lifecycle changes of the users and groups
+// of a service to the service
+type ProvisioningConnector struct {
+	DbItem
+	ServiceId int64         `db:"service_id" json:"serviceId"`
+	Name      string        `db:"name" json:"name"`
+	Kind      ConnectorKind `db:"kind" json:"kind"`
+	Endpoint  string        `db:"endpoint" json:"endpoint"`
+	Token     string        `db:"token" json:"token,omitempty"`
+	Enabled   bool          `db:"enabled" json:"enabled"`
+}
+
+// SyncRecord - sync state of an user or a group for a connector
+type SyncRecord struct {
+	ConnectorId  int64        `db:"connector_id" json:"connectorId"`
+	ResourceType ProvResource `db:"resource_type" json:"resourceType"`
+	ResourceId   int64        `db:"resource_id" json:"resourceId"`
+	RemoteId     string       `db:"remote_id" json:"remoteId"`
+	State        SyncState    `db:"state" json:"state"`
+	Attempts     int          `db:"attempts" json:"attempts"`
+	LastError    string       `db:"last_error" json:"lastError"`
+	NextAttempt  time.Time    `db:"next_attempt" json:"nextAttempt"`
+	SyncedOn     *time.Time   `db:"synced_on" json:"syncedOn"`
+}
+
+type ReconcileReport struct {
+	ConnectorId  int64    `json:"connectorId"`
+	UsersQueued  int      `json:"usersQueued"`
+	GroupsQueued int      `json:"groupsQueued"`
+	Orphans      []string `json:"orphans"`
+
+	// FullResync - target cannot be read, so everything is pushed again
+	FullResync bool `json:"fullResync"`
+}
+
+type ProvisioningController interface {
+	Save(gtx context.Context, conn *ProvisioningConnector) (int64, error)
+	Update(gtx context.Context, conn *ProvisioningConnector) error
+	GetOne(gtx context.Context, id int64) (*ProvisioningConnector, error)
+	Remove(gtx context.Context, id int64) error
+	Get(gtx context.Context,
+		params *data.CommonParams) ([]*ProvisioningConnector, error)
+
+	SyncRecords(gtx context.Context,
+		connectorId int64, params *data.CommonParams) ([]*SyncRecord, error)
+	Retry(gtx context.Context, connectorId int64) error
+	Reconcile(gtx context.Context, connectorId int64) (*ReconcileReport, error)
+
+	// Notify - marks the resource for sync with every connector it is
+	// relevant to, the actual push happens in the background
+	Notify(gtx context.Context, resType ProvResource, id int64) error
+
+	// PushDue - pushes pending changes and the failed ones that are due for
+	// retry, returns number of records processed
+	PushDue(gtx context.Context) (int, error)
+}
+
+// NotifyProvisioning - informs the downstream connectors about changes to an
+// user or a group. Failure does not fail the change itself, it is logged and
+// fixed on the next reconcile
+func NotifyProvisioning(gtx context.Context, resType ProvResource, ids ...int64) {
+	pc := srvs(gtx).ProvisioningController
+	if pc == nil {
+		return
+	}
+	for _, id := range ids {
+		if err := pc.Notify(gtx, resType, id); err != nil {
+			log.Error().Err(err).
+				Str("resourceType", string(resType)).
+				Int64("resourceId", id).
+				Msg("failed to queue provisioning sync")
+		}
+	}
+}
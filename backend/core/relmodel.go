@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// RelUserNs - namespace of the subjects that are idx users, the subject id is
+// the user id
+const RelUserNs = "user"
+
+// RelationTuple - object#relation@subject, e.g. 'doc:42#editor@user:7'. The
+// subject can be an userset such as 'group:eng#member', in which case every
+// subject of that userset gets the relation
+type RelationTuple struct {
+	Namespace  string `db:"namespace" json:"namespace"`
+	ObjectId   string `db:"object_id" json:"objectId"`
+	Relation   string `db:"relation" json:"relation"`
+	SubjectNs  string `db:"subject_ns" json:"subjectNs"`
+	SubjectId  string `db:"subject_id" json:"subjectId"`
+	SubjectRel string `db:"subject_rel" json:"subjectRel,omitempty"`
+}
+
+func (rt *RelationTuple) String() string {
+	str := rt.Namespace + ":" + rt.ObjectId + "#" + rt.Relation + "@" +
+		rt.SubjectNs + ":" + rt.SubjectId
+	if rt.SubjectRel != "" {
+		str += "#" + rt.SubjectRel
+	}
+	return str
+}
+
+// RelatedRule - relation inherited from a related object, e.g. viewers of
+// the parent folder of a document are viewers of the document:
+// {via: "parent", relation: "viewer"}
+type RelatedRule struct {
+	Via      string `json:"via"`
+	Relation string `json:"relation"`
+}
+
+// RelationRule - defines a relation of a namespace. Apart from the subjects
+// of the tuples with the relation, the relation includes subjects of the
+// relations in ImpliedBy on the same object (editors are viewers) and the
+// subjects from related objects given by FromRelated
+type RelationRule struct {
+	Name        string         `json:"name"`
+	ImpliedBy   []string       `json:"impliedBy,omitempty"`
+	FromRelated []*RelatedRule `json:"fromRelated,omitempty"`
+}
+
+type RelationRules []*RelationRule
+
+func (rr RelationRules) Value() (driver.Value, error) {
+	return json.Marshal(rr)
+}
+
+func (rr *RelationRules) Scan(value any) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, rr)
+}
+
+// RelNamespace - type of objects of a service along with their relations
+type RelNamespace struct {
+	ServiceId int64         `db:"service_id" json:"serviceId"`
+	Name      string        `db:"name" json:"name"`
+	Relations RelationRules `db:"relations" json:"relations"`
+	UpdatedOn time.Time     `db:"updated_on" json:"updatedOn"`
+}
+
+func (ns *RelNamespace) Rule(relation string) *RelationRule {
+	for _, rule := range ns.Relations {
+		if rule.Name == relation {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Consistency - without a token the latest snapshot is used. With a token
+// the snapshot is at least as fresh as the one the token was issued for,
+// Exact evaluates at exactly that snapshot
+type Consistency struct {
+	Token string `json:"token,omitempty"`
+	Exact bool   `json:"exact,omitempty"`
+}
+
+type TupleWrite struct {
+	Touch  []*RelationTuple `json:"touch"`
+	Delete []*RelationTuple `json:"delete"`
+}
+
+type TupleFilter struct {
+	Namespace   string       `json:"namespace"`
+	ObjectId    string       `json:"objectId,omitempty"`
+	Relation    string       `json:"relation,omitempty"`
+	SubjectNs   string       `json:"subjectNs,omitempty"`
+	SubjectId   string       `json:"subjectId,omitempty"`
+	Consistency *Consistency `json:"consistency,omitempty"`
+}
+
+type RelCheckRequest struct {
+	Tuple       *RelationTuple `json:"tuple"`
+	Consistency *Consistency   `json:"consistency,omitempty"`
+}
+
+type RelExpandRequest struct {
+	Namespace   string       `json:"namespace"`
+	ObjectId    string       `json:"objectId"`
+	Relation    string       `json:"relation"`
+	Consistency *Consistency `json:"consistency,omitempty"`
+}
+
+// ListObjectsRequest - objects of the namespace on which the subject has the
+// relation
+type ListObjectsRequest struct {
+	Namespace   string       `json:"namespace"`
+	Relation    string       `json:"relation"`
+	SubjectNs   string       `json:"subjectNs"`
+	SubjectId   string       `json:"subjectId"`
+	SubjectRel  string       `json:"subjectRel,omitempty"`
+	Consistency *Consistency `json:"consistency,omitempty"`
+}
+
+type RelCheckResult struct {
+	Allowed bool   `json:"allowed"`
+	Token   string `json:"token"`
+}
+
+// ExpandNode - userset tree of an object relation. Subjects are the direct
+// subjects, children are the usersets the relation is made of
+type ExpandNode struct {
+	Userset  string        `json:"userset"`
+	Subjects []string      `json:"subjects,omitempty"`
+	Children []*ExpandNode `json:"children,omitempty"`
+}
+
+type ExpandResult struct {
+	Tree  *ExpandNode `json:"tree"`
+	Token string      `json:"token"`
+}
+
+type ListObjectsResult struct {
+	ObjectIds []string `json:"objectIds"`
+	Token     string   `json:"token"`
+}
+
+type ReadTuplesResult struct {
+	Tuples []*RelationTuple `json:"tuples"`
+	Token  string           `json:"token"`
+}
+
+type RelationController interface {
+	SaveNamespace(gtx context.Context, ns *RelNamespace) error
+	GetNamespaces(gtx context.Context, serviceId int64) ([]*RelNamespace, error)
+	RemoveNamespace(gtx context.Context, serviceId int64, name string) error
+
+	// Write - applies the touches and deletes atomically, returns the
+	// consistency token of the resulting snapshot
+	Write(gtx context.Context,
+		serviceId int64, write *TupleWrite) (string, error)
+	Read(gtx context.Context,
+		serviceId int64, filter *TupleFilter) (*ReadTuplesResult, error)
+
+	Check(gtx context.Context,
+		serviceId int64, req *RelCheckRequest) (*RelCheckResult, error)
+	Expand(gtx context.Context,
+		serviceId int64, req *RelExpandRequest) (*ExpandResult, error)
+	ListObjects(gtx context.Context,
+		serviceId int64, req *ListObjectsRequest) (*ListObjectsResult, error)
+
+	// PurgeDeleted - removes tuples deleted before the given time, snapshots
+	// older than the purged tuples cannot be used after that
+	PurgeDeleted(gtx context.Context, deletedBefore time.Time) (int64, error)
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/libx/data"
+)
+
+type ReviewState string
+
+const (
+	ReviewOpen   ReviewState = "open"
+	ReviewClosed ReviewState = "closed"
+)
+
+type ReviewDecision string
+
+const (
+	ReviewPending   ReviewDecision = "pending"
+	ReviewConfirmed ReviewDecision = "confirmed"
+	ReviewRevoked   ReviewDecision = "revoked"
+
+	// ReviewAutoRevoked - not reviewed till the deadline of a campaign that
+	// revokes such entries
+	ReviewAutoRevoked ReviewDecision = "autoRevoked"
+
+	// ReviewUnreviewed - not reviewed till the deadline, access is retained
+	ReviewUnreviewed ReviewDecision = "unreviewed"
+
+	// ReviewRevokeFailed - revoked or auto revoked but the access is not
+	// removed yet, the review sweeper retries the removal till it succeeds
+	ReviewRevokeFailed ReviewDecision = "revokeFailed"
+)
+
+// ReviewCampaign - certification of the memberships in the selected services
+// and groups. The memberships are snapshotted when the campaign is created
+type ReviewCampaign struct {
+	DbItem
+	TenantId    int64           `db:"tenant_id" json:"tenantId"`
+	Name        string          `db:"name" json:"name"`
+	Description string          `db:"description" json:"description"`
+	ServiceIds  data.Vec[int64] `db:"service_ids" json:"serviceIds"`
+	GroupIds    data.Vec[int64] `db:"group_ids" json:"groupIds"`
+	Deadline    time.Time       `db:"deadline" json:"deadline"`
+	AutoRevoke  bool            `db:"auto_revoke" json:"autoRevoke"`
+	State       ReviewState     `db:"state" json:"state"`
+	ClosedOn    *time.Time      `db:"closed_on" json:"closedOn"`
+	RemindedOn  *time.Time      `db:"reminded_on" json:"remindedOn"`
+}
+
+// ReviewItem - membership of an user in a group to be confirmed or revoked.
+// Items without a reviewer are reviewed by the owners of the group and the
+// admins of the service
+type ReviewItem struct {
+	Id          int64          `db:"id" json:"id"`
+	CampaignId  int64          `db:"campaign_id" json:"campaignId"`
+	UserId      int64          `db:"user_id" json:"userId"`
+	UserName    string         `db:"user_name" json:"userName"`
+	GroupId     int64          `db:"group_id" json:"groupId"`
+	GroupName   string         `db:"group_name" json:"groupName"`
+	ServiceId   int64          `db:"service_id" json:"serviceId"`
+	ServiceName string         `db:"service_name" json:"serviceName"`
+	ValidFrom   time.Time      `db:"valid_from" json:"validFrom"`
+	ValidUntil  *time.Time     `db:"valid_until" json:"validUntil"`
+	ReviewerId  *int64         `db:"reviewer_id" json:"reviewerId"`
+	Decision    ReviewDecision `db:"decision" json:"decision"`
+	DecidedBy   *int64         `db:"decided_by" json:"decidedBy"`
+	DeciderName string         `db:"decider_name" json:"deciderName"`
+	DecidedOn   *time.Time     `db:"decided_on" json:"decidedOn"`
+	Comment     string         `db:"comment" json:"comment"`
+}
+
+type ReviewItemFilter struct {
+	ServiceId int64          `json:"serviceId"`
+	Decision  ReviewDecision `json:"decision"`
+
+	// Mine - only the items the user in the context can review
+	Mine bool `json:"mine"`
+}
+
+// ItemDecision - decision of a reviewer, only confirmed and revoked are
+// accepted
+type ItemDecision struct {
+	Decision ReviewDecision `json:"decision"`
+	Comment  string         `json:"comment"`
+}
+
+type ReviewSummary struct {
+	Total        int `json:"total"`
+	Pending      int `json:"pending"`
+	Confirmed    int `json:"confirmed"`
+	Revoked      int `json:"revoked"`
+	AutoRevoked  int `json:"autoRevoked"`
+	Unreviewed   int `json:"unreviewed"`
+	RevokeFailed int `json:"revokeFailed"`
+}
+
+// ReviewReport - evidence of a campaign for the auditors
+type ReviewReport struct {
+	Campaign    *ReviewCampaign `json:"campaign"`
+	GeneratedOn time.Time       `json:"generatedOn"`
+	Summary     ReviewSummary   `json:"summary"`
+	Items       []*ReviewItem   `json:"items"`
+}
+
+type ReviewController interface {
+	// Create - creates the campaign and snapshots the memberships of the
+	// groups of the services and of the groups in it
+	Create(gtx context.Context, campaign *ReviewCampaign) (int64, error)
+	GetOne(gtx context.Context, id int64) (*ReviewCampaign, error)
+	Get(gtx context.Context, state ReviewState) ([]*ReviewCampaign, error)
+	Remove(gtx context.Context, id int64) error
+
+	GetItems(gtx context.Context,
+		campaignId int64, filter *ReviewItemFilter) ([]*ReviewItem, error)
+
+	// AssignReviewer - assigns the item to an user other than the member,
+	// nil gives it back to the owners of the group and the admins of the
+	// service
+	AssignReviewer(gtx context.Context, itemId int64, reviewerId *int64) error
+
+	// Decide - confirms or revokes an item of an open campaign, revoking
+	// removes the user from the group
+	Decide(gtx context.Context, itemId int64, decision *ItemDecision) error
+
+	// Close - closes the campaign, pending items are revoked if the campaign
+	// revokes unreviewed items
+	Close(gtx context.Context, id int64) error
+
+	Report(gtx context.Context, id int64) (*ReviewReport, error)
+
+	// Remind - mails the reviewers of the open campaigns that were not
+	// reminded within the given duration, returns the number of mails sent
+	Remind(gtx context.Context, every time.Duration) (int, error)
+
+	// CloseDue - closes the open campaigns that are past their deadline
+	CloseDue(gtx context.Context) ([]int64, error)
+
+	// RetryRevocations - removes the access of the items whose revocation
+	// did not go through, returns the number of items revoked
+	RetryRevocations(gtx context.Context) (int, error)
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"slices"
+
+	"github.com/varunamachi/libx/data"
+)
+
+// RoleTemplate - named bundle of groups, possibly from different services,
+// that can be given to an user in one go when the user is approved
+type RoleTemplate struct {
+	DbItem
+	Name        string          `db:"name" json:"name"`
+	Description string          `db:"description" json:"description"`
+	GroupIds    data.Vec[int64] `db:"group_ids" json:"groupIds"`
+}
+
+// Approval - access given to an user along with the approval. Groups of the
+// role templates are added to the groups given explicitly
+type Approval struct {
+	GroupIds  []int64  `json:"groupIds"`
+	Templates []string `json:"templates"`
+}
+
+type RoleTemplateController interface {
+	Save(gtx context.Context, tmpl *RoleTemplate) (int64, error)
+	Update(gtx context.Context, tmpl *RoleTemplate) error
+	GetOne(gtx context.Context, id int64) (*RoleTemplate, error)
+	GetByName(gtx context.Context, name string) (*RoleTemplate, error)
+	Get(gtx context.Context) ([]*RoleTemplate, error)
+	Remove(gtx context.Context, id int64) error
+}
+
+// InitialGroups - groups an user joins on becoming active. These are the
+// default groups of all the services of the tenant, the groups of the given
+// role templates and the given groups, without duplicates
+func InitialGroups(
+	gtx context.Context,
+	tenantId int64,
+	approval *Approval) ([]int64, error) {
+	groups, err := ServiceCtlr(gtx).DefaultGroups(gtx, tenantId)
+	if err != nil {
+		return nil, err
+	}
+	if approval == nil {
+		return groups, nil
+	}
+
+	groups = append(groups, approval.GroupIds...)
+	for _, name := range approval.Templates {
+		tmpl, err := RoleTemplateCtlr(gtx).GetByName(gtx, name)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, tmpl.GroupIds...)
+	}
+
+	slices.Sort(groups)
+	return slices.Compact(groups), nil
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	NameIdUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIdEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIdPersistent  = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIdTransient   = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+)
+
+// SamlAttributes - maps SAML attribute names to the source of their values.
+// Valid sources are userName, email, firstName, lastName, fullName, title,
+// role, permissions and props.<propName>
+type SamlAttributes map[string]string
+
+func (sa SamlAttributes) Value() (driver.Value, error) {
+	return json.Marshal(sa)
+}
+
+func (sa *SamlAttributes) Scan(value any) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, sa)
+}
+
+// SamlServiceProvider - SAML configuration of a service that acts as a SAML
+// service provider with idx as its identity provider
+type SamlServiceProvider struct {
+	ServiceId    int64          `db:"service_id" json:"serviceId"`
+	EntityId     string         `db:"entity_id" json:"entityId"`
+	AcsUrl       string         `db:"acs_url" json:"acsUrl"`
+	NameIdFormat string         `db:"name_id_format" json:"nameIdFormat"`
+	Attributes   SamlAttributes `db:"attributes" json:"attributes"`
+
+	// NameIdSecret - key of the persistent NameIDs issued to the SP, it is
+	// never sent to the clients
+	NameIdSecret string `db:"name_id_secret" json:"-"`
+}
+
+// SamlPostForm - response that has to be posted to the service provider's
+// assertion consumer service by the user agent
+type SamlPostForm struct {
+	AcsUrl       string `json:"acsUrl"`
+	SAMLResponse string `json:"samlResponse"`
+	RelayState   string `json:"relayState"`
+}
+
+type SamlController interface {
+	SaveServiceProvider(gtx context.Context, sp *SamlServiceProvider) error
+	GetServiceProvider(
+		gtx context.Context, serviceId int64) (*SamlServiceProvider, error)
+	RemoveServiceProvider(gtx context.Context, serviceId int64) error
+
+	Metadata(gtx context.Context) (string, error)
+	HandleAuthnRequest(
+		gtx context.Context,
+		samlRequest, relayState string,
+		deflated bool) (*SamlPostForm, error)
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	ScimUserSchema     = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimGroupSchema    = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimIdxGroupSchema = "urn:ietf:params:scim:schemas:extension:idx:2.0:Group"
+	ScimListSchema     = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimPatchSchema    = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimErrorSchema    = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+type ScimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+	Version      string    `json:"version"`
+}
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// ScimValue - entry of a multi valued SCIM attribute such as emails, groups
+// and members
+type ScimValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type ScimUser struct {
+	Schemas     []string    `json:"schemas"`
+	Id          string      `json:"id,omitempty"`
+	ExternalId  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *ScimName   `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Title       string      `json:"title,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Password    string      `json:"password,omitempty"`
+	Emails      []ScimValue `json:"emails,omitempty"`
+	Groups      []ScimValue `json:"groups,omitempty"`
+	Meta        *ScimMeta   `json:"meta,omitempty"`
+}
+
+// ScimGroupExt - idx specific group attributes, service id is required when
+// a group is created since every idx group belongs to a service
+type ScimGroupExt struct {
+	ServiceId   int64  `json:"serviceId"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type ScimGroup struct {
+	Schemas     []string      `json:"schemas"`
+	Id          string        `json:"id,omitempty"`
+	ExternalId  string        `json:"externalId,omitempty"`
+	DisplayName string        `json:"displayName"`
+	Members     []ScimValue   `json:"members,omitempty"`
+	Idx         *ScimGroupExt `json:"urn:ietf:params:scim:schemas:extension:idx:2.0:Group,omitempty"`
+	Meta        *ScimMeta     `json:"meta,omitempty"`
+}
+
+type ScimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int64    `json:"startIndex"`
+	ItemsPerPage int64    `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
+
+type ScimPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type ScimPatch struct {
+	Schemas    []string       `json:"schemas"`
+	Operations []*ScimPatchOp `json:"Operations"`
+}
+
+type ScimQuery struct {
+	Filter     string `json:"filter"`
+	SortBy     string `json:"sortBy"`
+	SortOrder  string `json:"sortOrder"`
+	StartIndex int64  `json:"startIndex"`
+	Count      int64  `json:"count"`
+}
+
+// ScimController - SCIM 2.0 view of idx users and groups. Mutating methods
+// take the version from the client's If-Match header, an empty version or
+// '*' skips the precondition check
+type ScimController interface {
+	GetUser(gtx context.Context, id int64) (*ScimUser, error)
+	QueryUsers(gtx context.Context, query *ScimQuery) (*ScimListResponse, error)
+	CreateUser(gtx context.Context, user *ScimUser) (*ScimUser, error)
+	ReplaceUser(gtx context.Context,
+		id int64, user *ScimUser, version string) (*ScimUser, error)
+	PatchUser(gtx context.Context,
+		id int64, patch *ScimPatch, version string) (*ScimUser, error)
+	DeleteUser(gtx context.Context, id int64, version string) error
+
+	GetGroup(gtx context.Context, id int64) (*ScimGroup, error)
+	QueryGroups(
+		gtx context.Context, query *ScimQuery) (*ScimListResponse, error)
+	CreateGroup(gtx context.Context, group *ScimGroup) (*ScimGroup, error)
+	ReplaceGroup(gtx context.Context,
+		id int64, group *ScimGroup, version string) (*ScimGroup, error)
+	PatchGroup(gtx context.Context,
+		id int64, patch *ScimPatch, version string) (*ScimGroup, error)
+	DeleteGroup(gtx context.Context, id int64, version string) error
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+
+	"github.com/varunamachi/libx/data"
+)
+
+type SodKind string
+
+const (
+	// SodGroups - nobody can be a member of both the groups, membership
+	// through sub groups counts
+	SodGroups SodKind = "groups"
+
+	// SodPerms - nobody can hold both the permissions, a grant of a parent
+	// node or a wildcard grant holds every permission it implies
+	SodPerms SodKind = "perms"
+)
+
+// SodConstraint - segregation of duties constraint of a service, makes a pair
+// of groups or a pair of permissions mutually exclusive
+type SodConstraint struct {
+	DbItem
+	ServiceId   int64            `db:"service_id" json:"serviceId"`
+	Name        string           `db:"name" json:"name"`
+	Description string           `db:"description" json:"description"`
+	Kind        SodKind          `db:"kind" json:"kind"`
+	GroupIds    data.Vec[int64]  `db:"group_ids" json:"groupIds"`
+	Perms       data.Vec[string] `db:"perms" json:"perms"`
+	Enabled     bool             `db:"enabled" json:"enabled"`
+}
+
+// SodViolation - user holding both sides of a constraint, Items are the
+// names of the groups or the permissions
+type SodViolation struct {
+	ConstraintId int64    `json:"constraintId"`
+	Constraint   string   `json:"constraint"`
+	UserId       int64    `json:"userId"`
+	UserName     string   `json:"userName"`
+	Items        []string `json:"items"`
+}
+
+type SodController interface {
+	Save(gtx context.Context, sod *SodConstraint) (int64, error)
+	Update(gtx context.Context, sod *SodConstraint) error
+	GetOne(gtx context.Context, id int64) (*SodConstraint, error)
+	Remove(gtx context.Context, id int64) error
+	GetForService(gtx context.Context, serviceId int64) ([]*SodConstraint, error)
+
+	// Check - fails with ErrSodViolation if the changes to the groups of the
+	// service make an user violate an enabled constraint. Violations that
+	// exist before the changes do not fail the check
+	Check(gtx context.Context, serviceId int64, changes ...*AccessChange) error
+
+	// Violations - users of the service who currently violate an enabled
+	// constraint, constraints can be added after the memberships exist
+	Violations(gtx context.Context, serviceId int64) ([]*SodViolation, error)
+}
@@ -1 +1,188 @@
 package core
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/rt"
+)
+
+// ServiceHeader - header that names the service a request is made for, idx
+// itself is the current service when the header is not given
+const ServiceHeader = "X-Idx-Service"
+
+type currentServiceKey struct{}
+
+func WithCurrentService(gtx context.Context, name string) context.Context {
+	return context.WithValue(gtx, currentServiceKey{}, name)
+}
+
+// IdxService - name of the service that represents idx itself, whose
+// permissions authorize the endpoints of idx
+func IdxService() string {
+	return rt.EnvString("IDX_SERVICE_NAME", "idx")
+}
+
+// CurrentService - name of the service the request in the context is made
+// for
+func CurrentService(gtx context.Context) string {
+	if name, ok := gtx.Value(currentServiceKey{}).(string); ok && name != "" {
+		return name
+	}
+	return IdxService()
+}
+
+// CheckServiceAdmin - fails with ErrUnauthorized unless the user in the
+// context is a super user, an admin of the tenant of the service or an admin
+// of the service
+func CheckServiceAdmin(gtx context.Context, serviceId int64) error {
+	return checkServiceAdmin(gtx, serviceId, true)
+}
+
+// CheckStandingServiceAdmin - same as CheckServiceAdmin but ignores the
+// elevations of the user, for granting rights that elevations should not be
+// able to pass on
+func CheckStandingServiceAdmin(gtx context.Context, serviceId int64) error {
+	return checkServiceAdmin(gtx, serviceId, false)
+}
+
+func checkServiceAdmin(
+	gtx context.Context, serviceId int64, elevated bool) error {
+	user, err := GetUser(gtx)
+	if err != nil {
+		return err
+	}
+	role := data.Qop(elevated, user.AuthzRole, user.StandingRole())
+	if role == auth.Super {
+		return nil
+	}
+	if role == TenantAdmin {
+		// Lookup is scoped to the tenant of the user unless the user is
+		// elevated to a super user, so the tenant is compared as well
+		service, err := ServiceCtlr(gtx).GetOne(gtx, serviceId)
+		if err != nil || service.TenantId != user.TenantId {
+			return errx.Errf(ErrUnauthorized,
+				"service '%d' is not in the tenant of user '%s'",
+				serviceId, user.UName)
+		}
+		return nil
+	}
+
+	if elevated && user.ElevatedAdmin(serviceId) {
+		return nil
+	}
+
+	isAdmin, err := ServiceCtlr(gtx).IsAdmin(gtx, serviceId, user.Id())
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return errx.Errf(ErrUnauthorized,
+			"user '%s' is not an admin of service '%d'",
+			user.UName, serviceId)
+	}
+	return nil
+}
+
+// SessionUser - user with the given name along with the elevations and the
+// access in idx and in the current service, as required by the authorized
+// endpoints
+func SessionUser(gtx context.Context, userName string) (*User, error) {
+	user, err := UserCtlr(gtx).ByUsername(gtx, userName)
+	if err != nil {
+		return nil, err
+	}
+	if err := LoadElevations(gtx, user); err != nil {
+		return nil, err
+	}
+	if err := LoadAccess(gtx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LoadAccess - loads the groups and the permissions of the user in idx, which
+// authorize the endpoints, and in the current service. The service named in
+// the request never contributes to the authorization of the endpoints
+func LoadAccess(gtx context.Context, user *User) error {
+	groupIds, perms, err := IdxAccess(gtx, user)
+	if err != nil {
+		return err
+	}
+	user.SetIdxAccess(groupIds, perms)
+
+	name := CurrentService(gtx)
+	if name != IdxService() {
+		groupIds, perms, err = accessIn(gtx, user, name)
+		if err != nil {
+			return err
+		}
+	}
+	user.SetAccess(groupIds, perms)
+	return nil
+}
+
+// IdxAccess - groups and permissions of the user in idx itself, whatever the
+// current service is
+func IdxAccess(
+	gtx context.Context, user *User) ([]string, auth.PermissionSet, error) {
+	return accessIn(gtx, user, IdxService())
+}
+
+// accessIn - groups and permissions of the user in the named service. A user
+// without access to the service, or a service that is not registered, has no
+// group or permission
+func accessIn(
+	gtx context.Context,
+	user *User,
+	name string) ([]string, auth.PermissionSet, error) {
+	exists, err := ServiceCtlr(gtx).Exists(gtx, name)
+	if err != nil || !exists {
+		return nil, nil, err
+	}
+	service, err := ServiceCtlr(gtx).GetByName(gtx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if service.TenantId != user.TenantId {
+		return nil, nil, nil
+	}
+
+	err = ServiceCtlr(gtx).CheckAccess(gtx, service.Id, user.Id())
+	if errors.Is(err, ErrServiceAccessDenied) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groups, err := GroupCtlr(gtx).GetUserGroups(
+		gtx, user.Id(), service.Id, &data.CommonParams{})
+	if err != nil {
+		return nil, nil, err
+	}
+	perms, err := ServiceCtlr(gtx).GetPermissionForService(
+		gtx, user.Id(), service.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groupIds := make([]string, 0, len(groups))
+	seen := make(map[int64]struct{}, len(groups))
+	for _, g := range groups {
+		if _, found := seen[g.GroupId]; found {
+			continue
+		}
+		seen[g.GroupId] = struct{}{}
+		groupIds = append(groupIds, strconv.FormatInt(g.GroupId, 10))
+	}
+	permSet := make(auth.PermissionSet, len(perms))
+	for _, perm := range perms {
+		permSet[perm] = struct{}{}
+	}
+	return groupIds, permSet, nil
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/errx"
+)
+
+// DefaultTenant - tenant of the data that was created before tenants were
+// introduced and of the entities created without a tenant
+const DefaultTenant int64 = 1
+
+// TenantAdmin - role of the users who administer their own tenant, it is a
+// tier between auth.Admin and auth.Super. Only super users work across
+// tenants
+const TenantAdmin auth.Role = "TenantAdmin"
+
+// ValidRoles - roles that can be assigned to the users
+var ValidRoles = []auth.Role{auth.Normal, auth.Admin, TenantAdmin, auth.Super}
+
+func ToRole(role string) auth.Role {
+	if auth.Role(role) == TenantAdmin {
+		return TenantAdmin
+	}
+	return auth.ToRole(role)
+}
+
+// RoleAtLeast - auth.Role.EqualOrAbove that knows about TenantAdmin
+func RoleAtLeast(role, another auth.Role) bool {
+	return roleRank(role) >= roleRank(another)
+}
+
+func roleRank(role auth.Role) int {
+	switch role {
+	case auth.Normal:
+		return 1
+	case auth.Admin:
+		return 2
+	case TenantAdmin:
+		return 3
+	case auth.Super:
+		return 4
+	}
+	return 0
+}
+
+// Tenant - organization that owns a set of users, services and groups
+type Tenant struct {
+	DbItem
+	Name        string `db:"name" json:"name"`
+	DisplayName string `db:"display_name" json:"displayName"`
+	Description string `db:"description" json:"description"`
+}
+
+type TenantController interface {
+	Save(gtx context.Context, tenant *Tenant) (int64, error)
+	Update(gtx context.Context, tenant *Tenant) error
+	GetOne(gtx context.Context, id int64) (*Tenant, error)
+	GetByName(gtx context.Context, name string) (*Tenant, error)
+	Get(gtx context.Context) ([]*Tenant, error)
+	Remove(gtx context.Context, id int64) error
+}
+
+// TenantScope - tenant the queries in the given context are limited to. The
+// context is not scoped when there is no user in it (internal jobs, login
+// etc) or when the user is a super user
+func TenantScope(gtx context.Context) (int64, bool) {
+	user := contextUser(gtx)
+	if user == nil || user.Role() == auth.Super {
+		return -1, false
+	}
+	return user.TenantId, true
+}
+
+// TenantFor - tenant of a new entity. Scoped users can only create entities
+// in their own tenant, others get the requested or the default tenant
+func TenantFor(gtx context.Context, requested int64) int64 {
+	if tenantId, scoped := TenantScope(gtx); scoped {
+		return tenantId
+	}
+	if requested <= 0 {
+		return DefaultTenant
+	}
+	return requested
+}
+
+// TenantTable - table expression that only has the rows of the tenant in
+// scope, usable in place of the table name in generic queries
+func TenantTable(gtx context.Context, table string) string {
+	tenantId, scoped := TenantScope(gtx)
+	if !scoped {
+		return table
+	}
+	return fmt.Sprintf(
+		"(SELECT * FROM %s WHERE tenant_id = %d) AS %s",
+		table, tenantId, table)
+}
+
+// TenantCond - SQL condition that limits the rows to the tenant in scope,
+// column is the tenant_id column of the table or of its alias
+func TenantCond(gtx context.Context, column string) string {
+	tenantId, scoped := TenantScope(gtx)
+	if !scoped {
+		return "TRUE"
+	}
+	return fmt.Sprintf("%s = %d", column, tenantId)
+}
+
+// TenantServiceCond - SQL condition that limits the rows to the ones that
+// belong to the services of the tenant in scope, column is the service id
+func TenantServiceCond(gtx context.Context, column string) string {
+	tenantId, scoped := TenantScope(gtx)
+	if !scoped {
+		return "TRUE"
+	}
+	return fmt.Sprintf(
+		"%s IN (SELECT id FROM idx_service WHERE tenant_id = %d)",
+		column, tenantId)
+}
+
+// CheckTenant - fails with ErrUnauthorized if the context is scoped to a
+// tenant other than the given one
+func CheckTenant(gtx context.Context, tenantId int64) error {
+	scope, scoped := TenantScope(gtx)
+	if scoped && scope != tenantId {
+		return errx.Errf(ErrUnauthorized,
+			"tenant '%d' is not accessible from tenant '%d'", tenantId, scope)
+	}
+	return nil
+}
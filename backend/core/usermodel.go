@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"slices"
 
 	"github.com/varunamachi/libx/auth"
 	"github.com/varunamachi/libx/data"
@@ -38,6 +39,7 @@ var ValidUserStates = []UserState{
 
 type User struct {
 	DbItem
+	TenantId  int64     `json:"tenantId" db:"tenant_id"`
 	UName     string    `json:"userName" db:"user_name"`
 	EmailId   string    `json:"email" db:"email"`
 	AuthzRole auth.Role `json:"auth" db:"auth"`
@@ -47,6 +49,23 @@ type User struct {
 	Title     string    `json:"title" db:"title"`
 	Props     data.M    `json:"props,omitempty" db:"props"`
 	// Perms     auth.PermissionSet `json:"perms,omitempty" db:"perms"`
+
+	// Groups and permissions of the user in the current service, only loaded
+	// for the authenticated user of a request
+	groupIds []string
+	perms    auth.PermissionSet
+
+	// Groups and permissions of the user in idx itself, which authorize the
+	// endpoints of idx through RouteUser
+	idxGroupIds []string
+	idxPerms    auth.PermissionSet
+
+	// Elevations in effect for the request, their kinds, the services the
+	// user is an admin of through them and the role held without them
+	elevations   []int64
+	kinds        []ElevationKind
+	adminOf      []int64
+	standingRole auth.Role
 }
 
 func (u *User) Id() int64 {
@@ -65,16 +84,125 @@ func (u *User) FullName() string {
 	return u.FirstName + " " + u.LastName
 }
 
+// Role - role as known to the authorization of the endpoints, where tenant
+// admins are admins. AuthzRole has the actual role
 func (u *User) Role() auth.Role {
+	if u.AuthzRole == TenantAdmin {
+		return auth.Admin
+	}
 	return u.AuthzRole
 }
 
+// TenantAdmin - user administers own tenant, super users administer all of
+// them
+func (u *User) TenantAdmin() bool {
+	return RoleAtLeast(u.AuthzRole, TenantAdmin)
+}
+
+// GroupIds - groups of the user in the current service
 func (u *User) GroupIds() []string {
-	return []string{}
+	if u.groupIds == nil {
+		return []string{}
+	}
+	return u.groupIds
 }
 
+// Permissions - permissions of the user in the current service
 func (u *User) Permissions() auth.PermissionSet {
-	return auth.PermissionSet{}
+	if u.perms == nil {
+		return auth.PermissionSet{}
+	}
+	return u.perms
+}
+
+// Elevate - applies an active elevation to the user. Group elevations are
+// memberships and need nothing more
+func (u *User) Elevate(el *Elevation) {
+	u.elevations = append(u.elevations, el.Id)
+	u.kinds = append(u.kinds, el.Kind)
+	switch el.Kind {
+	case ElevateRole:
+		if u.standingRole == auth.None {
+			u.standingRole = u.AuthzRole
+		}
+		if !RoleAtLeast(u.AuthzRole, el.Role) {
+			u.AuthzRole = el.Role
+		}
+	case ElevateServiceAdmin:
+		u.adminOf = append(u.adminOf, el.TargetId)
+	}
+}
+
+func (u *User) Elevations() []int64 {
+	return u.elevations
+}
+
+// Elevated - user holds an active elevation of the given kind
+func (u *User) Elevated(kind ElevationKind) bool {
+	return slices.Contains(u.kinds, kind)
+}
+
+// StandingRole - role of the user without the elevations in effect
+func (u *User) StandingRole() auth.Role {
+	if u.standingRole != auth.None {
+		return u.standingRole
+	}
+	return u.AuthzRole
+}
+
+// ElevatedAdmin - user is an admin of the service through an elevation
+func (u *User) ElevatedAdmin(serviceId int64) bool {
+	return slices.Contains(u.adminOf, serviceId)
+}
+
+// SetAccess - sets the groups and the permissions of the user in the current
+// service
+func (u *User) SetAccess(groupIds []string, perms auth.PermissionSet) {
+	u.groupIds = groupIds
+	u.perms = perms
+}
+
+// IdxGroupIds - groups of the user in idx itself
+func (u *User) IdxGroupIds() []string {
+	if u.idxGroupIds == nil {
+		return []string{}
+	}
+	return u.idxGroupIds
+}
+
+// IdxPermissions - permissions of the user in idx itself
+func (u *User) IdxPermissions() auth.PermissionSet {
+	if u.idxPerms == nil {
+		return auth.PermissionSet{}
+	}
+	return u.idxPerms
+}
+
+// SetIdxAccess - sets the groups and the permissions of the user in idx
+func (u *User) SetIdxAccess(groupIds []string, perms auth.PermissionSet) {
+	u.idxGroupIds = groupIds
+	u.idxPerms = perms
+}
+
+// routeUser - the user as seen by the authorization of the endpoints, which
+// only ever looks at the groups and the permissions the user has in idx
+type routeUser struct {
+	*User
+}
+
+func (ru *routeUser) GroupIds() []string {
+	return ru.IdxGroupIds()
+}
+
+func (ru *routeUser) Permissions() auth.PermissionSet {
+	return ru.IdxPermissions()
+}
+
+// RouteUser - the user to hand over to the authorization of the endpoints.
+// The permissions of the current service, as given by User.Permissions, must
+// never authorize an endpoint of idx. GetUser and MustGetUser unwrap it
+func RouteUser(user *User) auth.User {
+	return &routeUser{user}
 }
 
 func (u *User) AddProp(key string, value any) {
@@ -123,7 +251,7 @@ type UserController interface {
 	Approve(gtx context.Context,
 		userId int64,
 		role auth.Role,
-		groups ...int64) error
+		approval *Approval) error
 	InitResetPassword(gtx context.Context, userName string) error
 	ResetPassword(
 		gtx context.Context, userName, token, newPassword string) error
@@ -0,0 +1,281 @@
+package elevdx
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+// Any user can request an elevation they are eligible for, granting and
+// deciding is limited to the users who can grant the elevation by the
+// controller
+
+func ElevationEndpoints(gtx context.Context) []*httpx.Endpoint {
+	ec := core.ElevationCtlr(gtx)
+	return []*httpx.Endpoint{
+		createEligibilityEp(ec),
+		removeEligibilityEp(ec),
+		getEligibilitiesEp(ec),
+		requestElevationEp(ec),
+		getElevationEp(ec),
+		getElevationsEp(ec),
+		approveElevationEp(ec),
+		denyElevationEp(ec),
+		endElevationEp(ec),
+	}
+}
+
+type elevationDecision struct {
+	Comment string `json:"comment"`
+}
+
+func createEligibilityEp(ec core.ElevationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var el core.Eligibility
+		if err := etx.Bind(&el); err != nil {
+			return errx.BadReqX(err, "failed to read eligibility from request")
+		}
+
+		id, err := ec.SaveEligibility(etx.Request().Context(), &el)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, data.M{
+			"eligibilityId": id,
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.POST,
+		Path:     "/elevation/eligibility",
+		Category: "idx.elevation",
+		Desc:     "Make an user eligible for an elevation",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func removeEligibilityEp(ec core.ElevationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := ec.RemoveEligibility(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.DELETE,
+		Path:     "/elevation/eligibility/:id",
+		Category: "idx.elevation",
+		Desc:     "Remove an eligibility for elevation",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getEligibilitiesEp(ec core.ElevationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		userId := prmg.Int64("userId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		els, err := ec.GetEligibilities(etx.Request().Context(), userId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, els)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/user/:userId/eligibility",
+		Category: "idx.elevation",
+		Desc:     "Get the elevations an user is eligible for",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func requestElevationEp(ec core.ElevationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var req core.Elevation
+		if err := etx.Bind(&req); err != nil {
+			return errx.BadReqX(err, "failed to read elevation request")
+		}
+
+		el, err := ec.Request(etx.Request().Context(), &req)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, el)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.POST,
+		Path:     "/elevation",
+		Category: "idx.elevation",
+		Desc:     "Request a temporary elevation",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getElevationEp(ec core.ElevationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		el, err := ec.GetOne(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, el)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/elevation/:id",
+		Category: "idx.elevation",
+		Desc:     "Get an elevation",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getElevationsEp(ec core.ElevationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		userId := prmg.QueryInt64Or("userId", 0)
+		state := prmg.QueryStrOr("state", "")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		els, err := ec.Get(etx.Request().Context(), &core.ElevationFilter{
+			UserId: userId,
+			State:  core.ElevationState(state),
+		})
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, els)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/elevation",
+		Category: "idx.elevation",
+		Desc:     "Get elevations filtered by user and state",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func approveElevationEp(ec core.ElevationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var decision elevationDecision
+		if err := etx.Bind(&decision); err != nil {
+			return errx.BadReqX(err, "failed to read decision from request")
+		}
+
+		err := ec.Approve(etx.Request().Context(), id, decision.Comment)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/elevation/:id/approve",
+		Category: "idx.elevation",
+		Desc:     "Approve a pending elevation",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func denyElevationEp(ec core.ElevationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var decision elevationDecision
+		if err := etx.Bind(&decision); err != nil {
+			return errx.BadReqX(err, "failed to read decision from request")
+		}
+
+		err := ec.Deny(etx.Request().Context(), id, decision.Comment)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/elevation/:id/deny",
+		Category: "idx.elevation",
+		Desc:     "Deny a pending elevation",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func endElevationEp(ec core.ElevationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := ec.End(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/elevation/:id/end",
+		Category: "idx.elevation",
+		Desc:     "End an active elevation before it expires",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
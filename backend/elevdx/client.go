@@ -0,0 +1,123 @@
+package elevdx
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+type Client struct {
+	*httpx.Client
+	Timeout time.Duration
+}
+
+func (c *Client) build() *httpx.RequestBuilder {
+	builder := c.Build()
+	if c.Timeout != 0 {
+		builder = builder.WithTimeout(c.Timeout)
+	}
+	return builder
+}
+
+func (c *Client) CreateEligibility(
+	gtx context.Context, el *core.Eligibility) (int64, error) {
+	apiRes := c.build().Path("/api/v1/elevation/eligibility").Post(gtx, el)
+	res := map[string]int64{"eligibilityId": int64(-1)}
+	if err := apiRes.LoadClose(&res); err != nil {
+		return -1, errx.Errf(err,
+			"failed to create eligibility for user: '%d'", el.UserId)
+	}
+	return res["eligibilityId"], nil
+}
+
+func (c *Client) RemoveEligibility(gtx context.Context, id int64) error {
+	apiRes := c.build().Path("/api/v1/elevation/eligibility", id).Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to remove eligibility: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) GetEligibilities(
+	gtx context.Context, userId int64) ([]*core.Eligibility, error) {
+	els := make([]*core.Eligibility, 0, 10)
+	apiRes := c.build().Path("/api/v1/user", userId, "eligibility").Get(gtx)
+	if err := apiRes.LoadClose(&els); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get eligibilities of user: '%d'", userId)
+	}
+	return els, nil
+}
+
+func (c *Client) RequestElevation(
+	gtx context.Context, req *core.Elevation) (*core.Elevation, error) {
+	var el core.Elevation
+	apiRes := c.build().Path("/api/v1/elevation").Post(gtx, req)
+	if err := apiRes.LoadClose(&el); err != nil {
+		return nil, errx.Errf(err,
+			"failed to request elevation for eligibility: '%d'",
+			req.EligibilityId)
+	}
+	return &el, nil
+}
+
+func (c *Client) GetElevation(
+	gtx context.Context, id int64) (*core.Elevation, error) {
+	var el core.Elevation
+	apiRes := c.build().Path("/api/v1/elevation", id).Get(gtx)
+	if err := apiRes.LoadClose(&el); err != nil {
+		return nil, errx.Errf(err, "failed to get elevation: '%d'", id)
+	}
+	return &el, nil
+}
+
+func (c *Client) GetElevations(
+	gtx context.Context,
+	filter *core.ElevationFilter) ([]*core.Elevation, error) {
+	builder := c.build().Path("/api/v1/elevation")
+	if filter.UserId != 0 {
+		builder = builder.QInt("userId", filter.UserId)
+	}
+	if filter.State != "" {
+		builder = builder.QStr("state", string(filter.State))
+	}
+	els := make([]*core.Elevation, 0, 20)
+	if err := builder.Get(gtx).LoadClose(&els); err != nil {
+		return nil, errx.Errf(err, "failed to get elevations")
+	}
+	return els, nil
+}
+
+func (c *Client) ApproveElevation(
+	gtx context.Context, id int64, comment string) error {
+	apiRes := c.build().
+		Path("/api/v1/elevation", id, "approve").
+		Put(gtx, data.M{"comment": comment})
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to approve elevation: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) DenyElevation(
+	gtx context.Context, id int64, comment string) error {
+	apiRes := c.build().
+		Path("/api/v1/elevation", id, "deny").
+		Put(gtx, data.M{"comment": comment})
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to deny elevation: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) EndElevation(gtx context.Context, id int64) error {
+	apiRes := c.build().Path("/api/v1/elevation", id, "end").Put(gtx, nil)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to end elevation: '%d'", id)
+	}
+	return nil
+}
@@ -0,0 +1,432 @@
+package elevdx
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+// maxElevationMinutes - no elevation lasts longer than a day, longer access
+// should be a regular role or membership
+const maxElevationMinutes = 24 * 60
+
+type elevationCtl struct {
+	estore *PgElevationStorage
+}
+
+func NewElevationController(
+	estore *PgElevationStorage) core.ElevationController {
+	return &elevationCtl{
+		estore: estore,
+	}
+}
+
+func (ec *elevationCtl) SaveEligibility(
+	gtx context.Context, el *core.Eligibility) (int64, error) {
+	ev := core.NewEventAdder(gtx, "elevation.saveEligibility", data.M{
+		"eligibility": el,
+	})
+
+	if el.MaxMinutes <= 0 || el.MaxMinutes > maxElevationMinutes {
+		return -1, ev.Errf(core.ErrInvalidState,
+			"maximum duration of an elevation should be between 1 and %d "+
+				"minutes", maxElevationMinutes)
+	}
+	switch el.Kind {
+	case core.ElevateRole:
+		if !slices.Contains(core.ValidRoles, el.Role) ||
+			el.Role == auth.Normal {
+			return -1, ev.Errf(core.ErrInvalidRole,
+				"invalid role '%s' for elevation", el.Role)
+		}
+		el.TargetId = 0
+	case core.ElevateGroup, core.ElevateServiceAdmin:
+		if el.TargetId <= 0 {
+			return -1, ev.Errf(core.ErrInvalidState,
+				"target is required for '%s' elevation", el.Kind)
+		}
+		el.Role = auth.None
+	default:
+		return -1, ev.Errf(core.ErrInvalidState,
+			"invalid elevation kind '%s'", el.Kind)
+	}
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	if el.UserId == user.Id() {
+		return -1, ev.Errf(core.ErrUnauthorized,
+			"user '%s' cannot grant an eligibility to self", user.UName)
+	}
+
+	// Getting the user also makes sure that the user is in the tenant
+	if _, err := core.UserCtlr(gtx).GetOne(gtx, el.UserId); err != nil {
+		return -1, ev.Commit(err)
+	}
+	if err := checkGrantor(gtx, el.Kind, el.Role, el.TargetId); err != nil {
+		return -1, ev.Commit(err)
+	}
+
+	el.CreatedBy = user.Id()
+	el.UpdatedBy = user.Id()
+
+	id, err := ec.estore.SaveEligibility(gtx, el)
+	return id, ev.Commit(err)
+}
+
+func (ec *elevationCtl) RemoveEligibility(gtx context.Context, id int64) error {
+	ev := core.NewEventAdder(gtx, "elevation.removeEligibility", data.M{
+		"eligibilityId": id,
+	})
+
+	el, err := ec.estore.GetEligibility(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if _, err := core.UserCtlr(gtx).GetOne(gtx, el.UserId); err != nil {
+		return ev.Commit(err)
+	}
+	if err := checkGrantor(gtx, el.Kind, el.Role, el.TargetId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(ec.estore.RemoveEligibility(gtx, id))
+}
+
+func (ec *elevationCtl) GetEligibilities(
+	gtx context.Context, userId int64) ([]*core.Eligibility, error) {
+	ev := core.NewEventAdder(gtx, "elevation.getEligibilities", data.M{
+		"userId": userId,
+	})
+	if err := checkLister(gtx, userId); err != nil {
+		return nil, ev.Commit(err)
+	}
+	els, err := ec.estore.GetEligibilities(gtx, userId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return els, nil
+}
+
+func (ec *elevationCtl) Request(
+	gtx context.Context, req *core.Elevation) (*core.Elevation, error) {
+	ev := core.NewEventAdder(gtx, "elevation.request", data.M{
+		"eligibilityId": req.EligibilityId,
+		"minutes":       req.Minutes,
+	})
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	el, err := ec.estore.GetEligibility(gtx, req.EligibilityId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if el.UserId != user.Id() {
+		return nil, ev.Errf(core.ErrUnauthorized,
+			"eligibility '%d' does not belong to user '%s'",
+			el.Id, user.UName)
+	}
+	if req.Reason == "" {
+		return nil, ev.Errf(core.ErrInvalidState,
+			"reason is required to request an elevation")
+	}
+	if req.Minutes <= 0 || req.Minutes > el.MaxMinutes {
+		return nil, ev.Errf(core.ErrInvalidState,
+			"elevation can be requested for 1 to %d minutes", el.MaxMinutes)
+	}
+
+	if el.Kind == core.ElevateGroup {
+		_, err := core.GroupCtlr(gtx).GetMembership(gtx, user.Id(), el.TargetId)
+		if err == nil {
+			return nil, ev.Errf(core.ErrEntityExists,
+				"user '%s' is already a member of group '%d'",
+				user.UName, el.TargetId)
+		}
+		if !errors.Is(err, core.ErrInvalidState) {
+			return nil, ev.Commit(err)
+		}
+	}
+
+	open, err := ec.estore.HasOpen(gtx, el.Id)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if open {
+		return nil, ev.Errf(core.ErrEntityExists,
+			"user '%s' already has an open elevation for eligibility '%d'",
+			user.UName, el.Id)
+	}
+
+	req.UserId = user.Id()
+	req.Kind, req.Role, req.TargetId = el.Kind, el.Role, el.TargetId
+	id, err := ec.estore.Create(gtx, req)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	if el.AutoApprove {
+		if err := ec.activate(gtx, req, id, nil, "auto approved"); err != nil {
+			return nil, ev.Commit(err)
+		}
+	}
+
+	out, err := ec.estore.GetOne(gtx, id)
+	return out, ev.Commit(err)
+}
+
+func (ec *elevationCtl) GetOne(
+	gtx context.Context, id int64) (*core.Elevation, error) {
+	ev := core.NewEventAdder(gtx, "elevation.getOne", data.M{
+		"elevationId": id,
+	})
+	el, err := ec.estore.GetOne(gtx, id)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if err := checkLister(gtx, el.UserId); err != nil {
+		return nil, ev.Commit(err)
+	}
+	return el, nil
+}
+
+func (ec *elevationCtl) Get(
+	gtx context.Context,
+	filter *core.ElevationFilter) ([]*core.Elevation, error) {
+	ev := core.NewEventAdder(gtx, "elevation.get", data.M{
+		"filter": filter,
+	})
+	if err := checkLister(gtx, filter.UserId); err != nil {
+		return nil, ev.Commit(err)
+	}
+	els, err := ec.estore.Get(gtx, filter)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return els, nil
+}
+
+func (ec *elevationCtl) Approve(
+	gtx context.Context, id int64, comment string) error {
+	ev := core.NewEventAdder(gtx, "elevation.approve", data.M{
+		"elevationId": id,
+		"comment":     comment,
+	})
+
+	el, approver, err := ec.forDecision(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	approverId := approver.Id()
+	return ev.Commit(ec.activate(gtx, el, id, &approverId, comment))
+}
+
+func (ec *elevationCtl) Deny(
+	gtx context.Context, id int64, comment string) error {
+	ev := core.NewEventAdder(gtx, "elevation.deny", data.M{
+		"elevationId": id,
+		"comment":     comment,
+	})
+
+	if comment == "" {
+		return ev.Errf(core.ErrInvalidState,
+			"comment is required to deny an elevation")
+	}
+	_, approver, err := ec.forDecision(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(ec.estore.Close(gtx, id,
+		core.ElevationPending, core.ElevationDenied, approver.Id(), comment))
+}
+
+func (ec *elevationCtl) End(gtx context.Context, id int64) error {
+	ev := core.NewEventAdder(gtx, "elevation.end", data.M{
+		"elevationId": id,
+	})
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	el, err := ec.estore.GetOne(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if el.UserId != user.Id() {
+		err := checkGrantor(gtx, el.Kind, el.Role, el.TargetId)
+		if err != nil {
+			return ev.Commit(err)
+		}
+	}
+
+	err = ec.estore.Close(
+		gtx, id, core.ElevationActive, core.ElevationEnded, user.Id(), "")
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if el.Kind == core.ElevateGroup {
+		err = core.GroupCtlr(gtx).RemoveFromGroup(gtx, el.UserId, el.TargetId)
+	}
+	return ev.Commit(err)
+}
+
+func (ec *elevationCtl) Active(
+	gtx context.Context, userId int64) ([]*core.Elevation, error) {
+	els, err := ec.estore.Active(gtx, userId)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "elevation.active", data.M{
+			"userId": userId,
+		}).Commit(err)
+	}
+	return els, nil
+}
+
+func (ec *elevationCtl) Expire(
+	gtx context.Context) ([]*core.Elevation, error) {
+	expired, err := ec.estore.Expire(gtx)
+	if err != nil {
+		return nil, core.NewEventAdder(
+			gtx, "elevation.expire", data.M{}).Commit(err)
+	}
+	for _, el := range expired {
+		core.NewEventAdder(gtx, "elevation.expired", data.M{
+			"elevationId": el.Id,
+			"userId":      el.UserId,
+			"kind":        el.Kind,
+			"role":        el.Role,
+			"targetId":    el.TargetId,
+		}).Commit(nil)
+	}
+	return expired, nil
+}
+
+// activate - starts the elevation. Group elevations become memberships that
+// end with the elevation, so they are removed by the membership sweeper
+// even if the elevation is not expired yet
+func (ec *elevationCtl) activate(
+	gtx context.Context,
+	el *core.Elevation,
+	id int64,
+	actorId *int64,
+	comment string) error {
+	expiresOn := time.Now().Add(time.Duration(el.Minutes) * time.Minute)
+	if el.Kind == core.ElevateGroup {
+		err := core.GroupCtlr(gtx).AddMembership(gtx, &core.Membership{
+			UserId:     el.UserId,
+			GroupId:    el.TargetId,
+			ValidUntil: &expiresOn,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return ec.estore.Activate(gtx, id, actorId, comment, expiresOn)
+}
+
+func (ec *elevationCtl) forDecision(
+	gtx context.Context, id int64) (*core.Elevation, *core.User, error) {
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	el, err := ec.estore.GetOne(gtx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if el.State != core.ElevationPending {
+		return nil, nil, errx.Errf(core.ErrInvalidState,
+			"elevation '%d' is already %s", id, el.State)
+	}
+	if el.UserId == user.Id() {
+		return nil, nil, errx.Errf(core.ErrUnauthorized,
+			"user '%s' cannot decide on own elevation", user.UName)
+	}
+	if user.Elevated(el.Kind) {
+		return nil, nil, errx.Errf(core.ErrUnauthorized,
+			"user '%s' cannot decide on a '%s' elevation while holding one",
+			user.UName, el.Kind)
+	}
+	if err := checkGrantor(gtx, el.Kind, el.Role, el.TargetId); err != nil {
+		return nil, nil, err
+	}
+	return el, user, nil
+}
+
+// checkGrantor - user in the context should be able to grant what the
+// elevation gives: a role up to own role for tenant admins, a group or admin
+// rights of a service for the admins of the service. Only the standing rights
+// count, so that an elevation cannot be used to hand out more elevations
+func checkGrantor(
+	gtx context.Context,
+	kind core.ElevationKind,
+	role auth.Role,
+	targetId int64) error {
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case core.ElevateRole:
+		standing := user.StandingRole()
+		if !core.RoleAtLeast(standing, core.TenantAdmin) ||
+			!core.RoleAtLeast(standing, role) {
+			return errx.Errf(core.ErrUnauthorized,
+				"user '%s' cannot grant role '%s'", user.UName, role)
+		}
+		return nil
+	case core.ElevateGroup:
+		group, err := core.GroupCtlr(gtx).GetOne(gtx, targetId)
+		if err != nil {
+			return err
+		}
+		return core.CheckStandingServiceAdmin(gtx, int64(group.ServiceId))
+	case core.ElevateServiceAdmin:
+		return core.CheckStandingServiceAdmin(gtx, targetId)
+	}
+	return errx.Errf(core.ErrInvalidState, "invalid elevation kind '%s'", kind)
+}
+
+// checkLister - elevations are visible to the user who holds them and to the
+// admins of the tenant
+func checkLister(gtx context.Context, userId int64) error {
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return err
+	}
+	if userId == user.Id() || user.TenantAdmin() {
+		return nil
+	}
+	return errx.Errf(core.ErrUnauthorized,
+		"user '%s' can only list own elevations", user.UName)
+}
+
+// RunElevationSweeper - expires the elevations that are past their expiry at
+// every interval
+func RunElevationSweeper(gtx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gtx.Done():
+			return
+		case <-ticker.C:
+			expired, err := core.ElevationCtlr(gtx).Expire(gtx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to expire elevations")
+				continue
+			}
+			log.Debug().Int("count", len(expired)).Msg("expired elevations")
+		}
+	}
+}
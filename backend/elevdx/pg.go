@@ -0,0 +1,279 @@
+package elevdx
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+const maxListed = 1000
+
+type PgElevationStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewElevationStorage(gd data.GetterDeleter) *PgElevationStorage {
+	return &PgElevationStorage{
+		gd: gd,
+	}
+}
+
+func (pes *PgElevationStorage) SaveEligibility(
+	gtx context.Context, el *core.Eligibility) (int64, error) {
+	query := `
+		INSERT INTO idx_eligibility (
+			created_by,
+			updated_by,
+			user_id,
+			kind,
+			role,
+			target_id,
+			max_minutes,
+			auto_approve
+		) VALUES (
+			:created_by,
+			:updated_by,
+			:user_id,
+			:kind,
+			:role,
+			:target_id,
+			:max_minutes,
+			:auto_approve
+		) RETURNING id;
+	`
+
+	stmt, err := pg.Conn().PrepareNamed(query)
+	if err != nil {
+		return -1, errx.Errf(err, "failed to prepare query to save eligibility")
+	}
+
+	var id int64
+	if err = stmt.GetContext(gtx, &id, el); err != nil {
+		return -1, errx.Errf(err,
+			"failed to insert eligibility of user '%d'", el.UserId)
+	}
+	return id, nil
+}
+
+func (pes *PgElevationStorage) GetEligibility(
+	gtx context.Context, id int64) (*core.Eligibility, error) {
+	var el core.Eligibility
+	err := pes.gd.GetOne(gtx, "idx_eligibility", "id", id, &el)
+	if err != nil {
+		return nil, errx.Wrap(err)
+	}
+	return &el, nil
+}
+
+func (pes *PgElevationStorage) RemoveEligibility(
+	gtx context.Context, id int64) error {
+	if err := pes.gd.Delete(gtx, "idx_eligibility", "id", id); err != nil {
+		return errx.Wrap(err)
+	}
+	return nil
+}
+
+func (pes *PgElevationStorage) GetEligibilities(
+	gtx context.Context, userId int64) ([]*core.Eligibility, error) {
+	query := `
+		SELECT * FROM idx_eligibility
+		WHERE user_id = $1
+		ORDER BY kind, role, target_id
+	`
+	els := make([]*core.Eligibility, 0, 10)
+	if err := pg.Conn().SelectContext(gtx, &els, query, userId); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get eligibilities of user '%d'", userId)
+	}
+	return els, nil
+}
+
+func (pes *PgElevationStorage) Create(
+	gtx context.Context, req *core.Elevation) (int64, error) {
+	const query = `
+		INSERT INTO idx_elevation (
+			eligibility_id,
+			user_id,
+			kind,
+			role,
+			target_id,
+			minutes,
+			reason
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7
+		) RETURNING id
+	`
+	var id int64
+	err := pg.Conn().GetContext(gtx, &id, query, req.EligibilityId,
+		req.UserId, req.Kind, req.Role, req.TargetId, req.Minutes, req.Reason)
+	if err != nil {
+		return -1, errx.Errf(err,
+			"failed to create elevation for user '%d'", req.UserId)
+	}
+	return id, nil
+}
+
+const selectElevations = `
+	SELECT
+		e.*,
+		u.user_name
+	FROM idx_elevation e
+	JOIN idx_user u ON u.id = e.user_id
+`
+
+func (pes *PgElevationStorage) GetOne(
+	gtx context.Context, id int64) (*core.Elevation, error) {
+	query := selectElevations + `WHERE e.id = $1 AND ` +
+		core.TenantCond(gtx, "u.tenant_id")
+	var el core.Elevation
+	if err := pg.Conn().GetContext(gtx, &el, query, id); err != nil {
+		return nil, errx.Errf(err, "failed to get elevation '%d'", id)
+	}
+	return &el, nil
+}
+
+func (pes *PgElevationStorage) Get(
+	gtx context.Context,
+	filter *core.ElevationFilter) ([]*core.Elevation, error) {
+
+	eq := squirrel.Eq{}
+	if filter.UserId != 0 {
+		eq["e.user_id"] = filter.UserId
+	}
+	if filter.State != "" {
+		eq["e.state"] = filter.State
+	}
+
+	query, args, err := squirrel.StatementBuilder.
+		PlaceholderFormat(squirrel.Dollar).
+		Select("e.*", "u.user_name").
+		From("idx_elevation e").
+		Join("idx_user u ON u.id = e.user_id").
+		Where(eq).
+		Where(core.TenantCond(gtx, "u.tenant_id")).
+		OrderBy("e.created_on DESC").
+		Limit(maxListed).
+		ToSql()
+	if err != nil {
+		return nil, errx.Errf(err, "failed to build elevation query")
+	}
+
+	els := make([]*core.Elevation, 0, 50)
+	if err := pg.Conn().SelectContext(gtx, &els, query, args...); err != nil {
+		return nil, errx.Errf(err, "failed to get elevations")
+	}
+	return els, nil
+}
+
+func (pes *PgElevationStorage) HasOpen(
+	gtx context.Context, eligibilityId int64) (bool, error) {
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM idx_elevation
+			WHERE eligibility_id = $1 AND state IN ('pending', 'active')
+		)
+	`
+	open := false
+	if err := pg.Conn().GetContext(gtx, &open, query, eligibilityId); err != nil {
+		return false, errx.Errf(err,
+			"failed to check open elevations of eligibility '%d'",
+			eligibilityId)
+	}
+	return open, nil
+}
+
+// Activate - starts a pending elevation, actor is nil for elevations that
+// are approved automatically
+func (pes *PgElevationStorage) Activate(
+	gtx context.Context,
+	id int64,
+	actorId *int64,
+	comment string,
+	expiresOn time.Time) error {
+	const query = `
+		UPDATE idx_elevation SET
+			state = 'active',
+			decided_by = $2,
+			decided_on = NOW(),
+			comment = $3,
+			expires_on = $4,
+			updated_on = NOW()
+		WHERE id = $1 AND state = 'pending'
+	`
+	res, err := pg.Conn().ExecContext(
+		gtx, query, id, actorId, comment, expiresOn)
+	if err != nil {
+		return errx.Errf(err, "failed to activate elevation '%d'", id)
+	}
+	if num, err := res.RowsAffected(); err != nil || num != 1 {
+		return errx.Errf(core.ErrInvalidState,
+			"elevation '%d' is not pending", id)
+	}
+	return nil
+}
+
+// Close - moves the elevation from the given state to a final state. Only
+// deciding on a pending elevation records the actor and the comment
+func (pes *PgElevationStorage) Close(
+	gtx context.Context,
+	id int64,
+	from, to core.ElevationState,
+	actorId int64,
+	comment string) error {
+	const query = `
+		UPDATE idx_elevation SET
+			state = $3,
+			decided_by = CASE WHEN $2 = 'pending' THEN $4 ELSE decided_by END,
+			decided_on = CASE WHEN $2 = 'pending' THEN NOW() ELSE decided_on END,
+			comment = CASE WHEN $2 = 'pending' THEN $5 ELSE comment END,
+			expires_on = CASE WHEN $2 = 'active' THEN NOW() ELSE expires_on END,
+			updated_on = NOW()
+		WHERE id = $1 AND state = $2
+	`
+	res, err := pg.Conn().ExecContext(gtx, query, id, from, to, actorId, comment)
+	if err != nil {
+		return errx.Errf(err, "failed to move elevation '%d' to '%s'", id, to)
+	}
+	if num, err := res.RowsAffected(); err != nil || num != 1 {
+		return errx.Errf(core.ErrInvalidState,
+			"elevation '%d' is not %s", id, from)
+	}
+	return nil
+}
+
+func (pes *PgElevationStorage) Active(
+	gtx context.Context, userId int64) ([]*core.Elevation, error) {
+	query := selectElevations + `
+		WHERE
+			e.user_id = $1 AND
+			e.state = 'active' AND
+			e.expires_on > NOW()
+	`
+	els := make([]*core.Elevation, 0, 4)
+	if err := pg.Conn().SelectContext(gtx, &els, query, userId); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get active elevations of user '%d'", userId)
+	}
+	return els, nil
+}
+
+func (pes *PgElevationStorage) Expire(
+	gtx context.Context) ([]*core.Elevation, error) {
+	query := `
+		UPDATE idx_elevation SET
+			state = 'expired',
+			updated_on = NOW()
+		WHERE state = 'active' AND expires_on <= NOW()
+		RETURNING *
+	`
+	expired := make([]*core.Elevation, 0, 20)
+	if err := pg.Conn().SelectContext(gtx, &expired, query); err != nil {
+		return nil, errx.Errf(err, "failed to expire elevations")
+	}
+	return expired, nil
+}
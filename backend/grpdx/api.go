@@ -4,10 +4,12 @@ import (
 	"context"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/varunamachi/idx/core"
 	"github.com/varunamachi/idx/userdx"
+	"github.com/varunamachi/libx/auth"
 	"github.com/varunamachi/libx/data"
 	"github.com/varunamachi/libx/errx"
 	"github.com/varunamachi/libx/httpx"
@@ -28,6 +30,21 @@ func GroupEndpoints(gtx context.Context) []*httpx.Endpoint {
 		getGroupPermissionsEp(gs),
 		addUserToGroups(gs),
 		removeUserFromGroup(gs),
+		addSubGroupEp(gs),
+		removeSubGroupEp(gs),
+		getSubGroupsEp(gs),
+		getMembersEp(gs),
+		getUserGroupsEp(gs),
+		getServiceUsersEp(gs),
+		addMembershipEp(gs),
+		getMembershipEp(gs),
+		extendMembershipEp(gs),
+		addOwnerEp(gs),
+		removeOwnerEp(gs),
+		getOwnersEp(gs),
+		getJoinableGroupsEp(gs),
+		joinGroupEp(gs),
+		leaveGroupEp(gs),
 	}
 }
 
@@ -139,10 +156,18 @@ func deleteGroupEp(gs core.GroupController) *httpx.Endpoint {
 	handler := func(etx echo.Context) error {
 		prmg := httpx.NewParamGetter(etx)
 		id := prmg.Int64("id")
+		dryRun := prmg.QueryBoolOr("dryRun", false)
 		if prmg.HasError() {
 			return prmg.BadReqError()
 		}
 
+		if dryRun {
+			return sendImpact(etx, gs, &core.AccessChange{
+				GroupId:     id,
+				RemoveGroup: true,
+			})
+		}
+
 		err := gs.Remove(etx.Request().Context(), id)
 		if err != nil {
 			return errx.Wrap(err)
@@ -222,6 +247,7 @@ func setGroupPermissionsEp(gs core.GroupController) *httpx.Endpoint {
 
 		pmg := httpx.NewParamGetter(etx)
 		groupId := pmg.Int64("groupId")
+		dryRun := pmg.QueryBoolOr("dryRun", false)
 		if pmg.HasError() {
 			return pmg.BadReqError()
 		}
@@ -231,6 +257,13 @@ func setGroupPermissionsEp(gs core.GroupController) *httpx.Endpoint {
 			return errx.BadReq("failed to read group info from request", err)
 		}
 
+		if dryRun {
+			return sendImpact(etx, gs, &core.AccessChange{
+				GroupId: groupId,
+				Perms:   perms,
+			})
+		}
+
 		err := gs.SetPermissions(etx.Request().Context(), groupId, perms)
 		if err != nil {
 			return errx.Wrap(err)
@@ -290,7 +323,78 @@ func addUserToGroups(gs core.GroupController) *httpx.Endpoint {
 			return errx.BadReq("failed to read group info from request", err)
 		}
 
-		err := gs.AddToGroups(etx.Request().Context(), userId, groupIds...)
+		gtx, err := memberManager(etx, PermModifyGroupPerm, groupIds...)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		if err := gs.AddToGroups(gtx, userId, groupIds...); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/group/:userId",
+		Category: "idx.group",
+		Desc:     "Add user to ne or more groups",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func removeUserFromGroup(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		userId := prmg.Int64("userId")
+		dryRun := prmg.QueryBoolOr("dryRun", false)
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		gtx, err := memberManager(etx, PermDeleteGroup, groupId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		if dryRun {
+			return sendImpact(etx, gs, &core.AccessChange{
+				GroupId:      groupId,
+				RemovedUsers: []int64{userId},
+			})
+		}
+
+		if err := gs.RemoveFromGroup(gtx, userId, groupId); err != nil {
+			return errx.Wrap(err)
+		}
+
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.DELETE,
+		Path:     "/group/:groupId/:userId",
+		Category: "idx.group",
+		Desc:     "Delete a group",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func addSubGroupEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		childId := prmg.Int64("childId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		err := gs.AddSubGroup(etx.Request().Context(), groupId, childId)
 		if err != nil {
 			return errx.Wrap(err)
 		}
@@ -299,39 +403,604 @@ func addUserToGroups(gs core.GroupController) *httpx.Endpoint {
 
 	return &httpx.Endpoint{
 		Method:      echo.PUT,
-		Path:        "/group/:userId",
+		Path:        "/group/:groupId/group/:childId",
 		Category:    "idx.group",
-		Desc:        "Add user to ne or more groups",
+		Desc:        "Add a group as a member of another group",
 		Version:     "v1",
 		Permissions: []string{PermModifyGroupPerm},
 		Handler:     handler,
 	}
 }
 
-func removeUserFromGroup(gs core.GroupController) *httpx.Endpoint {
+func removeSubGroupEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		childId := prmg.Int64("childId")
+		dryRun := prmg.QueryBoolOr("dryRun", false)
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if dryRun {
+			return sendImpact(etx, gs, &core.AccessChange{
+				GroupId:          groupId,
+				RemovedSubGroups: []int64{childId},
+			})
+		}
+
+		err := gs.RemoveSubGroup(etx.Request().Context(), groupId, childId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/group/:groupId/group/:childId",
+		Category:    "idx.group",
+		Desc:        "Remove a group from another group",
+		Version:     "v1",
+		Permissions: []string{PermModifyGroupPerm},
+		Handler:     handler,
+	}
+}
+
+// sendImpact - responds with the impact of the change instead of applying it,
+// used by the mutation endpoints when 'dryRun' is set
+func sendImpact(
+	etx echo.Context, gs core.GroupController, change *core.AccessChange) error {
+	impact, err := gs.PreviewChange(etx.Request().Context(), change)
+	if err != nil {
+		return errx.Wrap(err)
+	}
+	return httpx.SendJSON(etx, impact)
+}
+
+func getSubGroupsEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		groups, err := gs.GetSubGroups(etx.Request().Context(), groupId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, groups)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/group/:groupId/group",
+		Category:    "idx.group",
+		Desc:        "Get groups that are direct members of a group",
+		Version:     "v1",
+		Permissions: []string{PermGetGroup},
+		Handler:     handler,
+	}
+}
+
+func getMembersEp(gs core.GroupController) *httpx.Endpoint {
 	handler := func(etx echo.Context) error {
 		prmg := httpx.NewParamGetter(etx)
 		groupId := prmg.Int64("groupId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		cmnParams, err := rest.GetCommonParams(etx)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		members, err := gs.GetMembers(
+			etx.Request().Context(), groupId, cmnParams)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, members)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/group/:groupId/member",
+		Category:    "idx.group",
+		Desc:        "Get direct and inherited members of a group",
+		Version:     "v1",
+		Permissions: []string{PermGetGroup},
+		Handler:     handler,
+	}
+}
+
+func getUserGroupsEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
 		userId := prmg.Int64("userId")
+		serviceId := prmg.QueryInt64Or("serviceId", 0)
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		cmnParams, err := rest.GetCommonParams(etx)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		groups, err := gs.GetUserGroups(
+			etx.Request().Context(), userId, serviceId, cmnParams)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, groups)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/user/:userId/group",
+		Category:    "idx.group",
+		Desc:        "Get direct and inherited groups of a user",
+		Version:     "v1",
+		Permissions: []string{PermGetGroup},
+		Handler:     handler,
+	}
+}
+
+func getServiceUsersEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
 		if prmg.HasError() {
 			return prmg.BadReqError()
 		}
 
-		err := gs.RemoveFromGroup(etx.Request().Context(), userId, groupId)
+		cmnParams, err := rest.GetCommonParams(etx)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		users, err := gs.GetServiceUsers(
+			etx.Request().Context(), serviceId, cmnParams)
 		if err != nil {
 			return errx.Wrap(err)
 		}
+		return httpx.SendJSON(etx, users)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/service/:serviceId/member",
+		Category:    "idx.group",
+		Desc:        "Get users with access to a service",
+		Version:     "v1",
+		Permissions: []string{PermGetGroup},
+		Handler:     handler,
+	}
+}
 
+func addMembershipEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		userId := prmg.Int64("userId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var membership core.Membership
+		if err := etx.Bind(&membership); err != nil {
+			return errx.BadReq("failed to read membership from request", err)
+		}
+		membership.UserId = userId
+		membership.GroupId = groupId
+
+		gtx, err := memberManager(etx, PermModifyGroupPerm, groupId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		if err := gs.AddMembership(gtx, &membership); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/group/:groupId/member/:userId",
+		Category: "idx.group",
+		Desc:     "Add user to a group for a period of time",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getMembershipEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		userId := prmg.Int64("userId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		membership, err := gs.GetMembership(
+			etx.Request().Context(), userId, groupId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, membership)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/group/:groupId/member/:userId",
+		Category:    "idx.group",
+		Desc:        "Get membership of an user in a group",
+		Version:     "v1",
+		Permissions: []string{PermGetGroup},
+		Handler:     handler,
+	}
+}
+
+func extendMembershipEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		userId := prmg.Int64("userId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var validity struct {
+			ValidUntil *time.Time `json:"validUntil"`
+		}
+		if err := etx.Bind(&validity); err != nil {
+			return errx.BadReq("failed to read validity from request", err)
+		}
+
+		gtx, err := memberManager(etx, PermModifyGroupPerm, groupId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		err = gs.ExtendMembership(gtx, userId, groupId, validity.ValidUntil)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/group/:groupId/member/:userId/validity",
+		Category: "idx.group",
+		Desc:     "Extend membership of an user in a group",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func addOwnerEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		userId := prmg.Int64("userId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		err := gs.AddOwner(etx.Request().Context(), groupId, userId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/group/:groupId/owner/:userId",
+		Category:    "idx.group",
+		Desc:        "Make an user an owner of a group",
+		Version:     "v1",
+		Permissions: []string{PermModifyGroupPerm},
+		Handler:     handler,
+	}
+}
+
+func removeOwnerEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		userId := prmg.Int64("userId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		err := gs.RemoveOwner(etx.Request().Context(), groupId, userId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
 		return nil
 	}
 
 	return &httpx.Endpoint{
 		Method:      echo.DELETE,
-		Path:        "/group/:groupId/:userId",
+		Path:        "/group/:groupId/owner/:userId",
 		Category:    "idx.group",
-		Desc:        "Delete a group",
+		Desc:        "Remove an owner of a group",
 		Version:     "v1",
-		Permissions: []string{PermDeleteGroup},
+		Permissions: []string{PermModifyGroupPerm},
+		Handler:     handler,
+	}
+}
+
+func getOwnersEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		owners, err := gs.GetOwners(etx.Request().Context(), groupId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, owners)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/group/:groupId/owner",
+		Category:    "idx.group",
+		Desc:        "Get the owners of a group",
+		Version:     "v1",
+		Permissions: []string{PermGetGroup},
+		Handler:     handler,
+	}
+}
+
+func getJoinableGroupsEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		groups, err := gs.Joinable(etx.Request().Context(), serviceId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, groups)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/service/:serviceId/group/joinable",
+		Category: "idx.group",
+		Desc:     "Get the groups of a service that the user can join",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func joinGroupEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := gs.Join(etx.Request().Context(), groupId); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/group/:groupId/join",
+		Category: "idx.group",
+		Desc:     "Join an open group",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func leaveGroupEp(gs core.GroupController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		groupId := prmg.Int64("groupId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := gs.Leave(etx.Request().Context(), groupId); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/group/:groupId/leave",
+		Category: "idx.group",
+		Desc:     "Leave a group that is not closed",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+// memberManager - context to change the members of the groups in. Users
+// without the permission can only change the members of the groups they
+// own, their actions are recorded as owner actions
+func memberManager(
+	etx echo.Context,
+	perm string,
+	groupIds ...int64) (context.Context, error) {
+	gtx := etx.Request().Context()
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, err
+	}
+	if auth.HasPerms(user, perm) {
+		return gtx, nil
+	}
+
+	gs := core.GroupCtlr(gtx)
+	for _, groupId := range groupIds {
+		owner, err := gs.IsOwner(gtx, groupId, user.Id())
+		if err != nil {
+			return nil, err
+		}
+		if !owner {
+			return nil, errx.Errf(core.ErrUnauthorized,
+				"user '%s' does not own group '%d'", user.UName, groupId)
+		}
+	}
+	return core.AsGroupOwner(gtx, groupIds...), nil
+}
+
+func RoleTemplateEndpoints(gtx context.Context) []*httpx.Endpoint {
+	tc := core.RoleTemplateCtlr(gtx)
+	return []*httpx.Endpoint{
+		createRoleTemplateEp(tc),
+		updateRoleTemplateEp(tc),
+		getRoleTemplateEp(tc),
+		getRoleTemplatesEp(tc),
+		deleteRoleTemplateEp(tc),
+	}
+}
+
+func createRoleTemplateEp(tc core.RoleTemplateController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var tmpl core.RoleTemplate
+		if err := etx.Bind(&tmpl); err != nil {
+			return errx.BadReqX(err, "failed to read role template from request")
+		}
+
+		id, err := tc.Save(etx.Request().Context(), &tmpl)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, data.M{
+			"templateId": id,
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/role/template",
+		Category:    "idx.group",
+		Desc:        "Create a role template",
+		Version:     "v1",
+		Permissions: []string{PermManageRoleTemplate},
+		Handler:     handler,
+	}
+}
+
+func updateRoleTemplateEp(tc core.RoleTemplateController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var tmpl core.RoleTemplate
+		if err := etx.Bind(&tmpl); err != nil {
+			return errx.BadReqX(err, "failed to read role template from request")
+		}
+
+		if err := tc.Update(etx.Request().Context(), &tmpl); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/role/template",
+		Category:    "idx.group",
+		Desc:        "Update a role template",
+		Version:     "v1",
+		Permissions: []string{PermManageRoleTemplate},
+		Handler:     handler,
+	}
+}
+
+func getRoleTemplateEp(tc core.RoleTemplateController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		tmpl, err := tc.GetOne(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, tmpl)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/role/template/:id",
+		Category:    "idx.group",
+		Desc:        "Get a role template",
+		Version:     "v1",
+		Permissions: []string{PermGetGroup},
+		Handler:     handler,
+	}
+}
+
+func getRoleTemplatesEp(tc core.RoleTemplateController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		tmpls, err := tc.Get(etx.Request().Context())
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, tmpls)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/role/template",
+		Category:    "idx.group",
+		Desc:        "Get all role templates",
+		Version:     "v1",
+		Permissions: []string{PermGetGroup},
+		Handler:     handler,
+	}
+}
+
+func deleteRoleTemplateEp(tc core.RoleTemplateController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := tc.Remove(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return etx.String(http.StatusOK, strconv.FormatInt(id, 10))
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/role/template/:id",
+		Category:    "idx.group",
+		Desc:        "Delete a role template",
+		Version:     "v1",
+		Permissions: []string{PermManageRoleTemplate},
 		Handler:     handler,
 	}
 }
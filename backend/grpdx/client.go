@@ -149,3 +149,300 @@ func (c *Client) RemoveUserFromGroup(
 	// TODO - implement
 	return nil
 }
+
+func (c *Client) AddSubGroup(
+	gtx context.Context, parentId, childId int64) error {
+	apiRes := c.build().
+		Path("/api/v1/group", parentId, "group", childId).
+		Put(gtx, nil)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to add group '%d' to group '%d'",
+			childId, parentId)
+	}
+	return nil
+}
+
+func (c *Client) RemoveSubGroup(
+	gtx context.Context, parentId, childId int64) error {
+	apiRes := c.build().
+		Path("/api/v1/group", parentId, "group", childId).
+		Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to remove group '%d' from group '%d'",
+			childId, parentId)
+	}
+	return nil
+}
+
+func (c *Client) GetSubGroups(
+	gtx context.Context, groupId int64) ([]*core.Group, error) {
+	groups := make([]*core.Group, 0, 20)
+	apiRes := c.build().Path("/api/v1/group", groupId, "group").Get(gtx)
+	if err := apiRes.LoadClose(&groups); err != nil {
+		return nil, errx.Errf(
+			err, "failed to get sub groups of group: '%d'", groupId)
+	}
+	return groups, nil
+}
+
+func (c *Client) GetMembers(
+	gtx context.Context,
+	groupId int64,
+	params *data.CommonParams) ([]*core.GroupMember, error) {
+	members := make([]*core.GroupMember, 0, 100)
+	apiRes := c.build().
+		Path("/api/v1/group", groupId, "member").
+		CmnParam(params).
+		Get(gtx)
+	if err := apiRes.LoadClose(&members); err != nil {
+		return nil, errx.Errf(
+			err, "failed to get members of group: '%d'", groupId)
+	}
+	return members, nil
+}
+
+func (c *Client) GetUserGroups(
+	gtx context.Context,
+	userId, serviceId int64,
+	params *data.CommonParams) ([]*core.UserGroup, error) {
+	groups := make([]*core.UserGroup, 0, 50)
+	apiRes := c.build().
+		Path("/api/v1/user", userId, "group").
+		QInt("serviceId", serviceId).
+		CmnParam(params).
+		Get(gtx)
+	if err := apiRes.LoadClose(&groups); err != nil {
+		return nil, errx.Errf(err, "failed to get groups of user: '%d'", userId)
+	}
+	return groups, nil
+}
+
+func (c *Client) GetServiceUsers(
+	gtx context.Context,
+	serviceId int64,
+	params *data.CommonParams) ([]*core.ServiceUser, error) {
+	users := make([]*core.ServiceUser, 0, 100)
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "member").
+		CmnParam(params).
+		Get(gtx)
+	if err := apiRes.LoadClose(&users); err != nil {
+		return nil, errx.Errf(
+			err, "failed to get users of service: '%d'", serviceId)
+	}
+	return users, nil
+}
+
+func (c *Client) AddMembership(
+	gtx context.Context, membership *core.Membership) error {
+	apiRes := c.build().
+		Path("/api/v1/group", membership.GroupId, "member", membership.UserId).
+		Put(gtx, membership)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to add user '%d' to group '%d'",
+			membership.UserId, membership.GroupId)
+	}
+	return nil
+}
+
+func (c *Client) GetMembership(
+	gtx context.Context, userId, groupId int64) (*core.Membership, error) {
+	var membership core.Membership
+	apiRes := c.build().
+		Path("/api/v1/group", groupId, "member", userId).
+		Get(gtx)
+	if err := apiRes.LoadClose(&membership); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get membership of user '%d' in group '%d'",
+			userId, groupId)
+	}
+	return &membership, nil
+}
+
+func (c *Client) ExtendMembership(
+	gtx context.Context,
+	userId, groupId int64,
+	validUntil *time.Time) error {
+	apiRes := c.build().
+		Path("/api/v1/group", groupId, "member", userId, "validity").
+		Put(gtx, data.M{"validUntil": validUntil})
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to extend membership of user '%d' in group '%d'",
+			userId, groupId)
+	}
+	return nil
+}
+
+func (c *Client) AddGroupOwner(
+	gtx context.Context, groupId, userId int64) error {
+	apiRes := c.build().
+		Path("/api/v1/group", groupId, "owner", userId).
+		Put(gtx, nil)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to add user '%d' as owner of group '%d'",
+			userId, groupId)
+	}
+	return nil
+}
+
+func (c *Client) RemoveGroupOwner(
+	gtx context.Context, groupId, userId int64) error {
+	apiRes := c.build().
+		Path("/api/v1/group", groupId, "owner", userId).
+		Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to remove user '%d' as owner of group '%d'",
+			userId, groupId)
+	}
+	return nil
+}
+
+func (c *Client) GetGroupOwners(
+	gtx context.Context, groupId int64) ([]*core.GroupOwner, error) {
+	owners := make([]*core.GroupOwner, 0, 10)
+	apiRes := c.build().Path("/api/v1/group", groupId, "owner").Get(gtx)
+	if err := apiRes.LoadClose(&owners); err != nil {
+		return nil, errx.Errf(
+			err, "failed to get owners of group: '%d'", groupId)
+	}
+	return owners, nil
+}
+
+func (c *Client) GetJoinableGroups(
+	gtx context.Context, serviceId int64) ([]*core.JoinableGroup, error) {
+	groups := make([]*core.JoinableGroup, 0, 20)
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "group/joinable").
+		Get(gtx)
+	if err := apiRes.LoadClose(&groups); err != nil {
+		return nil, errx.Errf(
+			err, "failed to get joinable groups of service: '%d'", serviceId)
+	}
+	return groups, nil
+}
+
+func (c *Client) JoinGroup(gtx context.Context, groupId int64) error {
+	apiRes := c.build().Path("/api/v1/group", groupId, "join").Put(gtx, nil)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to join group '%d'", groupId)
+	}
+	return nil
+}
+
+func (c *Client) LeaveGroup(gtx context.Context, groupId int64) error {
+	apiRes := c.build().Path("/api/v1/group", groupId, "leave").Put(gtx, nil)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to leave group '%d'", groupId)
+	}
+	return nil
+}
+
+func (c *Client) PreviewRemoveGroup(
+	gtx context.Context, id int64) (*core.AccessImpact, error) {
+	apiRes := c.build().
+		Path("/api/v1/group", id).
+		QBool("dryRun", true).
+		Delete(gtx)
+	var impact core.AccessImpact
+	if err := apiRes.LoadClose(&impact); err != nil {
+		return nil, errx.Errf(err, "failed to preview removal of group '%d'", id)
+	}
+	return &impact, nil
+}
+
+func (c *Client) PreviewGroupPermissions(
+	gtx context.Context,
+	groupId int64,
+	perms []string) (*core.AccessImpact, error) {
+	apiRes := c.build().
+		Path("/api/v1/group", groupId, "perm").
+		QBool("dryRun", true).
+		Put(gtx, perms)
+	var impact core.AccessImpact
+	if err := apiRes.LoadClose(&impact); err != nil {
+		return nil, errx.Errf(err,
+			"failed to preview permissions of group '%d'", groupId)
+	}
+	return &impact, nil
+}
+
+func (c *Client) PreviewRemoveFromGroup(
+	gtx context.Context, userId, groupId int64) (*core.AccessImpact, error) {
+	apiRes := c.build().
+		Path("/api/v1/group", groupId, userId).
+		QBool("dryRun", true).
+		Delete(gtx)
+	var impact core.AccessImpact
+	if err := apiRes.LoadClose(&impact); err != nil {
+		return nil, errx.Errf(err,
+			"failed to preview removal of user '%d' from group '%d'",
+			userId, groupId)
+	}
+	return &impact, nil
+}
+
+func (c *Client) PreviewRemoveSubGroup(
+	gtx context.Context, parentId, childId int64) (*core.AccessImpact, error) {
+	apiRes := c.build().
+		Path("/api/v1/group", parentId, "group", childId).
+		QBool("dryRun", true).
+		Delete(gtx)
+	var impact core.AccessImpact
+	if err := apiRes.LoadClose(&impact); err != nil {
+		return nil, errx.Errf(err,
+			"failed to preview removal of group '%d' from group '%d'",
+			childId, parentId)
+	}
+	return &impact, nil
+}
+
+func (c *Client) CreateRoleTemplate(
+	gtx context.Context, tmpl *core.RoleTemplate) (int64, error) {
+	apiRes := c.build().Path("/api/v1/role/template").Post(gtx, tmpl)
+	res := map[string]int64{"templateId": int64(-1)}
+	if err := apiRes.LoadClose(&res); err != nil {
+		return -1, errx.Errf(err,
+			"failed to create role template: '%s'", tmpl.Name)
+	}
+	return res["templateId"], nil
+}
+
+func (c *Client) UpdateRoleTemplate(
+	gtx context.Context, tmpl *core.RoleTemplate) error {
+	apiRes := c.build().Path("/api/v1/role/template").Put(gtx, tmpl)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to update role template: '%s'", tmpl.Name)
+	}
+	return nil
+}
+
+func (c *Client) GetRoleTemplate(
+	gtx context.Context, id int64) (*core.RoleTemplate, error) {
+	var tmpl core.RoleTemplate
+	apiRes := c.build().Path("/api/v1/role/template", id).Get(gtx)
+	if err := apiRes.LoadClose(&tmpl); err != nil {
+		return nil, errx.Errf(err, "failed to get role template: '%d'", id)
+	}
+	return &tmpl, nil
+}
+
+func (c *Client) GetRoleTemplates(
+	gtx context.Context) ([]*core.RoleTemplate, error) {
+	tmpls := make([]*core.RoleTemplate, 0, 20)
+	apiRes := c.build().Path("/api/v1/role/template").Get(gtx)
+	if err := apiRes.LoadClose(&tmpls); err != nil {
+		return nil, errx.Errf(err, "failed to get role templates")
+	}
+	return tmpls, nil
+}
+
+func (c *Client) RemoveRoleTemplate(gtx context.Context, id int64) error {
+	apiRes := c.build().Path("/api/v1/role/template", id).Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to delete role template: '%d'", id)
+	}
+	return nil
+}
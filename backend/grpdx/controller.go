@@ -2,9 +2,13 @@ package grpdx
 
 import (
 	"context"
+	"time"
 
+	"github.com/rs/zerolog/log"
 	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/idx/mailtmpl"
 	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
 )
 
 type groupCtl struct {
@@ -30,6 +34,9 @@ func (gc *groupCtl) Save(
 	ev := core.NewEventAdder(gtx, "group.save", data.M{
 		"group": group,
 	})
+	if err := checkJoinPolicy(group); err != nil {
+		return -1, ev.Commit(err)
+	}
 	id, err := gc.gstore.Save(gtx, group)
 	if err != nil {
 		return id, ev.Commit(err)
@@ -51,12 +58,22 @@ func (gc *groupCtl) SaveWithPerms(
 		"group": group,
 	})
 
+	if err := checkJoinPolicy(group); err != nil {
+		return -1, ev.Commit(err)
+	}
+	err := core.ServiceCtlr(gtx).ValidatePermissions(
+		gtx, int64(group.ServiceId), perms)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+
 	id, err := gc.gstore.Save(gtx, group)
 	if err != nil {
 		return id, ev.Commit(err)
 	}
 
-	if err := gc.gstore.SetPermissions(gtx, group.Id, perms); err != nil {
+	group.Id = id
+	if err := gc.gstore.SetPermissions(gtx, id, perms); err != nil {
 		return id, ev.Commit(err)
 	}
 
@@ -67,14 +84,21 @@ func (gc *groupCtl) Update(gtx context.Context, group *core.Group) error {
 	ev := core.NewEventAdder(gtx, "group.update", data.M{
 		"group": group,
 	})
+	if err := checkJoinPolicy(group); err != nil {
+		return ev.Commit(err)
+	}
 	if err := gc.gstore.Update(gtx, group); err != nil {
 		return ev.Commit(err)
 	}
+	core.NotifyProvisioning(gtx, core.ProvGroup, group.Id)
 	return ev.Commit(nil)
 }
 
 func (gc *groupCtl) GetOne(gtx context.Context, id int64) (*core.Group, error) {
 	group, err := gc.gstore.GetOne(gtx, id)
+	if err == nil {
+		err = gc.withOwners(gtx, group)
+	}
 	if err != nil {
 		return nil, core.NewEventAdder(gtx, "group.getOne", data.M{
 			"groupId": id,
@@ -87,9 +111,15 @@ func (gc *groupCtl) Remove(gtx context.Context, id int64) error {
 	ev := core.NewEventAdder(gtx, "group.remove", data.M{
 		"groupId": id,
 	})
+	members, err := gc.gstore.MemberIds(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
 	if err := gc.gstore.Remove(gtx, id); err != nil {
 		return ev.Commit(err)
 	}
+	core.NotifyProvisioning(gtx, core.ProvGroup, id)
+	core.NotifyProvisioning(gtx, core.ProvUser, members...)
 	return ev.Commit(nil)
 }
 
@@ -98,6 +128,9 @@ func (gc *groupCtl) Get(
 	params *data.CommonParams) ([]*core.Group, error) {
 
 	group, err := gc.gstore.Get(gtx, params)
+	if err == nil {
+		err = gc.withOwners(gtx, group...)
+	}
 	if err != nil {
 		return nil, core.NewEventAdder(gtx, "group.get", data.M{
 			"params": params,
@@ -106,6 +139,17 @@ func (gc *groupCtl) Get(
 	return group, nil
 }
 
+func (gc *groupCtl) GetForService(
+	gtx context.Context, serviceId int64) ([]*core.Group, error) {
+	groups, err := gc.gstore.GetForService(gtx, serviceId)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "group.getForService", data.M{
+			"serviceId": serviceId,
+		}).Commit(err)
+	}
+	return groups, nil
+}
+
 func (gc *groupCtl) Exists(gtx context.Context, id int64) (bool, error) {
 	group, err := gc.gstore.Exists(gtx, id)
 	if err != nil {
@@ -136,6 +180,20 @@ func (gc *groupCtl) SetPermissions(
 		"perms":   perms,
 	})
 
+	group, err := gc.gstore.GetOne(gtx, groupId)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	err = core.ServiceCtlr(gtx).ValidatePermissions(
+		gtx, int64(group.ServiceId), perms)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	err = gc.checkSod(gtx, &core.AccessChange{GroupId: groupId, Perms: perms})
+	if err != nil {
+		return ev.Commit(err)
+	}
+
 	if err := gc.gstore.SetPermissions(gtx, groupId, perms); err != nil {
 		return ev.Commit(err)
 	}
@@ -157,7 +215,21 @@ func (gc *groupCtl) GetPermissions(
 
 func (gc *groupCtl) AddToGroups(
 	gtx context.Context, userId int64, groupId ...int64) error {
-	err := gc.gstore.AddToGroups(gtx, userId, groupId...)
+	changes := make([]*core.AccessChange, 0, len(groupId))
+	for _, id := range groupId {
+		changes = append(changes, &core.AccessChange{
+			GroupId:    id,
+			AddedUsers: []int64{userId},
+		})
+	}
+	err := gc.checkSod(gtx, changes...)
+	if err == nil {
+		err = gc.gstore.AddToGroups(gtx, userId, groupId...)
+	}
+	if err == nil {
+		core.NotifyProvisioning(gtx, core.ProvUser, userId)
+		core.NotifyProvisioning(gtx, core.ProvGroup, groupId...)
+	}
 	return core.NewEventAdder(gtx, "user.addToGroup", data.M{
 		"userId":  userId,
 		"groupId": groupId,
@@ -167,8 +239,551 @@ func (gc *groupCtl) AddToGroups(
 func (gc *groupCtl) RemoveFromGroup(
 	gtx context.Context, userId, groupId int64) error {
 	err := gc.gstore.RemoveFromGroup(gtx, userId, groupId)
+	if err == nil {
+		core.NotifyProvisioning(gtx, core.ProvUser, userId)
+		core.NotifyProvisioning(gtx, core.ProvGroup, groupId)
+	}
 	return core.NewEventAdder(gtx, "user.removeFromGroup", data.M{
 		"userId":  userId,
 		"groupId": groupId,
 	}).Commit(err)
 }
+
+func (gc *groupCtl) Joinable(
+	gtx context.Context, serviceId int64) ([]*core.JoinableGroup, error) {
+	ev := core.NewEventAdder(gtx, "group.joinable", data.M{
+		"serviceId": serviceId,
+	})
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	groups, err := gc.gstore.Joinable(gtx, serviceId, user.Id())
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return groups, nil
+}
+
+func (gc *groupCtl) Join(gtx context.Context, groupId int64) error {
+	ev := core.NewEventAdder(gtx, "group.join", data.M{
+		"groupId": groupId,
+	})
+	user, group, err := gc.selfService(gtx, groupId, core.JoinOpen)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	member, err := gc.gstore.IsMember(gtx, user.Id(), groupId)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if member {
+		return ev.Errf(core.ErrInvalidState,
+			"user '%s' is already a member of group '%s'",
+			user.UName, group.Name)
+	}
+
+	err = gc.AddMembership(gtx, &core.Membership{
+		UserId:  user.Id(),
+		GroupId: groupId,
+	})
+	if err != nil {
+		return ev.Commit(err)
+	}
+	gc.notifyOwners(gtx, group, user, true)
+	return ev.Commit(nil)
+}
+
+func (gc *groupCtl) Leave(gtx context.Context, groupId int64) error {
+	ev := core.NewEventAdder(gtx, "group.leave", data.M{
+		"groupId": groupId,
+	})
+	user, group, err := gc.selfService(
+		gtx, groupId, core.JoinOpen, core.JoinRequest)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	member, err := gc.gstore.IsMember(gtx, user.Id(), groupId)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if !member {
+		return ev.Errf(core.ErrInvalidState,
+			"user '%s' is not a member of group '%s'", user.UName, group.Name)
+	}
+
+	if err := gc.RemoveFromGroup(gtx, user.Id(), groupId); err != nil {
+		return ev.Commit(err)
+	}
+	gc.notifyOwners(gtx, group, user, false)
+	return ev.Commit(nil)
+}
+
+// selfService - user in the context and the group, if the policy of the group
+// is one of the given policies
+func (gc *groupCtl) selfService(
+	gtx context.Context,
+	groupId int64,
+	policies ...core.JoinPolicy) (*core.User, *core.Group, error) {
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	group, err := gc.gstore.GetOne(gtx, groupId)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, policy := range policies {
+		if group.JoinPolicy == policy {
+			return user, group, nil
+		}
+	}
+	return nil, nil, errx.Errf(core.ErrInvalidState,
+		"group '%s' does not allow this with join policy '%s'",
+		group.Name, group.JoinPolicy)
+}
+
+// notifyOwners - mails the owners of the group about the user joining or
+// leaving it, failures are only logged
+func (gc *groupCtl) notifyOwners(
+	gtx context.Context, group *core.Group, user *core.User, joined bool) {
+	if !group.NotifyOwners {
+		return
+	}
+	owners, err := gc.gstore.GetOwners(gtx, group.Id)
+	if err != nil {
+		log.Error().Err(err).Int64("groupId", group.Id).
+			Msg("failed to get owners to notify about membership change")
+		return
+	}
+	for _, owner := range owners[group.Id] {
+		ou, err := core.UserCtlr(gtx).GetOne(gtx, owner.UserId)
+		if err == nil {
+			err = core.SendSimpleMail(gtx, ou.EmailId,
+				mailtmpl.GroupMemberChangedTemplate, data.M{
+					"userName":  user.UName,
+					"groupName": group.Name,
+					"joined":    joined,
+				})
+		}
+		if err != nil {
+			log.Error().Err(err).
+				Int64("ownerId", owner.UserId).
+				Int64("groupId", group.Id).
+				Msg("failed to notify owner about membership change")
+		}
+	}
+}
+
+func checkJoinPolicy(group *core.Group) error {
+	switch group.JoinPolicy {
+	case "":
+		group.JoinPolicy = core.JoinRequest
+	case core.JoinClosed, core.JoinRequest, core.JoinOpen:
+	default:
+		return errx.Errf(core.ErrInvalidState,
+			"invalid join policy '%s' for group '%s'",
+			group.JoinPolicy, group.Name)
+	}
+	return nil
+}
+
+func (gc *groupCtl) AddOwner(
+	gtx context.Context, groupId, userId int64) error {
+	ev := core.NewEventAdder(gtx, "group.addOwner", data.M{
+		"groupId": groupId,
+		"userId":  userId,
+	})
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if _, err := gc.gstore.GetOne(gtx, groupId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(gc.gstore.AddOwner(gtx, groupId, userId, user.Id()))
+}
+
+func (gc *groupCtl) RemoveOwner(
+	gtx context.Context, groupId, userId int64) error {
+	ev := core.NewEventAdder(gtx, "group.removeOwner", data.M{
+		"groupId": groupId,
+		"userId":  userId,
+	})
+	if _, err := gc.gstore.GetOne(gtx, groupId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(gc.gstore.RemoveOwner(gtx, groupId, userId))
+}
+
+func (gc *groupCtl) GetOwners(
+	gtx context.Context, groupId int64) ([]*core.GroupOwner, error) {
+	group, err := gc.GetOne(gtx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	return group.Owners, nil
+}
+
+func (gc *groupCtl) IsOwner(
+	gtx context.Context, groupId, userId int64) (bool, error) {
+	owner, err := gc.gstore.IsOwner(gtx, groupId, userId)
+	if err != nil {
+		return false, core.NewEventAdder(gtx, "group.isOwner", data.M{
+			"groupId": groupId,
+			"userId":  userId,
+		}).Commit(err)
+	}
+	return owner, nil
+}
+
+// withOwners - fills the owners of the groups
+func (gc *groupCtl) withOwners(
+	gtx context.Context, groups ...*core.Group) error {
+	ids := make([]int64, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.Id)
+	}
+	owners, err := gc.gstore.GetOwners(gtx, ids...)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		group.Owners = owners[group.Id]
+		if group.Owners == nil {
+			group.Owners = []*core.GroupOwner{}
+		}
+	}
+	return nil
+}
+
+func (gc *groupCtl) AddSubGroup(
+	gtx context.Context, parentId, childId int64) error {
+	ev := core.NewEventAdder(gtx, "group.addSubGroup", data.M{
+		"parentId": parentId,
+		"childId":  childId,
+	})
+
+	parent, err := gc.gstore.GetOne(gtx, parentId)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	child, err := gc.gstore.GetOne(gtx, childId)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if parent.ServiceId != child.ServiceId {
+		return ev.Errf(core.ErrInvalidState,
+			"groups '%s' and '%s' belong to different services",
+			parent.Name, child.Name)
+	}
+
+	err = gc.checkSod(gtx, &core.AccessChange{
+		GroupId:        parentId,
+		AddedSubGroups: []int64{childId},
+	})
+	if err != nil {
+		return ev.Commit(err)
+	}
+
+	if err := gc.gstore.AddSubGroup(gtx, parentId, childId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(nil)
+}
+
+func (gc *groupCtl) RemoveSubGroup(
+	gtx context.Context, parentId, childId int64) error {
+	ev := core.NewEventAdder(gtx, "group.removeSubGroup", data.M{
+		"parentId": parentId,
+		"childId":  childId,
+	})
+	if err := gc.gstore.RemoveSubGroup(gtx, parentId, childId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(nil)
+}
+
+func (gc *groupCtl) PreviewChange(
+	gtx context.Context, change *core.AccessChange) (*core.AccessImpact, error) {
+	group, err := gc.gstore.GetOne(gtx, change.GroupId)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "group.previewChange", data.M{
+			"change": change,
+		}).Commit(err)
+	}
+	// Sub groups belong to the service of their parent, so the change does
+	// not reach beyond the service of the group
+	return core.ServiceCtlr(gtx).PreviewImpact(
+		gtx, int64(group.ServiceId), change)
+}
+
+func (gc *groupCtl) GetSubGroups(
+	gtx context.Context, groupId int64) ([]*core.Group, error) {
+	groups, err := gc.gstore.GetSubGroups(gtx, groupId)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "group.getSubGroups", data.M{
+			"groupId": groupId,
+		}).Commit(err)
+	}
+	return groups, nil
+}
+
+func (gc *groupCtl) GetMembers(
+	gtx context.Context,
+	groupId int64,
+	params *data.CommonParams) ([]*core.GroupMember, error) {
+	members, err := gc.gstore.GetMembers(gtx, groupId, params)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "group.getMembers", data.M{
+			"groupId": groupId,
+		}).Commit(err)
+	}
+	return members, nil
+}
+
+func (gc *groupCtl) GetUserGroups(
+	gtx context.Context,
+	userId, serviceId int64,
+	params *data.CommonParams) ([]*core.UserGroup, error) {
+	groups, err := gc.gstore.GetUserGroups(gtx, userId, serviceId, params)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "group.getUserGroups", data.M{
+			"userId":    userId,
+			"serviceId": serviceId,
+		}).Commit(err)
+	}
+	return groups, nil
+}
+
+func (gc *groupCtl) GetServiceUsers(
+	gtx context.Context,
+	serviceId int64,
+	params *data.CommonParams) ([]*core.ServiceUser, error) {
+	users, err := gc.gstore.GetServiceUsers(gtx, serviceId, params)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "group.getServiceUsers", data.M{
+			"serviceId": serviceId,
+		}).Commit(err)
+	}
+	return users, nil
+}
+
+func (gc *groupCtl) AddMembership(
+	gtx context.Context, membership *core.Membership) error {
+	ev := core.NewEventAdder(gtx, "user.addToGroup", data.M{
+		"membership": membership,
+	})
+
+	if membership.ValidFrom.IsZero() {
+		membership.ValidFrom = time.Now()
+	}
+	if membership.ValidUntil != nil &&
+		!membership.ValidUntil.After(membership.ValidFrom) {
+		return ev.Errf(core.ErrInvalidState,
+			"membership of user '%d' in group '%d' ends before it starts",
+			membership.UserId, membership.GroupId)
+	}
+
+	err := gc.checkSod(gtx, &core.AccessChange{
+		GroupId:    membership.GroupId,
+		AddedUsers: []int64{membership.UserId},
+	})
+	if err != nil {
+		return ev.Commit(err)
+	}
+
+	if err := gc.gstore.AddMembership(gtx, membership); err != nil {
+		return ev.Commit(err)
+	}
+	core.NotifyProvisioning(gtx, core.ProvUser, membership.UserId)
+	core.NotifyProvisioning(gtx, core.ProvGroup, membership.GroupId)
+	return ev.Commit(nil)
+}
+
+func (gc *groupCtl) GetMembership(
+	gtx context.Context, userId, groupId int64) (*core.Membership, error) {
+	membership, err := gc.gstore.GetMembership(gtx, userId, groupId)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "group.getMembership", data.M{
+			"userId":  userId,
+			"groupId": groupId,
+		}).Commit(err)
+	}
+	return membership, nil
+}
+
+func (gc *groupCtl) ExtendMembership(
+	gtx context.Context,
+	userId, groupId int64,
+	validUntil *time.Time) error {
+	ev := core.NewEventAdder(gtx, "group.extendMembership", data.M{
+		"userId":     userId,
+		"groupId":    groupId,
+		"validUntil": validUntil,
+	})
+
+	membership, err := gc.gstore.GetMembership(gtx, userId, groupId)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if validUntil != nil {
+		if !validUntil.After(time.Now()) {
+			return ev.Errf(core.ErrInvalidState,
+				"membership can only be extended to a time in future")
+		}
+		if !validUntil.After(membership.ValidFrom) {
+			return ev.Errf(core.ErrInvalidState,
+				"membership of user '%d' in group '%d' ends before it starts",
+				userId, groupId)
+		}
+	}
+
+	err = gc.gstore.ExtendMembership(gtx, userId, groupId, validUntil)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(nil)
+}
+
+func (gc *groupCtl) ExpireMemberships(
+	gtx context.Context) ([]*core.Membership, error) {
+	expired, err := gc.gstore.ExpireMemberships(gtx)
+	if err != nil {
+		return nil, core.NewEventAdder(
+			gtx, "group.expireMemberships", data.M{}).Commit(err)
+	}
+
+	for _, m := range expired {
+		core.NewEventAdder(gtx, "group.membershipExpired", data.M{
+			"userId":     m.UserId,
+			"groupId":    m.GroupId,
+			"validFrom":  m.ValidFrom,
+			"validUntil": m.ValidUntil,
+		}).Commit(nil)
+		core.NotifyProvisioning(gtx, core.ProvUser, m.UserId)
+		core.NotifyProvisioning(gtx, core.ProvGroup, m.GroupId)
+	}
+	return expired, nil
+}
+
+func (gc *groupCtl) WarnExpiring(
+	gtx context.Context, within time.Duration) (int, error) {
+	expiring, err := gc.gstore.Expiring(gtx, time.Now().Add(within))
+	if err != nil {
+		return 0, core.NewEventAdder(gtx, "group.warnExpiring", data.M{
+			"within": within.String(),
+		}).Commit(err)
+	}
+
+	admins := map[int64][]*core.User{}
+	num := 0
+	for _, m := range expiring {
+		svcAdmins, found := admins[m.ServiceId]
+		if !found {
+			svcAdmins, err = core.ServiceCtlr(gtx).GetAdmins(gtx, m.ServiceId)
+			if err != nil {
+				log.Error().Err(err).Int64("serviceId", m.ServiceId).
+					Msg("failed to get admins for membership expiry warning")
+				continue
+			}
+			admins[m.ServiceId] = svcAdmins
+		}
+
+		// Warning is retried in the next sweep unless the member is notified,
+		// failing to notify an admin is only logged
+		if err := sendExpiryWarning(gtx, m, m.Email, false); err != nil {
+			log.Error().Err(err).
+				Int64("userId", m.UserId).
+				Int64("groupId", m.GroupId).
+				Msg("failed to warn user about membership expiry")
+			continue
+		}
+		for _, admin := range svcAdmins {
+			if err := sendExpiryWarning(gtx, m, admin.EmailId, true); err != nil {
+				log.Error().Err(err).
+					Int64("adminId", admin.Id()).
+					Int64("groupId", m.GroupId).
+					Msg("failed to warn admin about membership expiry")
+			}
+		}
+
+		if err := gc.gstore.MarkWarned(gtx, m.UserId, m.GroupId); err != nil {
+			return num, err
+		}
+		num++
+	}
+	return num, nil
+}
+
+func sendExpiryWarning(
+	gtx context.Context,
+	m *expiringMembership,
+	to string,
+	forAdmin bool) error {
+	err := core.SendSimpleMail(gtx, to, mailtmpl.MembershipExpiringTemplate,
+		data.M{
+			"userName":   m.UserName,
+			"groupName":  m.GroupName,
+			"validUntil": m.ValidUntil.Format(time.RFC1123),
+			"forAdmin":   forAdmin,
+		})
+	if err != nil {
+		return errx.Errf(err, "failed to send membership expiry warning to '%s'",
+			to)
+	}
+	return nil
+}
+
+// checkSod - checks the changes against the segregation of duties constraints
+// of the services of the changed groups
+func (gc *groupCtl) checkSod(
+	gtx context.Context, changes ...*core.AccessChange) error {
+	byService := map[int64][]*core.AccessChange{}
+	for _, change := range changes {
+		group, err := gc.gstore.GetOne(gtx, change.GroupId)
+		if err != nil {
+			return err
+		}
+		serviceId := int64(group.ServiceId)
+		byService[serviceId] = append(byService[serviceId], change)
+	}
+	for serviceId, changes := range byService {
+		err := core.SodCtlr(gtx).Check(gtx, serviceId, changes...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunMembershipSweeper - removes expired memberships and warns about the ones
+// expiring within warnBefore at every interval
+func RunMembershipSweeper(
+	gtx context.Context, interval, warnBefore time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gtx.Done():
+			return
+		case <-ticker.C:
+			gc := core.GroupCtlr(gtx)
+			expired, err := gc.ExpireMemberships(gtx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to remove expired memberships")
+			} else {
+				log.Debug().Int("count", len(expired)).
+					Msg("removed expired memberships")
+			}
+
+			num, err := gc.WarnExpiring(gtx, warnBefore)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to warn expiring memberships")
+				continue
+			}
+			log.Debug().Int("count", num).Msg("warned expiring memberships")
+		}
+	}
+}
@@ -5,4 +5,6 @@ const (
 	PermDeleteGroup     = "idx.deleteGroup"
 	PermGetGroup        = "idx.getGroup"
 	PermModifyGroupPerm = "idx.modifyGroupPermTree"
+
+	PermManageRoleTemplate = "idx.manageRoleTemplate"
 )
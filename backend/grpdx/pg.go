@@ -3,6 +3,9 @@ package grpdx
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/varunamachi/idx/core"
@@ -23,28 +26,41 @@ func NewGroupStorage(gd data.GetterDeleter) *PgGroupStorage {
 
 func (pgs PgGroupStorage) Save(
 	gtx context.Context, group *core.Group) (int64, error) {
+	// Group belongs to the tenant of its service, which has to be in scope
 	query := `
 		INSERT INTO idx_group (
+			tenant_id,
 			created_by,
 			updated_by,
 			service_id,
 			name,
 			display_name,
-			description
+			description,
+			join_policy,
+			notify_owners
 		) VALUES (
+			(
+				SELECT tenant_id FROM idx_service
+				WHERE id = :service_id AND ` +
+		core.TenantCond(gtx, "tenant_id") + `
+			),
 			:created_by,
 			:updated_by,
 			:service_id,
 			:name,
 			:display_name,
-			:description
+			:description,
+			:join_policy,
+			:notify_owners
 		) ON CONFLICT (id) DO UPDATE SET
 				created_by = EXCLUDED.created_by,
 				updated_by = EXCLUDED.updated_by,
 				service_id = EXCLUDED.service_id,
 				name = EXCLUDED.name,
 				display_name = EXCLUDED.display_name,
-				description = EXCLUDED.description
+				description = EXCLUDED.description,
+				join_policy = EXCLUDED.join_policy,
+				notify_owners = EXCLUDED.notify_owners
 		RETURNING id;
 	`
 
@@ -75,9 +91,14 @@ func (pgs PgGroupStorage) Update(gtx context.Context, group *core.Group) error {
 			service_id = :service_id,
 			name = :name,
 			display_name = :display_name,
-			description = :description
-		WHERE id = :id
-	`
+			description = :description,
+			join_policy = :join_policy,
+			notify_owners = :notify_owners
+		WHERE
+			id = :id AND
+			tenant_id = (
+				SELECT tenant_id FROM idx_service WHERE id = :service_id
+			) AND ` + core.TenantCond(gtx, "tenant_id")
 	if _, err := pg.Conn().NamedExecContext(gtx, query, group); err != nil {
 		return errx.Errf(
 			err, "failed to insert user '%s' to database", group.Id)
@@ -89,7 +110,8 @@ func (pgs PgGroupStorage) Update(gtx context.Context, group *core.Group) error {
 func (pgs PgGroupStorage) GetOne(
 	gtx context.Context, id int64) (*core.Group, error) {
 	var group core.Group
-	err := pgs.gd.GetOne(gtx, "idx_group", "id", id, &group)
+	err := pgs.gd.GetOne(
+		gtx, core.TenantTable(gtx, "idx_group"), "id", id, &group)
 	if err != nil {
 		return nil, err
 	}
@@ -97,9 +119,10 @@ func (pgs PgGroupStorage) GetOne(
 }
 
 func (pgs PgGroupStorage) Remove(gtx context.Context, id int64) error {
-	err := pgs.gd.Delete(gtx, "idx_group", "id", id)
-	if err != nil {
-		return errx.Wrap(err)
+	query := `DELETE FROM idx_group WHERE id = $1 AND ` +
+		core.TenantCond(gtx, "tenant_id")
+	if _, err := pg.Conn().ExecContext(gtx, query, id); err != nil {
+		return errx.Errf(err, "failed to remove group '%d'", id)
 	}
 	return nil
 }
@@ -107,21 +130,65 @@ func (pgs PgGroupStorage) Remove(gtx context.Context, id int64) error {
 func (pgs PgGroupStorage) Get(
 	gtx context.Context, params *data.CommonParams) ([]*core.Group, error) {
 	groups := make([]*core.Group, 0, params.PageSize)
-	err := pgs.gd.Get(gtx, "idx_group", params, &groups)
+	err := pgs.gd.Get(gtx, core.TenantTable(gtx, "idx_group"), params, &groups)
 	if err != nil {
 		return nil, err
 	}
 	return groups, nil
 }
 
+func (pgs PgGroupStorage) GetForService(
+	gtx context.Context, serviceId int64) ([]*core.Group, error) {
+	query := `
+		SELECT * FROM idx_group
+		WHERE service_id = $1 AND ` + core.TenantCond(gtx, "tenant_id") + `
+		ORDER BY name
+	`
+	groups := make([]*core.Group, 0, 20)
+	err := pg.Conn().SelectContext(gtx, &groups, query, serviceId)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get groups of service '%d'", serviceId)
+	}
+	return groups, nil
+}
+
+// Joinable - groups of the service that are not closed, along with whether
+// the user is a direct member of them
+func (pgs *PgGroupStorage) Joinable(
+	gtx context.Context,
+	serviceId, userId int64) ([]*core.JoinableGroup, error) {
+	query := `
+		SELECT
+			g.*,
+			EXISTS(
+				SELECT 1 FROM user_to_group ug
+				WHERE ug.group_id = g.id AND ug.user_id = $2
+			) AS member
+		FROM idx_group g
+		WHERE
+			g.service_id = $1 AND
+			g.join_policy <> 'closed' AND ` +
+		core.TenantCond(gtx, "g.tenant_id") + `
+		ORDER BY g.name
+	`
+	groups := make([]*core.JoinableGroup, 0, 20)
+	err := pg.Conn().SelectContext(gtx, &groups, query, serviceId, userId)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get joinable groups of service '%d'", serviceId)
+	}
+	return groups, nil
+}
+
 func (pgs *PgGroupStorage) Exists(
 	gtx context.Context, id int64) (bool, error) {
-	return pgs.gd.Exists(gtx, "idx_group", "id", id)
+	return pgs.gd.Exists(gtx, core.TenantTable(gtx, "idx_group"), "id", id)
 }
 
 func (pgs *PgGroupStorage) Count(
 	gtx context.Context, filter *data.Filter) (int64, error) {
-	return pgs.gd.Count(gtx, "idx_group", filter)
+	return pgs.gd.Count(gtx, core.TenantTable(gtx, "idx_group"), filter)
 }
 
 func (pgs *PgGroupStorage) SetPermissions(
@@ -136,7 +203,7 @@ func (pgs *PgGroupStorage) SetPermissions(
 		) VALUES (
 			$1,
 			$2
-		) ON CONFLICT IGNORE
+		) ON CONFLICT DO NOTHING
 	`
 
 	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
@@ -151,10 +218,15 @@ func (pgs *PgGroupStorage) SetPermissions(
 		return errx.Errf(err, fmtStr, args...)
 	}
 
-	for perm := range perms {
-		_, err := tx.ExecContext(gtx, query)
+	const dquery = `DELETE FROM group_to_perm WHERE group_id = $1`
+	if _, err := tx.ExecContext(gtx, dquery, groupId); err != nil {
+		return ef(err, "failed to clear permissions of group '%d'", groupId)
+	}
+
+	for _, perm := range perms {
+		_, err := tx.ExecContext(gtx, query, groupId, perm)
 		if err != nil {
-			return ef(err, "failed to add permission '%s' to group '%s'",
+			return ef(err, "failed to add permission '%s' to group '%d'",
 				perm, groupId)
 		}
 	}
@@ -182,6 +254,9 @@ func (pgs *PgGroupStorage) GetPermissions(
 
 func (pgs *PgGroupStorage) AddToGroups(
 	gtx context.Context, userId int64, groupIds ...int64) error {
+	if err := checkMemberTenant(gtx, userId, groupIds...); err != nil {
+		return err
+	}
 
 	query := `
 		INSERT INTO user_to_group (
@@ -191,7 +266,7 @@ func (pgs *PgGroupStorage) AddToGroups(
 		VALUES (
 			$1, 
 			$2 
-		)	
+		) ON CONFLICT DO NOTHING
 	`
 
 	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
@@ -233,3 +308,550 @@ func (pgs *PgGroupStorage) RemoveFromGroup(
 	}
 	return nil
 }
+
+func (pgs *PgGroupStorage) AddOwner(
+	gtx context.Context, groupId, userId, actorId int64) error {
+	if err := checkMemberTenant(gtx, userId, groupId); err != nil {
+		return err
+	}
+	const query = `
+		INSERT INTO group_to_owner (
+			group_id,
+			owner_id,
+			created_by
+		) VALUES (
+			$1, $2, $3
+		) ON CONFLICT DO NOTHING
+	`
+	_, err := pg.Conn().ExecContext(gtx, query, groupId, userId, actorId)
+	if err != nil {
+		return errx.Errf(err,
+			"failed to add user '%d' as owner of group '%d'", userId, groupId)
+	}
+	return nil
+}
+
+func (pgs *PgGroupStorage) RemoveOwner(
+	gtx context.Context, groupId, userId int64) error {
+	const query = `
+		DELETE FROM group_to_owner WHERE group_id = $1 AND owner_id = $2
+	`
+	_, err := pg.Conn().ExecContext(gtx, query, groupId, userId)
+	if err != nil {
+		return errx.Errf(err,
+			"failed to remove user '%d' as owner of group '%d'", userId, groupId)
+	}
+	return nil
+}
+
+// GetOwners - owners of the given groups by group
+func (pgs *PgGroupStorage) GetOwners(
+	gtx context.Context,
+	groupIds ...int64) (map[int64][]*core.GroupOwner, error) {
+	const query = `
+		SELECT
+			gto.group_id,
+			gto.owner_id,
+			u.user_name,
+			gto.created_on,
+			gto.created_by
+		FROM group_to_owner gto
+		JOIN idx_user u ON u.id = gto.owner_id
+		WHERE gto.group_id = ANY($1)
+		ORDER BY u.user_name
+	`
+	owners := make([]*struct {
+		GroupId int64 `db:"group_id"`
+		core.GroupOwner
+	}, 0, len(groupIds))
+	err := pg.Conn().SelectContext(
+		gtx, &owners, query, data.Vec[int64](groupIds))
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get owners of groups")
+	}
+
+	byGroup := make(map[int64][]*core.GroupOwner, len(groupIds))
+	for _, owner := range owners {
+		id := owner.GroupId
+		byGroup[id] = append(byGroup[id], &owner.GroupOwner)
+	}
+	return byGroup, nil
+}
+
+func (pgs *PgGroupStorage) IsOwner(
+	gtx context.Context, groupId, userId int64) (bool, error) {
+	const query = `
+		SELECT EXISTS(
+			SELECT 1 FROM group_to_owner WHERE group_id = $1 AND owner_id = $2
+		)
+	`
+	owner := false
+	err := pg.Conn().GetContext(gtx, &owner, query, groupId, userId)
+	if err != nil {
+		return false, errx.Errf(err,
+			"failed to check if user '%d' owns group '%d'", userId, groupId)
+	}
+	return owner, nil
+}
+
+func (pgs *PgGroupStorage) IsMember(
+	gtx context.Context, userId, groupId int64) (bool, error) {
+	const query = `
+		SELECT EXISTS(
+			SELECT 1 FROM user_to_group WHERE user_id = $1 AND group_id = $2
+		)
+	`
+	member := false
+	err := pg.Conn().GetContext(gtx, &member, query, userId, groupId)
+	if err != nil {
+		return false, errx.Errf(err,
+			"failed to check if user '%d' is a member of group '%d'",
+			userId, groupId)
+	}
+	return member, nil
+}
+
+// subGroupsCTE - the group given by the first argument and all its sub groups
+// at any depth. UNION stops the recursion even if the relations form a cycle
+const subGroupsCTE = `
+	WITH RECURSIVE sub_group(group_id) AS (
+		SELECT $1::INT
+		UNION
+		SELECT g2g.child_id
+		FROM group_to_group g2g
+		JOIN sub_group sg ON g2g.parent_id = sg.group_id
+	)
+`
+
+func (pgs *PgGroupStorage) MemberIds(
+	gtx context.Context, groupId int64) ([]int64, error) {
+	query := `SELECT user_id FROM user_to_group WHERE group_id = $1`
+	ids := make([]int64, 0, 100)
+	if err := pg.Conn().SelectContext(gtx, &ids, query, groupId); err != nil {
+		return nil, errx.Errf(
+			err, "failed to get members of group '%d'", groupId)
+	}
+	return ids, nil
+}
+
+func (pgs *PgGroupStorage) AddSubGroup(
+	gtx context.Context, parentId, childId int64) error {
+
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return errx.Errf(err, "failed to initilize DB transaction")
+	}
+	ef := func(err error, fmtStr string, args ...any) error {
+		if e := tx.Rollback(); e != nil {
+			log.Error().Err(e).
+				Msg("transaction rollback failed for sub group addition")
+		}
+		return errx.Errf(err, fmtStr, args...)
+	}
+
+	// Concurrent additions could together form a cycle even though each of
+	// them passes the check, so they are serialized
+	const lquery = `LOCK TABLE group_to_group IN SHARE ROW EXCLUSIVE MODE`
+	if _, err := tx.ExecContext(gtx, lquery); err != nil {
+		return ef(err, "failed to lock group relations")
+	}
+
+	// Groups of different tenants cannot be nested
+	const tquery = `
+		SELECT COUNT(DISTINCT tenant_id) = 1
+		FROM idx_group
+		WHERE id IN ($1, $2)
+	`
+	same := false
+	if err := tx.GetContext(gtx, &same, tquery, parentId, childId); err != nil {
+		return ef(err, "failed to check tenants of groups '%d' and '%d'",
+			parentId, childId)
+	}
+	if !same {
+		return ef(core.ErrInvalidState,
+			"groups '%d' and '%d' do not belong to the same tenant",
+			parentId, childId)
+	}
+
+	// Parent should not already be the child itself or one of its sub groups
+	const cquery = subGroupsCTE + `
+		SELECT EXISTS(SELECT 1 FROM sub_group WHERE group_id = $2)
+	`
+	cycle := false
+	if err := tx.GetContext(gtx, &cycle, cquery, childId, parentId); err != nil {
+		return ef(err, "failed to check relation between groups '%d' and '%d'",
+			parentId, childId)
+	}
+	if cycle {
+		return ef(core.ErrGroupCycle,
+			"adding group '%d' to group '%d' forms a cycle", childId, parentId)
+	}
+
+	const query = `
+		INSERT INTO group_to_group (
+			parent_id,
+			child_id
+		) VALUES (
+			$1,
+			$2
+		) ON CONFLICT DO NOTHING
+	`
+	if _, err := tx.ExecContext(gtx, query, parentId, childId); err != nil {
+		return ef(err, "failed to add group '%d' to group '%d'",
+			childId, parentId)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ef(err, "failed to commit addition of group '%d' to group '%d'",
+			childId, parentId)
+	}
+	return nil
+}
+
+func (pgs *PgGroupStorage) RemoveSubGroup(
+	gtx context.Context, parentId, childId int64) error {
+	query := `
+		DELETE FROM group_to_group WHERE parent_id = $1 AND child_id = $2
+	`
+	_, err := pg.Conn().ExecContext(gtx, query, parentId, childId)
+	if err != nil {
+		return errx.Errf(err, "failed to remove group '%d' from group '%d'",
+			childId, parentId)
+	}
+	return nil
+}
+
+func (pgs *PgGroupStorage) GetSubGroups(
+	gtx context.Context, groupId int64) ([]*core.Group, error) {
+	query := `
+		SELECT g.*
+		FROM idx_group g
+		JOIN group_to_group g2g ON g.id = g2g.child_id
+		WHERE g2g.parent_id = $1 AND ` + core.TenantCond(gtx, "g.tenant_id") + `
+		ORDER BY g.name
+	`
+	groups := make([]*core.Group, 0, 20)
+	if err := pg.Conn().SelectContext(gtx, &groups, query, groupId); err != nil {
+		return nil, errx.Errf(
+			err, "failed to get sub groups of group '%d'", groupId)
+	}
+	return groups, nil
+}
+
+func (pgs *PgGroupStorage) GetMembers(
+	gtx context.Context,
+	groupId int64,
+	params *data.CommonParams) ([]*core.GroupMember, error) {
+	query := subGroupsCTE + `
+		SELECT
+			u.id AS user_id,
+			u.user_name,
+			g.id AS via_group_id,
+			g.name AS via_group,
+			g.id = $1 AS direct,
+			u2g.valid_from,
+			u2g.valid_until
+		FROM user_to_group u2g
+		JOIN sub_group sg ON u2g.group_id = sg.group_id
+		JOIN idx_user u ON u.id = u2g.user_id
+		JOIN idx_group g ON g.id = u2g.group_id
+		WHERE
+			u2g.valid_from <= NOW() AND
+			(u2g.valid_until IS NULL OR u2g.valid_until > NOW()) AND ` +
+		core.TenantCond(gtx, "g.tenant_id") + `
+		ORDER BY u.user_name, direct DESC, g.name
+	`
+	query, args := paged(query, params, groupId)
+	members := make([]*core.GroupMember, 0, 100)
+	if err := pg.Conn().SelectContext(gtx, &members, query, args...); err != nil {
+		return nil, errx.Errf(
+			err, "failed to get members of group '%d'", groupId)
+	}
+	return members, nil
+}
+
+// GetUserGroups - groups the user is a member of along with the parents of
+// those groups at any depth, limited to the service unless serviceId is zero.
+// Parents are reported once for each group of the user they are reached from
+func (pgs *PgGroupStorage) GetUserGroups(
+	gtx context.Context,
+	userId, serviceId int64,
+	params *data.CommonParams) ([]*core.UserGroup, error) {
+	query := `
+		WITH RECURSIVE user_group(group_id, via_group_id, valid_until) AS (
+			SELECT group_id, group_id, valid_until
+			FROM user_to_group
+			WHERE
+				user_id = $1 AND
+				valid_from <= NOW() AND
+				(valid_until IS NULL OR valid_until > NOW())
+			UNION
+			SELECT g2g.parent_id, ug.via_group_id, ug.valid_until
+			FROM group_to_group g2g
+			JOIN user_group ug ON g2g.child_id = ug.group_id
+		)
+		SELECT
+			g.id AS group_id,
+			g.name AS group_name,
+			g.service_id,
+			vg.id AS via_group_id,
+			vg.name AS via_group,
+			ug.group_id = ug.via_group_id AS direct,
+			ug.valid_until
+		FROM user_group ug
+		JOIN idx_group g ON g.id = ug.group_id
+		JOIN idx_group vg ON vg.id = ug.via_group_id
+		WHERE
+			($2 = 0 OR g.service_id = $2) AND ` +
+		core.TenantCond(gtx, "g.tenant_id") + `
+		ORDER BY g.name, direct DESC, vg.name
+	`
+	query, args := paged(query, params, userId, serviceId)
+	groups := make([]*core.UserGroup, 0, 50)
+	if err := pg.Conn().SelectContext(gtx, &groups, query, args...); err != nil {
+		return nil, errx.Errf(err, "failed to get groups of user '%d'", userId)
+	}
+	return groups, nil
+}
+
+// GetServiceUsers - users who are members of a group of the service, directly
+// or through sub groups, users in the allowlist of the service and the admins
+// of the service
+func (pgs *PgGroupStorage) GetServiceUsers(
+	gtx context.Context,
+	serviceId int64,
+	params *data.CommonParams) ([]*core.ServiceUser, error) {
+	query := `
+		WITH RECURSIVE service_group(group_id, root_id) AS (
+			SELECT id, id FROM idx_group WHERE service_id = $1
+			UNION
+			SELECT g2g.child_id, sg.root_id
+			FROM group_to_group g2g
+			JOIN service_group sg ON g2g.parent_id = sg.group_id
+		), member(user_id, group_id) AS (
+			SELECT u2g.user_id, sg.root_id
+			FROM service_group sg
+			JOIN user_to_group u2g ON u2g.group_id = sg.group_id
+			WHERE
+				u2g.valid_from <= NOW() AND
+				(u2g.valid_until IS NULL OR u2g.valid_until > NOW())
+		), access(user_id) AS (
+			SELECT user_id FROM member
+			UNION
+			SELECT user_id FROM user_to_service WHERE service_id = $1
+			UNION
+			SELECT admin_id FROM service_to_owner WHERE service_id = $1
+		)
+		SELECT
+			u.id AS user_id,
+			u.user_name,
+			ARRAY(
+				SELECT DISTINCT g.name
+				FROM member m
+				JOIN idx_group g ON g.id = m.group_id
+				WHERE m.user_id = u.id
+				ORDER BY g.name
+			) AS groups,
+			EXISTS(
+				SELECT 1 FROM service_to_owner
+				WHERE service_id = $1 AND admin_id = u.id
+			) AS admin,
+			EXISTS(
+				SELECT 1 FROM user_to_service
+				WHERE service_id = $1 AND user_id = u.id
+			) AS allowed
+		FROM access a
+		JOIN idx_user u ON u.id = a.user_id
+		WHERE ` + core.TenantCond(gtx, "u.tenant_id") + `
+		ORDER BY u.user_name
+	`
+	query, args := paged(query, params, serviceId)
+	users := make([]*core.ServiceUser, 0, 100)
+	if err := pg.Conn().SelectContext(gtx, &users, query, args...); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get users of service '%d'", serviceId)
+	}
+	return users, nil
+}
+
+// paged - adds the page given in the params to the query, everything is
+// returned if the page size is not given
+func paged(
+	query string, params *data.CommonParams, args ...any) (string, []any) {
+	if params == nil || params.PageSize <= 0 {
+		return query, args
+	}
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	return query, append(args, params.Limit(), params.Offset())
+}
+
+func (pgs *PgGroupStorage) AddMembership(
+	gtx context.Context, membership *core.Membership) error {
+	err := checkMemberTenant(gtx, membership.UserId, membership.GroupId)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO user_to_group (
+			user_id,
+			group_id,
+			valid_from,
+			valid_until
+		) VALUES (
+			:user_id,
+			:group_id,
+			:valid_from,
+			:valid_until
+		) ON CONFLICT (user_id, group_id) DO UPDATE SET
+			valid_from = EXCLUDED.valid_from,
+			valid_until = EXCLUDED.valid_until,
+			warned_on = NULL
+	`
+	if _, err := pg.Conn().NamedExecContext(gtx, query, membership); err != nil {
+		return errx.Errf(err, "failed to add user '%d' to group '%d'",
+			membership.UserId, membership.GroupId)
+	}
+	return nil
+}
+
+func (pgs *PgGroupStorage) GetMembership(
+	gtx context.Context, userId, groupId int64) (*core.Membership, error) {
+	query := `
+		SELECT
+			user_id,
+			group_id,
+			valid_from,
+			valid_until
+		FROM user_to_group
+		WHERE user_id = $1 AND group_id = $2
+	`
+	var membership core.Membership
+	err := pg.Conn().GetContext(gtx, &membership, query, userId, groupId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errx.Errf(core.ErrInvalidState,
+			"user '%d' is not a member of group '%d'", userId, groupId)
+	}
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get membership of user '%d' in group '%d'",
+			userId, groupId)
+	}
+	return &membership, nil
+}
+
+func (pgs *PgGroupStorage) ExtendMembership(
+	gtx context.Context,
+	userId, groupId int64,
+	validUntil *time.Time) error {
+	query := `
+		UPDATE user_to_group SET
+			valid_until = $3,
+			warned_on = NULL
+		WHERE user_id = $1 AND group_id = $2
+	`
+	_, err := pg.Conn().ExecContext(gtx, query, userId, groupId, validUntil)
+	if err != nil {
+		return errx.Errf(err,
+			"failed to extend membership of user '%d' in group '%d'",
+			userId, groupId)
+	}
+	return nil
+}
+
+// ExpireMemberships - deletes the memberships that are past their validity
+// and returns them
+func (pgs *PgGroupStorage) ExpireMemberships(
+	gtx context.Context) ([]*core.Membership, error) {
+	query := `
+		DELETE FROM user_to_group
+		WHERE valid_until <= NOW()
+		RETURNING
+			user_id,
+			group_id,
+			valid_from,
+			valid_until
+	`
+	expired := make([]*core.Membership, 0, 20)
+	if err := pg.Conn().SelectContext(gtx, &expired, query); err != nil {
+		return nil, errx.Errf(err, "failed to remove expired memberships")
+	}
+	return expired, nil
+}
+
+// expiringMembership - membership along with the details required to warn
+// the member and the admins about its expiry
+type expiringMembership struct {
+	core.Membership
+	UserName  string `db:"user_name"`
+	Email     string `db:"email"`
+	GroupName string `db:"group_name"`
+	ServiceId int64  `db:"service_id"`
+}
+
+// Expiring - memberships expiring before the given time for which the
+// warning is not sent yet
+func (pgs *PgGroupStorage) Expiring(
+	gtx context.Context, before time.Time) ([]*expiringMembership, error) {
+	query := `
+		SELECT
+			u2g.user_id,
+			u2g.group_id,
+			u2g.valid_from,
+			u2g.valid_until,
+			u.user_name,
+			u.email,
+			g.name AS group_name,
+			g.service_id
+		FROM user_to_group u2g
+		JOIN idx_user u ON u.id = u2g.user_id
+		JOIN idx_group g ON g.id = u2g.group_id
+		WHERE
+			u2g.valid_until > NOW() AND
+			u2g.valid_until <= $1 AND
+			u2g.warned_on IS NULL
+		ORDER BY g.service_id, u2g.valid_until
+	`
+	expiring := make([]*expiringMembership, 0, 20)
+	if err := pg.Conn().SelectContext(gtx, &expiring, query, before); err != nil {
+		return nil, errx.Errf(err, "failed to get expiring memberships")
+	}
+	return expiring, nil
+}
+
+func (pgs *PgGroupStorage) MarkWarned(
+	gtx context.Context, userId, groupId int64) error {
+	query := `
+		UPDATE user_to_group SET warned_on = NOW()
+		WHERE user_id = $1 AND group_id = $2
+	`
+	if _, err := pg.Conn().ExecContext(gtx, query, userId, groupId); err != nil {
+		return errx.Errf(err,
+			"failed to mark expiry warning of user '%d' in group '%d'",
+			userId, groupId)
+	}
+	return nil
+}
+
+// checkMemberTenant - users can only join the groups of their own tenant
+func checkMemberTenant(
+	gtx context.Context, userId int64, groupIds ...int64) error {
+	const query = `
+		SELECT g.id
+		FROM idx_group g
+		JOIN idx_user u ON u.id = $1
+		WHERE g.id = ANY($2) AND g.tenant_id <> u.tenant_id
+	`
+	others := make([]int64, 0, len(groupIds))
+	err := pg.Conn().SelectContext(
+		gtx, &others, query, userId, data.Vec[int64](groupIds))
+	if err != nil {
+		return errx.Errf(err,
+			"failed to check tenant of groups for user '%d'", userId)
+	}
+	if len(others) != 0 {
+		return errx.Errf(core.ErrInvalidState,
+			"groups %v do not belong to the tenant of user '%d'",
+			others, userId)
+	}
+	return nil
+}
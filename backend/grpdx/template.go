@@ -0,0 +1,294 @@
+package grpdx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+type PgRoleTemplateStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewRoleTemplateStorage(gd data.GetterDeleter) *PgRoleTemplateStorage {
+	return &PgRoleTemplateStorage{
+		gd: gd,
+	}
+}
+
+const selectTemplates = `
+	SELECT
+		t.*,
+		ARRAY(
+			SELECT tg.group_id
+			FROM template_to_group tg
+			WHERE tg.template_id = t.id
+			ORDER BY tg.group_id
+		) AS group_ids
+	FROM idx_role_template t
+`
+
+func (pts *PgRoleTemplateStorage) Save(
+	gtx context.Context, tmpl *core.RoleTemplate) (int64, error) {
+	query := `
+		INSERT INTO idx_role_template (
+			created_by,
+			updated_by,
+			name,
+			description
+		) VALUES (
+			$1,
+			$2,
+			$3,
+			$4
+		) RETURNING id
+	`
+
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return -1, errx.Errf(err, "failed to initilize DB transaction")
+	}
+	ef := func(err error, fmtStr string, args ...any) error {
+		if e := tx.Rollback(); e != nil {
+			log.Error().Err(e).
+				Msg("transaction rollback failed for role template")
+		}
+		return errx.Errf(err, fmtStr, args...)
+	}
+
+	var id int64
+	err = tx.QueryRowxContext(gtx, query,
+		tmpl.CreatedBy, tmpl.UpdatedBy, tmpl.Name, tmpl.Description).Scan(&id)
+	if err != nil {
+		return -1, ef(err, "failed to insert role template '%s'", tmpl.Name)
+	}
+	if err := setTemplateGroups(gtx, tx, id, tmpl.GroupIds); err != nil {
+		return -1, ef(err, "failed to set groups of template '%s'", tmpl.Name)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, ef(err, "failed to commit role template '%s'", tmpl.Name)
+	}
+	return id, nil
+}
+
+func (pts *PgRoleTemplateStorage) Update(
+	gtx context.Context, tmpl *core.RoleTemplate) error {
+	tmpl.UpdatedOn = time.Now()
+	query := `
+		UPDATE idx_role_template SET
+			updated_by = $1,
+			updated_on = $2,
+			name = $3,
+			description = $4
+		WHERE id = $5
+	`
+
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return errx.Errf(err, "failed to initilize DB transaction")
+	}
+	ef := func(err error, fmtStr string, args ...any) error {
+		if e := tx.Rollback(); e != nil {
+			log.Error().Err(e).
+				Msg("transaction rollback failed for role template")
+		}
+		return errx.Errf(err, fmtStr, args...)
+	}
+
+	_, err = tx.ExecContext(gtx, query,
+		tmpl.UpdatedBy, tmpl.UpdatedOn, tmpl.Name, tmpl.Description, tmpl.Id)
+	if err != nil {
+		return ef(err, "failed to update role template '%s'", tmpl.Name)
+	}
+	if err := setTemplateGroups(gtx, tx, tmpl.Id, tmpl.GroupIds); err != nil {
+		return ef(err, "failed to set groups of template '%s'", tmpl.Name)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ef(err, "failed to commit role template '%s'", tmpl.Name)
+	}
+	return nil
+}
+
+func (pts *PgRoleTemplateStorage) GetOne(
+	gtx context.Context, id int64) (*core.RoleTemplate, error) {
+	var tmpl core.RoleTemplate
+	err := pg.Conn().GetContext(
+		gtx, &tmpl, selectTemplates+" WHERE t.id = $1", id)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get role template '%d'", id)
+	}
+	return &tmpl, nil
+}
+
+func (pts *PgRoleTemplateStorage) GetByName(
+	gtx context.Context, name string) (*core.RoleTemplate, error) {
+	var tmpl core.RoleTemplate
+	err := pg.Conn().GetContext(
+		gtx, &tmpl, selectTemplates+" WHERE t.name = $1", name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errx.Errf(core.ErrInvalidState,
+			"role template '%s' does not exist", name)
+	}
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get role template '%s'", name)
+	}
+	return &tmpl, nil
+}
+
+func (pts *PgRoleTemplateStorage) Get(
+	gtx context.Context) ([]*core.RoleTemplate, error) {
+	tmpls := make([]*core.RoleTemplate, 0, 20)
+	err := pg.Conn().SelectContext(
+		gtx, &tmpls, selectTemplates+" ORDER BY t.name")
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get role templates")
+	}
+	return tmpls, nil
+}
+
+func (pts *PgRoleTemplateStorage) Remove(gtx context.Context, id int64) error {
+	if err := pts.gd.Delete(gtx, "idx_role_template", "id", id); err != nil {
+		return errx.Wrap(err)
+	}
+	return nil
+}
+
+type execer interface {
+	ExecContext(gtx context.Context, query string, args ...any) (
+		sql.Result, error)
+}
+
+func setTemplateGroups(
+	gtx context.Context, ex execer, tmplId int64, groupIds []int64) error {
+	_, err := ex.ExecContext(gtx,
+		"DELETE FROM template_to_group WHERE template_id = $1", tmplId)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO template_to_group (template_id, group_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	for _, gid := range groupIds {
+		if _, err := ex.ExecContext(gtx, query, tmplId, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type roleTemplateCtl struct {
+	tstore *PgRoleTemplateStorage
+}
+
+func NewRoleTemplateController(
+	tstore *PgRoleTemplateStorage) core.RoleTemplateController {
+	return &roleTemplateCtl{
+		tstore: tstore,
+	}
+}
+
+func (tc *roleTemplateCtl) Save(
+	gtx context.Context, tmpl *core.RoleTemplate) (int64, error) {
+	ev := core.NewEventAdder(gtx, "roleTemplate.save", data.M{
+		"template": tmpl,
+	})
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	if err := validateTemplate(gtx, tmpl); err != nil {
+		return -1, ev.Commit(err)
+	}
+
+	tmpl.CreatedBy, tmpl.UpdatedBy = user.Id(), user.Id()
+	id, err := tc.tstore.Save(gtx, tmpl)
+	return id, ev.Commit(err)
+}
+
+func (tc *roleTemplateCtl) Update(
+	gtx context.Context, tmpl *core.RoleTemplate) error {
+	ev := core.NewEventAdder(gtx, "roleTemplate.update", data.M{
+		"template": tmpl,
+	})
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if err := validateTemplate(gtx, tmpl); err != nil {
+		return ev.Commit(err)
+	}
+
+	tmpl.UpdatedBy = user.Id()
+	return ev.Commit(tc.tstore.Update(gtx, tmpl))
+}
+
+func (tc *roleTemplateCtl) GetOne(
+	gtx context.Context, id int64) (*core.RoleTemplate, error) {
+	tmpl, err := tc.tstore.GetOne(gtx, id)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "roleTemplate.getOne", data.M{
+			"id": id,
+		}).Commit(err)
+	}
+	return tmpl, nil
+}
+
+func (tc *roleTemplateCtl) GetByName(
+	gtx context.Context, name string) (*core.RoleTemplate, error) {
+	tmpl, err := tc.tstore.GetByName(gtx, name)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "roleTemplate.getByName", data.M{
+			"name": name,
+		}).Commit(err)
+	}
+	return tmpl, nil
+}
+
+func (tc *roleTemplateCtl) Get(
+	gtx context.Context) ([]*core.RoleTemplate, error) {
+	tmpls, err := tc.tstore.Get(gtx)
+	if err != nil {
+		return nil, core.NewEventAdder(
+			gtx, "roleTemplate.get", data.M{}).Commit(err)
+	}
+	return tmpls, nil
+}
+
+func (tc *roleTemplateCtl) Remove(gtx context.Context, id int64) error {
+	err := tc.tstore.Remove(gtx, id)
+	return core.NewEventAdder(gtx, "roleTemplate.remove", data.M{
+		"id": id,
+	}).Commit(err)
+}
+
+func validateTemplate(gtx context.Context, tmpl *core.RoleTemplate) error {
+	if tmpl.Name == "" {
+		return errx.Errf(core.ErrInvalidState,
+			"role template requires a name")
+	}
+	if len(tmpl.GroupIds) == 0 {
+		return errx.Errf(core.ErrInvalidState,
+			"role template '%s' does not have any groups", tmpl.Name)
+	}
+
+	slices.Sort(tmpl.GroupIds)
+	tmpl.GroupIds = slices.Compact(tmpl.GroupIds)
+	for _, groupId := range tmpl.GroupIds {
+		if _, err := core.GroupCtlr(gtx).GetOne(gtx, groupId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package kms
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/rt"
+)
+
+var (
+	ErrNoMasterKey   = errors.New("master key not configured")
+	ErrInvalidKey    = errors.New("invalid master key")
+	ErrUnknownKey    = errors.New("unknown master key version")
+	ErrInvalidSealed = errors.New("invalid sealed value")
+)
+
+const (
+	keySize    = 32
+	sealPrefix = "$idxenc$"
+)
+
+// Keyring - versioned master keys, the latest version is used for sealing
+// and the older ones are kept only for opening existing values
+type Keyring struct {
+	keys    map[int][]byte
+	peppers map[int][]byte
+	current int
+}
+
+// LoadKeyring - reads the master keys from the file given by
+// IDX_MASTER_KEY_FILE or from IDX_MASTER_KEY. Keys are given as
+// '<version>:<base64 key>' separated by new lines or commas
+func LoadKeyring() (*Keyring, error) {
+	if path := rt.EnvString("IDX_MASTER_KEY_FILE", ""); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, errx.Errf(err, "failed to open master key file")
+		}
+		defer file.Close()
+		return ReadKeyring(file)
+	}
+	if keys := rt.EnvString("IDX_MASTER_KEY", ""); keys != "" {
+		return ReadKeyring(strings.NewReader(keys))
+	}
+	return nil, errx.Errf(ErrNoMasterKey,
+		"set IDX_MASTER_KEY_FILE or IDX_MASTER_KEY, "+
+			"use 'idx keys generate' to create a key")
+}
+
+func ReadKeyring(reader io.Reader) (*Keyring, error) {
+	kr := &Keyring{
+		keys:    map[int][]byte{},
+		peppers: map[int][]byte{},
+		current: -1,
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		for _, entry := range strings.Split(scanner.Text(), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" || strings.HasPrefix(entry, "#") {
+				continue
+			}
+			if err := kr.add(entry); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errx.Errf(err, "failed to read master keys")
+	}
+	if kr.current < 0 {
+		return nil, errx.Errf(ErrNoMasterKey, "no master key found")
+	}
+	return kr, nil
+}
+
+func (kr *Keyring) add(entry string) error {
+	verStr, keyStr, found := strings.Cut(entry, ":")
+	version, err := strconv.Atoi(verStr)
+	if !found || err != nil || version < 0 {
+		return errx.Errf(ErrInvalidKey,
+			"expected '<version>:<base64 key>', found '%s...'", verStr)
+	}
+	key, err := base64.StdEncoding.DecodeString(keyStr)
+	if err != nil || len(key) != keySize {
+		return errx.Errf(ErrInvalidKey,
+			"master key version %d must be %d bytes of base64",
+			version, keySize)
+	}
+	if _, dup := kr.keys[version]; dup {
+		return errx.Errf(ErrInvalidKey,
+			"master key version %d is given more than once", version)
+	}
+
+	// Pepper is derived from the master key so that it is rotated along
+	// with it without having to manage another secret
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("idx.pepper"))
+
+	kr.keys[version], kr.peppers[version] = key, mac.Sum(nil)
+	kr.current = max(kr.current, version)
+	return nil
+}
+
+func (kr *Keyring) CurrentVersion() int {
+	return kr.current
+}
+
+// Seal - encrypts the value with a new random data key and wraps the data
+// key with the current master key. The result has the format
+// $idxenc$k=<version>$<wrapped data key>$<cipher text>
+func (kr *Keyring) Seal(plain string) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", errx.Errf(err, "failed to generate data key")
+	}
+
+	wrapped, err := encrypt(kr.keys[kr.current], dataKey)
+	if err != nil {
+		return "", err
+	}
+	cipherText, err := encrypt(dataKey, []byte(plain))
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%sk=%d$%s$%s",
+		sealPrefix,
+		kr.current,
+		enc.EncodeToString(wrapped),
+		enc.EncodeToString(cipherText)), nil
+}
+
+func (kr *Keyring) Open(sealed string) (string, error) {
+	if !strings.HasPrefix(sealed, sealPrefix) {
+		return sealed, nil
+	}
+
+	version, wrapped, cipherText, err := parse(sealed)
+	if err != nil {
+		return "", err
+	}
+	masterKey, found := kr.keys[version]
+	if !found {
+		return "", errx.Errf(ErrUnknownKey,
+			"value is sealed with master key version %d", version)
+	}
+
+	dataKey, err := decrypt(masterKey, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plain, err := decrypt(dataKey, cipherText)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (kr *Keyring) NeedsReseal(sealed string) bool {
+	if sealed == "" {
+		return false
+	}
+	if !strings.HasPrefix(sealed, sealPrefix) {
+		return true
+	}
+	version, _, _, err := parse(sealed)
+	return err == nil && version != kr.current
+}
+
+func (kr *Keyring) Pepper(version int, value string) (string, error) {
+	pepper, found := kr.peppers[version]
+	if !found {
+		return "", errx.Errf(ErrUnknownKey,
+			"no pepper for master key version %d", version)
+	}
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(value))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// GenerateKey - creates a random master key in the format expected by the
+// keyring
+func GenerateKey(version int) (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", errx.Errf(err, "failed to generate master key")
+	}
+	encoded := base64.StdEncoding.EncodeToString(key)
+	return fmt.Sprintf("%d:%s", version, encoded), nil
+}
+
+func parse(sealed string) (int, []byte, []byte, error) {
+	comps := strings.Split(strings.TrimPrefix(sealed, sealPrefix), "$")
+	if len(comps) != 3 || !strings.HasPrefix(comps[0], "k=") {
+		return 0, nil, nil, ErrInvalidSealed
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(comps[0], "k="))
+	if err != nil {
+		return 0, nil, nil, ErrInvalidSealed
+	}
+
+	enc := base64.RawStdEncoding
+	wrapped, err := enc.DecodeString(comps[1])
+	if err != nil {
+		return 0, nil, nil, ErrInvalidSealed
+	}
+	cipherText, err := enc.DecodeString(comps[2])
+	if err != nil {
+		return 0, nil, nil, ErrInvalidSealed
+	}
+	return version, wrapped, cipherText, nil
+}
+
+// encrypt - AES-256-GCM, nonce is prepended to the cipher text
+func encrypt(key, plain []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errx.Errf(err, "failed to generate nonce")
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func decrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrInvalidSealed
+	}
+	nonce, cipherText := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, cipherText, nil)
+	if err != nil {
+		return nil, errx.Errf(ErrInvalidSealed, "failed to decrypt: %v", err)
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to create cipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to create GCM")
+	}
+	return gcm, nil
+}
@@ -0,0 +1,92 @@
+package kms
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+// sealedColumns - columns holding sealed secrets along with the integer
+// primary key of their tables
+var sealedColumns = []struct {
+	table  string
+	key    string
+	column string
+}{
+	{"idx_upstream_provider", "id", "client_secret"},
+	{"idx_prov_connector", "id", "token"},
+	{"idx_saml_sp", "service_id", "name_id_secret"},
+}
+
+// Reseal - re-encrypts the secrets that are plain or sealed with an older
+// master key with the current one. Password hashes are peppered with the
+// current key when their users login, the older keys can be removed only once
+// no hash depends on them. Returns number of values re-encrypted
+func Reseal(gtx context.Context, kr *Keyring) (int, error) {
+	total := 0
+	for _, sc := range sealedColumns {
+		num, err := reseal(gtx, kr, sc.table, sc.key, sc.column)
+		if err != nil {
+			return total, err
+		}
+		log.Info().
+			Str("table", sc.table).
+			Str("column", sc.column).
+			Int("count", num).
+			Msg("re-encrypted secrets")
+		total += num
+	}
+	return total, nil
+}
+
+func reseal(
+	gtx context.Context,
+	kr *Keyring,
+	table, key, column string) (int, error) {
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return 0, errx.Errf(err, "failed to initilize DB transaction")
+	}
+	defer tx.Rollback()
+
+	rows := []struct {
+		Id    int64  `db:"id"`
+		Value string `db:"value"`
+	}{}
+	query := "SELECT " + key + " AS id, " + column + " AS value FROM " +
+		table + " FOR UPDATE"
+	if err := tx.SelectContext(gtx, &rows, query); err != nil {
+		return 0, errx.Errf(err, "failed to read secrets from '%s'", table)
+	}
+
+	num := 0
+	update := "UPDATE " + table + " SET " + column + " = $1 WHERE " +
+		key + " = $2"
+	for _, row := range rows {
+		if !kr.NeedsReseal(row.Value) {
+			continue
+		}
+		plain, err := kr.Open(row.Value)
+		if err != nil {
+			return 0, errx.Errf(err,
+				"failed to open secret of '%s' with id '%d'", table, row.Id)
+		}
+		sealed, err := kr.Seal(plain)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(gtx, update, sealed, row.Id); err != nil {
+			return 0, errx.Errf(err,
+				"failed to update secret of '%s' with id '%d'", table, row.Id)
+		}
+		num++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errx.Errf(err, "failed to commit re-encrypted secrets")
+	}
+	return num, nil
+}
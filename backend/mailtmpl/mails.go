@@ -15,6 +15,11 @@ const (
 	UserAccountApprovedTemplate     = "user_account_approved"
 	UserAccountLockedTemplate       = "user_account_locked"
 	PasswordResetInitTemplate       = "pw_reset_init"
+	MembershipExpiringTemplate      = "membership_expiring"
+	AccessRequestedTemplate         = "access_requested"
+	AccessDecidedTemplate           = "access_decided"
+	ReviewReminderTemplate          = "review_reminder"
+	GroupMemberChangedTemplate      = "group_member_changed"
 )
 
 var cache = struct {
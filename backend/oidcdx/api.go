@@ -0,0 +1,244 @@
+package oidcdx
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/idx/userdx"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+	"github.com/varunamachi/libx/utils/rest"
+)
+
+func UpstreamEndpoints(gtx context.Context) []*httpx.Endpoint {
+	uc := core.UpstreamCtlr(gtx)
+	return []*httpx.Endpoint{
+		createProviderEp(uc),
+		updateProviderEp(uc),
+		getProviderEp(uc),
+		getProvidersEp(uc),
+		deleteProviderEp(uc),
+		loginEp(uc),
+		callbackEp(uc),
+	}
+}
+
+func createProviderEp(uc core.UpstreamController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var provider core.UpstreamProvider
+		if err := etx.Bind(&provider); err != nil {
+			return errx.BadReqX(err, "failed to read provider info from request")
+		}
+
+		id, err := uc.Save(etx.Request().Context(), &provider)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, data.M{"providerId": id})
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/oidc/provider",
+		Category:    "idx.upstream",
+		Desc:        "Create an upstream OIDC provider",
+		Version:     "v1",
+		Permissions: []string{PermManageUpstream},
+		Handler:     handler,
+	}
+}
+
+func updateProviderEp(uc core.UpstreamController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var provider core.UpstreamProvider
+		if err := etx.Bind(&provider); err != nil {
+			return errx.BadReqX(err, "failed to read provider info from request")
+		}
+
+		if err := uc.Update(etx.Request().Context(), &provider); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/oidc/provider",
+		Category:    "idx.upstream",
+		Desc:        "Update an upstream OIDC provider",
+		Version:     "v1",
+		Permissions: []string{PermManageUpstream},
+		Handler:     handler,
+	}
+}
+
+func getProviderEp(uc core.UpstreamController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		provider, err := uc.GetOne(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		provider.ClientSecret = ""
+		return httpx.SendJSON(etx, provider)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/oidc/provider/:id",
+		Category:    "idx.upstream",
+		Desc:        "Get an upstream OIDC provider",
+		Version:     "v1",
+		Permissions: []string{PermGetUpstream},
+		Handler:     handler,
+	}
+}
+
+func getProvidersEp(uc core.UpstreamController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		cmnParams, err := rest.GetCommonParams(etx)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		providers, err := uc.Get(etx.Request().Context(), cmnParams)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		for _, p := range providers {
+			p.ClientSecret = ""
+		}
+		return httpx.SendJSON(etx, providers)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/oidc/provider",
+		Category:    "idx.upstream",
+		Desc:        "Get upstream OIDC provider list",
+		Version:     "v1",
+		Permissions: []string{PermGetUpstream},
+		Handler:     handler,
+	}
+}
+
+func deleteProviderEp(uc core.UpstreamController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := uc.Remove(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return etx.String(http.StatusOK, strconv.FormatInt(id, 10))
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/oidc/provider/:id",
+		Category:    "idx.upstream",
+		Desc:        "Delete an upstream OIDC provider",
+		Version:     "v1",
+		Permissions: []string{PermManageUpstream},
+		Handler:     handler,
+	}
+}
+
+func loginEp(uc core.UpstreamController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		provider := prmg.Str("provider")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		authUrl, binding, err := uc.LoginUrl(
+			etx.Request().Context(), provider)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		setLoginCookie(etx, binding, loginCookieTTL)
+		return etx.Redirect(http.StatusFound, authUrl)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/oidc/:provider/login",
+		Category: "idx.upstream",
+		Desc:     "Redirect to upstream provider for login",
+		Version:  "v1",
+		Handler:  handler,
+	}
+}
+
+func callbackEp(uc core.UpstreamController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		provider := prmg.Str("provider")
+		state := prmg.QueryStr("state")
+		code := prmg.QueryStr("code")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if upErr := etx.QueryParam("error"); upErr != "" {
+			return errx.BadReq("upstream login failed: %s %s",
+				upErr, etx.QueryParam("error_description"))
+		}
+
+		binding := ""
+		if cookie, err := etx.Cookie(loginCookie); err == nil {
+			binding = cookie.Value
+		}
+		setLoginCookie(etx, "", -1)
+
+		res, err := uc.CompleteLogin(
+			etx.Request().Context(), provider, state, binding, code)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		userdx.SetSessionCookie(etx, res.Token)
+		return httpx.SendJSON(etx, res)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/oidc/:provider/callback",
+		Category: "idx.upstream",
+		Desc:     "Complete login through upstream provider",
+		Version:  "v1",
+		Handler:  handler,
+	}
+}
+
+// loginCookie - ties the callback of an upstream login to the browser that
+// initiated the login
+const loginCookie = "idx_upstream_login"
+
+// loginCookieTTL - in seconds, same as the validity of the login state
+const loginCookieTTL = 10 * 60
+
+func setLoginCookie(etx echo.Context, binding string, maxAge int) {
+	etx.SetCookie(&http.Cookie{
+		Name:     loginCookie,
+		Value:    binding,
+		Path:     "/api/v1/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		// The callback is a top level navigation from the upstream provider
+		SameSite: http.SameSiteLaxMode,
+	})
+}
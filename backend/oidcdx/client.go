@@ -0,0 +1,90 @@
+package oidcdx
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+type Client struct {
+	*httpx.Client
+	Timeout time.Duration
+}
+
+func (c *Client) build() *httpx.RequestBuilder {
+	builder := c.Build()
+	if c.Timeout != 0 {
+		builder = builder.WithTimeout(c.Timeout)
+	}
+	return builder
+}
+
+func (c *Client) CreateProvider(
+	gtx context.Context, provider *core.UpstreamProvider) (int64, error) {
+	apiRes := c.build().Path("/api/v1/oidc/provider").Post(gtx, provider)
+	res := map[string]int64{"providerId": int64(-1)}
+	if err := apiRes.LoadClose(&res); err != nil {
+		return -1, errx.Errf(err,
+			"failed to create upstream provider: '%s'", provider.Name)
+	}
+	return res["providerId"], nil
+}
+
+func (c *Client) UpdateProvider(
+	gtx context.Context, provider *core.UpstreamProvider) error {
+	apiRes := c.build().Path("/api/v1/oidc/provider").Put(gtx, provider)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to update upstream provider: '%s'", provider.Name)
+	}
+	return nil
+}
+
+func (c *Client) GetProvider(
+	gtx context.Context, id int64) (*core.UpstreamProvider, error) {
+	apiRes := c.build().Path("/api/v1/oidc/provider", id).Get(gtx)
+	var provider core.UpstreamProvider
+	if err := apiRes.LoadClose(&provider); err != nil {
+		return nil, errx.Errf(err, "failed to get upstream provider: '%d'", id)
+	}
+	return &provider, nil
+}
+
+func (c *Client) GetProviders(
+	gtx context.Context,
+	params *data.CommonParams) ([]*core.UpstreamProvider, error) {
+	apiRes := c.build().Path("/api/v1/oidc/provider").CmnParam(params).Get(gtx)
+	providers := make([]*core.UpstreamProvider, 0, params.PageSize)
+	if err := apiRes.LoadClose(&providers); err != nil {
+		return nil, errx.Errf(err, "failed to get upstream providers")
+	}
+	return providers, nil
+}
+
+func (c *Client) RemoveProvider(gtx context.Context, id int64) error {
+	apiRes := c.build().Path("/api/v1/oidc/provider", id).Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to remove upstream provider: '%d'", id)
+	}
+	return nil
+}
+
+// UpstreamLogin - performs the redirect based login through the given
+// provider. Works only with providers that do not need user interaction, like
+// the mock provider used in tests
+func (c *Client) UpstreamLogin(
+	gtx context.Context, providerName string) (*core.User, error) {
+	apiRes := c.build().Path("/api/v1/oidc", providerName, "login").Get(gtx)
+
+	var res core.UpstreamLogin
+	if err := apiRes.LoadClose(&res); err != nil {
+		return nil, errx.Errf(err,
+			"failed to login through upstream provider '%s'", providerName)
+	}
+	c.SetUser(res.User).SetToken(res.Token)
+	return res.User, nil
+}
@@ -0,0 +1,356 @@
+package oidcdx
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/idx/userdx"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+type upstreamCtl struct {
+	ustore *PgUpstreamStorage
+	oidc   *oidcClient
+}
+
+func NewUpstreamController(
+	ustore *PgUpstreamStorage) core.UpstreamController {
+	return &upstreamCtl{
+		ustore: ustore,
+		oidc:   newOidcClient(),
+	}
+}
+
+func (uc *upstreamCtl) Storage() *PgUpstreamStorage {
+	return uc.ustore
+}
+
+func (uc *upstreamCtl) Save(
+	gtx context.Context, provider *core.UpstreamProvider) (int64, error) {
+	ev := core.NewEventAdder(gtx, "upstream.save", data.M{
+		"provider": provider.Name,
+		"issuer":   provider.Issuer,
+	})
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+
+	provider.CreatedBy, provider.UpdatedBy = user.Id(), user.Id()
+	id, err := uc.ustore.Save(gtx, provider)
+	return id, ev.Commit(err)
+}
+
+func (uc *upstreamCtl) Update(
+	gtx context.Context, provider *core.UpstreamProvider) error {
+	ev := core.NewEventAdder(gtx, "upstream.update", data.M{
+		"provider": provider.Name,
+		"issuer":   provider.Issuer,
+	})
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	existing, err := uc.ustore.GetOne(gtx, provider.Id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+
+	// Secret is never sent back to the clients, so an empty secret means the
+	// existing one is retained
+	if provider.ClientSecret == "" {
+		provider.ClientSecret = existing.ClientSecret
+	}
+	provider.UpdatedBy, provider.UpdatedOn = user.Id(), time.Now()
+	return ev.Commit(uc.ustore.Update(gtx, provider))
+}
+
+func (uc *upstreamCtl) GetOne(
+	gtx context.Context, id int64) (*core.UpstreamProvider, error) {
+	provider, err := uc.ustore.GetOne(gtx, id)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "upstream.getOne", data.M{
+			"id": id,
+		}).Commit(err)
+	}
+	return provider, nil
+}
+
+func (uc *upstreamCtl) GetByName(
+	gtx context.Context, name string) (*core.UpstreamProvider, error) {
+	provider, err := uc.ustore.GetByName(gtx, name)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "upstream.getByName", data.M{
+			"name": name,
+		}).Commit(err)
+	}
+	return provider, nil
+}
+
+func (uc *upstreamCtl) Remove(gtx context.Context, id int64) error {
+	err := uc.ustore.Remove(gtx, id)
+	return core.NewEventAdder(gtx, "upstream.remove", data.M{
+		"id": id,
+	}).Commit(err)
+}
+
+func (uc *upstreamCtl) Get(
+	gtx context.Context,
+	params *data.CommonParams) ([]*core.UpstreamProvider, error) {
+	providers, err := uc.ustore.Get(gtx, params)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "upstream.get", data.M{
+			"commonParams": params,
+		}).Commit(err)
+	}
+	return providers, nil
+}
+
+func (uc *upstreamCtl) LoginUrl(
+	gtx context.Context, providerName string) (string, string, error) {
+	ev := core.NewEventAdder(gtx, "upstream.login.init", data.M{
+		"provider": providerName,
+	})
+
+	provider, err := uc.enabledProvider(gtx, providerName)
+	if err != nil {
+		return "", "", ev.Commit(err)
+	}
+
+	// The state is stored as a token so that the callback can be tied to a
+	// login that was initiated by idx, nonce and the browser binding are
+	// derived from it
+	tok := core.NewToken(provider.Name, core.TokUpstreamLogin, "idx_upstream")
+	err = core.UserCtlr(gtx).CredentialStorage().StoreToken(gtx, tok)
+	if err != nil {
+		return "", "", ev.Errf(err, "failed to store upstream login state")
+	}
+
+	authUrl, err := uc.oidc.authUrl(
+		gtx, provider, callbackUrl(provider), tok.Token, nonceFor(tok.Token))
+	if err != nil {
+		return "", "", ev.Commit(err)
+	}
+	return authUrl, bindingFor(tok.Token), ev.Commit(nil)
+}
+
+func (uc *upstreamCtl) CompleteLogin(
+	gtx context.Context,
+	providerName, state, binding, code string) (*core.UpstreamLogin, error) {
+	ev := core.NewEventAdder(gtx, "upstream.login.complete", data.M{
+		"provider": providerName,
+	})
+
+	provider, err := uc.enabledProvider(gtx, providerName)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	// A callback carrying the state of a login initiated in another browser
+	// would log this browser in as the user who initiated it
+	expected := bindingFor(state)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(binding)) != 1 {
+		return nil, ev.Errf(core.ErrUnauthorized,
+			"upstream login was not initiated in this browser")
+	}
+
+	err = core.UserCtlr(gtx).CredentialStorage().ConsumeToken(
+		gtx, provider.Name, core.TokUpstreamLogin, state)
+	if err != nil {
+		return nil, ev.Errf(err, "invalid upstream login state")
+	}
+
+	tr, err := uc.oidc.exchange(gtx, provider, callbackUrl(provider), code)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	claims, err := uc.oidc.verify(gtx, provider, tr.IdToken, nonceFor(state))
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	subject, ok := claims["sub"].(string)
+	if !ok || subject == "" {
+		return nil, ev.Errf(core.ErrInvalidState,
+			"id token from '%s' does not have a subject", provider.Name)
+	}
+	ev.AddData("subject", subject)
+
+	user, err := uc.linkOrCreate(gtx, provider, subject, claims)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	ev.AddData("userId", user.Id())
+
+	if user.State != core.Active {
+		return nil, ev.Errf(core.ErrInvalidState,
+			"user '%s' is in state '%s', cannot login",
+			user.UName, user.State)
+	}
+
+	token, err := userdx.NewSessionToken(user)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	return &core.UpstreamLogin{
+		User:  user,
+		Token: token,
+	}, ev.Commit(nil)
+}
+
+func (uc *upstreamCtl) enabledProvider(
+	gtx context.Context, name string) (*core.UpstreamProvider, error) {
+	provider, err := uc.ustore.GetByName(gtx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !provider.Enabled {
+		return nil, errx.Errf(core.ErrInvalidState,
+			"upstream provider '%s' is disabled", name)
+	}
+	return provider, nil
+}
+
+func (uc *upstreamCtl) linkOrCreate(
+	gtx context.Context,
+	provider *core.UpstreamProvider,
+	subject string,
+	claims data.M) (*core.User, error) {
+
+	uctl := core.UserCtlr(gtx)
+	userId, err := uc.ustore.LinkedUser(gtx, provider.Id, subject)
+	if err != nil {
+		return nil, err
+	}
+	if userId != -1 {
+		return uctl.GetOne(gtx, userId)
+	}
+
+	user := mapUser(provider, subject, claims)
+
+	// Link to an existing local account with the same user name only if the
+	// provider is trusted to assert user names
+	exists, err := uctl.Exists(gtx, user.UName)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		if !provider.LinkByName {
+			return nil, errx.Errf(core.ErrEntityExists,
+				"user '%s' already exists and provider '%s' is not "+
+					"allowed to link existing accounts",
+				user.UName, provider.Name)
+		}
+		existing, err := uctl.ByUsername(gtx, user.UName)
+		if err != nil {
+			return nil, err
+		}
+		if existing.TenantId != provider.TenantId {
+			return nil, errx.Errf(core.ErrEntityExists,
+				"user '%s' belongs to a different tenant than provider '%s'",
+				user.UName, provider.Name)
+		}
+		err = uc.ustore.Link(gtx, &core.FederatedIdentity{
+			ProviderId: provider.Id,
+			Subject:    subject,
+			UserId:     existing.Id(),
+		})
+		return existing, err
+	}
+
+	// Upstream has already verified the user, so the account either becomes
+	// active through an approval rule or waits for a manual approval
+	rule := provider.ApprovalRules.Match(claims)
+	user.State = core.Verfied
+	user.AuthzRole = auth.Normal
+	if rule != nil {
+		user.State = core.Active
+		user.AuthzRole = data.Qop(rule.Role == auth.None, auth.Normal, rule.Role)
+		if core.RoleAtLeast(user.AuthzRole, core.TenantAdmin) {
+			user.AuthzRole = auth.Normal
+		}
+		user.SetProp("autoApproved", true)
+	}
+
+	id, err := uctl.Save(gtx, user)
+	if err != nil {
+		return nil, err
+	}
+	user.DbItem.Id = id
+
+	err = uc.ustore.Link(gtx, &core.FederatedIdentity{
+		ProviderId: provider.Id,
+		Subject:    subject,
+		UserId:     id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rule != nil {
+		groups, err := core.InitialGroups(
+			gtx, user.TenantId, &core.Approval{GroupIds: rule.Groups})
+		if err != nil {
+			return nil, err
+		}
+		if len(groups) != 0 {
+			err := core.GroupCtlr(gtx).AddToGroups(gtx, id, groups...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return user, nil
+}
+
+func mapUser(
+	provider *core.UpstreamProvider,
+	subject string,
+	claims data.M) *core.User {
+	cm := provider.ClaimMapping
+	claim := func(name, def string) string {
+		val, _ := claims[data.Qop(name == "", def, name)].(string)
+		return val
+	}
+
+	user := &core.User{
+		UName:     claim(cm.UserName, "preferred_username"),
+		EmailId:   claim(cm.Email, "email"),
+		FirstName: claim(cm.FirstName, "given_name"),
+		LastName:  claim(cm.LastName, "family_name"),
+		Title:     claim(cm.Title, ""),
+		TenantId:  provider.TenantId,
+	}
+	if user.UName == "" {
+		user.UName = provider.Name + ":" + subject
+	}
+	for prop, name := range cm.Props {
+		if val, found := claims[name]; found {
+			user.SetProp(prop, val)
+		}
+	}
+	user.SetProp("upstream", provider.Name)
+	return user
+}
+
+func callbackUrl(provider *core.UpstreamProvider) string {
+	return core.ToFullUrl("/api/v1/oidc", provider.Name, "callback")
+}
+
+func nonceFor(state string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("nonce:%s", state)))
+	return hex.EncodeToString(sum[:])
+}
+
+func bindingFor(state string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("binding:%s", state)))
+	return hex.EncodeToString(sum[:])
+}
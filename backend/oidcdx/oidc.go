@@ -0,0 +1,310 @@
+package oidcdx
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+var (
+	ErrInvalidIdToken = errors.New("invalid id token")
+	ErrUnknownKey     = errors.New("unknown signing key")
+)
+
+type discovery struct {
+	Issuer        string `json:"issuer"`
+	AuthEndpoint  string `json:"authorization_endpoint"`
+	TokenEndpoint string `json:"token_endpoint"`
+	JwksUri       string `json:"jwks_uri"`
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IdToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type issuerInfo struct {
+	disc    *discovery
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+// Discovery and key information is cached per issuer, keys are refetched
+// when an unknown key id is encountered or the cache is older than this
+const issuerCacheTTL = 1 * time.Hour
+
+type oidcClient struct {
+	http    *http.Client
+	cache   map[string]*issuerInfo
+	cacheMu sync.Mutex
+}
+
+func newOidcClient() *oidcClient {
+	return &oidcClient{
+		http:  &http.Client{Timeout: 30 * time.Second},
+		cache: make(map[string]*issuerInfo),
+	}
+}
+
+func (oc *oidcClient) getJSON(
+	gtx context.Context, target string, out any) error {
+	req, err := http.NewRequestWithContext(gtx, http.MethodGet, target, nil)
+	if err != nil {
+		return errx.Errf(err, "failed to create request for '%s'", target)
+	}
+	resp, err := oc.http.Do(req)
+	if err != nil {
+		return errx.Errf(err, "failed to fetch '%s'", target)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errx.Fmt("unexpected status '%d' from '%s'",
+			resp.StatusCode, target)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errx.Errf(err, "failed to decode response from '%s'", target)
+	}
+	return nil
+}
+
+func (oc *oidcClient) issuer(
+	gtx context.Context, issuer string, refresh bool) (*issuerInfo, error) {
+	oc.cacheMu.Lock()
+	defer oc.cacheMu.Unlock()
+
+	info, found := oc.cache[issuer]
+	if found && !refresh && time.Since(info.fetched) < issuerCacheTTL {
+		return info, nil
+	}
+
+	var disc discovery
+	discUrl := strings.TrimSuffix(issuer, "/") +
+		"/.well-known/openid-configuration"
+	if err := oc.getJSON(gtx, discUrl, &disc); err != nil {
+		return nil, errx.Wrap(err)
+	}
+	if disc.Issuer != issuer {
+		return nil, errx.Fmt("issuer mismatch in discovery document: "+
+			"expected '%s', found '%s'", issuer, disc.Issuer)
+	}
+
+	jwks := struct {
+		Keys []*jwk `json:"keys"`
+	}{}
+	if err := oc.getJSON(gtx, disc.JwksUri, &jwks); err != nil {
+		return nil, errx.Wrap(err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		pub, err := key.rsaKey()
+		if err != nil {
+			return nil, errx.Errf(err,
+				"invalid key '%s' in JWKS of '%s'", key.Kid, issuer)
+		}
+		keys[key.Kid] = pub
+	}
+
+	info = &issuerInfo{
+		disc:    &disc,
+		keys:    keys,
+		fetched: time.Now(),
+	}
+	oc.cache[issuer] = info
+	return info, nil
+}
+
+func (k *jwk) rsaKey() (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, errx.Errf(err, "invalid modulus")
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, errx.Errf(err, "invalid exponent")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nb),
+		E: int(new(big.Int).SetBytes(eb).Int64()),
+	}, nil
+}
+
+func (oc *oidcClient) authUrl(
+	gtx context.Context,
+	provider *core.UpstreamProvider,
+	redirectUrl, state, nonce string) (string, error) {
+	info, err := oc.issuer(gtx, provider.Issuer, false)
+	if err != nil {
+		return "", errx.Wrap(err)
+	}
+
+	scopes := provider.Scopes.AsSlice()
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	authUrl, err := url.Parse(info.disc.AuthEndpoint)
+	if err != nil {
+		return "", errx.Errf(err, "invalid authorization endpoint for '%s'",
+			provider.Name)
+	}
+	q := authUrl.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", provider.ClientId)
+	q.Set("redirect_uri", redirectUrl)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	authUrl.RawQuery = q.Encode()
+	return authUrl.String(), nil
+}
+
+func (oc *oidcClient) exchange(
+	gtx context.Context,
+	provider *core.UpstreamProvider,
+	redirectUrl, code string) (*tokenResponse, error) {
+	info, err := oc.issuer(gtx, provider.Issuer, false)
+	if err != nil {
+		return nil, errx.Wrap(err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectUrl)
+
+	req, err := http.NewRequestWithContext(
+		gtx,
+		http.MethodPost,
+		info.disc.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errx.Errf(err, "failed to create token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(
+		url.QueryEscape(provider.ClientId),
+		url.QueryEscape(provider.ClientSecret))
+
+	resp, err := oc.http.Do(req)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to exchange code with '%s'", provider.Name)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errx.Fmt("token endpoint of '%s' returned status '%d'",
+			provider.Name, resp.StatusCode)
+	}
+
+	var tr tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return nil, errx.Errf(err, "failed to decode token response")
+	}
+	if tr.IdToken == "" {
+		return nil, errx.Errf(ErrInvalidIdToken,
+			"no id_token in token response from '%s'", provider.Name)
+	}
+	return &tr, nil
+}
+
+// verify - validates signature, issuer, audience, expiry and nonce of the
+// given ID token and returns its claims
+func (oc *oidcClient) verify(
+	gtx context.Context,
+	provider *core.UpstreamProvider,
+	idToken, nonce string) (data.M, error) {
+
+	keyFunc := func(tok *jwt.Token) (any, error) {
+		if _, ok := tok.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errx.Errf(ErrInvalidIdToken,
+				"unexpected signing method '%v'", tok.Header["alg"])
+		}
+		kid, _ := tok.Header["kid"].(string)
+
+		info, err := oc.issuer(gtx, provider.Issuer, false)
+		if err != nil {
+			return nil, err
+		}
+		if key, found := info.keys[kid]; found {
+			return key, nil
+		}
+
+		// Upstream might have rotated its keys
+		info, err = oc.issuer(gtx, provider.Issuer, true)
+		if err != nil {
+			return nil, err
+		}
+		if key, found := info.keys[kid]; found {
+			return key, nil
+		}
+		return nil, errx.Errf(ErrUnknownKey, "key '%s' not found", kid)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(idToken, claims, keyFunc); err != nil {
+		return nil, errx.Errf(err, "failed to validate id token")
+	}
+
+	if !claims.VerifyIssuer(provider.Issuer, true) {
+		return nil, errx.Errf(ErrInvalidIdToken, "issuer mismatch")
+	}
+	if !audienceContains(claims["aud"], provider.ClientId) {
+		return nil, errx.Errf(ErrInvalidIdToken, "audience mismatch")
+	}
+	if _, found := claims["exp"]; !found {
+		return nil, errx.Errf(ErrInvalidIdToken, "token has no expiry")
+	}
+	if tn, _ := claims["nonce"].(string); tn != nonce {
+		return nil, errx.Errf(ErrInvalidIdToken, "nonce mismatch")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errx.Errf(ErrInvalidIdToken, "token has no subject")
+	}
+
+	return data.M(claims), nil
+}
+
+func audienceContains(aud any, clientId string) bool {
+	switch val := aud.(type) {
+	case string:
+		return val == clientId
+	case []any:
+		for _, a := range val {
+			if s, ok := a.(string); ok && s == clientId {
+				return true
+			}
+		}
+	}
+	return false
+}
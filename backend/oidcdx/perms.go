@@ -0,0 +1,6 @@
+package oidcdx
+
+const (
+	PermManageUpstream = "idx.manageUpstream"
+	PermGetUpstream    = "idx.getUpstream"
+)
@@ -0,0 +1,202 @@
+package oidcdx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+type PgUpstreamStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewUpstreamStorage(gd data.GetterDeleter) *PgUpstreamStorage {
+	return &PgUpstreamStorage{
+		gd: gd,
+	}
+}
+
+func (pus *PgUpstreamStorage) Save(
+	gtx context.Context, provider *core.UpstreamProvider) (int64, error) {
+	query := `
+		INSERT INTO idx_upstream_provider (
+			created_by,
+			updated_by,
+			name,
+			display_name,
+			issuer,
+			client_id,
+			client_secret,
+			scopes,
+			link_by_name,
+			enabled,
+			claim_mapping,
+			approval_rules,
+			tenant_id
+		) VALUES (
+			:created_by,
+			:updated_by,
+			:name,
+			:display_name,
+			:issuer,
+			:client_id,
+			:client_secret,
+			:scopes,
+			:link_by_name,
+			:enabled,
+			:claim_mapping,
+			:approval_rules,
+			:tenant_id
+		) RETURNING id;
+	`
+
+	stmt, err := pg.Conn().PrepareNamed(query)
+	if err != nil {
+		return -1, errx.Errf(err,
+			"failed to prepare query to save upstream provider")
+	}
+
+	sealed := *provider
+	sealed.TenantId = core.TenantFor(gtx, provider.TenantId)
+	if err := core.SealAll(gtx, &sealed.ClientSecret); err != nil {
+		return -1, errx.Errf(err, "failed to seal upstream client secret")
+	}
+
+	var id int64
+	if err = stmt.GetContext(gtx, &id, &sealed); err != nil {
+		return -1, errx.Errf(err,
+			"failed to insert upstream provider '%s' to database",
+			provider.Name)
+	}
+	return id, nil
+}
+
+func (pus *PgUpstreamStorage) Update(
+	gtx context.Context, provider *core.UpstreamProvider) error {
+	query := `
+		UPDATE idx_upstream_provider SET
+			updated_by = :updated_by,
+			updated_on = :updated_on,
+			name = :name,
+			display_name = :display_name,
+			issuer = :issuer,
+			client_id = :client_id,
+			client_secret = :client_secret,
+			scopes = :scopes,
+			link_by_name = :link_by_name,
+			enabled = :enabled,
+			claim_mapping = :claim_mapping,
+			approval_rules = :approval_rules
+		WHERE id = :id AND ` + core.TenantCond(gtx, "tenant_id")
+	sealed := *provider
+	if err := core.SealAll(gtx, &sealed.ClientSecret); err != nil {
+		return errx.Errf(err, "failed to seal upstream client secret")
+	}
+	if _, err := pg.Conn().NamedExecContext(gtx, query, &sealed); err != nil {
+		return errx.Errf(err,
+			"failed to update upstream provider '%s'", provider.Name)
+	}
+	return nil
+}
+
+func (pus *PgUpstreamStorage) GetOne(
+	gtx context.Context, id int64) (*core.UpstreamProvider, error) {
+	var provider core.UpstreamProvider
+	table := core.TenantTable(gtx, "idx_upstream_provider")
+	err := pus.gd.GetOne(gtx, table, "id", id, &provider)
+	if err != nil {
+		return nil, errx.Wrap(err)
+	}
+	if err := core.OpenAll(gtx, &provider.ClientSecret); err != nil {
+		return nil, errx.Errf(err, "failed to open upstream client secret")
+	}
+	return &provider, nil
+}
+
+func (pus *PgUpstreamStorage) GetByName(
+	gtx context.Context, name string) (*core.UpstreamProvider, error) {
+	var provider core.UpstreamProvider
+	err := pus.gd.GetOne(
+		gtx, "idx_upstream_provider", "name", name, &provider)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get upstream provider with name '%s'", name)
+	}
+	if err := core.OpenAll(gtx, &provider.ClientSecret); err != nil {
+		return nil, errx.Errf(err, "failed to open upstream client secret")
+	}
+	return &provider, nil
+}
+
+func (pus *PgUpstreamStorage) Remove(gtx context.Context, id int64) error {
+	query := `DELETE FROM idx_upstream_provider WHERE id = $1 AND ` +
+		core.TenantCond(gtx, "tenant_id")
+	if _, err := pg.Conn().ExecContext(gtx, query, id); err != nil {
+		return errx.Errf(err, "failed to remove upstream provider '%d'", id)
+	}
+	return nil
+}
+
+func (pus *PgUpstreamStorage) Get(
+	gtx context.Context,
+	params *data.CommonParams) ([]*core.UpstreamProvider, error) {
+	out := make([]*core.UpstreamProvider, 0, params.PageSize)
+	table := core.TenantTable(gtx, "idx_upstream_provider")
+	if err := pus.gd.Get(gtx, table, params, &out); err != nil {
+		return nil, errx.Wrap(err)
+	}
+	for _, provider := range out {
+		if err := core.OpenAll(gtx, &provider.ClientSecret); err != nil {
+			return nil, errx.Errf(err, "failed to open upstream client secret")
+		}
+	}
+	return out, nil
+}
+
+// LinkedUser - gives the id of the idx user linked to the upstream subject,
+// -1 if the subject is not linked yet
+func (pus *PgUpstreamStorage) LinkedUser(
+	gtx context.Context, providerId int64, subject string) (int64, error) {
+	const query = `
+		SELECT user_id
+		FROM user_to_upstream
+		WHERE provider_id = $1 AND subject = $2
+	`
+
+	userId := int64(-1)
+	err := pg.Conn().GetContext(gtx, &userId, query, providerId, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return -1, nil
+		}
+		return -1, errx.Errf(err,
+			"failed to get user linked to '%d:%s'", providerId, subject)
+	}
+	return userId, nil
+}
+
+func (pus *PgUpstreamStorage) Link(
+	gtx context.Context, fid *core.FederatedIdentity) error {
+	const query = `
+		INSERT INTO user_to_upstream (
+			provider_id,
+			subject,
+			user_id
+		) VALUES (
+			:provider_id,
+			:subject,
+			:user_id
+		) ON CONFLICT (provider_id, subject) DO UPDATE SET
+			user_id = EXCLUDED.user_id
+	`
+	if _, err := pg.Conn().NamedExecContext(gtx, query, fid); err != nil {
+		return errx.Errf(err, "failed to link user '%d' to '%d:%s'",
+			fid.UserId, fid.ProviderId, fid.Subject)
+	}
+	return nil
+}
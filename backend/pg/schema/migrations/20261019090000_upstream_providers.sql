@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idx_upstream_provider (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_by VARCHAR NOT NULL,
+    updated_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR NOT NULL,
+    name VARCHAR NOT NULL UNIQUE,
+    display_name VARCHAR NOT NULL,
+    issuer VARCHAR NOT NULL,
+    client_id VARCHAR NOT NULL,
+    client_secret VARCHAR NOT NULL,
+    scopes VARCHAR [] DEFAULT '{}',
+    link_by_name BOOLEAN NOT NULL DEFAULT FALSE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    claim_mapping JSONB NOT NULL DEFAULT '{}',
+    approval_rules JSONB NOT NULL DEFAULT '[]'
+);
+
+CREATE TABLE IF NOT EXISTS user_to_upstream (
+    provider_id INT NOT NULL,
+    subject VARCHAR NOT NULL,
+    user_id INT NOT NULL,
+    PRIMARY KEY(provider_id, subject),
+    CONSTRAINT fk_u2u_provider FOREIGN KEY(provider_id)
+        REFERENCES idx_upstream_provider(id) ON DELETE CASCADE,
+    CONSTRAINT fk_u2u_user FOREIGN KEY(user_id)
+        REFERENCES idx_user(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_to_upstream;
+
+DROP TABLE idx_upstream_provider;
+-- +goose StatementEnd
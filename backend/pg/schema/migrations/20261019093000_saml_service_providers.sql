@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idx_saml_sp (
+    service_id INT PRIMARY KEY,
+    entity_id VARCHAR NOT NULL UNIQUE,
+    acs_url VARCHAR NOT NULL,
+    name_id_format VARCHAR NOT NULL,
+    attributes JSONB NOT NULL DEFAULT '{}',
+    CONSTRAINT fk_saml_service FOREIGN KEY(service_id)
+        REFERENCES idx_service(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idx_saml_sp;
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idx_prov_connector (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_by VARCHAR NOT NULL,
+    updated_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR NOT NULL,
+    service_id INT NOT NULL,
+    name VARCHAR NOT NULL,
+    kind VARCHAR NOT NULL,
+    endpoint VARCHAR NOT NULL,
+    token VARCHAR NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    UNIQUE(service_id, name),
+    CONSTRAINT fk_prov_service FOREIGN KEY(service_id)
+        REFERENCES idx_service(id) ON DELETE CASCADE
+);
+
+-- No foreign key to the resource, the record has to outlive the user or the
+-- group so that the removal can be pushed
+CREATE TABLE IF NOT EXISTS idx_prov_sync (
+    connector_id INT NOT NULL,
+    resource_type VARCHAR NOT NULL,
+    resource_id INT NOT NULL,
+    remote_id VARCHAR NOT NULL DEFAULT '',
+    state VARCHAR NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR NOT NULL DEFAULT '',
+    next_attempt TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    synced_on TIMESTAMPTZ,
+    PRIMARY KEY(connector_id, resource_type, resource_id),
+    CONSTRAINT fk_sync_connector FOREIGN KEY(connector_id)
+        REFERENCES idx_prov_connector(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_prov_sync_due
+    ON idx_prov_sync(state, next_attempt);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idx_prov_sync;
+
+DROP TABLE idx_prov_connector;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Existing tokens are stored in plain text and cannot be carried over, they
+-- are short lived anyway and have to be requested again
+DROP TABLE IF EXISTS idx_token;
+
+CREATE TABLE IF NOT EXISTS idx_token (
+    token_hash VARCHAR NOT NULL,
+    unique_name VARCHAR NOT NULL,
+    assoc_type VARCHAR NOT NULL,
+    -- user or service
+    operation VARCHAR NOT NULL,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_on TIMESTAMPTZ NOT NULL,
+    used_on TIMESTAMPTZ,
+    PRIMARY KEY(token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_token_expiry ON idx_token(expires_on);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idx_token;
+
+CREATE TABLE IF NOT EXISTS idx_token (
+    token VARCHAR NOT NULL,
+    unique_name VARCHAR NOT NULL,
+    assoc_type VARCHAR NOT NULL,
+    -- user or service
+    operation VARCHAR NOT NULL,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY(token),
+    UNIQUE(token, unique_name, assoc_type, operation)
+);
+-- +goose StatementEnd
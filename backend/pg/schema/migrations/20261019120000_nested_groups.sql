@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Child group is a member of the parent group, members of the child get the
+-- permissions of the parent. Cycles are rejected while inserting
+CREATE TABLE IF NOT EXISTS group_to_group (
+    parent_id INT NOT NULL,
+    child_id INT NOT NULL,
+    PRIMARY KEY(parent_id, child_id),
+    CHECK(parent_id <> child_id),
+    CONSTRAINT fk_g2g_parent FOREIGN KEY(parent_id)
+        REFERENCES idx_group(id) ON DELETE CASCADE,
+    CONSTRAINT fk_g2g_child FOREIGN KEY(child_id)
+        REFERENCES idx_group(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_g2g_child ON group_to_group(child_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE group_to_group;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idx_policy (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_by VARCHAR NOT NULL,
+    updated_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR NOT NULL,
+    service_id INT NOT NULL,
+    name VARCHAR NOT NULL,
+    description VARCHAR NOT NULL DEFAULT '',
+    effect VARCHAR NOT NULL,
+    perms VARCHAR[] NOT NULL,
+    condition VARCHAR NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    UNIQUE(service_id, name),
+    CONSTRAINT fk_policy_service FOREIGN KEY(service_id)
+        REFERENCES idx_service(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idx_policy;
+-- +goose StatementEnd
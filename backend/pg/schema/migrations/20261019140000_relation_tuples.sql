@@ -0,0 +1,68 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idx_rel_namespace (
+    service_id INT NOT NULL,
+    name VARCHAR NOT NULL,
+    relations JSONB NOT NULL,
+    updated_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY(service_id, name),
+    CONSTRAINT fk_rel_ns_service FOREIGN KEY(service_id)
+        REFERENCES idx_service(id) ON DELETE CASCADE
+);
+
+-- Single row holding the latest revision, writers update it in their
+-- transaction so revisions become visible in the order they are assigned
+CREATE TABLE IF NOT EXISTS idx_rel_revision (
+    id INT PRIMARY KEY DEFAULT 1 CHECK(id = 1),
+    revision BIGINT NOT NULL,
+    -- snapshots older than this have lost deleted tuples to the purge
+    purged_revision BIGINT NOT NULL
+);
+
+INSERT INTO idx_rel_revision(id, revision, purged_revision)
+VALUES (1, 0, 0) ON CONFLICT DO NOTHING;
+
+-- Tuples are versioned, a tuple is visible at revision R if it was created at
+-- or before R and not deleted at or before R
+CREATE TABLE IF NOT EXISTS idx_rel_tuple (
+    service_id INT NOT NULL,
+    namespace VARCHAR NOT NULL,
+    object_id VARCHAR NOT NULL,
+    relation VARCHAR NOT NULL,
+    subject_ns VARCHAR NOT NULL,
+    subject_id VARCHAR NOT NULL,
+    subject_rel VARCHAR NOT NULL DEFAULT '',
+    created_rev BIGINT NOT NULL,
+    deleted_rev BIGINT,
+    deleted_on TIMESTAMPTZ,
+    CONSTRAINT fk_rel_tuple_service FOREIGN KEY(service_id)
+        REFERENCES idx_service(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rel_tuple_live ON idx_rel_tuple(
+    service_id, namespace, object_id, relation,
+    subject_ns, subject_id, subject_rel
+) WHERE deleted_rev IS NULL;
+
+-- Forward lookup, subjects of an object relation. Used by check and expand
+CREATE INDEX IF NOT EXISTS idx_rel_tuple_object ON idx_rel_tuple(
+    service_id, namespace, object_id, relation
+) INCLUDE (subject_ns, subject_id, subject_rel, created_rev, deleted_rev);
+
+-- Reverse lookup, usersets a subject belongs to. Used by list objects
+CREATE INDEX IF NOT EXISTS idx_rel_tuple_subject ON idx_rel_tuple(
+    service_id, subject_ns, subject_id, subject_rel
+) INCLUDE (namespace, object_id, relation, created_rev, deleted_rev);
+
+CREATE INDEX IF NOT EXISTS idx_rel_tuple_deleted ON idx_rel_tuple(deleted_on)
+    WHERE deleted_on IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idx_rel_tuple;
+
+DROP TABLE idx_rel_revision;
+
+DROP TABLE idx_rel_namespace;
+-- +goose StatementEnd
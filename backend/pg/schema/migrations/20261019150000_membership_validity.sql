@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_to_group
+    ADD COLUMN IF NOT EXISTS valid_from TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS valid_until TIMESTAMPTZ,
+    -- set once the expiry warning is sent, cleared when the membership is
+    -- extended
+    ADD COLUMN IF NOT EXISTS warned_on TIMESTAMPTZ;
+
+ALTER TABLE user_to_group DROP CONSTRAINT IF EXISTS chk_u2g_validity;
+ALTER TABLE user_to_group ADD CONSTRAINT chk_u2g_validity
+    CHECK(valid_until IS NULL OR valid_until > valid_from);
+
+CREATE INDEX IF NOT EXISTS idx_u2g_valid_until ON user_to_group(valid_until)
+    WHERE valid_until IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_u2g_valid_until;
+
+ALTER TABLE user_to_group
+    DROP CONSTRAINT IF EXISTS chk_u2g_validity,
+    DROP COLUMN IF EXISTS warned_on,
+    DROP COLUMN IF EXISTS valid_until,
+    DROP COLUMN IF EXISTS valid_from;
+-- +goose StatementEnd
@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idx_access_request (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    user_id INT NOT NULL,
+    group_id INT NOT NULL,
+    service_id INT NOT NULL,
+    justification VARCHAR NOT NULL,
+    valid_until TIMESTAMPTZ,
+    state VARCHAR NOT NULL DEFAULT 'pending',
+    decided_by INT,
+    decided_on TIMESTAMPTZ,
+    comment VARCHAR NOT NULL DEFAULT '',
+    CONSTRAINT fk_acr_user FOREIGN KEY(user_id)
+        REFERENCES idx_user(id) ON DELETE CASCADE,
+    CONSTRAINT fk_acr_group FOREIGN KEY(group_id)
+        REFERENCES idx_group(id) ON DELETE CASCADE,
+    CONSTRAINT fk_acr_service FOREIGN KEY(service_id)
+        REFERENCES idx_service(id) ON DELETE CASCADE
+);
+
+-- An user can have only one open request for a group
+CREATE UNIQUE INDEX IF NOT EXISTS idx_acr_pending
+    ON idx_access_request(user_id, group_id) WHERE state = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_acr_service
+    ON idx_access_request(service_id, state);
+
+CREATE TABLE IF NOT EXISTS idx_access_request_log (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    request_id INT NOT NULL,
+    state VARCHAR NOT NULL,
+    actor_id INT NOT NULL,
+    comment VARCHAR NOT NULL DEFAULT '',
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_acr_log_request FOREIGN KEY(request_id)
+        REFERENCES idx_access_request(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_acr_log_request
+    ON idx_access_request_log(request_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idx_access_request_log;
+
+DROP TABLE idx_access_request;
+-- +goose StatementEnd
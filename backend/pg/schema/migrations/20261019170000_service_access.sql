@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE idx_service
+    ADD COLUMN IF NOT EXISTS access_mode VARCHAR NOT NULL DEFAULT 'open';
+
+-- Users allowed to use services whose access mode is 'allowlist'
+CREATE TABLE IF NOT EXISTS user_to_service (
+    user_id INT NOT NULL,
+    service_id INT NOT NULL,
+    granted_by INT NOT NULL,
+    granted_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY(service_id, user_id),
+    CONSTRAINT fk_u2s_user FOREIGN KEY(user_id)
+        REFERENCES idx_user(id) ON DELETE CASCADE,
+    CONSTRAINT fk_u2s_service FOREIGN KEY(service_id)
+        REFERENCES idx_service(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_to_service;
+
+ALTER TABLE idx_service DROP COLUMN IF EXISTS access_mode;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE idx_service
+    ADD COLUMN IF NOT EXISTS default_groups INT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS idx_role_template (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_by VARCHAR NOT NULL,
+    updated_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR NOT NULL,
+    name VARCHAR NOT NULL UNIQUE,
+    description VARCHAR NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS template_to_group (
+    template_id INT NOT NULL,
+    group_id INT NOT NULL,
+    PRIMARY KEY(template_id, group_id),
+    CONSTRAINT fk_t2g_template FOREIGN KEY(template_id)
+        REFERENCES idx_role_template(id) ON DELETE CASCADE,
+    CONSTRAINT fk_t2g_group FOREIGN KEY(group_id)
+        REFERENCES idx_group(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE template_to_group;
+
+DROP TABLE idx_role_template;
+
+ALTER TABLE idx_service DROP COLUMN IF EXISTS default_groups;
+-- +goose StatementEnd
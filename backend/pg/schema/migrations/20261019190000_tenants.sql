@@ -0,0 +1,61 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idx_tenant (
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_by VARCHAR NOT NULL,
+    updated_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR NOT NULL,
+    name VARCHAR NOT NULL UNIQUE,
+    display_name VARCHAR NOT NULL,
+    description VARCHAR NOT NULL DEFAULT ''
+);
+
+-- Data that existed before tenants belongs to the default tenant
+INSERT INTO idx_tenant (id, created_by, updated_by, name, display_name)
+    VALUES (1, '-1', '-1', 'default', 'Default');
+SELECT setval(pg_get_serial_sequence('idx_tenant', 'id'), 1);
+
+ALTER TABLE idx_user
+    ADD COLUMN IF NOT EXISTS tenant_id INT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT fk_user_tenant FOREIGN KEY(tenant_id)
+        REFERENCES idx_tenant(id);
+CREATE INDEX IF NOT EXISTS idx_user_tenant ON idx_user(tenant_id);
+
+ALTER TABLE idx_service
+    ADD COLUMN IF NOT EXISTS tenant_id INT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT fk_service_tenant FOREIGN KEY(tenant_id)
+        REFERENCES idx_tenant(id);
+CREATE INDEX IF NOT EXISTS idx_service_tenant ON idx_service(tenant_id);
+
+ALTER TABLE idx_group
+    ADD COLUMN IF NOT EXISTS tenant_id INT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT fk_group_tenant FOREIGN KEY(tenant_id)
+        REFERENCES idx_tenant(id);
+CREATE INDEX IF NOT EXISTS idx_group_tenant ON idx_group(tenant_id);
+
+-- Policies of the default tenant apply to tenants without their own policy
+ALTER TABLE credential_policy
+    ADD COLUMN IF NOT EXISTS tenant_id INT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT fk_cred_policy_tenant FOREIGN KEY(tenant_id)
+        REFERENCES idx_tenant(id) ON DELETE CASCADE,
+    DROP CONSTRAINT IF EXISTS credential_policy_pkey,
+    ADD PRIMARY KEY(tenant_id, item_type);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE credential_policy DROP CONSTRAINT IF EXISTS credential_policy_pkey;
+DELETE FROM credential_policy WHERE tenant_id <> 1;
+ALTER TABLE credential_policy
+    DROP COLUMN IF EXISTS tenant_id,
+    ADD PRIMARY KEY(item_type);
+
+ALTER TABLE idx_group DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE idx_service DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE idx_user DROP COLUMN IF EXISTS tenant_id;
+
+DROP TABLE idx_tenant;
+-- +goose StatementEnd
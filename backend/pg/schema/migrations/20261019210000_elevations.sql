@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idx_eligibility (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_by VARCHAR NOT NULL,
+    updated_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR NOT NULL,
+    user_id INT NOT NULL,
+    kind VARCHAR NOT NULL,
+    role VARCHAR NOT NULL DEFAULT '',
+    target_id INT NOT NULL DEFAULT 0,
+    max_minutes INT NOT NULL,
+    auto_approve BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE(user_id, kind, role, target_id),
+    CONSTRAINT fk_eligibility_user FOREIGN KEY(user_id)
+        REFERENCES idx_user(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS idx_elevation (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    eligibility_id INT NOT NULL,
+    user_id INT NOT NULL,
+    kind VARCHAR NOT NULL,
+    role VARCHAR NOT NULL DEFAULT '',
+    target_id INT NOT NULL DEFAULT 0,
+    minutes INT NOT NULL,
+    reason VARCHAR NOT NULL,
+    state VARCHAR NOT NULL DEFAULT 'pending',
+    decided_by INT,
+    decided_on TIMESTAMPTZ,
+    comment VARCHAR NOT NULL DEFAULT '',
+    expires_on TIMESTAMPTZ,
+    CONSTRAINT fk_elevation_eligibility FOREIGN KEY(eligibility_id)
+        REFERENCES idx_eligibility(id) ON DELETE CASCADE,
+    CONSTRAINT fk_elevation_user FOREIGN KEY(user_id)
+        REFERENCES idx_user(id) ON DELETE CASCADE
+);
+
+-- Only one open elevation for an eligibility at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_elevation_open
+    ON idx_elevation(eligibility_id) WHERE state IN ('pending', 'active');
+
+CREATE INDEX IF NOT EXISTS idx_elevation_active
+    ON idx_elevation(user_id, expires_on) WHERE state = 'active';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idx_elevation;
+
+DROP TABLE idx_eligibility;
+-- +goose StatementEnd
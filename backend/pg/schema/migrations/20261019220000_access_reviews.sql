@@ -0,0 +1,59 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idx_review_campaign (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_by VARCHAR NOT NULL,
+    updated_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR NOT NULL,
+    tenant_id INT NOT NULL DEFAULT 1,
+    name VARCHAR NOT NULL,
+    description VARCHAR NOT NULL DEFAULT '',
+    service_ids INT[] NOT NULL DEFAULT '{}',
+    group_ids INT[] NOT NULL DEFAULT '{}',
+    deadline TIMESTAMPTZ NOT NULL,
+    auto_revoke BOOLEAN NOT NULL DEFAULT FALSE,
+    state VARCHAR NOT NULL DEFAULT 'open',
+    closed_on TIMESTAMPTZ,
+    reminded_on TIMESTAMPTZ,
+    UNIQUE(tenant_id, name),
+    CONSTRAINT fk_review_tenant FOREIGN KEY(tenant_id)
+        REFERENCES idx_tenant(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_open
+    ON idx_review_campaign(deadline) WHERE state = 'open';
+
+-- Items are a snapshot, names are copied so that the evidence stays readable
+-- after users and groups are removed
+CREATE TABLE IF NOT EXISTS idx_review_item (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    campaign_id INT NOT NULL,
+    user_id INT NOT NULL,
+    user_name VARCHAR NOT NULL,
+    group_id INT NOT NULL,
+    group_name VARCHAR NOT NULL,
+    service_id INT NOT NULL,
+    service_name VARCHAR NOT NULL,
+    valid_from TIMESTAMPTZ NOT NULL,
+    valid_until TIMESTAMPTZ,
+    reviewer_id INT,
+    decision VARCHAR NOT NULL DEFAULT 'pending',
+    decided_by INT,
+    decided_on TIMESTAMPTZ,
+    comment VARCHAR NOT NULL DEFAULT '',
+    UNIQUE(campaign_id, user_id, group_id),
+    CONSTRAINT fk_review_item_campaign FOREIGN KEY(campaign_id)
+        REFERENCES idx_review_campaign(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_item_pending
+    ON idx_review_item(campaign_id, service_id) WHERE decision = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idx_review_item;
+
+DROP TABLE idx_review_campaign;
+-- +goose StatementEnd
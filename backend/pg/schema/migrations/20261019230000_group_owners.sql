@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS group_to_owner (
+    group_id INT NOT NULL,
+    owner_id INT NOT NULL,
+    created_on TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_by INT NOT NULL,
+    PRIMARY KEY(group_id, owner_id),
+    CONSTRAINT fk_gto_group FOREIGN KEY(group_id)
+        REFERENCES idx_group(id) ON DELETE CASCADE,
+    CONSTRAINT fk_gto_owner FOREIGN KEY(owner_id)
+        REFERENCES idx_user(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_gto_owner ON group_to_owner(owner_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE group_to_owner;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Existing groups keep accepting access requests
+ALTER TABLE idx_group
+    ADD COLUMN IF NOT EXISTS join_policy VARCHAR NOT NULL DEFAULT 'request',
+    ADD COLUMN IF NOT EXISTS notify_owners BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE idx_group
+    DROP COLUMN IF EXISTS join_policy,
+    DROP COLUMN IF EXISTS notify_owners;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Sealed secret of the SP used to derive persistent NameIDs, filled in when
+-- the SP is saved or when it is first used for single sign on
+ALTER TABLE idx_saml_sp
+    ADD COLUMN IF NOT EXISTS name_id_secret VARCHAR NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE idx_saml_sp DROP COLUMN IF EXISTS name_id_secret;
+-- +goose StatementEnd
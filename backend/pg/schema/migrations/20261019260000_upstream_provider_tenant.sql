@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Users created through an upstream provider join the provider's tenant
+ALTER TABLE idx_upstream_provider
+    ADD COLUMN IF NOT EXISTS tenant_id INT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT fk_upstream_provider_tenant FOREIGN KEY(tenant_id)
+        REFERENCES idx_tenant(id);
+CREATE INDEX IF NOT EXISTS idx_upstream_provider_tenant
+    ON idx_upstream_provider(tenant_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE idx_upstream_provider DROP COLUMN IF EXISTS tenant_id;
+-- +goose StatementEnd
@@ -21,6 +21,9 @@ func Init(gtx context.Context, initContext string) error {
 		return errx.Wrap(err)
 	}
 	// Any other DB initialization logic can go here
+	if err := removeReservedPerms(gtx); err != nil {
+		return errx.Wrap(err)
+	}
 	return nil
 }
 
@@ -65,12 +68,32 @@ func CleanData(gtx context.Context) error {
 	}
 
 	tables := []string{
+		"idx_review_item",
+		"idx_review_campaign",
+		"idx_elevation",
+		"idx_eligibility",
+		"idx_access_request_log",
+		"idx_access_request",
+		"idx_rel_tuple",
+		"idx_rel_namespace",
+		"idx_sod_constraint",
+		"idx_policy",
+		"idx_prov_sync",
+		"idx_prov_connector",
+		"idx_saml_sp",
+		"user_to_upstream",
+		"idx_upstream_provider",
 		"idx_token",
 		"credential",
+		"template_to_group",
+		"idx_role_template",
+		"group_to_owner",
+		"group_to_group",
 		"group_to_perm",
 		"user_to_group",
 		"idx_event",
 		"user_pass",
+		"user_to_service",
 		"service_to_owner",
 		"idx_group",
 		"idx_service",
@@ -90,5 +113,18 @@ func CleanData(gtx context.Context) error {
 		}
 		log.Trace().Str("table", table).Msg("data clean done")
 	}
+
+	// Default tenant is created by the migrations and is always expected
+	query, args, err := squirrel.StatementBuilder.
+		PlaceholderFormat(squirrel.Dollar).
+		Delete("idx_tenant").
+		Where(squirrel.NotEq{"id": 1}).
+		ToSql()
+	if err != nil {
+		return errx.Errf(err, "failed to generate tenant deletion query")
+	}
+	if _, err := pg.Conn().ExecContext(gtx, query, args...); err != nil {
+		return errx.Errf(err, "failed to clean data from table 'idx_tenant'")
+	}
 	return nil
 }
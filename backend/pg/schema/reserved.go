@@ -0,0 +1,117 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+// idxPrefix - permissions with the prefix are reserved to idx itself
+const idxPrefix = "idx."
+
+// removeReservedPerms - removes the idx permissions from the permission trees
+// and the groups of the other services. They were accepted before being
+// reserved to idx and make the trees of those services invalid. The name of
+// the idx service comes from the environment, hence this is not a migration
+func removeReservedPerms(gtx context.Context) error {
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return errx.Errf(err, "failed to begin transaction")
+	}
+	ef := func(err error, fmtStr string, args ...any) error {
+		if e := tx.Rollback(); e != nil {
+			log.Error().Err(e).
+				Msg("transaction rollback failed for reserved permissions")
+		}
+		return errx.Errf(err, fmtStr, args...)
+	}
+
+	const dquery = `
+		DELETE FROM group_to_perm
+		WHERE perm_id LIKE 'idx.%' AND group_id IN (
+			SELECT g.id
+			FROM idx_group g
+			JOIN idx_service s ON s.id = g.service_id
+			WHERE s.name <> $1
+		)
+	`
+	res, err := tx.ExecContext(gtx, dquery, core.IdxService())
+	if err != nil {
+		return ef(err, "failed to remove idx permissions from groups")
+	}
+	if n, err := res.RowsAffected(); err == nil && n != 0 {
+		log.Warn().Int64("grants", n).
+			Msg("removed idx permissions granted in other services")
+	}
+
+	type svcTree struct {
+		Id          int64  `db:"id"`
+		Name        string `db:"name"`
+		Permissions []byte `db:"permissions"`
+	}
+	trees := []*svcTree{}
+	const squery = `
+		SELECT id, name, permissions
+		FROM idx_service
+		WHERE name <> $1
+		FOR UPDATE
+	`
+	if err := tx.SelectContext(
+		gtx, &trees, squery, core.IdxService()); err != nil {
+		return ef(err, "failed to get permission trees of services")
+	}
+
+	const uquery = `UPDATE idx_service SET permissions = $1 WHERE id = $2`
+	for _, st := range trees {
+		var tree auth.PermissionTree
+		if err := json.Unmarshal(st.Permissions, &tree); err != nil {
+			return ef(err, "invalid permission tree in service '%s'", st.Name)
+		}
+		nodes, removed := withoutReserved(tree.Permissions)
+		if !removed {
+			continue
+		}
+		tree.Permissions = nodes
+		raw, err := json.Marshal(&tree)
+		if err != nil {
+			return ef(err, "failed to encode permission tree of '%s'", st.Name)
+		}
+		if _, err := tx.ExecContext(gtx, uquery, raw, st.Id); err != nil {
+			return ef(err, "failed to update permission tree of '%s'", st.Name)
+		}
+		log.Warn().Str("service", st.Name).
+			Msg("removed idx permissions from the permission tree")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errx.Errf(err, "failed to commit reserved permission removal")
+	}
+	return nil
+}
+
+// withoutReserved - nodes without the idx permissions, the children of a
+// removed node take its place so that the permissions of the service remain
+func withoutReserved(
+	nodes []*auth.PermissionNode) ([]*auth.PermissionNode, bool) {
+	out := make([]*auth.PermissionNode, 0, len(nodes))
+	removed := false
+	for _, node := range nodes {
+		children, rm := withoutReserved(node.Children)
+		removed = removed || rm
+		if strings.HasPrefix(node.PermId, idxPrefix) {
+			out = append(out, children...)
+			removed = true
+			continue
+		}
+		node.Children = children
+		out = append(out, node)
+	}
+	return out, removed
+}
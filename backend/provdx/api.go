@@ -0,0 +1,238 @@
+package provdx
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+	"github.com/varunamachi/libx/utils/rest"
+)
+
+func ProvisioningEndpoints(gtx context.Context) []*httpx.Endpoint {
+	pc := core.ProvisioningCtlr(gtx)
+	return []*httpx.Endpoint{
+		createConnectorEp(pc),
+		updateConnectorEp(pc),
+		getConnectorEp(pc),
+		getConnectorsEp(pc),
+		deleteConnectorEp(pc),
+		getSyncRecordsEp(pc),
+		retryEp(pc),
+		reconcileEp(pc),
+	}
+}
+
+func createConnectorEp(pc core.ProvisioningController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var conn core.ProvisioningConnector
+		if err := etx.Bind(&conn); err != nil {
+			return errx.BadReqX(err, "failed to read connector info from request")
+		}
+
+		id, err := pc.Save(etx.Request().Context(), &conn)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, data.M{"connectorId": id})
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/provisioning/connector",
+		Category:    "idx.provisioning",
+		Desc:        "Create a provisioning connector for a service",
+		Version:     "v1",
+		Permissions: []string{PermManageProvisioning},
+		Handler:     handler,
+	}
+}
+
+func updateConnectorEp(pc core.ProvisioningController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var conn core.ProvisioningConnector
+		if err := etx.Bind(&conn); err != nil {
+			return errx.BadReqX(err, "failed to read connector info from request")
+		}
+
+		if err := pc.Update(etx.Request().Context(), &conn); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/provisioning/connector",
+		Category:    "idx.provisioning",
+		Desc:        "Update a provisioning connector",
+		Version:     "v1",
+		Permissions: []string{PermManageProvisioning},
+		Handler:     handler,
+	}
+}
+
+func getConnectorEp(pc core.ProvisioningController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		conn, err := pc.GetOne(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		conn.Token = ""
+		return httpx.SendJSON(etx, conn)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/provisioning/connector/:id",
+		Category:    "idx.provisioning",
+		Desc:        "Get a provisioning connector",
+		Version:     "v1",
+		Permissions: []string{PermGetProvisioning},
+		Handler:     handler,
+	}
+}
+
+func getConnectorsEp(pc core.ProvisioningController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		cmnParams, err := rest.GetCommonParams(etx)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		conns, err := pc.Get(etx.Request().Context(), cmnParams)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		for _, conn := range conns {
+			conn.Token = ""
+		}
+		return httpx.SendJSON(etx, conns)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/provisioning/connector",
+		Category:    "idx.provisioning",
+		Desc:        "Get provisioning connector list",
+		Version:     "v1",
+		Permissions: []string{PermGetProvisioning},
+		Handler:     handler,
+	}
+}
+
+func deleteConnectorEp(pc core.ProvisioningController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := pc.Remove(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return etx.String(http.StatusOK, strconv.FormatInt(id, 10))
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/provisioning/connector/:id",
+		Category:    "idx.provisioning",
+		Desc:        "Delete a provisioning connector",
+		Version:     "v1",
+		Permissions: []string{PermManageProvisioning},
+		Handler:     handler,
+	}
+}
+
+func getSyncRecordsEp(pc core.ProvisioningController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+		cmnParams, err := rest.GetCommonParams(etx)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		recs, err := pc.SyncRecords(etx.Request().Context(), id, cmnParams)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, recs)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/provisioning/connector/:id/sync",
+		Category:    "idx.provisioning",
+		Desc:        "Get sync state of users and groups for a connector",
+		Version:     "v1",
+		Permissions: []string{PermGetProvisioning},
+		Handler:     handler,
+	}
+}
+
+func retryEp(pc core.ProvisioningController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := pc.Retry(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/provisioning/connector/:id/retry",
+		Category:    "idx.provisioning",
+		Desc:        "Retry failed pushes of a connector",
+		Version:     "v1",
+		Permissions: []string{PermManageProvisioning},
+		Handler:     handler,
+	}
+}
+
+func reconcileEp(pc core.ProvisioningController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		report, err := pc.Reconcile(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, report)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/provisioning/connector/:id/reconcile",
+		Category:    "idx.provisioning",
+		Desc:        "Compare the target with idx and queue the differences",
+		Version:     "v1",
+		Permissions: []string{PermManageProvisioning},
+		Handler:     handler,
+	}
+}
@@ -0,0 +1,117 @@
+package provdx
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+type Client struct {
+	*httpx.Client
+	Timeout time.Duration
+}
+
+func (c *Client) build() *httpx.RequestBuilder {
+	builder := c.Build()
+	if c.Timeout != 0 {
+		builder = builder.WithTimeout(c.Timeout)
+	}
+	return builder
+}
+
+func (c *Client) CreateConnector(
+	gtx context.Context, conn *core.ProvisioningConnector) (int64, error) {
+	apiRes := c.build().Path("/api/v1/provisioning/connector").Post(gtx, conn)
+	res := map[string]int64{"connectorId": int64(-1)}
+	if err := apiRes.LoadClose(&res); err != nil {
+		return -1, errx.Errf(err,
+			"failed to create provisioning connector: '%s'", conn.Name)
+	}
+	return res["connectorId"], nil
+}
+
+func (c *Client) UpdateConnector(
+	gtx context.Context, conn *core.ProvisioningConnector) error {
+	apiRes := c.build().Path("/api/v1/provisioning/connector").Put(gtx, conn)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to update provisioning connector: '%s'", conn.Name)
+	}
+	return nil
+}
+
+func (c *Client) GetConnector(
+	gtx context.Context, id int64) (*core.ProvisioningConnector, error) {
+	apiRes := c.build().Path("/api/v1/provisioning/connector", id).Get(gtx)
+	var conn core.ProvisioningConnector
+	if err := apiRes.LoadClose(&conn); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get provisioning connector: '%d'", id)
+	}
+	return &conn, nil
+}
+
+func (c *Client) GetConnectors(
+	gtx context.Context,
+	params *data.CommonParams) ([]*core.ProvisioningConnector, error) {
+	apiRes := c.build().
+		Path("/api/v1/provisioning/connector").
+		CmnParam(params).
+		Get(gtx)
+	conns := make([]*core.ProvisioningConnector, 0, params.PageSize)
+	if err := apiRes.LoadClose(&conns); err != nil {
+		return nil, errx.Errf(err, "failed to get provisioning connectors")
+	}
+	return conns, nil
+}
+
+func (c *Client) RemoveConnector(gtx context.Context, id int64) error {
+	apiRes := c.build().Path("/api/v1/provisioning/connector", id).Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to remove provisioning connector: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) GetSyncRecords(
+	gtx context.Context,
+	id int64,
+	params *data.CommonParams) ([]*core.SyncRecord, error) {
+	apiRes := c.build().
+		Path("/api/v1/provisioning/connector", id, "sync").
+		CmnParam(params).
+		Get(gtx)
+	recs := make([]*core.SyncRecord, 0, params.PageSize)
+	if err := apiRes.LoadClose(&recs); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get sync records of connector: '%d'", id)
+	}
+	return recs, nil
+}
+
+func (c *Client) RetrySync(gtx context.Context, id int64) error {
+	apiRes := c.build().
+		Path("/api/v1/provisioning/connector", id, "retry").
+		Post(gtx, nil)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to retry sync of connector: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) Reconcile(
+	gtx context.Context, id int64) (*core.ReconcileReport, error) {
+	apiRes := c.build().
+		Path("/api/v1/provisioning/connector", id, "reconcile").
+		Post(gtx, nil)
+	var report core.ReconcileReport
+	if err := apiRes.LoadClose(&report); err != nil {
+		return nil, errx.Errf(err, "failed to reconcile connector: '%d'", id)
+	}
+	return &report, nil
+}
@@ -0,0 +1,631 @@
+package provdx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+const (
+	pushBatchSize = 100
+	maxAttempts   = 10
+	retryBase     = 30 * time.Second
+	retryMax      = time.Hour
+)
+
+type provCtl struct {
+	pstore *PgProvStorage
+}
+
+func NewProvisioningController(
+	pstore *PgProvStorage) core.ProvisioningController {
+	return &provCtl{
+		pstore: pstore,
+	}
+}
+
+func (pc *provCtl) Storage() *PgProvStorage {
+	return pc.pstore
+}
+
+func (pc *provCtl) Save(
+	gtx context.Context, conn *core.ProvisioningConnector) (int64, error) {
+	ev := core.NewEventAdder(gtx, "prov.connector.save", data.M{
+		"serviceId": conn.ServiceId,
+		"name":      conn.Name,
+		"kind":      conn.Kind,
+	})
+	if err := core.CheckServiceAdmin(gtx, conn.ServiceId); err != nil {
+		return -1, ev.Commit(err)
+	}
+	if err := validate(conn); err != nil {
+		return -1, ev.Commit(err)
+	}
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	conn.CreatedBy, conn.UpdatedBy = user.Id(), user.Id()
+	id, err := pc.pstore.Save(gtx, conn)
+	return id, ev.Commit(err)
+}
+
+func (pc *provCtl) Update(
+	gtx context.Context, conn *core.ProvisioningConnector) error {
+	ev := core.NewEventAdder(gtx, "prov.connector.update", data.M{
+		"connectorId": conn.Id,
+		"name":        conn.Name,
+	})
+	existing, err := pc.pstore.GetOne(gtx, conn.Id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if err := core.CheckServiceAdmin(gtx, existing.ServiceId); err != nil {
+		return ev.Commit(err)
+	}
+	if err := validate(conn); err != nil {
+		return ev.Commit(err)
+	}
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return ev.Commit(err)
+	}
+
+	// Token is never sent back to the clients, so an empty token means the
+	// existing one is retained
+	if conn.Token == "" {
+		conn.Token = existing.Token
+	}
+	conn.ServiceId = existing.ServiceId
+	conn.UpdatedBy = user.Id()
+	return ev.Commit(pc.pstore.Update(gtx, conn))
+}
+
+func (pc *provCtl) GetOne(
+	gtx context.Context, id int64) (*core.ProvisioningConnector, error) {
+	conn, err := pc.forAdmin(gtx, id)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "prov.connector.getOne", data.M{
+			"connectorId": id,
+		}).Commit(err)
+	}
+	return conn, nil
+}
+
+func (pc *provCtl) Remove(gtx context.Context, id int64) error {
+	ev := core.NewEventAdder(gtx, "prov.connector.remove", data.M{
+		"connectorId": id,
+	})
+	conn, err := pc.pstore.GetOne(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if err := core.CheckServiceAdmin(gtx, conn.ServiceId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(pc.pstore.Remove(gtx, id))
+}
+
+func (pc *provCtl) Get(
+	gtx context.Context,
+	params *data.CommonParams) ([]*core.ProvisioningConnector, error) {
+	conns, err := pc.pstore.Get(gtx, params)
+	if err == nil {
+		conns, err = administered(gtx, conns)
+	}
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "prov.connector.get", data.M{
+			"params": params,
+		}).Commit(err)
+	}
+	return conns, nil
+}
+
+// administered - connectors of the services the user in the context is an
+// admin of, tenant admins and super users see all of them
+func administered(
+	gtx context.Context,
+	conns []*core.ProvisioningConnector) ([]*core.ProvisioningConnector, error) {
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, err
+	}
+	if user.TenantAdmin() {
+		return conns, nil
+	}
+
+	admin := map[int64]bool{}
+	out := make([]*core.ProvisioningConnector, 0, len(conns))
+	for _, conn := range conns {
+		isAdmin, found := admin[conn.ServiceId]
+		if !found {
+			err := core.CheckServiceAdmin(gtx, conn.ServiceId)
+			if err != nil && !errors.Is(err, core.ErrUnauthorized) {
+				return nil, err
+			}
+			isAdmin = err == nil
+			admin[conn.ServiceId] = isAdmin
+		}
+		if isAdmin {
+			out = append(out, conn)
+		}
+	}
+	return out, nil
+}
+
+// forAdmin - connector with the given id if the user in the context is an
+// admin of its service
+func (pc *provCtl) forAdmin(
+	gtx context.Context, id int64) (*core.ProvisioningConnector, error) {
+	conn, err := pc.pstore.GetOne(gtx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := core.CheckServiceAdmin(gtx, conn.ServiceId); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (pc *provCtl) SyncRecords(
+	gtx context.Context,
+	connectorId int64,
+	params *data.CommonParams) ([]*core.SyncRecord, error) {
+	_, err := pc.forAdmin(gtx, connectorId)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "prov.sync.get", data.M{
+			"connectorId": connectorId,
+		}).Commit(err)
+	}
+	recs, err := pc.pstore.Records(gtx, connectorId, params)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "prov.sync.get", data.M{
+			"connectorId": connectorId,
+		}).Commit(err)
+	}
+	return recs, nil
+}
+
+func (pc *provCtl) Retry(gtx context.Context, connectorId int64) error {
+	ev := core.NewEventAdder(gtx, "prov.sync.retry", data.M{
+		"connectorId": connectorId,
+	})
+	if _, err := pc.forAdmin(gtx, connectorId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(pc.pstore.Retry(gtx, connectorId))
+}
+
+func (pc *provCtl) Notify(
+	gtx context.Context, resType core.ProvResource, id int64) error {
+	connIds, err := pc.pstore.ConnectorsFor(gtx, resType, id)
+	if err != nil {
+		return err
+	}
+	for _, connId := range connIds {
+		if err := pc.pstore.MarkPending(gtx, connId, resType, id, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pc *provCtl) PushDue(gtx context.Context) (int, error) {
+	recs, err := pc.pstore.Due(gtx, pushBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	conns := map[int64]*core.ProvisioningConnector{}
+	targets := map[int64]target{}
+	for _, rec := range recs {
+		conn, tgt := conns[rec.ConnectorId], targets[rec.ConnectorId]
+		if conn == nil {
+			conn, err = pc.pstore.GetOne(gtx, rec.ConnectorId)
+			if err != nil {
+				return 0, err
+			}
+			if tgt, err = newTarget(conn); err != nil {
+				return 0, err
+			}
+			conns[conn.Id], targets[conn.Id] = conn, tgt
+		}
+
+		ev := core.NewEventAdder(gtx, "prov.push", data.M{
+			"connectorId":  rec.ConnectorId,
+			"resourceType": rec.ResourceType,
+			"resourceId":   rec.ResourceId,
+		})
+		if rec.ResourceType == core.ProvUser {
+			err = pc.pushUser(gtx, conn, tgt, rec)
+		} else {
+			err = pc.pushGroup(gtx, conn, tgt, rec)
+		}
+		if err != nil {
+			if e := pc.markFailed(gtx, rec, err); e != nil {
+				return 0, ev.Commit(e)
+			}
+		}
+		ev.Commit(err)
+	}
+	return len(recs), nil
+}
+
+func (pc *provCtl) Reconcile(
+	gtx context.Context, connectorId int64) (*core.ReconcileReport, error) {
+	ev := core.NewEventAdder(gtx, "prov.reconcile", data.M{
+		"connectorId": connectorId,
+	})
+	conn, err := pc.forAdmin(gtx, connectorId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	report, err := pc.reconcile(gtx, conn)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	ev.AddData("report", report)
+	return report, ev.Commit(nil)
+}
+
+// reconcile - reconciles the connector without checking the user, used by
+// the background worker as well
+func (pc *provCtl) reconcile(
+	gtx context.Context,
+	conn *core.ProvisioningConnector) (*core.ReconcileReport, error) {
+	tgt, err := newTarget(conn)
+	if err != nil {
+		return nil, err
+	}
+	userIds, err := pc.pstore.Members(gtx, conn.ServiceId)
+	if err != nil {
+		return nil, err
+	}
+	groupIds, err := pc.pstore.Groups(gtx, conn.ServiceId)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &core.ReconcileReport{
+		ConnectorId: conn.Id,
+		Orphans:     []string{},
+	}
+	ls, ok := tgt.(lister)
+	if !ok {
+		report.FullResync = true
+		err = pc.queueAll(gtx, conn, userIds, groupIds, report)
+	} else {
+		err = pc.diff(gtx, conn, ls, userIds, groupIds, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// queueAll - queues every member and group of the service, failed records of
+// resources that left the service are retried as well
+func (pc *provCtl) queueAll(
+	gtx context.Context,
+	conn *core.ProvisioningConnector,
+	userIds, groupIds []int64,
+	report *core.ReconcileReport) error {
+
+	for _, id := range userIds {
+		err := pc.pstore.MarkPending(gtx, conn.Id, core.ProvUser, id, "")
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range groupIds {
+		err := pc.pstore.MarkPending(gtx, conn.Id, core.ProvGroup, id, "")
+		if err != nil {
+			return err
+		}
+	}
+	report.UsersQueued, report.GroupsQueued = len(userIds), len(groupIds)
+	return pc.pstore.Retry(gtx, conn.Id)
+}
+
+// diff - compares the state of the target with idx and queues the users and
+// groups that are missing or differ. Remote users that are not known to idx
+// are reported as orphans, they are left alone
+func (pc *provCtl) diff(
+	gtx context.Context,
+	conn *core.ProvisioningConnector,
+	ls lister,
+	userIds, groupIds []int64,
+	report *core.ReconcileReport) error {
+
+	remoteUsers, err := ls.Users(gtx)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*core.ScimUser, len(remoteUsers))
+	remoteNames := make(map[string]string, len(remoteUsers))
+	for _, ru := range remoteUsers {
+		byName[strings.ToLower(ru.UserName)] = ru
+		remoteNames[ru.Id] = strings.ToLower(ru.UserName)
+	}
+
+	for _, id := range userIds {
+		su, err := outboundUser(gtx, id, true)
+		if err != nil {
+			return err
+		}
+		name := strings.ToLower(su.UserName)
+		remote := byName[name]
+		delete(byName, name)
+		if remote != nil && !userDrifted(su, remote) {
+			continue
+		}
+		err = pc.pstore.MarkPending(
+			gtx, conn.Id, core.ProvUser, id, remoteIdOf(remote))
+		if err != nil {
+			return err
+		}
+		report.UsersQueued++
+	}
+
+	// Remaining remote users are not members of the service anymore, the
+	// active ones are queued for deactivation
+	for _, remote := range byName {
+		if remote.Active != nil && !*remote.Active {
+			continue
+		}
+		user, err := core.UserCtlr(gtx).ByUsername(gtx, remote.UserName)
+		if errors.Is(err, sql.ErrNoRows) {
+			report.Orphans = append(report.Orphans, remote.UserName)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = pc.pstore.MarkPending(
+			gtx, conn.Id, core.ProvUser, user.Id(), remote.Id)
+		if err != nil {
+			return err
+		}
+		report.UsersQueued++
+	}
+
+	remoteGroups, err := ls.Groups(gtx)
+	if err != nil {
+		return err
+	}
+	groupsByName := make(map[string]*core.ScimGroup, len(remoteGroups))
+	for _, rg := range remoteGroups {
+		groupsByName[rg.DisplayName] = rg
+	}
+
+	for _, id := range groupIds {
+		sg, err := core.ScimCtlr(gtx).GetGroup(gtx, id)
+		if err != nil {
+			return err
+		}
+		remote := groupsByName[sg.DisplayName]
+		delete(groupsByName, sg.DisplayName)
+		if remote != nil && !groupDrifted(sg, remote, remoteNames) {
+			continue
+		}
+		remoteId := ""
+		if remote != nil {
+			remoteId = remote.Id
+		}
+		err = pc.pstore.MarkPending(gtx, conn.Id, core.ProvGroup, id, remoteId)
+		if err != nil {
+			return err
+		}
+		report.GroupsQueued++
+	}
+	for name := range groupsByName {
+		report.Orphans = append(report.Orphans, "group:"+name)
+	}
+	return nil
+}
+
+func (pc *provCtl) pushUser(
+	gtx context.Context,
+	conn *core.ProvisioningConnector,
+	tgt target,
+	rec *core.SyncRecord) error {
+
+	member, err := pc.pstore.IsMember(gtx, rec.ResourceId, conn.ServiceId)
+	if err != nil {
+		return err
+	}
+	su, err := outboundUser(gtx, rec.ResourceId, member)
+	if errors.Is(err, sql.ErrNoRows) {
+		if rec.RemoteId != "" {
+			if err := tgt.DeleteUser(gtx, rec.RemoteId); err != nil {
+				return err
+			}
+		}
+		return pc.pstore.RemoveRecord(gtx, rec)
+	}
+	if err != nil {
+		return err
+	}
+	if !member && rec.RemoteId == "" {
+		// Never reached the target, nothing to deactivate
+		return pc.pstore.RemoveRecord(gtx, rec)
+	}
+
+	remoteId, err := tgt.PutUser(gtx, rec.RemoteId, su)
+	if err != nil {
+		return err
+	}
+	return pc.pstore.MarkSynced(gtx, rec, remoteId)
+}
+
+func (pc *provCtl) pushGroup(
+	gtx context.Context,
+	conn *core.ProvisioningConnector,
+	tgt target,
+	rec *core.SyncRecord) error {
+
+	exists, err := core.GroupCtlr(gtx).Exists(gtx, rec.ResourceId)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if rec.RemoteId != "" {
+			if err := tgt.DeleteGroup(gtx, rec.RemoteId); err != nil {
+				return err
+			}
+		}
+		return pc.pstore.RemoveRecord(gtx, rec)
+	}
+
+	sg, err := core.ScimCtlr(gtx).GetGroup(gtx, rec.ResourceId)
+	if err != nil {
+		return err
+	}
+
+	// Members are referred by their id in the target, group is pushed only
+	// after all the members have reached the target
+	members := make([]core.ScimValue, 0, len(sg.Members))
+	for _, m := range sg.Members {
+		userId, _ := strconv.ParseInt(m.Value, 10, 64)
+		urec, err := pc.pstore.Record(gtx, conn.Id, core.ProvUser, userId)
+		if err != nil {
+			return err
+		}
+		if urec == nil || urec.RemoteId == "" {
+			if urec == nil {
+				err := pc.pstore.MarkPending(
+					gtx, conn.Id, core.ProvUser, userId, "")
+				if err != nil {
+					return err
+				}
+			}
+			return errx.Errf(ErrPushFailed,
+				"member '%s' of group '%s' is not synced yet",
+				m.Display, sg.DisplayName)
+		}
+		members = append(members, core.ScimValue{
+			Value:   urec.RemoteId,
+			Display: m.Display,
+		})
+	}
+
+	sg.ExternalId = sg.Id
+	sg.Id, sg.Meta, sg.Idx = "", nil, nil
+	sg.Schemas = []string{core.ScimGroupSchema}
+	sg.Members = members
+
+	remoteId, err := tgt.PutGroup(gtx, rec.RemoteId, sg)
+	if err != nil {
+		return err
+	}
+	return pc.pstore.MarkSynced(gtx, rec, remoteId)
+}
+
+// markFailed - schedules the next attempt with exponential backoff, record
+// is parked in error state once the attempts run out
+func (pc *provCtl) markFailed(
+	gtx context.Context, rec *core.SyncRecord, cause error) error {
+	state := core.SyncFailed
+	if rec.Attempts+1 >= maxAttempts {
+		state = core.SyncError
+	}
+
+	delay := retryMax
+	if rec.Attempts < 7 {
+		delay = min(retryBase<<rec.Attempts, retryMax)
+	}
+	return pc.pstore.MarkFailed(
+		gtx, rec, state, time.Now().Add(delay), cause.Error())
+}
+
+// outboundUser - SCIM representation of an user as sent to the targets.
+// Users that are not members of the service are sent as inactive
+func outboundUser(
+	gtx context.Context, userId int64, member bool) (*core.ScimUser, error) {
+	su, err := core.ScimCtlr(gtx).GetUser(gtx, userId)
+	if err != nil {
+		return nil, err
+	}
+	active := member && su.Active != nil && *su.Active
+	su.ExternalId = su.Id
+	su.Id, su.Groups, su.Meta = "", nil, nil
+	su.Active = &active
+	return su, nil
+}
+
+func userDrifted(want, have *core.ScimUser) bool {
+	if have.Active == nil || *have.Active != *want.Active {
+		return true
+	}
+	if primaryEmail(want) != primaryEmail(have) {
+		return true
+	}
+	if want.Name != nil && (have.Name == nil ||
+		want.Name.GivenName != have.Name.GivenName ||
+		want.Name.FamilyName != have.Name.FamilyName) {
+		return true
+	}
+	return false
+}
+
+func groupDrifted(
+	want, have *core.ScimGroup, remoteNames map[string]string) bool {
+	if len(want.Members) != len(have.Members) {
+		return true
+	}
+	names := make(map[string]bool, len(have.Members))
+	for _, m := range have.Members {
+		names[remoteNames[m.Value]] = true
+	}
+	for _, m := range want.Members {
+		if !names[strings.ToLower(m.Display)] {
+			return true
+		}
+	}
+	return false
+}
+
+func primaryEmail(su *core.ScimUser) string {
+	for _, email := range su.Emails {
+		if email.Primary {
+			return strings.ToLower(email.Value)
+		}
+	}
+	if len(su.Emails) != 0 {
+		return strings.ToLower(su.Emails[0].Value)
+	}
+	return ""
+}
+
+func remoteIdOf(su *core.ScimUser) string {
+	if su == nil {
+		return ""
+	}
+	return su.Id
+}
+
+func validate(conn *core.ProvisioningConnector) error {
+	if conn.Name == "" {
+		return errx.Errf(core.ErrInvalidState, "connector name is required")
+	}
+	if !data.OneOf(conn.Kind, core.ScimConnector, core.WebhookConnector) {
+		return errx.Errf(core.ErrInvalidState,
+			"unsupported connector kind '%s'", conn.Kind)
+	}
+	u, err := url.Parse(conn.Endpoint)
+	if err != nil || !data.OneOf(u.Scheme, "http", "https") || u.Host == "" {
+		return errx.Errf(core.ErrInvalidState,
+			"invalid connector endpoint '%s'", conn.Endpoint)
+	}
+	return nil
+}
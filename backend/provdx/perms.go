@@ -0,0 +1,6 @@
+package provdx
+
+const (
+	PermManageProvisioning = "idx.manageProvisioning"
+	PermGetProvisioning    = "idx.getProvisioning"
+)
@@ -0,0 +1,406 @@
+package provdx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+type PgProvStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewProvStorage(gd data.GetterDeleter) *PgProvStorage {
+	return &PgProvStorage{
+		gd: gd,
+	}
+}
+
+func (pps *PgProvStorage) Save(
+	gtx context.Context, conn *core.ProvisioningConnector) (int64, error) {
+	query := `
+		INSERT INTO idx_prov_connector (
+			created_by,
+			updated_by,
+			service_id,
+			name,
+			kind,
+			endpoint,
+			token,
+			enabled
+		) VALUES (
+			:created_by,
+			:updated_by,
+			:service_id,
+			:name,
+			:kind,
+			:endpoint,
+			:token,
+			:enabled
+		) RETURNING id;
+	`
+
+	stmt, err := pg.Conn().PrepareNamed(query)
+	if err != nil {
+		return -1, errx.Errf(err, "failed to prepare query to save connector")
+	}
+
+	sealed := *conn
+	if err := core.SealAll(gtx, &sealed.Token); err != nil {
+		return -1, errx.Errf(err, "failed to seal connector token")
+	}
+
+	var id int64
+	if err = stmt.GetContext(gtx, &id, &sealed); err != nil {
+		return -1, errx.Errf(err,
+			"failed to insert connector '%s' to database", conn.Name)
+	}
+	return id, nil
+}
+
+func (pps *PgProvStorage) Update(
+	gtx context.Context, conn *core.ProvisioningConnector) error {
+	conn.UpdatedOn = time.Now()
+	query := `
+		UPDATE idx_prov_connector SET
+			updated_by = :updated_by,
+			updated_on = :updated_on,
+			name = :name,
+			kind = :kind,
+			endpoint = :endpoint,
+			token = :token,
+			enabled = :enabled
+		WHERE id = :id AND ` + core.TenantServiceCond(gtx, "service_id")
+	sealed := *conn
+	if err := core.SealAll(gtx, &sealed.Token); err != nil {
+		return errx.Errf(err, "failed to seal connector token")
+	}
+	if _, err := pg.Conn().NamedExecContext(gtx, query, &sealed); err != nil {
+		return errx.Errf(err, "failed to update connector '%s'", conn.Name)
+	}
+	return nil
+}
+
+func (pps *PgProvStorage) GetOne(
+	gtx context.Context, id int64) (*core.ProvisioningConnector, error) {
+	var conn core.ProvisioningConnector
+	err := pps.gd.GetOne(gtx, pps.table(gtx), "id", id, &conn)
+	if err != nil {
+		return nil, errx.Wrap(err)
+	}
+	if err := core.OpenAll(gtx, &conn.Token); err != nil {
+		return nil, errx.Errf(err, "failed to open connector token")
+	}
+	return &conn, nil
+}
+
+func (pps *PgProvStorage) Remove(gtx context.Context, id int64) error {
+	query := `DELETE FROM idx_prov_connector WHERE id = $1 AND ` +
+		core.TenantServiceCond(gtx, "service_id")
+	if _, err := pg.Conn().ExecContext(gtx, query, id); err != nil {
+		return errx.Errf(err, "failed to remove connector '%d'", id)
+	}
+	return nil
+}
+
+func (pps *PgProvStorage) Get(
+	gtx context.Context,
+	params *data.CommonParams) ([]*core.ProvisioningConnector, error) {
+	out := make([]*core.ProvisioningConnector, 0, params.PageSize)
+	if err := pps.gd.Get(gtx, pps.table(gtx), params, &out); err != nil {
+		return nil, errx.Wrap(err)
+	}
+	for _, conn := range out {
+		if err := core.OpenAll(gtx, &conn.Token); err != nil {
+			return nil, errx.Errf(err, "failed to open connector token")
+		}
+	}
+	return out, nil
+}
+
+// table - connectors of the services of the tenant in scope
+func (pps *PgProvStorage) table(gtx context.Context) string {
+	return "(SELECT * FROM idx_prov_connector WHERE " +
+		core.TenantServiceCond(gtx, "service_id") + ") AS idx_prov_connector"
+}
+
+func (pps *PgProvStorage) Enabled(
+	gtx context.Context) ([]*core.ProvisioningConnector, error) {
+	const query = `SELECT * FROM idx_prov_connector WHERE enabled`
+	out := make([]*core.ProvisioningConnector, 0, 10)
+	if err := pg.Conn().SelectContext(gtx, &out, query); err != nil {
+		return nil, errx.Errf(err, "failed to get enabled connectors")
+	}
+	for _, conn := range out {
+		if err := core.OpenAll(gtx, &conn.Token); err != nil {
+			return nil, errx.Errf(err, "failed to open connector token")
+		}
+	}
+	return out, nil
+}
+
+// ConnectorsFor - ids of enabled connectors the resource is relevant to,
+// which are the connectors of the services the resource belongs to and the
+// connectors the resource was synced with earlier
+func (pps *PgProvStorage) ConnectorsFor(
+	gtx context.Context,
+	resType core.ProvResource,
+	id int64) ([]int64, error) {
+	serviceQuery := `
+		SELECT g.service_id
+		FROM user_to_group ug
+		JOIN idx_group g ON g.id = ug.group_id
+		WHERE ug.user_id = $1
+	`
+	if resType == core.ProvGroup {
+		serviceQuery = `SELECT service_id FROM idx_group WHERE id = $1`
+	}
+
+	query := `
+		SELECT c.id FROM idx_prov_connector c
+		WHERE c.enabled AND (
+			c.service_id IN (` + serviceQuery + `) OR
+			c.id IN (
+				SELECT connector_id FROM idx_prov_sync
+				WHERE resource_type = $2 AND resource_id = $1
+			)
+		)
+	`
+	ids := make([]int64, 0, 10)
+	if err := pg.Conn().SelectContext(gtx, &ids, query, id, resType); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get connectors for %s '%d'", resType, id)
+	}
+	return ids, nil
+}
+
+// MarkPending - queues the resource for immediate sync, remote id is kept
+// unless a new one is given
+func (pps *PgProvStorage) MarkPending(
+	gtx context.Context,
+	connectorId int64,
+	resType core.ProvResource,
+	id int64,
+	remoteId string) error {
+	const query = `
+		INSERT INTO idx_prov_sync (
+			connector_id,
+			resource_type,
+			resource_id,
+			remote_id,
+			state,
+			attempts,
+			next_attempt
+		) VALUES (
+			$1, $2, $3, $4, $5, 0, NOW()
+		) ON CONFLICT (connector_id, resource_type, resource_id) DO UPDATE SET
+			remote_id = CASE
+				WHEN EXCLUDED.remote_id = '' THEN idx_prov_sync.remote_id
+				ELSE EXCLUDED.remote_id
+			END,
+			state = EXCLUDED.state,
+			attempts = 0,
+			next_attempt = NOW()
+	`
+	_, err := pg.Conn().ExecContext(
+		gtx, query, connectorId, resType, id, remoteId, core.SyncPending)
+	if err != nil {
+		return errx.Errf(err, "failed to queue %s '%d' for connector '%d'",
+			resType, id, connectorId)
+	}
+	return nil
+}
+
+func (pps *PgProvStorage) MarkSynced(
+	gtx context.Context, rec *core.SyncRecord, remoteId string) error {
+	const query = `
+		UPDATE idx_prov_sync SET
+			remote_id = $4,
+			state = $5,
+			attempts = 0,
+			last_error = '',
+			synced_on = NOW()
+		WHERE connector_id = $1 AND resource_type = $2 AND resource_id = $3
+	`
+	_, err := pg.Conn().ExecContext(gtx, query,
+		rec.ConnectorId, rec.ResourceType, rec.ResourceId,
+		remoteId, core.SyncDone)
+	if err != nil {
+		return errx.Errf(err, "failed to mark %s '%d' as synced",
+			rec.ResourceType, rec.ResourceId)
+	}
+	return nil
+}
+
+func (pps *PgProvStorage) MarkFailed(
+	gtx context.Context,
+	rec *core.SyncRecord,
+	state core.SyncState,
+	nextAttempt time.Time,
+	reason string) error {
+	const query = `
+		UPDATE idx_prov_sync SET
+			state = $4,
+			attempts = attempts + 1,
+			last_error = $5,
+			next_attempt = $6
+		WHERE connector_id = $1 AND resource_type = $2 AND resource_id = $3
+	`
+	_, err := pg.Conn().ExecContext(gtx, query,
+		rec.ConnectorId, rec.ResourceType, rec.ResourceId,
+		state, reason, nextAttempt)
+	if err != nil {
+		return errx.Errf(err, "failed to mark %s '%d' as failed",
+			rec.ResourceType, rec.ResourceId)
+	}
+	return nil
+}
+
+func (pps *PgProvStorage) RemoveRecord(
+	gtx context.Context, rec *core.SyncRecord) error {
+	const query = `
+		DELETE FROM idx_prov_sync
+		WHERE connector_id = $1 AND resource_type = $2 AND resource_id = $3
+	`
+	_, err := pg.Conn().ExecContext(gtx, query,
+		rec.ConnectorId, rec.ResourceType, rec.ResourceId)
+	if err != nil {
+		return errx.Errf(err, "failed to remove sync record of %s '%d'",
+			rec.ResourceType, rec.ResourceId)
+	}
+	return nil
+}
+
+// Retry - makes failed records of the connector due immediately
+func (pps *PgProvStorage) Retry(gtx context.Context, connectorId int64) error {
+	const query = `
+		UPDATE idx_prov_sync SET
+			state = $2,
+			attempts = 0,
+			next_attempt = NOW()
+		WHERE connector_id = $1 AND state IN ($3, $4)
+	`
+	_, err := pg.Conn().ExecContext(gtx, query,
+		connectorId, core.SyncPending, core.SyncFailed, core.SyncError)
+	if err != nil {
+		return errx.Errf(err,
+			"failed to retry sync records of connector '%d'", connectorId)
+	}
+	return nil
+}
+
+// Due - records that are pending or failed and due for a retry. Users come
+// first so that group members already exist in the target
+func (pps *PgProvStorage) Due(
+	gtx context.Context, limit int) ([]*core.SyncRecord, error) {
+	const query = `
+		SELECT s.* FROM idx_prov_sync s
+		JOIN idx_prov_connector c ON c.id = s.connector_id
+		WHERE c.enabled AND
+			s.state IN ($1, $2) AND
+			s.next_attempt <= NOW()
+		ORDER BY s.resource_type DESC, s.next_attempt
+		LIMIT $3
+	`
+	out := make([]*core.SyncRecord, 0, limit)
+	err := pg.Conn().SelectContext(gtx, &out, query,
+		core.SyncPending, core.SyncFailed, limit)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get due sync records")
+	}
+	return out, nil
+}
+
+func (pps *PgProvStorage) Record(
+	gtx context.Context,
+	connectorId int64,
+	resType core.ProvResource,
+	id int64) (*core.SyncRecord, error) {
+	const query = `
+		SELECT * FROM idx_prov_sync
+		WHERE connector_id = $1 AND resource_type = $2 AND resource_id = $3
+	`
+	var rec core.SyncRecord
+	err := pg.Conn().GetContext(gtx, &rec, query, connectorId, resType, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get sync record of %s '%d'",
+			resType, id)
+	}
+	return &rec, nil
+}
+
+func (pps *PgProvStorage) Records(
+	gtx context.Context,
+	connectorId int64,
+	params *data.CommonParams) ([]*core.SyncRecord, error) {
+	const query = `
+		SELECT * FROM idx_prov_sync
+		WHERE connector_id = $1
+		ORDER BY resource_type, resource_id
+		OFFSET $2 LIMIT $3
+	`
+	out := make([]*core.SyncRecord, 0, params.PageSize)
+	err := pg.Conn().SelectContext(gtx, &out, query,
+		connectorId, params.Offset(), params.Limit())
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get sync records of connector '%d'", connectorId)
+	}
+	return out, nil
+}
+
+// IsMember - checks if the user is a member of any group of the service
+func (pps *PgProvStorage) IsMember(
+	gtx context.Context, userId, serviceId int64) (bool, error) {
+	const query = `
+		SELECT EXISTS(
+			SELECT 1 FROM user_to_group ug
+			JOIN idx_group g ON g.id = ug.group_id
+			WHERE ug.user_id = $1 AND g.service_id = $2
+		)
+	`
+	var member bool
+	err := pg.Conn().GetContext(gtx, &member, query, userId, serviceId)
+	if err != nil {
+		return false, errx.Errf(err,
+			"failed to check membership of user '%d' in service '%d'",
+			userId, serviceId)
+	}
+	return member, nil
+}
+
+// Members - ids of users that are members of any group of the service
+func (pps *PgProvStorage) Members(
+	gtx context.Context, serviceId int64) ([]int64, error) {
+	const query = `
+		SELECT DISTINCT ug.user_id FROM user_to_group ug
+		JOIN idx_group g ON g.id = ug.group_id
+		WHERE g.service_id = $1
+	`
+	ids := make([]int64, 0, 100)
+	if err := pg.Conn().SelectContext(gtx, &ids, query, serviceId); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get members of service '%d'", serviceId)
+	}
+	return ids, nil
+}
+
+func (pps *PgProvStorage) Groups(
+	gtx context.Context, serviceId int64) ([]int64, error) {
+	const query = `SELECT id FROM idx_group WHERE service_id = $1`
+	ids := make([]int64, 0, 100)
+	if err := pg.Conn().SelectContext(gtx, &ids, query, serviceId); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get groups of service '%d'", serviceId)
+	}
+	return ids, nil
+}
@@ -0,0 +1,285 @@
+package provdx
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+)
+
+var (
+	ErrPushFailed     = errors.New("provisioning push failed")
+	errRemoteNotFound = errors.New("remote resource not found")
+)
+
+// target - downstream system that receives the users and groups of a service.
+// Put methods create the resource when remote id is empty and give back the
+// id of the resource in the target
+type target interface {
+	PutUser(gtx context.Context,
+		remoteId string, user *core.ScimUser) (string, error)
+	DeleteUser(gtx context.Context, remoteId string) error
+	PutGroup(gtx context.Context,
+		remoteId string, group *core.ScimGroup) (string, error)
+	DeleteGroup(gtx context.Context, remoteId string) error
+}
+
+// lister - target whose state can be read back for reconciliation
+type lister interface {
+	Users(gtx context.Context) ([]*core.ScimUser, error)
+	Groups(gtx context.Context) ([]*core.ScimGroup, error)
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func newTarget(conn *core.ProvisioningConnector) (target, error) {
+	switch conn.Kind {
+	case core.ScimConnector:
+		return &scimTarget{
+			baseUrl: strings.TrimSuffix(conn.Endpoint, "/"),
+			token:   conn.Token,
+		}, nil
+	case core.WebhookConnector:
+		return &webhookTarget{
+			url:    conn.Endpoint,
+			secret: conn.Token,
+		}, nil
+	}
+	return nil, errx.Errf(core.ErrInvalidState,
+		"unknown connector kind '%s'", conn.Kind)
+}
+
+type scimTarget struct {
+	baseUrl string
+	token   string
+}
+
+func (st *scimTarget) PutUser(
+	gtx context.Context, remoteId string, user *core.ScimUser) (string, error) {
+	return put(gtx, st, "/Users", remoteId, "userName", user.UserName, user)
+}
+
+func (st *scimTarget) DeleteUser(gtx context.Context, remoteId string) error {
+	return st.delete(gtx, "/Users/"+url.PathEscape(remoteId))
+}
+
+func (st *scimTarget) PutGroup(
+	gtx context.Context,
+	remoteId string,
+	group *core.ScimGroup) (string, error) {
+	return put(gtx, st, "/Groups", remoteId,
+		"displayName", group.DisplayName, group)
+}
+
+func (st *scimTarget) DeleteGroup(gtx context.Context, remoteId string) error {
+	return st.delete(gtx, "/Groups/"+url.PathEscape(remoteId))
+}
+
+func (st *scimTarget) Users(gtx context.Context) ([]*core.ScimUser, error) {
+	return list[*core.ScimUser](gtx, st, "/Users")
+}
+
+func (st *scimTarget) Groups(gtx context.Context) ([]*core.ScimGroup, error) {
+	return list[*core.ScimGroup](gtx, st, "/Groups")
+}
+
+// put - creates or replaces the resource. Resources that are not known yet
+// are looked up by their unique attribute first, so that accounts that
+// already exist in the target are adopted instead of duplicated
+func put(
+	gtx context.Context,
+	st *scimTarget,
+	path, remoteId, uniqueAttr, uniqueVal string,
+	resource any) (string, error) {
+	if remoteId == "" {
+		val, _ := json.Marshal(uniqueVal)
+		query := url.Values{}
+		query.Set("filter", uniqueAttr+" eq "+string(val))
+		var res struct {
+			Resources []struct {
+				Id string `json:"id"`
+			} `json:"Resources"`
+		}
+		if err := st.do(gtx, http.MethodGet, path, query, nil, &res); err != nil {
+			return "", err
+		}
+		if len(res.Resources) != 0 {
+			remoteId = res.Resources[0].Id
+		}
+	}
+
+	var out struct {
+		Id string `json:"id"`
+	}
+	if remoteId != "" {
+		err := st.do(gtx, http.MethodPut,
+			path+"/"+url.PathEscape(remoteId), nil, resource, &out)
+		if !errors.Is(err, errRemoteNotFound) {
+			if out.Id == "" {
+				out.Id = remoteId
+			}
+			return out.Id, err
+		}
+	}
+
+	err := st.do(gtx, http.MethodPost, path, nil, resource, &out)
+	return out.Id, err
+}
+
+func list[T any](gtx context.Context, st *scimTarget, path string) ([]T, error) {
+	const pageSize = 100
+	out := make([]T, 0, pageSize)
+	for start := 1; ; start += pageSize {
+		query := url.Values{}
+		query.Set("startIndex", strconv.Itoa(start))
+		query.Set("count", strconv.Itoa(pageSize))
+
+		var res struct {
+			TotalResults int `json:"totalResults"`
+			Resources    []T `json:"Resources"`
+		}
+		if err := st.do(gtx, http.MethodGet, path, query, nil, &res); err != nil {
+			return nil, err
+		}
+		out = append(out, res.Resources...)
+		if len(res.Resources) == 0 || len(out) >= res.TotalResults {
+			return out, nil
+		}
+	}
+}
+
+func (st *scimTarget) delete(gtx context.Context, path string) error {
+	err := st.do(gtx, http.MethodDelete, path, nil, nil, nil)
+	if errors.Is(err, errRemoteNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (st *scimTarget) do(
+	gtx context.Context,
+	method, path string,
+	query url.Values,
+	body, out any) error {
+
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return errx.Errf(err, "failed to marshal SCIM request")
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	target := st.baseUrl + path
+	if len(query) != 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(gtx, method, target, reader)
+	if err != nil {
+		return errx.Errf(err, "failed to create SCIM request")
+	}
+	req.Header.Set("Accept", "application/scim+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/scim+json")
+	}
+	if st.token != "" {
+		req.Header.Set("Authorization", "Bearer "+st.token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errx.Errf(ErrPushFailed, "%s %s: %v", method, target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errRemoteNotFound
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errx.Errf(ErrPushFailed, "%s %s: %s %s",
+			method, target, resp.Status, string(msg))
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errx.Errf(ErrPushFailed,
+			"%s %s: invalid response: %v", method, target, err)
+	}
+	return nil
+}
+
+// webhookTarget - posts every change as JSON to an URL. The body is signed
+// with HMAC-SHA256 using the connector token, the signature is sent in the
+// X-Idx-Signature header
+type webhookTarget struct {
+	url    string
+	secret string
+}
+
+func (wt *webhookTarget) PutUser(
+	gtx context.Context, remoteId string, user *core.ScimUser) (string, error) {
+	return user.ExternalId, wt.post(gtx, "user.put", user)
+}
+
+func (wt *webhookTarget) DeleteUser(gtx context.Context, remoteId string) error {
+	return wt.post(gtx, "user.delete", map[string]string{"id": remoteId})
+}
+
+func (wt *webhookTarget) PutGroup(
+	gtx context.Context,
+	remoteId string,
+	group *core.ScimGroup) (string, error) {
+	return group.ExternalId, wt.post(gtx, "group.put", group)
+}
+
+func (wt *webhookTarget) DeleteGroup(gtx context.Context, remoteId string) error {
+	return wt.post(gtx, "group.delete", map[string]string{"id": remoteId})
+}
+
+func (wt *webhookTarget) post(
+	gtx context.Context, event string, resource any) error {
+	raw, err := json.Marshal(map[string]any{
+		"event":    event,
+		"time":     time.Now().UTC(),
+		"resource": resource,
+	})
+	if err != nil {
+		return errx.Errf(err, "failed to marshal webhook payload")
+	}
+
+	req, err := http.NewRequestWithContext(
+		gtx, http.MethodPost, wt.url, bytes.NewReader(raw))
+	if err != nil {
+		return errx.Errf(err, "failed to create webhook request")
+	}
+	mac := hmac.New(sha256.New, []byte(wt.secret))
+	mac.Write(raw)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Idx-Event", event)
+	req.Header.Set("X-Idx-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errx.Errf(ErrPushFailed, "POST %s: %v", wt.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errx.Errf(ErrPushFailed, "POST %s: %s", wt.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package provdx
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+)
+
+// Run - pushes the due changes every push interval and reconciles all the
+// enabled connectors every reconcile interval. Returns when the context is
+// done
+func Run(gtx context.Context, pushInterval, reconcileInterval time.Duration) {
+	pushTicker := time.NewTicker(pushInterval)
+	defer pushTicker.Stop()
+	reconcileTicker := time.NewTicker(reconcileInterval)
+	defer reconcileTicker.Stop()
+
+	for {
+		select {
+		case <-gtx.Done():
+			return
+		case <-pushTicker.C:
+			pushAll(gtx)
+		case <-reconcileTicker.C:
+			reconcileAll(gtx)
+		}
+	}
+}
+
+func pushAll(gtx context.Context) {
+	pc := core.ProvisioningCtlr(gtx)
+	for gtx.Err() == nil {
+		num, err := pc.PushDue(gtx)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to push provisioning changes")
+			return
+		}
+		if num < pushBatchSize {
+			return
+		}
+	}
+}
+
+func reconcileAll(gtx context.Context) {
+	pc, ok := core.ProvisioningCtlr(gtx).(*provCtl)
+	if !ok {
+		return
+	}
+	conns, err := pc.pstore.Enabled(gtx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get provisioning connectors")
+		return
+	}
+	for _, conn := range conns {
+		report, err := pc.reconcile(gtx, conn)
+		core.NewEventAdder(gtx, "prov.reconcile", data.M{
+			"connectorId": conn.Id,
+			"report":      report,
+		}).Commit(err)
+		if err != nil {
+			log.Error().Err(err).
+				Int64("connectorId", conn.Id).
+				Msg("failed to reconcile provisioning connector")
+			continue
+		}
+		log.Info().
+			Int64("connectorId", conn.Id).
+			Int("users", report.UsersQueued).
+			Int("groups", report.GroupsQueued).
+			Int("orphans", len(report.Orphans)).
+			Msg("reconciled provisioning connector")
+	}
+}
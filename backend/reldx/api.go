@@ -0,0 +1,266 @@
+package reldx
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+func RelationEndpoints(gtx context.Context) []*httpx.Endpoint {
+	rc := core.RelationCtlr(gtx)
+	return []*httpx.Endpoint{
+		saveNamespaceEp(rc),
+		getNamespacesEp(rc),
+		deleteNamespaceEp(rc),
+		writeTuplesEp(rc),
+		readTuplesEp(rc),
+		checkEp(rc),
+		expandEp(rc),
+		listObjectsEp(rc),
+	}
+}
+
+func saveNamespaceEp(rc core.RelationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var ns core.RelNamespace
+		if err := etx.Bind(&ns); err != nil {
+			return errx.BadReqX(err, "failed to read namespace from request")
+		}
+		ns.ServiceId = serviceId
+
+		if err := rc.SaveNamespace(etx.Request().Context(), &ns); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/service/:serviceId/rel/namespace",
+		Category:    "idx.relation",
+		Desc:        "Create or replace a relation namespace of a service",
+		Version:     "v1",
+		Permissions: []string{PermManageRelations},
+		Handler:     handler,
+	}
+}
+
+func getNamespacesEp(rc core.RelationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		nss, err := rc.GetNamespaces(etx.Request().Context(), serviceId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, nss)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/service/:serviceId/rel/namespace",
+		Category:    "idx.relation",
+		Desc:        "Get relation namespaces of a service",
+		Version:     "v1",
+		Permissions: []string{PermCheckRelations},
+		Handler:     handler,
+	}
+}
+
+func deleteNamespaceEp(rc core.RelationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		name := prmg.Str("name")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		err := rc.RemoveNamespace(etx.Request().Context(), serviceId, name)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/service/:serviceId/rel/namespace/:name",
+		Category:    "idx.relation",
+		Desc:        "Delete a relation namespace of a service",
+		Version:     "v1",
+		Permissions: []string{PermManageRelations},
+		Handler:     handler,
+	}
+}
+
+func writeTuplesEp(rc core.RelationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var write core.TupleWrite
+		if err := etx.Bind(&write); err != nil {
+			return errx.BadReqX(err, "failed to read tuples from request")
+		}
+
+		token, err := rc.Write(etx.Request().Context(), serviceId, &write)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, data.M{
+			"token": token,
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/service/:serviceId/rel/write",
+		Category:    "idx.relation",
+		Desc:        "Add and delete relation tuples of a service",
+		Version:     "v1",
+		Permissions: []string{PermManageRelations},
+		Handler:     handler,
+	}
+}
+
+func readTuplesEp(rc core.RelationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var filter core.TupleFilter
+		if err := etx.Bind(&filter); err != nil {
+			return errx.BadReqX(err, "failed to read tuple filter from request")
+		}
+
+		res, err := rc.Read(etx.Request().Context(), serviceId, &filter)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, res)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/service/:serviceId/rel/read",
+		Category:    "idx.relation",
+		Desc:        "Read relation tuples of a service matching a filter",
+		Version:     "v1",
+		Permissions: []string{PermCheckRelations},
+		Handler:     handler,
+	}
+}
+
+func checkEp(rc core.RelationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var req core.RelCheckRequest
+		if err := etx.Bind(&req); err != nil {
+			return errx.BadReqX(err, "failed to read check request")
+		}
+
+		res, err := rc.Check(etx.Request().Context(), serviceId, &req)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, res)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/service/:serviceId/rel/check",
+		Category:    "idx.relation",
+		Desc:        "Check if a subject has a relation on an object",
+		Version:     "v1",
+		Permissions: []string{PermCheckRelations},
+		Handler:     handler,
+	}
+}
+
+func expandEp(rc core.RelationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var req core.RelExpandRequest
+		if err := etx.Bind(&req); err != nil {
+			return errx.BadReqX(err, "failed to read expand request")
+		}
+
+		res, err := rc.Expand(etx.Request().Context(), serviceId, &req)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, res)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/service/:serviceId/rel/expand",
+		Category:    "idx.relation",
+		Desc:        "Get the userset tree of a relation on an object",
+		Version:     "v1",
+		Permissions: []string{PermCheckRelations},
+		Handler:     handler,
+	}
+}
+
+func listObjectsEp(rc core.RelationController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var req core.ListObjectsRequest
+		if err := etx.Bind(&req); err != nil {
+			return errx.BadReqX(err, "failed to read list objects request")
+		}
+
+		res, err := rc.ListObjects(etx.Request().Context(), serviceId, &req)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, res)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/service/:serviceId/rel/objects",
+		Category:    "idx.relation",
+		Desc:        "List objects on which a subject has a relation",
+		Version:     "v1",
+		Permissions: []string{PermCheckRelations},
+		Handler:     handler,
+	}
+}
@@ -0,0 +1,135 @@
+package reldx
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+type Client struct {
+	*httpx.Client
+	Timeout time.Duration
+}
+
+func (c *Client) build() *httpx.RequestBuilder {
+	builder := c.Build()
+	if c.Timeout != 0 {
+		builder = builder.WithTimeout(c.Timeout)
+	}
+	return builder
+}
+
+func (c *Client) SaveRelNamespace(
+	gtx context.Context, ns *core.RelNamespace) error {
+	apiRes := c.build().
+		Path("/api/v1/service", ns.ServiceId, "rel/namespace").
+		Put(gtx, ns)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to save relation namespace: '%s'", ns.Name)
+	}
+	return nil
+}
+
+func (c *Client) GetRelNamespaces(
+	gtx context.Context, serviceId int64) ([]*core.RelNamespace, error) {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "rel/namespace").
+		Get(gtx)
+	nss := make([]*core.RelNamespace, 0, 10)
+	if err := apiRes.LoadClose(&nss); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get relation namespaces of service: '%d'", serviceId)
+	}
+	return nss, nil
+}
+
+func (c *Client) RemoveRelNamespace(
+	gtx context.Context, serviceId int64, name string) error {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "rel/namespace", name).
+		Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to delete relation namespace: '%s'", name)
+	}
+	return nil
+}
+
+// WriteTuples - returns the consistency token of the snapshot containing the
+// changes
+func (c *Client) WriteTuples(
+	gtx context.Context,
+	serviceId int64,
+	write *core.TupleWrite) (string, error) {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "rel/write").
+		Post(gtx, write)
+	res := map[string]string{}
+	if err := apiRes.LoadClose(&res); err != nil {
+		return "", errx.Errf(err,
+			"failed to write relation tuples of service: '%d'", serviceId)
+	}
+	return res["token"], nil
+}
+
+func (c *Client) ReadTuples(
+	gtx context.Context,
+	serviceId int64,
+	filter *core.TupleFilter) (*core.ReadTuplesResult, error) {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "rel/read").
+		Post(gtx, filter)
+	var res core.ReadTuplesResult
+	if err := apiRes.LoadClose(&res); err != nil {
+		return nil, errx.Errf(err,
+			"failed to read relation tuples of service: '%d'", serviceId)
+	}
+	return &res, nil
+}
+
+func (c *Client) CheckRelation(
+	gtx context.Context,
+	serviceId int64,
+	req *core.RelCheckRequest) (*core.RelCheckResult, error) {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "rel/check").
+		Post(gtx, req)
+	var res core.RelCheckResult
+	if err := apiRes.LoadClose(&res); err != nil {
+		return nil, errx.Errf(err, "failed to check relation: '%s'", req.Tuple)
+	}
+	return &res, nil
+}
+
+func (c *Client) ExpandRelation(
+	gtx context.Context,
+	serviceId int64,
+	req *core.RelExpandRequest) (*core.ExpandResult, error) {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "rel/expand").
+		Post(gtx, req)
+	var res core.ExpandResult
+	if err := apiRes.LoadClose(&res); err != nil {
+		return nil, errx.Errf(err, "failed to expand relation '%s' of '%s:%s'",
+			req.Relation, req.Namespace, req.ObjectId)
+	}
+	return &res, nil
+}
+
+func (c *Client) ListObjects(
+	gtx context.Context,
+	serviceId int64,
+	req *core.ListObjectsRequest) (*core.ListObjectsResult, error) {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "rel/objects").
+		Post(gtx, req)
+	var res core.ListObjectsResult
+	if err := apiRes.LoadClose(&res); err != nil {
+		return nil, errx.Errf(err, "failed to list '%s' objects of '%s:%s'",
+			req.Namespace, req.SubjectNs, req.SubjectId)
+	}
+	return &res, nil
+}
@@ -0,0 +1,407 @@
+package reldx
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+var (
+	ErrInvalidTuple     = errors.New("invalid relation tuple")
+	ErrInvalidNamespace = errors.New("invalid relation namespace")
+	ErrInvalidToken     = errors.New("invalid consistency token")
+	ErrSnapshotExpired  = errors.New("snapshot expired")
+	ErrTooComplex       = errors.New("relation graph too complex")
+)
+
+const (
+	// maxDepth - maximum nesting of usersets followed by check and expand
+	maxDepth = 32
+
+	// maxVisited - maximum number of usersets visited by list objects
+	maxVisited = 10000
+
+	maxReadTuples = 1000
+	maxWriteSize  = 1000
+
+	// deletedRetention - deleted tuples are kept for a while so that
+	// snapshots at recent tokens can be evaluated exactly
+	deletedRetention = 7 * 24 * time.Hour
+
+	tokenPrefix = "idx.rel."
+)
+
+type relCtl struct {
+	rstore *PgRelStorage
+}
+
+func NewRelationController(rstore *PgRelStorage) core.RelationController {
+	return &relCtl{
+		rstore: rstore,
+	}
+}
+
+func (rc *relCtl) SaveNamespace(
+	gtx context.Context, ns *core.RelNamespace) error {
+	ev := core.NewEventAdder(gtx, "relation.saveNamespace", data.M{
+		"namespace": ns,
+	})
+	if err := core.CheckServiceAdmin(gtx, ns.ServiceId); err != nil {
+		return ev.Commit(err)
+	}
+	if err := validateNamespace(ns); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(rc.rstore.SaveNamespace(gtx, ns))
+}
+
+func (rc *relCtl) GetNamespaces(
+	gtx context.Context, serviceId int64) ([]*core.RelNamespace, error) {
+	nss, err := rc.rstore.GetNamespaces(gtx, serviceId)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "relation.getNamespaces", data.M{
+			"serviceId": serviceId,
+		}).Commit(err)
+	}
+	return nss, nil
+}
+
+func (rc *relCtl) RemoveNamespace(
+	gtx context.Context, serviceId int64, name string) error {
+	ev := core.NewEventAdder(gtx, "relation.removeNamespace", data.M{
+		"serviceId": serviceId,
+		"namespace": name,
+	})
+	if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(rc.rstore.RemoveNamespace(gtx, serviceId, name))
+}
+
+func (rc *relCtl) Write(
+	gtx context.Context,
+	serviceId int64,
+	write *core.TupleWrite) (string, error) {
+	ev := core.NewEventAdder(gtx, "relation.write", data.M{
+		"serviceId": serviceId,
+		"touch":     len(write.Touch),
+		"delete":    len(write.Delete),
+	})
+	if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+		return "", ev.Commit(err)
+	}
+	if len(write.Touch)+len(write.Delete) > maxWriteSize {
+		return "", ev.Errf(ErrInvalidTuple,
+			"at most %d tuples can be written at once", maxWriteSize)
+	}
+
+	nss, err := rc.namespaces(gtx, serviceId)
+	if err != nil {
+		return "", ev.Commit(err)
+	}
+	for _, t := range slices.Concat(write.Touch, write.Delete) {
+		if err := validateTuple(nss, t); err != nil {
+			return "", ev.Commit(err)
+		}
+	}
+
+	rev, err := rc.rstore.Write(gtx, serviceId, write)
+	if err != nil {
+		return "", ev.Commit(err)
+	}
+	return encodeToken(rev), ev.Commit(nil)
+}
+
+func (rc *relCtl) Read(
+	gtx context.Context,
+	serviceId int64,
+	filter *core.TupleFilter) (*core.ReadTuplesResult, error) {
+	ev := core.NewEventAdder(gtx, "relation.read", data.M{
+		"serviceId": serviceId,
+		"filter":    filter,
+	})
+	if filter.Namespace == "" {
+		return nil, ev.Errf(ErrInvalidTuple, "namespace is required to read")
+	}
+	rev, err := rc.snapshot(gtx, filter.Consistency)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	tuples, err := rc.rstore.Read(gtx, serviceId, filter, rev)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return &core.ReadTuplesResult{
+		Tuples: tuples,
+		Token:  encodeToken(rev),
+	}, nil
+}
+
+func (rc *relCtl) Check(
+	gtx context.Context,
+	serviceId int64,
+	req *core.RelCheckRequest) (*core.RelCheckResult, error) {
+	ev := core.NewEventAdder(gtx, "relation.check", data.M{
+		"serviceId": serviceId,
+	})
+	if req.Tuple == nil {
+		return nil, ev.Errf(ErrInvalidTuple, "tuple to check is missing")
+	}
+	re, err := rc.evaluator(gtx, serviceId, req.Consistency)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	t := req.Tuple
+	subject := userset{t.SubjectNs, t.SubjectId, t.SubjectRel}
+	allowed, err := re.check(
+		userset{t.Namespace, t.ObjectId, t.Relation}, subject, 0, visitSet{})
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return &core.RelCheckResult{
+		Allowed: allowed,
+		Token:   encodeToken(re.rev),
+	}, nil
+}
+
+func (rc *relCtl) Expand(
+	gtx context.Context,
+	serviceId int64,
+	req *core.RelExpandRequest) (*core.ExpandResult, error) {
+	ev := core.NewEventAdder(gtx, "relation.expand", data.M{
+		"serviceId": serviceId,
+	})
+	re, err := rc.evaluator(gtx, serviceId, req.Consistency)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	root := userset{req.Namespace, req.ObjectId, req.Relation}
+	tree, err := re.expand(root, 0, visitSet{})
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return &core.ExpandResult{
+		Tree:  tree,
+		Token: encodeToken(re.rev),
+	}, nil
+}
+
+func (rc *relCtl) ListObjects(
+	gtx context.Context,
+	serviceId int64,
+	req *core.ListObjectsRequest) (*core.ListObjectsResult, error) {
+	ev := core.NewEventAdder(gtx, "relation.listObjects", data.M{
+		"serviceId": serviceId,
+	})
+	re, err := rc.evaluator(gtx, serviceId, req.Consistency)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	subject := userset{req.SubjectNs, req.SubjectId, req.SubjectRel}
+	ids, err := re.listObjects(req.Namespace, req.Relation, subject)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return &core.ListObjectsResult{
+		ObjectIds: ids,
+		Token:     encodeToken(re.rev),
+	}, nil
+}
+
+func (rc *relCtl) PurgeDeleted(
+	gtx context.Context, deletedBefore time.Time) (int64, error) {
+	return rc.rstore.PurgeDeleted(gtx, deletedBefore)
+}
+
+func (rc *relCtl) namespaces(
+	gtx context.Context,
+	serviceId int64) (map[string]*core.RelNamespace, error) {
+	nss, err := rc.rstore.GetNamespaces(gtx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*core.RelNamespace, len(nss))
+	for _, ns := range nss {
+		out[ns.Name] = ns
+	}
+	return out, nil
+}
+
+// snapshot - revision to evaluate at for the requested consistency
+func (rc *relCtl) snapshot(
+	gtx context.Context, cons *core.Consistency) (int64, error) {
+	latest, purged, err := rc.rstore.Revision(gtx)
+	if err != nil {
+		return 0, err
+	}
+	if cons == nil || cons.Token == "" {
+		return latest, nil
+	}
+
+	rev, err := decodeToken(cons.Token)
+	if err != nil {
+		return 0, err
+	}
+	if rev > latest {
+		return 0, errx.Errf(ErrInvalidToken,
+			"token is ahead of the latest revision")
+	}
+	if !cons.Exact {
+		return latest, nil
+	}
+	if rev < purged {
+		return 0, errx.Errf(ErrSnapshotExpired,
+			"snapshot of the token is no longer available")
+	}
+	return rev, nil
+}
+
+func (rc *relCtl) evaluator(
+	gtx context.Context,
+	serviceId int64,
+	cons *core.Consistency) (*relEvaluator, error) {
+	rev, err := rc.snapshot(gtx, cons)
+	if err != nil {
+		return nil, err
+	}
+	nss, err := rc.namespaces(gtx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	return &relEvaluator{
+		gtx:        gtx,
+		rstore:     rc.rstore,
+		serviceId:  serviceId,
+		rev:        rev,
+		namespaces: nss,
+		subjects:   map[userset][]*core.RelationTuple{},
+	}, nil
+}
+
+func encodeToken(rev int64) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(tokenPrefix + strconv.FormatInt(rev, 10)))
+}
+
+func decodeToken(token string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errx.Errf(ErrInvalidToken, "malformed consistency token")
+	}
+	revStr, found := strings.CutPrefix(string(raw), tokenPrefix)
+	if !found {
+		return 0, errx.Errf(ErrInvalidToken, "malformed consistency token")
+	}
+	rev, err := strconv.ParseInt(revStr, 10, 64)
+	if err != nil {
+		return 0, errx.Errf(ErrInvalidToken, "malformed consistency token")
+	}
+	return rev, nil
+}
+
+func validateNamespace(ns *core.RelNamespace) error {
+	if !validName(ns.Name) || ns.Name == core.RelUserNs {
+		return errx.Errf(ErrInvalidNamespace,
+			"invalid namespace name '%s'", ns.Name)
+	}
+	names := map[string]bool{}
+	for _, rule := range ns.Relations {
+		if !validName(rule.Name) || names[rule.Name] {
+			return errx.Errf(ErrInvalidNamespace,
+				"invalid or duplicate relation '%s' in namespace '%s'",
+				rule.Name, ns.Name)
+		}
+		names[rule.Name] = true
+	}
+	for _, rule := range ns.Relations {
+		for _, implied := range rule.ImpliedBy {
+			if !names[implied] {
+				return errx.Errf(ErrInvalidNamespace,
+					"relation '%s' implied by unknown relation '%s'",
+					rule.Name, implied)
+			}
+		}
+		for _, rel := range rule.FromRelated {
+			if !names[rel.Via] || !validName(rel.Relation) {
+				return errx.Errf(ErrInvalidNamespace,
+					"relation '%s' inherits through invalid relation '%s'",
+					rule.Name, rel.Via)
+			}
+		}
+	}
+	return nil
+}
+
+func validateTuple(nss map[string]*core.RelNamespace, t *core.RelationTuple) error {
+	ns, found := nss[t.Namespace]
+	if !found {
+		return errx.Errf(ErrInvalidTuple,
+			"unknown namespace in tuple '%s'", t)
+	}
+	if ns.Rule(t.Relation) == nil {
+		return errx.Errf(ErrInvalidTuple,
+			"unknown relation in tuple '%s'", t)
+	}
+	if t.ObjectId == "" || t.SubjectId == "" {
+		return errx.Errf(ErrInvalidTuple,
+			"object and subject are required in tuple '%s'", t)
+	}
+
+	if t.SubjectNs == core.RelUserNs {
+		if t.SubjectRel != "" {
+			return errx.Errf(ErrInvalidTuple,
+				"user subject cannot have a relation in tuple '%s'", t)
+		}
+		return nil
+	}
+	sns, found := nss[t.SubjectNs]
+	if !found {
+		return errx.Errf(ErrInvalidTuple,
+			"unknown subject namespace in tuple '%s'", t)
+	}
+	if t.SubjectRel != "" && sns.Rule(t.SubjectRel) == nil {
+		return errx.Errf(ErrInvalidTuple,
+			"unknown subject relation in tuple '%s'", t)
+	}
+	return nil
+}
+
+// validName - names should not contain the characters used in the textual
+// form of the tuples
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, ":#@ ")
+}
+
+// RunPurge - periodically removes the tuples deleted before the retention
+// period until the context is done
+func RunPurge(gtx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gtx.Done():
+			return
+		case <-ticker.C:
+			num, err := core.RelationCtlr(gtx).PurgeDeleted(
+				gtx, time.Now().Add(-deletedRetention))
+			if err != nil {
+				log.Error().Err(err).Msg("failed to purge deleted tuples")
+				continue
+			}
+			log.Debug().Int64("count", num).Msg("purged deleted tuples")
+		}
+	}
+}
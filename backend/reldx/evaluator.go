@@ -0,0 +1,263 @@
+package reldx
+
+import (
+	"context"
+	"slices"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+)
+
+// userset - subjects having the relation on the object. With an empty
+// relation it denotes the object itself, which is how users are represented
+type userset struct {
+	ns  string
+	id  string
+	rel string
+}
+
+func (us userset) String() string {
+	str := us.ns + ":" + us.id
+	if us.rel != "" {
+		str += "#" + us.rel
+	}
+	return str
+}
+
+func subjectOf(t *core.RelationTuple) userset {
+	return userset{t.SubjectNs, t.SubjectId, t.SubjectRel}
+}
+
+type visitSet map[userset]bool
+
+// tupleReader - lookups made by the evaluator, served by PgRelStorage
+type tupleReader interface {
+	Subjects(gtx context.Context,
+		serviceId int64,
+		ns, objectId, relation string,
+		rev int64) ([]*core.RelationTuple, error)
+	Referrers(gtx context.Context,
+		serviceId int64,
+		subjectNs, subjectId string,
+		rev int64) ([]*core.RelationTuple, error)
+}
+
+// relEvaluator - evaluates relations of a service at a single revision, so
+// that every lookup made for a request sees the same snapshot
+type relEvaluator struct {
+	gtx        context.Context
+	rstore     tupleReader
+	serviceId  int64
+	rev        int64
+	namespaces map[string]*core.RelNamespace
+	subjects   map[userset][]*core.RelationTuple
+}
+
+func (re *relEvaluator) direct(us userset) ([]*core.RelationTuple, error) {
+	if tuples, found := re.subjects[us]; found {
+		return tuples, nil
+	}
+	tuples, err := re.rstore.Subjects(
+		re.gtx, re.serviceId, us.ns, us.id, us.rel, re.rev)
+	if err != nil {
+		return nil, err
+	}
+	re.subjects[us] = tuples
+	return tuples, nil
+}
+
+func (re *relEvaluator) rule(ns, rel string) *core.RelationRule {
+	if nsCfg, found := re.namespaces[ns]; found {
+		return nsCfg.Rule(rel)
+	}
+	return nil
+}
+
+// rewrites - usersets the relation is made of apart from its own tuples,
+// relations implied by other relations of the object and relations from
+// related objects
+func (re *relEvaluator) rewrites(us userset) ([]userset, error) {
+	rule := re.rule(us.ns, us.rel)
+	if rule == nil {
+		return nil, nil
+	}
+	out := make([]userset, 0, len(rule.ImpliedBy))
+	for _, implied := range rule.ImpliedBy {
+		out = append(out, userset{us.ns, us.id, implied})
+	}
+	for _, fr := range rule.FromRelated {
+		related, err := re.direct(userset{us.ns, us.id, fr.Via})
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range related {
+			out = append(out, userset{t.SubjectNs, t.SubjectId, fr.Relation})
+		}
+	}
+	return out, nil
+}
+
+// check - depth first search from the userset towards the subject. Relations
+// are unions, so an userset that is already visited need not be searched
+// again even if the relations form a cycle
+func (re *relEvaluator) check(
+	us, subject userset, depth int, visited visitSet) (bool, error) {
+	if us == subject {
+		return true, nil
+	}
+	if visited[us] {
+		return false, nil
+	}
+	if depth > maxDepth {
+		return false, errx.Errf(ErrTooComplex,
+			"relation '%s' is nested more than %d levels", us, maxDepth)
+	}
+	visited[us] = true
+
+	tuples, err := re.direct(us)
+	if err != nil {
+		return false, err
+	}
+	next := make([]userset, 0, len(tuples))
+	for _, t := range tuples {
+		if subjectOf(t) == subject {
+			return true, nil
+		}
+		if t.SubjectRel != "" {
+			next = append(next, subjectOf(t))
+		}
+	}
+	rewrites, err := re.rewrites(us)
+	if err != nil {
+		return false, err
+	}
+
+	for _, n := range append(next, rewrites...) {
+		found, err := re.check(n, subject, depth+1, visited)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+func (re *relEvaluator) expand(
+	us userset, depth int, visited visitSet) (*core.ExpandNode, error) {
+	node := &core.ExpandNode{Userset: us.String()}
+	if visited[us] {
+		return node, nil
+	}
+	if depth > maxDepth {
+		return nil, errx.Errf(ErrTooComplex,
+			"relation '%s' is nested more than %d levels", us, maxDepth)
+	}
+	visited[us] = true
+
+	tuples, err := re.direct(us)
+	if err != nil {
+		return nil, err
+	}
+	next := make([]userset, 0, len(tuples))
+	for _, t := range tuples {
+		if t.SubjectRel == "" {
+			node.Subjects = append(node.Subjects, subjectOf(t).String())
+			continue
+		}
+		next = append(next, subjectOf(t))
+	}
+	rewrites, err := re.rewrites(us)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range append(next, rewrites...) {
+		child, err := re.expand(n, depth+1, visited)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+// listObjects - breadth first search from the subject over the reverse
+// lookup index, following the rewrite rules backwards
+func (re *relEvaluator) listObjects(
+	ns, rel string, subject userset) ([]string, error) {
+
+	// Reverse of the rewrite rules: relation to the relations it implies and
+	// (namespace, via, relation of related object) to the relations inherited
+	type relatedKey struct{ ns, via, rel string }
+	implies := map[userset][]string{}
+	inherited := map[relatedKey][]string{}
+	for _, nsCfg := range re.namespaces {
+		for _, rule := range nsCfg.Relations {
+			for _, implied := range rule.ImpliedBy {
+				key := userset{ns: nsCfg.Name, rel: implied}
+				implies[key] = append(implies[key], rule.Name)
+			}
+			for _, fr := range rule.FromRelated {
+				key := relatedKey{nsCfg.Name, fr.Via, fr.Relation}
+				inherited[key] = append(inherited[key], rule.Name)
+			}
+		}
+	}
+
+	objects := []string{}
+	visited := visitSet{}
+	queue := []userset{}
+	push := func(us userset) {
+		if visited[us] {
+			return
+		}
+		visited[us] = true
+		queue = append(queue, us)
+		if us.ns == ns && us.rel == rel {
+			objects = append(objects, us.id)
+		}
+	}
+
+	push(subject)
+	referrers := map[userset][]*core.RelationTuple{}
+	for len(queue) != 0 {
+		if len(visited) > maxVisited {
+			return nil, errx.Errf(ErrTooComplex,
+				"more than %d usersets reachable from '%s'",
+				maxVisited, subject)
+		}
+		us := queue[0]
+		queue = queue[1:]
+
+		for _, r := range implies[userset{ns: us.ns, rel: us.rel}] {
+			push(userset{us.ns, us.id, r})
+		}
+
+		obj := userset{ns: us.ns, id: us.id}
+		tuples, found := referrers[obj]
+		if !found {
+			var err error
+			tuples, err = re.rstore.Referrers(
+				re.gtx, re.serviceId, us.ns, us.id, re.rev)
+			if err != nil {
+				return nil, err
+			}
+			referrers[obj] = tuples
+		}
+
+		for _, t := range tuples {
+			if t.SubjectRel == us.rel {
+				push(userset{t.Namespace, t.ObjectId, t.Relation})
+			}
+			if us.rel == "" {
+				continue
+			}
+			key := relatedKey{t.Namespace, t.Relation, us.rel}
+			for _, r := range inherited[key] {
+				push(userset{t.Namespace, t.ObjectId, r})
+			}
+		}
+	}
+
+	slices.Sort(objects)
+	return objects, nil
+}
@@ -0,0 +1,319 @@
+package reldx
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/varunamachi/idx/core"
+)
+
+// memReader - tuples of a single service and revision held in memory
+type memReader []*core.RelationTuple
+
+func (mr memReader) Subjects(
+	_ context.Context,
+	_ int64,
+	ns, objectId, relation string,
+	_ int64) ([]*core.RelationTuple, error) {
+	out := []*core.RelationTuple{}
+	for _, t := range mr {
+		if t.Namespace == ns && t.ObjectId == objectId &&
+			t.Relation == relation {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (mr memReader) Referrers(
+	_ context.Context,
+	_ int64,
+	subjectNs, subjectId string,
+	_ int64) ([]*core.RelationTuple, error) {
+	out := []*core.RelationTuple{}
+	for _, t := range mr {
+		if t.SubjectNs == subjectNs && t.SubjectId == subjectId {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// tuple - parses 'ns:id#rel@subjectNs:subjectId[#subjectRel]'
+func tuple(str string) *core.RelationTuple {
+	obj, subject, _ := strings.Cut(str, "@")
+	objUs, subUs := parseUserset(obj), parseUserset(subject)
+	return &core.RelationTuple{
+		Namespace:  objUs.ns,
+		ObjectId:   objUs.id,
+		Relation:   objUs.rel,
+		SubjectNs:  subUs.ns,
+		SubjectId:  subUs.id,
+		SubjectRel: subUs.rel,
+	}
+}
+
+func parseUserset(str string) userset {
+	obj, rel, _ := strings.Cut(str, "#")
+	ns, id, _ := strings.Cut(obj, ":")
+	return userset{ns, id, rel}
+}
+
+func testNamespaces() map[string]*core.RelNamespace {
+	viaParent := []*core.RelatedRule{{Via: "parent", Relation: "viewer"}}
+	return map[string]*core.RelNamespace{
+		"doc": {
+			Name: "doc",
+			Relations: core.RelationRules{
+				{Name: "owner"},
+				{Name: "parent"},
+				{Name: "editor", ImpliedBy: []string{"owner"}},
+				{
+					Name:        "viewer",
+					ImpliedBy:   []string{"editor"},
+					FromRelated: viaParent,
+				},
+			},
+		},
+		"folder": {
+			Name: "folder",
+			Relations: core.RelationRules{
+				{Name: "parent"},
+				{Name: "viewer", FromRelated: viaParent},
+			},
+		},
+		"group": {
+			Name:      "group",
+			Relations: core.RelationRules{{Name: "member"}},
+		},
+	}
+}
+
+func testTuples() memReader {
+	strs := []string{
+		"doc:readme#owner@user:alice",
+		"doc:readme#parent@folder:eng",
+		"folder:eng#viewer@group:devs#member",
+		"group:devs#member@user:bob",
+		"group:devs#member@group:leads#member",
+		"group:leads#member@user:carol",
+
+		// groups containing each other
+		"group:a#member@group:b#member",
+		"group:b#member@group:a#member",
+		"group:a#member@user:dave",
+
+		// folders that are parents of each other
+		"folder:x#parent@folder:y",
+		"folder:y#parent@folder:x",
+		"folder:x#viewer@user:erin",
+		"doc:cyc#parent@folder:x",
+	}
+	out := make(memReader, 0, len(strs))
+	for _, str := range strs {
+		out = append(out, tuple(str))
+	}
+	return out
+}
+
+// chain - group:g0 contains g1 and so on till the user is a member of the
+// last group
+func chain(length int) memReader {
+	out := make(memReader, 0, length+1)
+	for i := 0; i < length; i++ {
+		out = append(out, tuple("group:g"+strconv.Itoa(i)+"#member@group:g"+
+			strconv.Itoa(i+1)+"#member"))
+	}
+	return append(out, tuple("group:g"+strconv.Itoa(length)+
+		"#member@user:zed"))
+}
+
+func newTestEvaluator(tuples memReader) *relEvaluator {
+	return &relEvaluator{
+		gtx:        context.Background(),
+		rstore:     tuples,
+		rev:        1,
+		namespaces: testNamespaces(),
+		subjects:   map[userset][]*core.RelationTuple{},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		tuples  memReader
+		object  string
+		subject string
+		allowed bool
+		err     error
+	}{
+		{"direct", nil, "doc:readme#owner", "user:alice", true, nil},
+		{"implied relation", nil, "doc:readme#viewer", "user:alice", true, nil},
+		{"not implied upwards", nil, "doc:readme#owner", "user:bob", false,
+			nil},
+		{"through parent and group", nil,
+			"doc:readme#viewer", "user:bob", true, nil},
+		{"through nested group", nil,
+			"doc:readme#viewer", "user:carol", true, nil},
+		{"userset as subject", nil,
+			"doc:readme#viewer", "group:devs#member", true, nil},
+		{"unrelated user", nil, "doc:readme#viewer", "user:mallory", false,
+			nil},
+		{"cyclic usersets", nil, "group:b#member", "user:dave", true, nil},
+		{"cyclic usersets without subject", nil,
+			"group:b#member", "user:mallory", false, nil},
+		{"cyclic parents", nil, "folder:y#viewer", "user:erin", true, nil},
+		{"cyclic parents without subject", nil,
+			"doc:cyc#viewer", "user:mallory", false, nil},
+		{"unknown namespace", nil, "repo:x#admin", "user:alice", false, nil},
+		{"chain within depth", chain(maxDepth / 2),
+			"group:g0#member", "user:zed", true, nil},
+		{"chain beyond depth", chain(maxDepth + 8),
+			"group:g0#member", "user:zed", false, ErrTooComplex},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tuples := test.tuples
+			if tuples == nil {
+				tuples = testTuples()
+			}
+			re := newTestEvaluator(tuples)
+			allowed, err := re.check(parseUserset(test.object),
+				parseUserset(test.subject), 0, visitSet{})
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected error '%v', got '%v'", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if allowed != test.allowed {
+				t.Errorf("expected %v, got %v", test.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name   string
+		tuples memReader
+		root   string
+		tree   *core.ExpandNode
+		err    error
+	}{
+		{
+			name: "implied relation",
+			root: "doc:readme#editor",
+			tree: &core.ExpandNode{
+				Userset: "doc:readme#editor",
+				Children: []*core.ExpandNode{{
+					Userset:  "doc:readme#owner",
+					Subjects: []string{"user:alice"},
+				}},
+			},
+		},
+		{
+			name: "nested groups",
+			root: "group:devs#member",
+			tree: &core.ExpandNode{
+				Userset:  "group:devs#member",
+				Subjects: []string{"user:bob"},
+				Children: []*core.ExpandNode{{
+					Userset:  "group:leads#member",
+					Subjects: []string{"user:carol"},
+				}},
+			},
+		},
+		{
+			name: "cyclic usersets end at the visited userset",
+			root: "group:a#member",
+			tree: &core.ExpandNode{
+				Userset:  "group:a#member",
+				Subjects: []string{"user:dave"},
+				Children: []*core.ExpandNode{{
+					Userset: "group:b#member",
+					Children: []*core.ExpandNode{{
+						Userset: "group:a#member",
+					}},
+				}},
+			},
+		},
+		{
+			name:   "chain beyond depth",
+			tuples: chain(maxDepth + 8),
+			root:   "group:g0#member",
+			err:    ErrTooComplex,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tuples := test.tuples
+			if tuples == nil {
+				tuples = testTuples()
+			}
+			re := newTestEvaluator(tuples)
+			tree, err := re.expand(parseUserset(test.root), 0, visitSet{})
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected error '%v', got '%v'", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tree, test.tree) {
+				t.Errorf("expected %+v, got %+v", test.tree, tree)
+			}
+		})
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		ns      string
+		rel     string
+		subject string
+		objects []string
+	}{
+		{"implied relations", "doc", "viewer", "user:alice",
+			[]string{"readme"}},
+		{"through parent and group", "doc", "viewer", "user:bob",
+			[]string{"readme"}},
+		{"nested groups", "group", "member", "user:carol",
+			[]string{"devs", "leads"}},
+		{"cyclic usersets", "group", "member", "user:dave",
+			[]string{"a", "b"}},
+		{"cyclic parents", "folder", "viewer", "user:erin",
+			[]string{"x", "y"}},
+		{"through cyclic parents", "doc", "viewer", "user:erin",
+			[]string{"cyc"}},
+		{"userset as subject", "doc", "viewer", "group:leads#member",
+			[]string{"readme"}},
+		{"unrelated user", "doc", "viewer", "user:mallory", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			re := newTestEvaluator(testTuples())
+			objects, err := re.listObjects(
+				test.ns, test.rel, parseUserset(test.subject))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(objects, test.objects) {
+				t.Errorf("expected %v, got %v", test.objects, objects)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+package reldx
+
+const (
+	PermManageRelations = "idx.manageRelations"
+	PermCheckRelations  = "idx.checkRelations"
+)
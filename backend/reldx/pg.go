@@ -0,0 +1,314 @@
+package reldx
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+// Tuples are versioned by revision. A tuple is part of the snapshot at
+// revision R if it was created at or before R and was not deleted by R
+
+type PgRelStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewRelStorage(gd data.GetterDeleter) *PgRelStorage {
+	return &PgRelStorage{
+		gd: gd,
+	}
+}
+
+func (prs *PgRelStorage) SaveNamespace(
+	gtx context.Context, ns *core.RelNamespace) error {
+	query := `
+		INSERT INTO idx_rel_namespace (
+			service_id,
+			name,
+			relations,
+			updated_on
+		) VALUES (
+			:service_id,
+			:name,
+			:relations,
+			NOW()
+		) ON CONFLICT (service_id, name) DO UPDATE SET
+			relations = EXCLUDED.relations,
+			updated_on = EXCLUDED.updated_on
+	`
+	if _, err := pg.Conn().NamedExecContext(gtx, query, ns); err != nil {
+		return errx.Errf(err, "failed to save namespace '%s' of service '%d'",
+			ns.Name, ns.ServiceId)
+	}
+	return nil
+}
+
+func (prs *PgRelStorage) GetNamespaces(
+	gtx context.Context, serviceId int64) ([]*core.RelNamespace, error) {
+	query := `
+		SELECT * FROM idx_rel_namespace
+		WHERE service_id = $1 AND ` +
+		core.TenantServiceCond(gtx, "service_id") + `
+		ORDER BY name
+	`
+	nss := make([]*core.RelNamespace, 0, 10)
+	if err := pg.Conn().SelectContext(gtx, &nss, query, serviceId); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get namespaces of service '%d'", serviceId)
+	}
+	return nss, nil
+}
+
+func (prs *PgRelStorage) RemoveNamespace(
+	gtx context.Context, serviceId int64, name string) error {
+	query := `
+		DELETE FROM idx_rel_namespace
+		WHERE service_id = $1 AND name = $2 AND ` +
+		core.TenantServiceCond(gtx, "service_id")
+	if _, err := pg.Conn().ExecContext(gtx, query, serviceId, name); err != nil {
+		return errx.Errf(err, "failed to remove namespace '%s' of service '%d'",
+			name, serviceId)
+	}
+	return nil
+}
+
+// Revision - latest revision and the revision up to which deleted tuples are
+// purged
+func (prs *PgRelStorage) Revision(
+	gtx context.Context) (latest, purged int64, err error) {
+	query := `SELECT revision, purged_revision FROM idx_rel_revision`
+	row := pg.Conn().QueryRowxContext(gtx, query)
+	if err := row.Scan(&latest, &purged); err != nil {
+		return 0, 0, errx.Errf(err, "failed to get latest relation revision")
+	}
+	return latest, purged, nil
+}
+
+// Write - deletes are applied before the touches, both are part of a single
+// new revision
+func (prs *PgRelStorage) Write(
+	gtx context.Context,
+	serviceId int64,
+	write *core.TupleWrite) (int64, error) {
+
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return 0, errx.Errf(err, "failed to initilize DB transaction")
+	}
+	ef := func(err error, fmtStr string, args ...any) error {
+		if e := tx.Rollback(); e != nil {
+			log.Error().Err(e).
+				Msg("transaction rollback failed for relation tuple write")
+		}
+		return errx.Errf(err, fmtStr, args...)
+	}
+
+	// Row lock on the revision serializes the writers
+	var rev int64
+	const rquery = `
+		UPDATE idx_rel_revision SET revision = revision + 1 RETURNING revision
+	`
+	if err := tx.GetContext(gtx, &rev, rquery); err != nil {
+		return 0, ef(err, "failed to get new relation revision")
+	}
+
+	const dquery = `
+		UPDATE idx_rel_tuple SET
+			deleted_rev = $1,
+			deleted_on = NOW()
+		WHERE
+			service_id = $2 AND
+			namespace = $3 AND
+			object_id = $4 AND
+			relation = $5 AND
+			subject_ns = $6 AND
+			subject_id = $7 AND
+			subject_rel = $8 AND
+			deleted_rev IS NULL
+	`
+	for _, t := range write.Delete {
+		_, err := tx.ExecContext(gtx, dquery, rev, serviceId,
+			t.Namespace, t.ObjectId, t.Relation,
+			t.SubjectNs, t.SubjectId, t.SubjectRel)
+		if err != nil {
+			return 0, ef(err, "failed to delete tuple '%s'", t)
+		}
+	}
+
+	const iquery = `
+		INSERT INTO idx_rel_tuple (
+			service_id,
+			namespace,
+			object_id,
+			relation,
+			subject_ns,
+			subject_id,
+			subject_rel,
+			created_rev
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8
+		) ON CONFLICT DO NOTHING
+	`
+	for _, t := range write.Touch {
+		_, err := tx.ExecContext(gtx, iquery, serviceId,
+			t.Namespace, t.ObjectId, t.Relation,
+			t.SubjectNs, t.SubjectId, t.SubjectRel, rev)
+		if err != nil {
+			return 0, ef(err, "failed to write tuple '%s'", t)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, ef(err, "failed to commit relation tuple write")
+	}
+	return rev, nil
+}
+
+// Subjects - tuples of an object relation at the revision
+func (prs *PgRelStorage) Subjects(
+	gtx context.Context,
+	serviceId int64,
+	ns, objectId, relation string,
+	rev int64) ([]*core.RelationTuple, error) {
+	query := `
+		SELECT
+			namespace,
+			object_id,
+			relation,
+			subject_ns,
+			subject_id,
+			subject_rel
+		FROM idx_rel_tuple
+		WHERE
+			service_id = $1 AND
+			namespace = $2 AND
+			object_id = $3 AND
+			relation = $4 AND
+			created_rev <= $5 AND
+			(deleted_rev IS NULL OR deleted_rev > $5) AND
+	` + core.TenantServiceCond(gtx, "service_id")
+	tuples := make([]*core.RelationTuple, 0, 20)
+	err := pg.Conn().SelectContext(
+		gtx, &tuples, query, serviceId, ns, objectId, relation, rev)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get subjects of '%s:%s#%s'",
+			ns, objectId, relation)
+	}
+	return tuples, nil
+}
+
+// Referrers - tuples whose subject is the given object, with or without a
+// subject relation. Served by the reverse lookup index
+func (prs *PgRelStorage) Referrers(
+	gtx context.Context,
+	serviceId int64,
+	subjectNs, subjectId string,
+	rev int64) ([]*core.RelationTuple, error) {
+	query := `
+		SELECT
+			namespace,
+			object_id,
+			relation,
+			subject_ns,
+			subject_id,
+			subject_rel
+		FROM idx_rel_tuple
+		WHERE
+			service_id = $1 AND
+			subject_ns = $2 AND
+			subject_id = $3 AND
+			created_rev <= $4 AND
+			(deleted_rev IS NULL OR deleted_rev > $4) AND
+	` + core.TenantServiceCond(gtx, "service_id")
+	tuples := make([]*core.RelationTuple, 0, 20)
+	err := pg.Conn().SelectContext(
+		gtx, &tuples, query, serviceId, subjectNs, subjectId, rev)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get tuples referring '%s:%s'",
+			subjectNs, subjectId)
+	}
+	return tuples, nil
+}
+
+func (prs *PgRelStorage) Read(
+	gtx context.Context,
+	serviceId int64,
+	filter *core.TupleFilter,
+	rev int64) ([]*core.RelationTuple, error) {
+
+	eq := squirrel.Eq{
+		"service_id": serviceId,
+		"namespace":  filter.Namespace,
+	}
+	if filter.ObjectId != "" {
+		eq["object_id"] = filter.ObjectId
+	}
+	if filter.Relation != "" {
+		eq["relation"] = filter.Relation
+	}
+	if filter.SubjectNs != "" {
+		eq["subject_ns"] = filter.SubjectNs
+	}
+	if filter.SubjectId != "" {
+		eq["subject_id"] = filter.SubjectId
+	}
+
+	query, args, err := squirrel.StatementBuilder.
+		PlaceholderFormat(squirrel.Dollar).
+		Select(
+			"namespace",
+			"object_id",
+			"relation",
+			"subject_ns",
+			"subject_id",
+			"subject_rel").
+		From("idx_rel_tuple").
+		Where(eq).
+		Where("created_rev <= ? AND (deleted_rev IS NULL OR deleted_rev > ?)",
+			rev, rev).
+		Where(core.TenantServiceCond(gtx, "service_id")).
+		OrderBy("object_id", "relation", "subject_ns", "subject_id").
+		Limit(maxReadTuples).
+		ToSql()
+	if err != nil {
+		return nil, errx.Errf(err, "failed to build tuple read query")
+	}
+
+	tuples := make([]*core.RelationTuple, 0, 100)
+	if err := pg.Conn().SelectContext(gtx, &tuples, query, args...); err != nil {
+		return nil, errx.Errf(err, "failed to read tuples of namespace '%s'",
+			filter.Namespace)
+	}
+	return tuples, nil
+}
+
+// PurgeDeleted - removes the tuples deleted before the given time and moves
+// the purged revision forward, so that snapshots missing those tuples are
+// not served anymore
+func (prs *PgRelStorage) PurgeDeleted(
+	gtx context.Context, deletedBefore time.Time) (int64, error) {
+	query := `
+		WITH purged AS (
+			DELETE FROM idx_rel_tuple
+			WHERE deleted_on < $1
+			RETURNING deleted_rev
+		)
+		UPDATE idx_rel_revision SET purged_revision = GREATEST(
+			purged_revision,
+			(SELECT COALESCE(MAX(deleted_rev), 0) FROM purged)
+		)
+		RETURNING (SELECT COUNT(*) FROM purged)
+	`
+	var num int64
+	if err := pg.Conn().GetContext(gtx, &num, query, deletedBefore); err != nil {
+		return 0, errx.Errf(err, "failed to purge deleted relation tuples")
+	}
+	return num, nil
+}
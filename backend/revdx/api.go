@@ -0,0 +1,331 @@
+package revdx
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+// Reviewing is open to any user the items are assigned to, the controller
+// limits the rest to the admins of the reviewed services
+
+func ReviewEndpoints(gtx context.Context) []*httpx.Endpoint {
+	rc := core.ReviewCtlr(gtx)
+	return []*httpx.Endpoint{
+		createCampaignEp(rc),
+		getCampaignEp(rc),
+		getCampaignsEp(rc),
+		removeCampaignEp(rc),
+		closeCampaignEp(rc),
+		getReviewItemsEp(rc),
+		assignReviewerEp(rc),
+		decideReviewItemEp(rc),
+		getReviewReportEp(rc),
+	}
+}
+
+func createCampaignEp(rc core.ReviewController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var campaign core.ReviewCampaign
+		if err := etx.Bind(&campaign); err != nil {
+			return errx.BadReqX(err, "failed to read campaign from request")
+		}
+
+		id, err := rc.Create(etx.Request().Context(), &campaign)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, data.M{
+			"campaignId": id,
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/review",
+		Category:    "idx.review",
+		Desc:        "Start an access review campaign",
+		Version:     "v1",
+		Permissions: []string{PermManageReview},
+		Handler:     handler,
+	}
+}
+
+func getCampaignEp(rc core.ReviewController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		campaign, err := rc.GetOne(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, campaign)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/review/:id",
+		Category: "idx.review",
+		Desc:     "Get an access review campaign",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getCampaignsEp(rc core.ReviewController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		state := prmg.QueryStrOr("state", "")
+
+		campaigns, err := rc.Get(
+			etx.Request().Context(), core.ReviewState(state))
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, campaigns)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/review",
+		Category: "idx.review",
+		Desc:     "Get access review campaigns",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func removeCampaignEp(rc core.ReviewController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := rc.Remove(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/review/:id",
+		Category:    "idx.review",
+		Desc:        "Remove an access review campaign along with its evidence",
+		Version:     "v1",
+		Permissions: []string{PermManageReview},
+		Handler:     handler,
+	}
+}
+
+func closeCampaignEp(rc core.ReviewController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := rc.Close(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/review/:id/close",
+		Category:    "idx.review",
+		Desc:        "Close an access review campaign before its deadline",
+		Version:     "v1",
+		Permissions: []string{PermManageReview},
+		Handler:     handler,
+	}
+}
+
+func getReviewItemsEp(rc core.ReviewController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		filter := &core.ReviewItemFilter{
+			ServiceId: prmg.QueryInt64Or("serviceId", 0),
+			Decision:  core.ReviewDecision(prmg.QueryStrOr("decision", "")),
+			Mine:      prmg.QueryBoolOr("mine", false),
+		}
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		items, err := rc.GetItems(etx.Request().Context(), id, filter)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, items)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/review/:id/item",
+		Category: "idx.review",
+		Desc:     "Get the items of an access review campaign",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func assignReviewerEp(rc core.ReviewController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		itemId := prmg.Int64("itemId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var body struct {
+			ReviewerId *int64 `json:"reviewerId"`
+		}
+		if err := etx.Bind(&body); err != nil {
+			return errx.BadReqX(err, "failed to read reviewer from request")
+		}
+
+		err := rc.AssignReviewer(etx.Request().Context(), itemId, body.ReviewerId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/review/item/:itemId/reviewer",
+		Category: "idx.review",
+		Desc:     "Assign a reviewer to an access review item",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func decideReviewItemEp(rc core.ReviewController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		itemId := prmg.Int64("itemId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var decision core.ItemDecision
+		if err := etx.Bind(&decision); err != nil {
+			return errx.BadReqX(err, "failed to read decision from request")
+		}
+
+		err := rc.Decide(etx.Request().Context(), itemId, &decision)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.PUT,
+		Path:     "/review/item/:itemId/decide",
+		Category: "idx.review",
+		Desc:     "Confirm or revoke an access review item",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getReviewReportEp(rc core.ReviewController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		format := prmg.QueryStrOr("format", "json")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+		if format != "json" && format != "csv" {
+			return errx.BadReq("unsupported report format '%s'", format)
+		}
+
+		report, err := rc.Report(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		if format == "csv" {
+			return sendCsvReport(etx, report)
+		}
+		return httpx.SendJSON(etx, report)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/review/:id/report",
+		Category:    "idx.review",
+		Desc:        "Get the evidence report of an access review campaign",
+		Version:     "v1",
+		Permissions: []string{PermGetReview},
+		Handler:     handler,
+	}
+}
+
+func sendCsvReport(etx echo.Context, report *core.ReviewReport) error {
+	res := etx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(
+		"attachment; filename=\"review-%d.csv\"", report.Campaign.Id))
+	res.WriteHeader(http.StatusOK)
+
+	optTime := func(tm *time.Time) string {
+		if tm == nil {
+			return ""
+		}
+		return tm.Format(time.RFC3339)
+	}
+
+	writer := csv.NewWriter(res)
+	err := writer.Write([]string{
+		"service", "group", "user", "validFrom", "validUntil",
+		"decision", "decidedBy", "decidedOn", "comment",
+	})
+	if err != nil {
+		return errx.Errf(err, "failed to write report header")
+	}
+	for _, item := range report.Items {
+		err := writer.Write([]string{
+			item.ServiceName,
+			item.GroupName,
+			item.UserName,
+			item.ValidFrom.Format(time.RFC3339),
+			optTime(item.ValidUntil),
+			string(item.Decision),
+			item.DeciderName,
+			optTime(item.DecidedOn),
+			item.Comment,
+		})
+		if err != nil {
+			return errx.Errf(err, "failed to write report item '%d'", item.Id)
+		}
+	}
+	writer.Flush()
+	return errx.Wrap(writer.Error())
+}
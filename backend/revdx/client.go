@@ -0,0 +1,131 @@
+package revdx
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+type Client struct {
+	*httpx.Client
+	Timeout time.Duration
+}
+
+func (c *Client) build() *httpx.RequestBuilder {
+	builder := c.Build()
+	if c.Timeout != 0 {
+		builder = builder.WithTimeout(c.Timeout)
+	}
+	return builder
+}
+
+func (c *Client) CreateReviewCampaign(
+	gtx context.Context, campaign *core.ReviewCampaign) (int64, error) {
+	apiRes := c.build().Path("/api/v1/review").Post(gtx, campaign)
+	res := map[string]int64{"campaignId": int64(-1)}
+	if err := apiRes.LoadClose(&res); err != nil {
+		return -1, errx.Errf(err,
+			"failed to create review campaign: '%s'", campaign.Name)
+	}
+	return res["campaignId"], nil
+}
+
+func (c *Client) GetReviewCampaign(
+	gtx context.Context, id int64) (*core.ReviewCampaign, error) {
+	var campaign core.ReviewCampaign
+	apiRes := c.build().Path("/api/v1/review", id).Get(gtx)
+	if err := apiRes.LoadClose(&campaign); err != nil {
+		return nil, errx.Errf(err, "failed to get review campaign: '%d'", id)
+	}
+	return &campaign, nil
+}
+
+func (c *Client) GetReviewCampaigns(
+	gtx context.Context,
+	state core.ReviewState) ([]*core.ReviewCampaign, error) {
+	builder := c.build().Path("/api/v1/review")
+	if state != "" {
+		builder = builder.QStr("state", string(state))
+	}
+	campaigns := make([]*core.ReviewCampaign, 0, 20)
+	if err := builder.Get(gtx).LoadClose(&campaigns); err != nil {
+		return nil, errx.Errf(err, "failed to get review campaigns")
+	}
+	return campaigns, nil
+}
+
+func (c *Client) RemoveReviewCampaign(gtx context.Context, id int64) error {
+	apiRes := c.build().Path("/api/v1/review", id).Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to remove review campaign: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) CloseReviewCampaign(gtx context.Context, id int64) error {
+	apiRes := c.build().Path("/api/v1/review", id, "close").Put(gtx, nil)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to close review campaign: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) GetReviewItems(
+	gtx context.Context,
+	campaignId int64,
+	filter *core.ReviewItemFilter) ([]*core.ReviewItem, error) {
+	builder := c.build().Path("/api/v1/review", campaignId, "item")
+	if filter.ServiceId != 0 {
+		builder = builder.QInt("serviceId", filter.ServiceId)
+	}
+	if filter.Decision != "" {
+		builder = builder.QStr("decision", string(filter.Decision))
+	}
+	if filter.Mine {
+		builder = builder.QBool("mine", true)
+	}
+	items := make([]*core.ReviewItem, 0, 100)
+	if err := builder.Get(gtx).LoadClose(&items); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get items of review campaign: '%d'", campaignId)
+	}
+	return items, nil
+}
+
+func (c *Client) AssignReviewer(
+	gtx context.Context, itemId int64, reviewerId *int64) error {
+	apiRes := c.build().
+		Path("/api/v1/review/item", itemId, "reviewer").
+		Put(gtx, data.M{"reviewerId": reviewerId})
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to assign reviewer to review item: '%d'", itemId)
+	}
+	return nil
+}
+
+func (c *Client) DecideReviewItem(
+	gtx context.Context, itemId int64, decision *core.ItemDecision) error {
+	apiRes := c.build().
+		Path("/api/v1/review/item", itemId, "decide").
+		Put(gtx, decision)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to decide on review item: '%d'", itemId)
+	}
+	return nil
+}
+
+func (c *Client) GetReviewReport(
+	gtx context.Context, id int64) (*core.ReviewReport, error) {
+	var report core.ReviewReport
+	apiRes := c.build().Path("/api/v1/review", id, "report").Get(gtx)
+	if err := apiRes.LoadClose(&report); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get report of review campaign: '%d'", id)
+	}
+	return &report, nil
+}
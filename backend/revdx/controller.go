@@ -0,0 +1,578 @@
+package revdx
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/idx/mailtmpl"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+type reviewCtl struct {
+	rstore *PgReviewStorage
+}
+
+func NewReviewController(rstore *PgReviewStorage) core.ReviewController {
+	return &reviewCtl{
+		rstore: rstore,
+	}
+}
+
+func (rc *reviewCtl) Create(
+	gtx context.Context, campaign *core.ReviewCampaign) (int64, error) {
+	ev := core.NewEventAdder(gtx, "review.create", data.M{
+		"campaign": campaign,
+	})
+
+	if campaign.Name == "" {
+		return -1, ev.Errf(core.ErrInvalidState, "campaign name is required")
+	}
+	if !campaign.Deadline.After(time.Now()) {
+		return -1, ev.Errf(core.ErrInvalidState,
+			"deadline of campaign '%s' should be in future", campaign.Name)
+	}
+	if len(campaign.ServiceIds) == 0 && len(campaign.GroupIds) == 0 {
+		return -1, ev.Errf(core.ErrInvalidState,
+			"campaign '%s' should review at least a service or a group",
+			campaign.Name)
+	}
+
+	// Campaigns are created by the admins of everything they review
+	for _, serviceId := range campaign.ServiceIds {
+		if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+			return -1, ev.Commit(err)
+		}
+	}
+	for _, groupId := range campaign.GroupIds {
+		group, err := core.GroupCtlr(gtx).GetOne(gtx, groupId)
+		if err != nil {
+			return -1, ev.Commit(err)
+		}
+		err = core.CheckServiceAdmin(gtx, int64(group.ServiceId))
+		if err != nil {
+			return -1, ev.Commit(err)
+		}
+	}
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	campaign.TenantId = core.TenantFor(gtx, campaign.TenantId)
+	campaign.CreatedBy = user.Id()
+	campaign.UpdatedBy = user.Id()
+
+	id, err := rc.rstore.Create(gtx, campaign)
+	return id, ev.Commit(err)
+}
+
+func (rc *reviewCtl) GetOne(
+	gtx context.Context, id int64) (*core.ReviewCampaign, error) {
+	campaign, err := rc.rstore.GetOne(gtx, id)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "review.getOne", data.M{
+			"campaignId": id,
+		}).Commit(err)
+	}
+	return campaign, nil
+}
+
+func (rc *reviewCtl) Get(
+	gtx context.Context,
+	state core.ReviewState) ([]*core.ReviewCampaign, error) {
+	campaigns, err := rc.rstore.Get(gtx, state)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "review.get", data.M{
+			"state": state,
+		}).Commit(err)
+	}
+	return campaigns, nil
+}
+
+func (rc *reviewCtl) Remove(gtx context.Context, id int64) error {
+	ev := core.NewEventAdder(gtx, "review.remove", data.M{
+		"campaignId": id,
+	})
+	if _, err := rc.forAdmin(gtx, id); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(rc.rstore.Remove(gtx, id))
+}
+
+func (rc *reviewCtl) GetItems(
+	gtx context.Context,
+	campaignId int64,
+	filter *core.ReviewItemFilter) ([]*core.ReviewItem, error) {
+	ev := core.NewEventAdder(gtx, "review.getItems", data.M{
+		"campaignId": campaignId,
+		"filter":     filter,
+	})
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if _, err := rc.rstore.GetOne(gtx, campaignId); err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	adminOf := []int64{}
+	switch {
+	case filter.Mine:
+		serviceIds, err := rc.rstore.ItemServices(gtx, campaignId)
+		if err != nil {
+			return nil, ev.Commit(err)
+		}
+		for _, serviceId := range serviceIds {
+			if core.CheckServiceAdmin(gtx, serviceId) == nil {
+				adminOf = append(adminOf, serviceId)
+			}
+		}
+	case filter.ServiceId != 0:
+		if err := core.CheckServiceAdmin(gtx, filter.ServiceId); err != nil {
+			return nil, ev.Commit(err)
+		}
+	default:
+		if _, err := rc.forAdmin(gtx, campaignId); err != nil {
+			return nil, ev.Commit(err)
+		}
+	}
+
+	items, err := rc.rstore.GetItems(
+		gtx, campaignId, filter, user.Id(), adminOf)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return items, nil
+}
+
+func (rc *reviewCtl) AssignReviewer(
+	gtx context.Context, itemId int64, reviewerId *int64) error {
+	ev := core.NewEventAdder(gtx, "review.assign", data.M{
+		"itemId":     itemId,
+		"reviewerId": reviewerId,
+	})
+
+	item, err := rc.openItem(gtx, itemId)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if err := core.CheckServiceAdmin(gtx, item.ServiceId); err != nil {
+		return ev.Commit(err)
+	}
+	if reviewerId != nil {
+		if *reviewerId == item.UserId {
+			return ev.Errf(core.ErrInvalidState,
+				"user '%s' cannot review own access", item.UserName)
+		}
+		// Reviewer should be an user of the tenant
+		_, err := core.UserCtlr(gtx).GetOne(gtx, *reviewerId)
+		if err != nil {
+			return ev.Commit(err)
+		}
+	}
+	return ev.Commit(rc.rstore.AssignReviewer(gtx, itemId, reviewerId))
+}
+
+func (rc *reviewCtl) Decide(
+	gtx context.Context, itemId int64, decision *core.ItemDecision) error {
+	ev := core.NewEventAdder(gtx, "review.decide", data.M{
+		"itemId":   itemId,
+		"decision": decision,
+	})
+
+	if decision.Decision != core.ReviewConfirmed &&
+		decision.Decision != core.ReviewRevoked {
+		return ev.Errf(core.ErrInvalidState,
+			"invalid review decision '%s'", decision.Decision)
+	}
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	item, err := rc.openItem(gtx, itemId)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if item.UserId == user.Id() {
+		return ev.Errf(core.ErrUnauthorized,
+			"user '%s' cannot review own access", user.UName)
+	}
+
+	if err := checkReviewer(gtx, item, user); err != nil {
+		return ev.Commit(err)
+	}
+
+	// A revocation is recorded as failed till the access is actually removed,
+	// so that the item is retried by the sweeper if the removal fails
+	stored := decision
+	if decision.Decision == core.ReviewRevoked {
+		stored = &core.ItemDecision{
+			Decision: core.ReviewRevokeFailed,
+			Comment:  decision.Comment,
+		}
+	}
+	if err := rc.rstore.Decide(gtx, itemId, user.Id(), stored); err != nil {
+		return ev.Commit(err)
+	}
+	if decision.Decision == core.ReviewRevoked {
+		err = rc.revoke(gtx, item)
+	}
+	return ev.Commit(err)
+}
+
+func (rc *reviewCtl) Close(gtx context.Context, id int64) error {
+	ev := core.NewEventAdder(gtx, "review.close", data.M{
+		"campaignId": id,
+	})
+	campaign, err := rc.forAdmin(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(rc.close(gtx, campaign))
+}
+
+func (rc *reviewCtl) Report(
+	gtx context.Context, id int64) (*core.ReviewReport, error) {
+	ev := core.NewEventAdder(gtx, "review.report", data.M{
+		"campaignId": id,
+	})
+
+	campaign, err := rc.rstore.GetOne(gtx, id)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	items, err := rc.rstore.GetItems(
+		gtx, id, &core.ReviewItemFilter{}, 0, nil)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	report := &core.ReviewReport{
+		Campaign:    campaign,
+		GeneratedOn: time.Now(),
+		Items:       items,
+	}
+	report.Summary.Total = len(items)
+	for _, item := range items {
+		switch item.Decision {
+		case core.ReviewPending:
+			report.Summary.Pending++
+		case core.ReviewConfirmed:
+			report.Summary.Confirmed++
+		case core.ReviewRevoked:
+			report.Summary.Revoked++
+		case core.ReviewAutoRevoked:
+			report.Summary.AutoRevoked++
+		case core.ReviewUnreviewed:
+			report.Summary.Unreviewed++
+		case core.ReviewRevokeFailed:
+			report.Summary.RevokeFailed++
+		}
+	}
+	return report, ev.Commit(nil)
+}
+
+func (rc *reviewCtl) Remind(
+	gtx context.Context, every time.Duration) (int, error) {
+	pending, err := rc.rstore.ToRemind(gtx, time.Now().Add(-every))
+	if err != nil {
+		return 0, core.NewEventAdder(
+			gtx, "review.remind", data.M{}).Commit(err)
+	}
+
+	// A reviewer gets a single mail per campaign, counting the items of all
+	// the services they review in it
+	type reminder struct {
+		review *pendingReview
+		user   *core.User
+		count  int
+	}
+	reminders := make(map[[2]int64]*reminder)
+	order := make([][2]int64, 0, len(pending))
+	for _, pr := range pending {
+		reviewers, err := reviewersOf(gtx, pr)
+		if err != nil {
+			log.Error().Err(err).
+				Int64("campaignId", pr.CampaignId).
+				Int64("serviceId", pr.ServiceId).
+				Msg("failed to get reviewers to remind")
+			continue
+		}
+		for _, reviewer := range reviewers {
+			key := [2]int64{pr.CampaignId, reviewer.Id()}
+			if rem, found := reminders[key]; found {
+				rem.count += pr.Pending
+				continue
+			}
+			reminders[key] = &reminder{pr, reviewer, pr.Pending}
+			order = append(order, key)
+		}
+	}
+
+	sent := 0
+	for _, key := range order {
+		rem := reminders[key]
+		err := core.SendSimpleMail(gtx, rem.user.EmailId,
+			mailtmpl.ReviewReminderTemplate, data.M{
+				"userName":   rem.user.UName,
+				"campaign":   rem.review.Campaign,
+				"pending":    rem.count,
+				"deadline":   rem.review.Deadline.Format(time.RFC1123),
+				"autoRevoke": rem.review.AutoRevoke,
+			})
+		if err != nil {
+			log.Error().Err(err).
+				Int64("campaignId", rem.review.CampaignId).
+				Int64("reviewerId", rem.user.Id()).
+				Msg("failed to remind reviewer")
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func (rc *reviewCtl) CloseDue(gtx context.Context) ([]int64, error) {
+	due, err := rc.rstore.Due(gtx)
+	if err != nil {
+		return nil, core.NewEventAdder(
+			gtx, "review.closeDue", data.M{}).Commit(err)
+	}
+
+	closed := make([]int64, 0, len(due))
+	for _, id := range due {
+		campaign, err := rc.rstore.GetOne(gtx, id)
+		if err == nil {
+			err = rc.close(gtx, campaign)
+		}
+		core.NewEventAdder(gtx, "review.closeDue", data.M{
+			"campaignId": id,
+		}).Commit(err)
+		if err != nil {
+			log.Error().Err(err).Int64("campaignId", id).
+				Msg("failed to close campaign past deadline")
+			continue
+		}
+		closed = append(closed, id)
+	}
+	return closed, nil
+}
+
+// RetryRevocations - failure to revoke an item does not stop the others
+// from being revoked, they are retried at the next run
+func (rc *reviewCtl) RetryRevocations(gtx context.Context) (int, error) {
+	items, err := rc.rstore.RevokeFailed(gtx)
+	if err != nil {
+		return 0, core.NewEventAdder(
+			gtx, "review.retryRevocations", data.M{}).Commit(err)
+	}
+
+	revoked := 0
+	for _, item := range items {
+		err := rc.revoke(gtx, item)
+		core.NewEventAdder(gtx, "review.retryRevocation", data.M{
+			"campaignId": item.CampaignId,
+			"itemId":     item.Id,
+		}).Commit(err)
+		if err != nil {
+			log.Error().Err(err).
+				Int64("campaignId", item.CampaignId).
+				Int64("itemId", item.Id).
+				Msg("failed to retry revocation")
+			continue
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// close - closes the campaign, revoking the unreviewed access if the
+// campaign is configured to. Failure to revoke an item does not stop the
+// others from being revoked
+func (rc *reviewCtl) close(
+	gtx context.Context, campaign *core.ReviewCampaign) error {
+	decision := core.ReviewUnreviewed
+	if campaign.AutoRevoke {
+		decision = core.ReviewRevokeFailed
+	}
+
+	items, err := rc.rstore.Close(gtx, campaign.Id, decision)
+	if err != nil {
+		return err
+	}
+	if !campaign.AutoRevoke {
+		return nil
+	}
+
+	var failed error
+	for _, item := range items {
+		if err := rc.revoke(gtx, item); err != nil {
+			log.Error().Err(err).
+				Int64("campaignId", campaign.Id).
+				Int64("itemId", item.Id).
+				Msg("failed to revoke unreviewed access")
+			failed = err
+		}
+	}
+	if failed != nil {
+		return errx.Errf(failed,
+			"failed to revoke some of the unreviewed access of campaign '%s'",
+			campaign.Name)
+	}
+	return nil
+}
+
+// revoke - removes the access of an item recorded as failed to revoke and
+// only then marks it revoked
+func (rc *reviewCtl) revoke(gtx context.Context, item *core.ReviewItem) error {
+	err := core.GroupCtlr(gtx).RemoveFromGroup(gtx, item.UserId, item.GroupId)
+	if err != nil {
+		return err
+	}
+	return rc.rstore.Revoked(gtx, item.Id)
+}
+
+// forAdmin - campaign if the user in the context is an admin of every
+// service it reviews
+func (rc *reviewCtl) forAdmin(
+	gtx context.Context, id int64) (*core.ReviewCampaign, error) {
+	campaign, err := rc.rstore.GetOne(gtx, id)
+	if err != nil {
+		return nil, err
+	}
+	serviceIds, err := rc.rstore.ItemServices(gtx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, serviceId := range campaign.ServiceIds {
+		if !slices.Contains(serviceIds, serviceId) {
+			serviceIds = append(serviceIds, serviceId)
+		}
+	}
+	for _, serviceId := range serviceIds {
+		if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+			return nil, err
+		}
+	}
+	return campaign, nil
+}
+
+// openItem - pending item of an open campaign in the tenant of the user
+func (rc *reviewCtl) openItem(
+	gtx context.Context, itemId int64) (*core.ReviewItem, error) {
+	item, err := rc.rstore.GetItem(gtx, itemId)
+	if err != nil {
+		return nil, err
+	}
+	campaign, err := rc.rstore.GetOne(gtx, item.CampaignId)
+	if err != nil {
+		return nil, err
+	}
+	if campaign.State != core.ReviewOpen {
+		return nil, errx.Errf(core.ErrInvalidState,
+			"campaign '%s' is already closed", campaign.Name)
+	}
+	if item.Decision != core.ReviewPending {
+		return nil, errx.Errf(core.ErrInvalidState,
+			"review item '%d' is already %s", itemId, item.Decision)
+	}
+	return item, nil
+}
+
+// checkReviewer - items are reviewed by the assigned reviewer, or by the
+// owners of the group if they are not assigned. Admins of the service can
+// review any item
+func checkReviewer(
+	gtx context.Context, item *core.ReviewItem, user *core.User) error {
+	if item.ReviewerId != nil && *item.ReviewerId == user.Id() {
+		return nil
+	}
+	if item.ReviewerId == nil {
+		owner, err := core.GroupCtlr(gtx).IsOwner(
+			gtx, item.GroupId, user.Id())
+		if err != nil {
+			return err
+		}
+		if owner {
+			return nil
+		}
+	}
+	return core.CheckServiceAdmin(gtx, item.ServiceId)
+}
+
+// reviewersOf - assigned reviewer of the items. Items that are not assigned
+// go to the owners of the group, or to the admins of the service if the group
+// does not have owners
+func reviewersOf(
+	gtx context.Context, pr *pendingReview) ([]*core.User, error) {
+	userIds := make([]int64, 0, 4)
+	if pr.ReviewerId != nil {
+		userIds = append(userIds, *pr.ReviewerId)
+	} else {
+		owners, err := core.GroupCtlr(gtx).GetOwners(gtx, pr.GroupId)
+		if err != nil {
+			return nil, err
+		}
+		if len(owners) == 0 {
+			return core.ServiceCtlr(gtx).GetAdmins(gtx, pr.ServiceId)
+		}
+		for _, owner := range owners {
+			userIds = append(userIds, owner.UserId)
+		}
+	}
+
+	reviewers := make([]*core.User, 0, len(userIds))
+	for _, userId := range userIds {
+		reviewer, err := core.UserCtlr(gtx).GetOne(gtx, userId)
+		if err != nil {
+			return nil, err
+		}
+		reviewers = append(reviewers, reviewer)
+	}
+	return reviewers, nil
+}
+
+// RunReviewSweeper - closes the campaigns past their deadline, retries the
+// revocations that failed and reminds the reviewers of open campaigns at
+// every interval
+func RunReviewSweeper(
+	gtx context.Context, interval, remindEvery time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gtx.Done():
+			return
+		case <-ticker.C:
+			rc := core.ReviewCtlr(gtx)
+			closed, err := rc.CloseDue(gtx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to close due campaigns")
+			} else {
+				log.Debug().Int("count", len(closed)).
+					Msg("closed campaigns past deadline")
+			}
+
+			retried, err := rc.RetryRevocations(gtx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to retry revocations")
+			} else if retried != 0 {
+				log.Info().Int("count", retried).Msg("retried revocations")
+			}
+
+			num, err := rc.Remind(gtx, remindEvery)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to remind reviewers")
+				continue
+			}
+			log.Debug().Int("count", num).Msg("reminded reviewers")
+		}
+	}
+}
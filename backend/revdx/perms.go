@@ -0,0 +1,6 @@
+package revdx
+
+const (
+	PermManageReview = "idx.manageReview"
+	PermGetReview    = "idx.getReview"
+)
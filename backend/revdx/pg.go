@@ -0,0 +1,429 @@
+package revdx
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+type PgReviewStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewReviewStorage(gd data.GetterDeleter) *PgReviewStorage {
+	return &PgReviewStorage{
+		gd: gd,
+	}
+}
+
+// Create - creates the campaign and snapshots the memberships in effect in
+// the same transaction, so that the campaign never exists without its items
+func (prs *PgReviewStorage) Create(
+	gtx context.Context, campaign *core.ReviewCampaign) (int64, error) {
+
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return -1, errx.Errf(err, "failed to initilize DB transaction")
+	}
+	ef := func(err error, fmtStr string, args ...any) error {
+		if e := tx.Rollback(); e != nil {
+			log.Error().Err(e).
+				Msg("transaction rollback failed for review campaign creation")
+		}
+		return errx.Errf(err, fmtStr, args...)
+	}
+
+	query := `
+		INSERT INTO idx_review_campaign (
+			created_by,
+			updated_by,
+			tenant_id,
+			name,
+			description,
+			service_ids,
+			group_ids,
+			deadline,
+			auto_revoke
+		) VALUES (
+			:created_by,
+			:updated_by,
+			:tenant_id,
+			:name,
+			:description,
+			:service_ids,
+			:group_ids,
+			:deadline,
+			:auto_revoke
+		) RETURNING id;
+	`
+	stmt, err := tx.PrepareNamedContext(gtx, query)
+	if err != nil {
+		return -1, ef(err, "failed to prepare query to create campaign")
+	}
+	var id int64
+	if err := stmt.GetContext(gtx, &id, campaign); err != nil {
+		return -1, ef(err, "failed to create campaign '%s'", campaign.Name)
+	}
+
+	const snapshot = `
+		INSERT INTO idx_review_item (
+			campaign_id,
+			user_id,
+			user_name,
+			group_id,
+			group_name,
+			service_id,
+			service_name,
+			valid_from,
+			valid_until
+		)
+		SELECT
+			$1,
+			u.id,
+			u.user_name,
+			g.id,
+			g.name,
+			s.id,
+			s.name,
+			ug.valid_from,
+			ug.valid_until
+		FROM user_to_group ug
+		JOIN idx_user u ON u.id = ug.user_id
+		JOIN idx_group g ON g.id = ug.group_id
+		JOIN idx_service s ON s.id = g.service_id
+		WHERE
+			(g.service_id = ANY($2) OR g.id = ANY($3)) AND
+			g.tenant_id = $4 AND
+			ug.valid_from <= NOW() AND
+			(ug.valid_until IS NULL OR ug.valid_until > NOW())
+	`
+	_, err = tx.ExecContext(gtx, snapshot, id,
+		campaign.ServiceIds, campaign.GroupIds, campaign.TenantId)
+	if err != nil {
+		return -1, ef(err, "failed to snapshot memberships for campaign '%s'",
+			campaign.Name)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, ef(err, "failed to commit creation of campaign '%s'",
+			campaign.Name)
+	}
+	return id, nil
+}
+
+func (prs *PgReviewStorage) GetOne(
+	gtx context.Context, id int64) (*core.ReviewCampaign, error) {
+	var campaign core.ReviewCampaign
+	err := prs.gd.GetOne(gtx,
+		core.TenantTable(gtx, "idx_review_campaign"), "id", id, &campaign)
+	if err != nil {
+		return nil, errx.Wrap(err)
+	}
+	return &campaign, nil
+}
+
+func (prs *PgReviewStorage) Get(
+	gtx context.Context,
+	state core.ReviewState) ([]*core.ReviewCampaign, error) {
+	query := `
+		SELECT * FROM idx_review_campaign
+		WHERE ($1 = '' OR state = $1) AND ` +
+		core.TenantCond(gtx, "tenant_id") + `
+		ORDER BY created_on DESC
+	`
+	campaigns := make([]*core.ReviewCampaign, 0, 20)
+	err := pg.Conn().SelectContext(gtx, &campaigns, query, string(state))
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get review campaigns")
+	}
+	return campaigns, nil
+}
+
+func (prs *PgReviewStorage) Remove(gtx context.Context, id int64) error {
+	if err := prs.gd.Delete(gtx, "idx_review_campaign", "id", id); err != nil {
+		return errx.Wrap(err)
+	}
+	return nil
+}
+
+const selectItems = `
+	SELECT
+		i.*,
+		COALESCE(d.user_name, '') AS decider_name
+	FROM idx_review_item i
+	LEFT JOIN idx_user d ON d.id = i.decided_by
+`
+
+func (prs *PgReviewStorage) GetItem(
+	gtx context.Context, id int64) (*core.ReviewItem, error) {
+	query := selectItems + `WHERE i.id = $1`
+	var item core.ReviewItem
+	if err := pg.Conn().GetContext(gtx, &item, query, id); err != nil {
+		return nil, errx.Errf(err, "failed to get review item '%d'", id)
+	}
+	return &item, nil
+}
+
+// GetItems - items of the campaign, reviewerId limits them to the items
+// assigned to the reviewer and the unassigned items of adminOf services and
+// of the groups owned by the reviewer
+func (prs *PgReviewStorage) GetItems(
+	gtx context.Context,
+	campaignId int64,
+	filter *core.ReviewItemFilter,
+	reviewerId int64,
+	adminOf []int64) ([]*core.ReviewItem, error) {
+
+	eq := squirrel.Eq{"i.campaign_id": campaignId}
+	if filter.ServiceId != 0 {
+		eq["i.service_id"] = filter.ServiceId
+	}
+	if filter.Decision != "" {
+		eq["i.decision"] = filter.Decision
+	}
+
+	builder := squirrel.StatementBuilder.
+		PlaceholderFormat(squirrel.Dollar).
+		Select("i.*", "COALESCE(d.user_name, '') AS decider_name").
+		From("idx_review_item i").
+		LeftJoin("idx_user d ON d.id = i.decided_by").
+		Where(eq)
+	if filter.Mine {
+		builder = builder.Where(squirrel.Or{
+			squirrel.Eq{"i.reviewer_id": reviewerId},
+			squirrel.And{
+				squirrel.Eq{"i.reviewer_id": nil},
+				squirrel.Or{
+					squirrel.Eq{"i.service_id": adminOf},
+					squirrel.Expr(`i.group_id IN (
+						SELECT group_id FROM group_to_owner WHERE owner_id = ?
+					)`, reviewerId),
+				},
+			},
+		})
+	}
+
+	query, args, err := builder.
+		OrderBy("i.service_name", "i.group_name", "i.user_name").
+		ToSql()
+	if err != nil {
+		return nil, errx.Errf(err, "failed to build review item query")
+	}
+
+	items := make([]*core.ReviewItem, 0, 100)
+	if err := pg.Conn().SelectContext(gtx, &items, query, args...); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get items of campaign '%d'", campaignId)
+	}
+	return items, nil
+}
+
+func (prs *PgReviewStorage) AssignReviewer(
+	gtx context.Context, itemId int64, reviewerId *int64) error {
+	const query = `
+		UPDATE idx_review_item SET reviewer_id = $2
+		WHERE id = $1 AND decision = 'pending'
+	`
+	res, err := pg.Conn().ExecContext(gtx, query, itemId, reviewerId)
+	if err != nil {
+		return errx.Errf(err, "failed to assign reviewer to item '%d'", itemId)
+	}
+	if num, err := res.RowsAffected(); err != nil || num != 1 {
+		return errx.Errf(core.ErrInvalidState,
+			"review item '%d' is already decided", itemId)
+	}
+	return nil
+}
+
+// Decide - the update only matches a pending item, so that concurrent
+// decisions on the same item cannot both succeed
+func (prs *PgReviewStorage) Decide(
+	gtx context.Context,
+	itemId int64,
+	actorId int64,
+	decision *core.ItemDecision) error {
+	const query = `
+		UPDATE idx_review_item SET
+			decision = $2,
+			decided_by = $3,
+			decided_on = NOW(),
+			comment = $4
+		WHERE id = $1 AND decision = 'pending'
+	`
+	res, err := pg.Conn().ExecContext(
+		gtx, query, itemId, decision.Decision, actorId, decision.Comment)
+	if err != nil {
+		return errx.Errf(err, "failed to decide on review item '%d'", itemId)
+	}
+	if num, err := res.RowsAffected(); err != nil || num != 1 {
+		return errx.Errf(core.ErrInvalidState,
+			"review item '%d' is already decided", itemId)
+	}
+	return nil
+}
+
+// Close - closes an open campaign and moves its pending items to the given
+// decision, returns the items that were pending
+func (prs *PgReviewStorage) Close(
+	gtx context.Context,
+	id int64,
+	pending core.ReviewDecision) ([]*core.ReviewItem, error) {
+
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return nil, errx.Errf(err, "failed to initilize DB transaction")
+	}
+	ef := func(err error, fmtStr string, args ...any) error {
+		if e := tx.Rollback(); e != nil {
+			log.Error().Err(e).
+				Msg("transaction rollback failed for review campaign closure")
+		}
+		return errx.Errf(err, fmtStr, args...)
+	}
+
+	const query = `
+		UPDATE idx_review_campaign SET
+			state = 'closed',
+			closed_on = NOW(),
+			updated_on = NOW()
+		WHERE id = $1 AND state = 'open'
+	`
+	res, err := tx.ExecContext(gtx, query, id)
+	if err != nil {
+		return nil, ef(err, "failed to close campaign '%d'", id)
+	}
+	if num, err := res.RowsAffected(); err != nil || num != 1 {
+		return nil, ef(core.ErrInvalidState, "campaign '%d' is not open", id)
+	}
+
+	const itemQuery = `
+		UPDATE idx_review_item SET
+			decision = $2,
+			decided_on = NOW()
+		WHERE campaign_id = $1 AND decision = 'pending'
+		RETURNING *, '' AS decider_name
+	`
+	items := make([]*core.ReviewItem, 0, 20)
+	if err := tx.SelectContext(gtx, &items, itemQuery, id, pending); err != nil {
+		return nil, ef(err, "failed to close pending items of campaign '%d'", id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, ef(err, "failed to commit closure of campaign '%d'", id)
+	}
+	return items, nil
+}
+
+// Revoked - marks an item revoked once its access is removed, items decided
+// by nobody were revoked by the closure of the campaign
+func (prs *PgReviewStorage) Revoked(gtx context.Context, itemId int64) error {
+	const query = `
+		UPDATE idx_review_item SET
+			decision = CASE
+				WHEN decided_by IS NULL THEN $2
+				ELSE $3
+			END
+		WHERE id = $1 AND decision = $4
+	`
+	_, err := pg.Conn().ExecContext(gtx, query, itemId,
+		core.ReviewAutoRevoked, core.ReviewRevoked, core.ReviewRevokeFailed)
+	if err != nil {
+		return errx.Errf(err, "failed to mark review item '%d' revoked", itemId)
+	}
+	return nil
+}
+
+// RevokeFailed - items whose access is yet to be removed
+func (prs *PgReviewStorage) RevokeFailed(
+	gtx context.Context) ([]*core.ReviewItem, error) {
+	query := selectItems + `WHERE i.decision = $1 ORDER BY i.id`
+	items := make([]*core.ReviewItem, 0, 20)
+	err := pg.Conn().SelectContext(gtx, &items, query, core.ReviewRevokeFailed)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get items failed to revoke")
+	}
+	return items, nil
+}
+
+func (prs *PgReviewStorage) Due(gtx context.Context) ([]int64, error) {
+	query := `
+		SELECT id FROM idx_review_campaign
+		WHERE state = 'open' AND deadline <= NOW()
+	`
+	ids := make([]int64, 0, 4)
+	if err := pg.Conn().SelectContext(gtx, &ids, query); err != nil {
+		return nil, errx.Errf(err, "failed to get campaigns past deadline")
+	}
+	return ids, nil
+}
+
+// pendingReview - pending items of a campaign for a reviewer, reviewer is
+// nil for the items that are reviewed by the owners of the group or the
+// admins of the service
+type pendingReview struct {
+	CampaignId int64     `db:"campaign_id"`
+	Campaign   string    `db:"campaign"`
+	Deadline   time.Time `db:"deadline"`
+	AutoRevoke bool      `db:"auto_revoke"`
+	ServiceId  int64     `db:"service_id"`
+	GroupId    int64     `db:"group_id"`
+	ReviewerId *int64    `db:"reviewer_id"`
+	Pending    int       `db:"pending"`
+}
+
+// ToRemind - pending items of the open campaigns that were not reminded
+// since the given time, the campaigns are marked as reminded
+func (prs *PgReviewStorage) ToRemind(
+	gtx context.Context, since time.Time) ([]*pendingReview, error) {
+	query := `
+		WITH reminded AS (
+			UPDATE idx_review_campaign SET reminded_on = NOW()
+			WHERE
+				state = 'open' AND
+				(reminded_on IS NULL OR reminded_on <= $1)
+			RETURNING id, name, deadline, auto_revoke
+		)
+		SELECT
+			r.id AS campaign_id,
+			r.name AS campaign,
+			r.deadline,
+			r.auto_revoke,
+			i.service_id,
+			i.group_id,
+			i.reviewer_id,
+			COUNT(*) AS pending
+		FROM reminded r
+		JOIN idx_review_item i ON i.campaign_id = r.id
+		WHERE i.decision = 'pending'
+		GROUP BY
+			r.id, r.name, r.deadline, r.auto_revoke,
+			i.service_id, i.group_id, i.reviewer_id
+	`
+	out := make([]*pendingReview, 0, 20)
+	if err := pg.Conn().SelectContext(gtx, &out, query, since); err != nil {
+		return nil, errx.Errf(err, "failed to get reviews to remind")
+	}
+	return out, nil
+}
+
+// ItemServices - services the items of the campaign belong to
+func (prs *PgReviewStorage) ItemServices(
+	gtx context.Context, campaignId int64) ([]int64, error) {
+	query := `
+		SELECT DISTINCT service_id FROM idx_review_item
+		WHERE campaign_id = $1
+	`
+	ids := make([]int64, 0, 4)
+	if err := pg.Conn().SelectContext(gtx, &ids, query, campaignId); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get services of campaign '%d'", campaignId)
+	}
+	return ids, nil
+}
@@ -0,0 +1,220 @@
+package samldx
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/idx/userdx"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+// SamlPages - SAML protocol endpoints, these are not under the /api prefix
+// since service providers get their location from the metadata
+func SamlPages(gtx context.Context) []*httpx.Endpoint {
+	sc := core.SamlCtlr(gtx)
+	return []*httpx.Endpoint{
+		metadataEp(sc),
+		ssoEp(sc, echo.GET),
+		ssoEp(sc, echo.POST),
+	}
+}
+
+func SamlEndpoints(gtx context.Context) []*httpx.Endpoint {
+	sc := core.SamlCtlr(gtx)
+	return []*httpx.Endpoint{
+		saveSpEp(sc),
+		getSpEp(sc),
+		deleteSpEp(sc),
+	}
+}
+
+func metadataEp(sc core.SamlController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		md, err := sc.Metadata(etx.Request().Context())
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return etx.Blob(
+			http.StatusOK, "application/samlmetadata+xml", []byte(md))
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/saml/metadata",
+		Category: "idx.saml",
+		Desc:     "SAML identity provider metadata",
+		Version:  "v1",
+		Handler:  handler,
+	}
+}
+
+var postFormTmpl = template.Must(template.New("samlPost").Parse(`<!DOCTYPE html>
+<html>
+<body onload="document.forms[0].submit()">
+<noscript><p>JavaScript is disabled, press Continue to proceed.</p></noscript>
+<form method="post" action="{{.AcsUrl}}">
+<input type="hidden" name="SAMLResponse" value="{{.SAMLResponse}}"/>
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}"/>{{end}}
+<noscript><input type="submit" value="Continue"/></noscript>
+</form>
+</body>
+</html>`))
+
+func ssoEp(sc core.SamlController, method string) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		// Redirect binding sends the request as query param after deflating
+		// it, POST binding as form value without compression. A POST request
+		// that comes back after login is sent as query param with the binding
+		deflated := etx.Request().Method == echo.GET &&
+			etx.QueryParam("binding") != "post"
+		samlRequest := etx.QueryParam("SAMLRequest")
+		relayState := etx.QueryParam("RelayState")
+		if etx.Request().Method == echo.POST {
+			samlRequest = etx.FormValue("SAMLRequest")
+			relayState = etx.FormValue("RelayState")
+		}
+		if samlRequest == "" {
+			return errx.BadReq("SAMLRequest is missing")
+		}
+
+		// User agent is not able to send a bearer token, the session comes
+		// from the cookie set at login
+		user, err := userdx.CookieUser(etx)
+		if errors.Is(err, core.ErrUnauthorized) {
+			return etx.Redirect(http.StatusFound,
+				loginUrl(samlRequest, relayState, deflated))
+		}
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		gtx := context.WithValue(
+			etx.Request().Context(), httpx.UserKey, user)
+
+		form, err := sc.HandleAuthnRequest(
+			gtx, samlRequest, relayState, deflated)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		etx.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTML)
+		etx.Response().Header().Set("Cache-Control", "no-store")
+		etx.Response().WriteHeader(http.StatusOK)
+		return postFormTmpl.Execute(etx.Response(), form)
+	}
+
+	return &httpx.Endpoint{
+		Method:   method,
+		Path:     "/saml/sso",
+		Category: "idx.saml",
+		Desc:     "SAML single sign on service",
+		Version:  "v1",
+		Handler:  handler,
+	}
+}
+
+// loginUrl - login page of idx, which returns to the SSO endpoint with the
+// same request once the user logs in
+func loginUrl(samlRequest, relayState string, deflated bool) string {
+	params := url.Values{}
+	params.Set("SAMLRequest", samlRequest)
+	if relayState != "" {
+		params.Set("RelayState", relayState)
+	}
+	if !deflated {
+		params.Set("binding", "post")
+	}
+	next := core.ToFullUrl("/saml/sso") + "?" + params.Encode()
+	return core.ToFullUrl("/login") + "?" +
+		url.Values{"next": []string{next}}.Encode()
+}
+
+func saveSpEp(sc core.SamlController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var sp core.SamlServiceProvider
+		if err := etx.Bind(&sp); err != nil {
+			return errx.BadReqX(err, "failed to read SAML config from request")
+		}
+		sp.ServiceId = serviceId
+
+		err := sc.SaveServiceProvider(etx.Request().Context(), &sp)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/service/:serviceId/saml",
+		Category:    "idx.saml",
+		Desc:        "Configure service as SAML service provider",
+		Version:     "v1",
+		Permissions: []string{PermManageSaml},
+		Handler:     handler,
+	}
+}
+
+func getSpEp(sc core.SamlController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		sp, err := sc.GetServiceProvider(etx.Request().Context(), serviceId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, sp)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/service/:serviceId/saml",
+		Category:    "idx.saml",
+		Desc:        "Get SAML service provider config of a service",
+		Version:     "v1",
+		Permissions: []string{PermManageSaml},
+		Handler:     handler,
+	}
+}
+
+func deleteSpEp(sc core.SamlController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		err := sc.RemoveServiceProvider(etx.Request().Context(), serviceId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return etx.String(http.StatusOK, strconv.FormatInt(serviceId, 10))
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/service/:serviceId/saml",
+		Category:    "idx.saml",
+		Desc:        "Remove SAML service provider config of a service",
+		Version:     "v1",
+		Permissions: []string{PermManageSaml},
+		Handler:     handler,
+	}
+}
@@ -0,0 +1,56 @@
+package samldx
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+type Client struct {
+	*httpx.Client
+	Timeout time.Duration
+}
+
+func (c *Client) build() *httpx.RequestBuilder {
+	builder := c.Build()
+	if c.Timeout != 0 {
+		builder = builder.WithTimeout(c.Timeout)
+	}
+	return builder
+}
+
+func (c *Client) SaveSamlConfig(
+	gtx context.Context, sp *core.SamlServiceProvider) error {
+	apiRes := c.build().
+		Path("/api/v1/service", sp.ServiceId, "saml").
+		Put(gtx, sp)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to save SAML config of service '%d'", sp.ServiceId)
+	}
+	return nil
+}
+
+func (c *Client) GetSamlConfig(
+	gtx context.Context, serviceId int64) (*core.SamlServiceProvider, error) {
+	apiRes := c.build().Path("/api/v1/service", serviceId, "saml").Get(gtx)
+	var sp core.SamlServiceProvider
+	if err := apiRes.LoadClose(&sp); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get SAML config of service '%d'", serviceId)
+	}
+	return &sp, nil
+}
+
+func (c *Client) RemoveSamlConfig(
+	gtx context.Context, serviceId int64) error {
+	apiRes := c.build().Path("/api/v1/service", serviceId, "saml").Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to remove SAML config of service '%d'", serviceId)
+	}
+	return nil
+}
@@ -0,0 +1,524 @@
+package samldx
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/rt"
+)
+
+var (
+	ErrInvalidAuthnRequest = errors.New("invalid SAML authn request")
+	ErrUnknownSP           = errors.New("unknown SAML service provider")
+)
+
+// Validity of the generated assertions
+const assertionTTL = 5 * time.Minute
+
+type authnRequest struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	Id           string   `xml:"ID,attr"`
+	Version      string   `xml:"Version,attr"`
+	Destination  string   `xml:"Destination,attr"`
+	AcsUrl       string   `xml:"AssertionConsumerServiceURL,attr"`
+	Binding      string   `xml:"ProtocolBinding,attr"`
+	Issuer       string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIdPolicy *struct {
+		Format string `xml:"Format,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+type idpKeys struct {
+	key     *rsa.PrivateKey
+	certDer []byte
+}
+
+type samlCtl struct {
+	sstore  *PgSamlStorage
+	keys    *idpKeys
+	keysMtx sync.Mutex
+}
+
+func NewSamlController(sstore *PgSamlStorage) core.SamlController {
+	return &samlCtl{
+		sstore: sstore,
+	}
+}
+
+func (sc *samlCtl) Storage() *PgSamlStorage {
+	return sc.sstore
+}
+
+func (sc *samlCtl) SaveServiceProvider(
+	gtx context.Context, sp *core.SamlServiceProvider) error {
+	ev := core.NewEventAdder(gtx, "saml.sp.save", data.M{
+		"serviceId": sp.ServiceId,
+		"entityId":  sp.EntityId,
+	})
+
+	if err := core.CheckServiceAdmin(gtx, sp.ServiceId); err != nil {
+		return ev.Commit(err)
+	}
+
+	if sp.EntityId == "" || sp.AcsUrl == "" {
+		return ev.Errf(core.ErrInvalidState,
+			"entity id and ACS url are required for SAML service provider")
+	}
+	if sp.NameIdFormat == "" {
+		sp.NameIdFormat = core.NameIdUnspecified
+	}
+	if !data.OneOf(sp.NameIdFormat,
+		core.NameIdUnspecified,
+		core.NameIdEmail,
+		core.NameIdPersistent,
+		core.NameIdTransient) {
+		return ev.Errf(core.ErrInvalidState,
+			"unsupported NameID format '%s'", sp.NameIdFormat)
+	}
+
+	// Secret is only used if the SP does not have one yet
+	secret, err := newNameIdSecret()
+	if err != nil {
+		return ev.Commit(err)
+	}
+	sp.NameIdSecret = secret
+	return ev.Commit(sc.sstore.Save(gtx, sp))
+}
+
+func (sc *samlCtl) GetServiceProvider(
+	gtx context.Context,
+	serviceId int64) (*core.SamlServiceProvider, error) {
+	sp, err := sc.sstore.GetOne(gtx, serviceId)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "saml.sp.get", data.M{
+			"serviceId": serviceId,
+		}).Commit(err)
+	}
+	return sp, nil
+}
+
+func (sc *samlCtl) RemoveServiceProvider(
+	gtx context.Context, serviceId int64) error {
+	ev := core.NewEventAdder(gtx, "saml.sp.remove", data.M{
+		"serviceId": serviceId,
+	})
+	if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(sc.sstore.Remove(gtx, serviceId))
+}
+
+func (sc *samlCtl) Metadata(gtx context.Context) (string, error) {
+	keys, err := sc.idpKeys()
+	if err != nil {
+		return "", err
+	}
+
+	ssoUrl := core.ToFullUrl("/saml/sso")
+	desc := elem("md:EntityDescriptor").
+		ns("md", nsMetadata).
+		ns("ds", nsDsig).
+		attr("entityID", entityId()).
+		add(
+			elem("md:IDPSSODescriptor").
+				attr("WantAuthnRequestsSigned", "false").
+				attr("protocolSupportEnumeration", nsProtocol).
+				add(
+					elem("md:KeyDescriptor").attr("use", "signing").add(
+						elem("ds:KeyInfo").add(
+							elem("ds:X509Data").add(
+								elem("ds:X509Certificate").setText(
+									base64.StdEncoding.EncodeToString(
+										keys.certDer)),
+							),
+						),
+					),
+					elem("md:NameIDFormat").setText(core.NameIdUnspecified),
+					elem("md:NameIDFormat").setText(core.NameIdEmail),
+					elem("md:NameIDFormat").setText(core.NameIdPersistent),
+					elem("md:NameIDFormat").setText(core.NameIdTransient),
+					elem("md:SingleSignOnService").
+						attr("Binding", bindingRedir).
+						attr("Location", ssoUrl),
+					elem("md:SingleSignOnService").
+						attr("Binding", bindingPost).
+						attr("Location", ssoUrl),
+				),
+		)
+	return xml.Header + desc.String(), nil
+}
+
+func (sc *samlCtl) HandleAuthnRequest(
+	gtx context.Context,
+	samlRequest, relayState string,
+	deflated bool) (*core.SamlPostForm, error) {
+	ev := core.NewEventAdder(gtx, "saml.sso", data.M{})
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	req, err := decodeAuthnRequest(samlRequest, deflated)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	ev.AddData("entityId", req.Issuer)
+	ev.AddData("requestId", req.Id)
+
+	sp, err := sc.sstore.ByEntityId(gtx, req.Issuer)
+	if err != nil {
+		return nil, ev.Errf(ErrUnknownSP,
+			"service provider '%s' is not registered", req.Issuer)
+	}
+
+	// Never post an assertion to an URL that is not registered for the SP
+	if req.AcsUrl != "" && req.AcsUrl != sp.AcsUrl {
+		return nil, ev.Errf(ErrInvalidAuthnRequest,
+			"ACS url '%s' does not match the one registered for '%s'",
+			req.AcsUrl, sp.EntityId)
+	}
+	if req.Binding != "" && req.Binding != bindingPost {
+		return nil, ev.Errf(ErrInvalidAuthnRequest,
+			"unsupported response binding '%s'", req.Binding)
+	}
+
+	// Assertion is a token for the service, users not allowed to use the
+	// service should not get one
+	err = core.ServiceCtlr(gtx).CheckAccess(gtx, sp.ServiceId, user.Id())
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	nameIdFormat := sp.NameIdFormat
+	if req.NameIdPolicy != nil && req.NameIdPolicy.Format != "" &&
+		req.NameIdPolicy.Format != core.NameIdUnspecified {
+		if req.NameIdPolicy.Format != sp.NameIdFormat {
+			return nil, ev.Errf(ErrInvalidAuthnRequest,
+				"NameID format '%s' is not configured for '%s'",
+				req.NameIdPolicy.Format, sp.EntityId)
+		}
+	}
+
+	if nameIdFormat == core.NameIdPersistent && sp.NameIdSecret == "" {
+		secret, err := newNameIdSecret()
+		if err != nil {
+			return nil, ev.Commit(err)
+		}
+		sp, err = sc.sstore.InitNameIdSecret(gtx, sp.ServiceId, secret)
+		if err != nil {
+			return nil, ev.Commit(err)
+		}
+	}
+
+	attrs, err := sc.attributes(gtx, sp, user)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	resp, err := sc.response(
+		sp, req.Id, nameId(sp, nameIdFormat, user), nameIdFormat, attrs)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	return &core.SamlPostForm{
+		AcsUrl:       sp.AcsUrl,
+		SAMLResponse: base64.StdEncoding.EncodeToString([]byte(resp)),
+		RelayState:   relayState,
+	}, ev.Commit(nil)
+}
+
+func (sc *samlCtl) response(
+	sp *core.SamlServiceProvider,
+	inResponseTo string,
+	nameId, nameIdFormat string,
+	attrs map[string][]string) (string, error) {
+
+	keys, err := sc.idpKeys()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	instant := now.Format(time.RFC3339)
+	notOnOrAfter := now.Add(assertionTTL).Format(time.RFC3339)
+	assertionId := "_" + uuid.NewString()
+
+	attrStmt := elem("saml:AttributeStatement")
+	for _, name := range sortedKeys(attrs) {
+		attr := elem("saml:Attribute").
+			attr("Name", name).
+			attr("NameFormat",
+				"urn:oasis:names:tc:SAML:2.0:attrname-format:basic")
+		for _, val := range attrs[name] {
+			attr.add(elem("saml:AttributeValue").setText(val))
+		}
+		attrStmt.add(attr)
+	}
+
+	assertion := elem("saml:Assertion").
+		ns("saml", nsAssertion).
+		attr("ID", assertionId).
+		attr("IssueInstant", instant).
+		attr("Version", "2.0").
+		add(
+			elem("saml:Issuer").setText(entityId()),
+			elem("saml:Subject").add(
+				elem("saml:NameID").
+					attr("Format", nameIdFormat).
+					setText(nameId),
+				elem("saml:SubjectConfirmation").
+					attr("Method", "urn:oasis:names:tc:SAML:2.0:cm:bearer").
+					add(
+						elem("saml:SubjectConfirmationData").
+							attr("InResponseTo", inResponseTo).
+							attr("NotOnOrAfter", notOnOrAfter).
+							attr("Recipient", sp.AcsUrl),
+					),
+			),
+			elem("saml:Conditions").
+				attr("NotBefore", instant).
+				attr("NotOnOrAfter", notOnOrAfter).
+				add(
+					elem("saml:AudienceRestriction").add(
+						elem("saml:Audience").setText(sp.EntityId),
+					),
+				),
+			elem("saml:AuthnStatement").
+				attr("AuthnInstant", instant).
+				attr("SessionIndex", assertionId).
+				add(
+					elem("saml:AuthnContext").add(
+						elem("saml:AuthnContextClassRef").setText(
+							"urn:oasis:names:tc:SAML:2.0:ac:classes:"+
+								"PasswordProtectedTransport"),
+					),
+				),
+			attrStmt,
+		)
+
+	// Signature goes right after the issuer
+	err = signEnveloped(assertion, assertionId, 1, keys.key, keys.certDer)
+	if err != nil {
+		return "", err
+	}
+
+	resp := elem("samlp:Response").
+		ns("samlp", nsProtocol).
+		ns("saml", nsAssertion).
+		attr("Destination", sp.AcsUrl).
+		attr("ID", "_"+uuid.NewString()).
+		attr("InResponseTo", inResponseTo).
+		attr("IssueInstant", instant).
+		attr("Version", "2.0").
+		add(
+			elem("saml:Issuer").setText(entityId()),
+			elem("samlp:Status").add(
+				elem("samlp:StatusCode").attr("Value", statusSuccess),
+			),
+			rawNode(assertion.String()),
+		)
+	return xml.Header + resp.String(), nil
+}
+
+func (sc *samlCtl) attributes(
+	gtx context.Context,
+	sp *core.SamlServiceProvider,
+	user *core.User) (map[string][]string, error) {
+
+	attrs := make(map[string][]string, len(sp.Attributes))
+	for name, source := range sp.Attributes {
+		switch source {
+		case "userName":
+			attrs[name] = []string{user.UName}
+		case "email":
+			attrs[name] = []string{user.EmailId}
+		case "firstName":
+			attrs[name] = []string{user.FirstName}
+		case "lastName":
+			attrs[name] = []string{user.LastName}
+		case "fullName":
+			attrs[name] = []string{user.FullName()}
+		case "title":
+			attrs[name] = []string{user.Title}
+		case "role":
+			attrs[name] = []string{string(user.AuthzRole)}
+		case "permissions":
+			perms, err := core.ServiceCtlr(gtx).GetPermissionForService(
+				gtx, user.Id(), sp.ServiceId)
+			if err != nil {
+				return nil, err
+			}
+			attrs[name] = perms
+		default:
+			prop, found := strings.CutPrefix(source, "props.")
+			if !found {
+				return nil, errx.Fmt(
+					"invalid source '%s' for SAML attribute '%s'",
+					source, name)
+			}
+			if val := user.Prop(prop); val != nil {
+				attrs[name] = propValues(val)
+			}
+		}
+	}
+	return attrs, nil
+}
+
+func (sc *samlCtl) idpKeys() (*idpKeys, error) {
+	sc.keysMtx.Lock()
+	defer sc.keysMtx.Unlock()
+	if sc.keys != nil {
+		return sc.keys, nil
+	}
+
+	keyFile := rt.EnvString("IDX_SAML_KEY_FILE", "")
+	certFile := rt.EnvString("IDX_SAML_CERT_FILE", "")
+	if keyFile == "" || certFile == "" {
+		return nil, errx.Fmt("SAML identity provider is not configured, " +
+			"set IDX_SAML_KEY_FILE and IDX_SAML_CERT_FILE")
+	}
+
+	keyPem, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to read SAML key file")
+	}
+	certPem, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to read SAML cert file")
+	}
+
+	kb, _ := pem.Decode(keyPem)
+	if kb == nil {
+		return nil, errx.Fmt("invalid PEM in SAML key file")
+	}
+	var key *rsa.PrivateKey
+	if pk, err := x509.ParsePKCS8PrivateKey(kb.Bytes); err == nil {
+		var ok bool
+		if key, ok = pk.(*rsa.PrivateKey); !ok {
+			return nil, errx.Fmt("SAML signing key must be a RSA key")
+		}
+	} else if key, err = x509.ParsePKCS1PrivateKey(kb.Bytes); err != nil {
+		return nil, errx.Errf(err, "failed to parse SAML signing key")
+	}
+
+	cb, _ := pem.Decode(certPem)
+	if cb == nil {
+		return nil, errx.Fmt("invalid PEM in SAML cert file")
+	}
+	if _, err := x509.ParseCertificate(cb.Bytes); err != nil {
+		return nil, errx.Errf(err, "failed to parse SAML certificate")
+	}
+
+	sc.keys = &idpKeys{key: key, certDer: cb.Bytes}
+	return sc.keys, nil
+}
+
+func decodeAuthnRequest(
+	samlRequest string, deflated bool) (*authnRequest, error) {
+	raw, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil {
+		return nil, errx.Errf(ErrInvalidAuthnRequest,
+			"SAMLRequest is not base64 encoded: %v", err)
+	}
+
+	if deflated {
+		// Redirect binding uses raw DEFLATE
+		raw, err = io.ReadAll(
+			io.LimitReader(flate.NewReader(bytes.NewReader(raw)), 1<<20))
+		if err != nil {
+			return nil, errx.Errf(ErrInvalidAuthnRequest,
+				"failed to inflate SAMLRequest: %v", err)
+		}
+	}
+
+	var req authnRequest
+	if err := xml.Unmarshal(raw, &req); err != nil {
+		return nil, errx.Errf(ErrInvalidAuthnRequest,
+			"failed to parse AuthnRequest: %v", err)
+	}
+	if req.Id == "" || req.Issuer == "" || req.Version != "2.0" {
+		return nil, errx.Errf(ErrInvalidAuthnRequest,
+			"AuthnRequest without ID, Issuer or version 2.0")
+	}
+	return &req, nil
+}
+
+func nameId(
+	sp *core.SamlServiceProvider, format string, user *core.User) string {
+	switch format {
+	case core.NameIdEmail:
+		return user.EmailId
+	case core.NameIdTransient:
+		return "_" + uuid.NewString()
+	case core.NameIdPersistent:
+		// Opaque but stable per user and SP. The key is a secret of the SP
+		// that only idx knows, so SPs cannot correlate their users
+		mac := hmac.New(sha256.New, []byte(sp.NameIdSecret))
+		mac.Write([]byte(strconv.FormatInt(user.Id(), 10)))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	return user.UName
+}
+
+func newNameIdSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", errx.Errf(err, "failed to generate SAML NameID secret")
+	}
+	return base64.RawStdEncoding.EncodeToString(secret), nil
+}
+
+func entityId() string {
+	return rt.EnvString("IDX_SAML_ENTITY_ID", core.ToFullUrl("/saml/metadata"))
+}
+
+func propValues(val any) []string {
+	switch v := val.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, propValues(item)...)
+		}
+		return out
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,5 @@
+package samldx
+
+const (
+	PermManageSaml = "idx.manageSaml"
+)
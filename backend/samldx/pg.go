@@ -0,0 +1,126 @@
+package samldx
+
+import (
+	"context"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+type PgSamlStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewSamlStorage(gd data.GetterDeleter) *PgSamlStorage {
+	return &PgSamlStorage{
+		gd: gd,
+	}
+}
+
+func (pss *PgSamlStorage) Save(
+	gtx context.Context, sp *core.SamlServiceProvider) error {
+	// Secret of an existing SP is retained so that the persistent NameIDs
+	// issued to it do not change
+	const query = `
+		INSERT INTO idx_saml_sp (
+			service_id,
+			entity_id,
+			acs_url,
+			name_id_format,
+			attributes,
+			name_id_secret
+		) VALUES (
+			:service_id,
+			:entity_id,
+			:acs_url,
+			:name_id_format,
+			:attributes,
+			:name_id_secret
+		) ON CONFLICT (service_id) DO UPDATE SET
+			entity_id = EXCLUDED.entity_id,
+			acs_url = EXCLUDED.acs_url,
+			name_id_format = EXCLUDED.name_id_format,
+			attributes = EXCLUDED.attributes,
+			name_id_secret = CASE
+				WHEN idx_saml_sp.name_id_secret = ''
+				THEN EXCLUDED.name_id_secret
+				ELSE idx_saml_sp.name_id_secret
+			END
+	`
+	sealed := *sp
+	if err := core.SealAll(gtx, &sealed.NameIdSecret); err != nil {
+		return errx.Errf(err, "failed to seal SAML NameID secret")
+	}
+	if _, err := pg.Conn().NamedExecContext(gtx, query, &sealed); err != nil {
+		return errx.Errf(err,
+			"failed to save SAML config of service '%d'", sp.ServiceId)
+	}
+	return nil
+}
+
+// InitNameIdSecret - sets the NameID secret of an SP that was configured
+// before the secrets were introduced, returns the SP with the secret in use
+func (pss *PgSamlStorage) InitNameIdSecret(
+	gtx context.Context,
+	serviceId int64,
+	secret string) (*core.SamlServiceProvider, error) {
+	const query = `
+		UPDATE idx_saml_sp SET name_id_secret = $2
+		WHERE service_id = $1 AND name_id_secret = ''
+	`
+	if err := core.SealAll(gtx, &secret); err != nil {
+		return nil, errx.Errf(err, "failed to seal SAML NameID secret")
+	}
+	_, err := pg.Conn().ExecContext(gtx, query, serviceId, secret)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to set SAML NameID secret of service '%d'", serviceId)
+	}
+	return pss.GetOne(gtx, serviceId)
+}
+
+func (pss *PgSamlStorage) GetOne(
+	gtx context.Context, serviceId int64) (*core.SamlServiceProvider, error) {
+	var sp core.SamlServiceProvider
+	err := pss.gd.GetOne(gtx, pss.table(gtx), "service_id", serviceId, &sp)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get SAML config of service '%d'", serviceId)
+	}
+	if err := core.OpenAll(gtx, &sp.NameIdSecret); err != nil {
+		return nil, errx.Errf(err, "failed to open SAML NameID secret")
+	}
+	return &sp, nil
+}
+
+func (pss *PgSamlStorage) ByEntityId(
+	gtx context.Context, entityId string) (*core.SamlServiceProvider, error) {
+	var sp core.SamlServiceProvider
+	err := pss.gd.GetOne(gtx, pss.table(gtx), "entity_id", entityId, &sp)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get SAML service provider '%s'", entityId)
+	}
+	if err := core.OpenAll(gtx, &sp.NameIdSecret); err != nil {
+		return nil, errx.Errf(err, "failed to open SAML NameID secret")
+	}
+	return &sp, nil
+}
+
+func (pss *PgSamlStorage) Remove(gtx context.Context, serviceId int64) error {
+	query := `DELETE FROM idx_saml_sp WHERE service_id = $1 AND ` +
+		core.TenantServiceCond(gtx, "service_id")
+	if _, err := pg.Conn().ExecContext(gtx, query, serviceId); err != nil {
+		return errx.Errf(err,
+			"failed to remove SAML config of service '%d'", serviceId)
+	}
+	return nil
+}
+
+// table - SPs of the services of the tenant in scope
+func (pss *PgSamlStorage) table(gtx context.Context) string {
+	return "(SELECT * FROM idx_saml_sp WHERE " +
+		core.TenantServiceCond(gtx, "service_id") + ") AS idx_saml_sp"
+}
@@ -0,0 +1,198 @@
+package samldx
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"github.com/varunamachi/libx/errx"
+)
+
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	nsDsig      = "http://www.w3.org/2000/09/xmldsig#"
+
+	algExcC14n    = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped  = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRsaSha256  = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algSha256     = "http://www.w3.org/2001/04/xmlenc#sha256"
+	bindingPost   = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	bindingRedir  = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	statusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+)
+
+type xmlAttr struct {
+	name  string
+	value string
+}
+
+// xmlNode - minimal XML element that serializes directly to exclusive
+// canonical form (no self closing tags, namespace declarations first, sorted
+// attributes, c14n escaping). This lets idx sign the documents it generates
+// without a full XML-DSig implementation. Only unprefixed attributes are
+// supported, namespace declarations have to be added where they are used
+type xmlNode struct {
+	name     string
+	nsDecls  []xmlAttr
+	attrs    []xmlAttr
+	children []*xmlNode
+	text     string
+	raw      string
+}
+
+func elem(name string) *xmlNode {
+	return &xmlNode{name: name}
+}
+
+func (n *xmlNode) ns(prefix, uri string) *xmlNode {
+	n.nsDecls = append(n.nsDecls, xmlAttr{name: "xmlns:" + prefix, value: uri})
+	return n
+}
+
+func (n *xmlNode) attr(name, value string) *xmlNode {
+	n.attrs = append(n.attrs, xmlAttr{name: name, value: value})
+	return n
+}
+
+func (n *xmlNode) add(children ...*xmlNode) *xmlNode {
+	n.children = append(n.children, children...)
+	return n
+}
+
+func (n *xmlNode) setText(text string) *xmlNode {
+	n.text = text
+	return n
+}
+
+// rawNode - already serialized canonical XML that is inserted as is
+func rawNode(xml string) *xmlNode {
+	return &xmlNode{raw: xml}
+}
+
+func (n *xmlNode) String() string {
+	var sb strings.Builder
+	n.write(&sb)
+	return sb.String()
+}
+
+func (n *xmlNode) write(sb *strings.Builder) {
+	if n.raw != "" {
+		sb.WriteString(n.raw)
+		return
+	}
+
+	nsDecls := append([]xmlAttr{}, n.nsDecls...)
+	sort.Slice(nsDecls, func(i, j int) bool {
+		return nsDecls[i].name < nsDecls[j].name
+	})
+	attrs := append([]xmlAttr{}, n.attrs...)
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].name < attrs[j].name
+	})
+
+	sb.WriteString("<")
+	sb.WriteString(n.name)
+	for _, a := range append(nsDecls, attrs...) {
+		sb.WriteString(" ")
+		sb.WriteString(a.name)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeAttr(a.value))
+		sb.WriteString(`"`)
+	}
+	sb.WriteString(">")
+	sb.WriteString(escapeText(n.text))
+	for _, c := range n.children {
+		c.write(sb)
+	}
+	sb.WriteString("</")
+	sb.WriteString(n.name)
+	sb.WriteString(">")
+}
+
+var textEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"\r", "&#xD;",
+)
+
+var attrEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	`"`, "&quot;",
+	"\t", "&#x9;",
+	"\n", "&#xA;",
+	"\r", "&#xD;",
+)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
+
+// signEnveloped - signs the given node with an enveloped signature that is
+// inserted as the child at given index. The node must have an ID attribute
+// and must declare every namespace it uses
+func signEnveloped(
+	n *xmlNode,
+	id string,
+	insertAt int,
+	key *rsa.PrivateKey,
+	certDer []byte) error {
+
+	// Digest is computed before the signature is inserted, which is what the
+	// enveloped signature transform gives the verifier
+	digest := sha256.Sum256([]byte(n.String()))
+
+	signedInfo := elem("ds:SignedInfo").add(
+		elem("ds:CanonicalizationMethod").attr("Algorithm", algExcC14n),
+		elem("ds:SignatureMethod").attr("Algorithm", algRsaSha256),
+		elem("ds:Reference").attr("URI", "#"+id).add(
+			elem("ds:Transforms").add(
+				elem("ds:Transform").attr("Algorithm", algEnveloped),
+				elem("ds:Transform").attr("Algorithm", algExcC14n),
+			),
+			elem("ds:DigestMethod").attr("Algorithm", algSha256),
+			elem("ds:DigestValue").setText(
+				base64.StdEncoding.EncodeToString(digest[:])),
+		),
+	)
+
+	// SignedInfo is canonicalized as the apex node, so the namespace
+	// declaration appears on it for signing but not in the final document
+	siForSigning := *signedInfo
+	siForSigning.nsDecls = []xmlAttr{{name: "xmlns:ds", value: nsDsig}}
+	siDigest := sha256.Sum256([]byte(siForSigning.String()))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, siDigest[:])
+	if err != nil {
+		return errx.Errf(err, "failed to sign SAML message '%s'", id)
+	}
+
+	signature := elem("ds:Signature").ns("ds", nsDsig).add(
+		signedInfo,
+		elem("ds:SignatureValue").setText(
+			base64.StdEncoding.EncodeToString(sig)),
+		elem("ds:KeyInfo").add(
+			elem("ds:X509Data").add(
+				elem("ds:X509Certificate").setText(
+					base64.StdEncoding.EncodeToString(certDer)),
+			),
+		),
+	)
+
+	children := make([]*xmlNode, 0, len(n.children)+1)
+	children = append(children, n.children[:insertAt]...)
+	children = append(children, signature)
+	children = append(children, n.children[insertAt:]...)
+	n.children = children
+	return nil
+}
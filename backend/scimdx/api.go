@@ -0,0 +1,512 @@
+package scimdx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+const mimeScim = "application/scim+json"
+
+// ScimPages - SCIM 2.0 endpoints, these live under /scim/v2 as expected by
+// SCIM clients rather than under the /api prefix. Responses and errors use
+// the SCIM message formats
+func ScimPages(gtx context.Context) []*httpx.Endpoint {
+	sc := core.ScimCtlr(gtx)
+	return []*httpx.Endpoint{
+		serviceProviderConfigEp(),
+		queryUsersEp(sc),
+		getUserEp(sc),
+		createUserEp(sc),
+		replaceUserEp(sc),
+		patchUserEp(sc),
+		deleteUserEp(sc),
+		queryGroupsEp(sc),
+		getGroupEp(sc),
+		createGroupEp(sc),
+		replaceGroupEp(sc),
+		patchGroupEp(sc),
+		deleteGroupEp(sc),
+	}
+}
+
+func serviceProviderConfigEp() *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		supported := map[string]any{"supported": true}
+		return sendScim(etx, http.StatusOK, map[string]any{
+			"schemas": []string{
+				"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig",
+			},
+			"patch": supported,
+			"etag":  supported,
+			"bulk":  map[string]any{"supported": false},
+			"sort":  supported,
+			"filter": map[string]any{
+				"supported":  true,
+				"maxResults": maxPageSize,
+			},
+			"changePassword": supported,
+			"authenticationSchemes": []map[string]any{{
+				"type":        "oauthbearertoken",
+				"name":        "Bearer Token",
+				"description": "idx access token",
+			}},
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/scim/v2/ServiceProviderConfig",
+		Category:    "idx.scim",
+		Desc:        "SCIM service provider configuration",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func queryUsersEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		query, err := readQuery(etx)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		res, err := sc.QueryUsers(etx.Request().Context(), query)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return sendScim(etx, http.StatusOK, res)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/scim/v2/Users",
+		Category:    "idx.scim",
+		Desc:        "Query users",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func getUserEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		id, err := resourceId(etx)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		user, err := sc.GetUser(etx.Request().Context(), id)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return sendResource(etx, http.StatusOK, user, user.Meta)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/scim/v2/Users/:id",
+		Category:    "idx.scim",
+		Desc:        "Get a user",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func createUserEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var in core.ScimUser
+		if err := readBody(etx, &in); err != nil {
+			return sendScimError(etx, err)
+		}
+		user, err := sc.CreateUser(etx.Request().Context(), &in)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return sendResource(etx, http.StatusCreated, user, user.Meta)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/scim/v2/Users",
+		Category:    "idx.scim",
+		Desc:        "Provision a user",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func replaceUserEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		id, err := resourceId(etx)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		var in core.ScimUser
+		if err := readBody(etx, &in); err != nil {
+			return sendScimError(etx, err)
+		}
+		user, err := sc.ReplaceUser(
+			etx.Request().Context(), id, &in, ifMatch(etx))
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return sendResource(etx, http.StatusOK, user, user.Meta)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/scim/v2/Users/:id",
+		Category:    "idx.scim",
+		Desc:        "Replace a user",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func patchUserEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		id, err := resourceId(etx)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		var patch core.ScimPatch
+		if err := readBody(etx, &patch); err != nil {
+			return sendScimError(etx, err)
+		}
+		user, err := sc.PatchUser(
+			etx.Request().Context(), id, &patch, ifMatch(etx))
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return sendResource(etx, http.StatusOK, user, user.Meta)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PATCH,
+		Path:        "/scim/v2/Users/:id",
+		Category:    "idx.scim",
+		Desc:        "Modify a user",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func deleteUserEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		id, err := resourceId(etx)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		err = sc.DeleteUser(etx.Request().Context(), id, ifMatch(etx))
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return etx.NoContent(http.StatusNoContent)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/scim/v2/Users/:id",
+		Category:    "idx.scim",
+		Desc:        "Delete a user",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func queryGroupsEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		query, err := readQuery(etx)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		res, err := sc.QueryGroups(etx.Request().Context(), query)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return sendScim(etx, http.StatusOK, res)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/scim/v2/Groups",
+		Category:    "idx.scim",
+		Desc:        "Query groups",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func getGroupEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		id, err := resourceId(etx)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		group, err := sc.GetGroup(etx.Request().Context(), id)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return sendResource(etx, http.StatusOK, group, group.Meta)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/scim/v2/Groups/:id",
+		Category:    "idx.scim",
+		Desc:        "Get a group",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func createGroupEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var in core.ScimGroup
+		if err := readBody(etx, &in); err != nil {
+			return sendScimError(etx, err)
+		}
+		group, err := sc.CreateGroup(etx.Request().Context(), &in)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return sendResource(etx, http.StatusCreated, group, group.Meta)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/scim/v2/Groups",
+		Category:    "idx.scim",
+		Desc:        "Provision a group",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func replaceGroupEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		id, err := resourceId(etx)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		var in core.ScimGroup
+		if err := readBody(etx, &in); err != nil {
+			return sendScimError(etx, err)
+		}
+		group, err := sc.ReplaceGroup(
+			etx.Request().Context(), id, &in, ifMatch(etx))
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return sendResource(etx, http.StatusOK, group, group.Meta)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/scim/v2/Groups/:id",
+		Category:    "idx.scim",
+		Desc:        "Replace a group",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func patchGroupEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		id, err := resourceId(etx)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		var patch core.ScimPatch
+		if err := readBody(etx, &patch); err != nil {
+			return sendScimError(etx, err)
+		}
+		group, err := sc.PatchGroup(
+			etx.Request().Context(), id, &patch, ifMatch(etx))
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return sendResource(etx, http.StatusOK, group, group.Meta)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PATCH,
+		Path:        "/scim/v2/Groups/:id",
+		Category:    "idx.scim",
+		Desc:        "Modify a group",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func deleteGroupEp(sc core.ScimController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		id, err := resourceId(etx)
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		err = sc.DeleteGroup(etx.Request().Context(), id, ifMatch(etx))
+		if err != nil {
+			return sendScimError(etx, err)
+		}
+		return etx.NoContent(http.StatusNoContent)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/scim/v2/Groups/:id",
+		Category:    "idx.scim",
+		Desc:        "Delete a group",
+		Version:     "v2",
+		Permissions: []string{PermScimProvision},
+		Handler:     handler,
+	}
+}
+
+func readQuery(etx echo.Context) (*core.ScimQuery, error) {
+	query := &core.ScimQuery{
+		Filter:     etx.QueryParam("filter"),
+		SortBy:     etx.QueryParam("sortBy"),
+		SortOrder:  etx.QueryParam("sortOrder"),
+		StartIndex: 1,
+		Count:      defaultPageSize,
+	}
+
+	var err error
+	if si := etx.QueryParam("startIndex"); si != "" {
+		if query.StartIndex, err = strconv.ParseInt(si, 10, 64); err != nil {
+			return nil, scimError(http.StatusBadRequest, "invalidValue",
+				"invalid startIndex '"+si+"'")
+		}
+	}
+	if cnt := etx.QueryParam("count"); cnt != "" {
+		if query.Count, err = strconv.ParseInt(cnt, 10, 64); err != nil {
+			return nil, scimError(http.StatusBadRequest, "invalidValue",
+				"invalid count '"+cnt+"'")
+		}
+	}
+	return query, nil
+}
+
+func readBody(etx echo.Context, out any) error {
+	if err := json.NewDecoder(etx.Request().Body).Decode(out); err != nil {
+		return scimError(http.StatusBadRequest, "invalidSyntax",
+			"failed to parse request body: "+errDetail(err))
+	}
+	return nil
+}
+
+func resourceId(etx echo.Context) (int64, error) {
+	id, err := strconv.ParseInt(etx.Param("id"), 10, 64)
+	if err != nil {
+		return 0, scimError(http.StatusNotFound, "",
+			"resource '"+etx.Param("id")+"' not found")
+	}
+	return id, nil
+}
+
+func ifMatch(etx echo.Context) string {
+	return etx.Request().Header.Get("If-Match")
+}
+
+func sendResource(
+	etx echo.Context, status int, res any, meta *core.ScimMeta) error {
+	etx.Response().Header().Set("ETag", meta.Version)
+	if status == http.StatusCreated {
+		etx.Response().Header().Set(echo.HeaderLocation, meta.Location)
+	}
+	if status == http.StatusOK &&
+		etx.Request().Method == echo.GET &&
+		etx.Request().Header.Get("If-None-Match") == meta.Version {
+		return etx.NoContent(http.StatusNotModified)
+	}
+	return sendScim(etx, status, res)
+}
+
+func sendScim(etx echo.Context, status int, res any) error {
+	raw, err := json.Marshal(res)
+	if err != nil {
+		return sendScimError(etx, err)
+	}
+	return etx.Blob(status, mimeScim, raw)
+}
+
+// httpError - error that is reported to the SCIM client as is
+type httpError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+func (he *httpError) Error() string {
+	return he.Detail
+}
+
+func scimError(status int, scimType, detail string) *httpError {
+	return &httpError{
+		Schemas:  []string{core.ScimErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+func sendScimError(etx echo.Context, err error) error {
+	var he *httpError
+	switch {
+	case errors.As(err, &he):
+	case errors.Is(err, sql.ErrNoRows):
+		he = scimError(http.StatusNotFound, "", "resource not found")
+	case errors.Is(err, ErrInvalidFilter):
+		he = scimError(http.StatusBadRequest, "invalidFilter", errDetail(err))
+	case errors.Is(err, ErrInvalidPath):
+		he = scimError(http.StatusBadRequest, "invalidPath", errDetail(err))
+	case errors.Is(err, ErrNoTarget):
+		he = scimError(http.StatusBadRequest, "noTarget", errDetail(err))
+	case errors.Is(err, ErrInvalidValue):
+		he = scimError(http.StatusBadRequest, "invalidValue", errDetail(err))
+	case errors.Is(err, ErrVersionMismatch):
+		he = scimError(http.StatusPreconditionFailed, "", errDetail(err))
+	case errors.Is(err, core.ErrEntityExists):
+		he = scimError(http.StatusConflict, "uniqueness", errDetail(err))
+	case errors.Is(err, core.ErrUnauthorized):
+		he = scimError(http.StatusForbidden, "", errDetail(err))
+	default:
+		log.Error().Err(err).Str("path", etx.Request().URL.Path).
+			Msg("SCIM request failed")
+		he = scimError(http.StatusInternalServerError, "",
+			"internal server error")
+	}
+
+	status, _ := strconv.Atoi(he.Status)
+	raw, _ := json.Marshal(he)
+	return etx.Blob(status, mimeScim, raw)
+}
+
+func errDetail(err error) string {
+	var ex *errx.Error
+	if errors.As(err, &ex) && ex.Msg != "" {
+		return ex.Msg
+	}
+	return err.Error()
+}
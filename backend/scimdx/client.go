@@ -0,0 +1,116 @@
+package scimdx
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+type Client struct {
+	*httpx.Client
+	Timeout time.Duration
+}
+
+func (c *Client) build() *httpx.RequestBuilder {
+	builder := c.Build()
+	if c.Timeout != 0 {
+		builder = builder.WithTimeout(c.Timeout)
+	}
+	return builder
+}
+
+func (c *Client) ScimCreateUser(
+	gtx context.Context, user *core.ScimUser) (*core.ScimUser, error) {
+	apiRes := c.build().Path("/scim/v2/Users").Post(gtx, user)
+	var out core.ScimUser
+	if err := apiRes.LoadClose(&out); err != nil {
+		return nil, errx.Errf(err,
+			"failed to provision user '%s' over SCIM", user.UserName)
+	}
+	return &out, nil
+}
+
+func (c *Client) ScimGetUser(
+	gtx context.Context, id string) (*core.ScimUser, error) {
+	apiRes := c.build().Path("/scim/v2/Users", id).Get(gtx)
+	var out core.ScimUser
+	if err := apiRes.LoadClose(&out); err != nil {
+		return nil, errx.Errf(err, "failed to get SCIM user '%s'", id)
+	}
+	return &out, nil
+}
+
+func (c *Client) ScimQueryUsers(
+	gtx context.Context, filter string) ([]*core.ScimUser, error) {
+	apiRes := c.build().
+		Path("/scim/v2/Users").
+		QStr("filter", filter).
+		Get(gtx)
+	users := make([]*core.ScimUser, 0, 10)
+	if err := loadList(apiRes, &users); err != nil {
+		return nil, errx.Errf(err,
+			"failed to query SCIM users with filter '%s'", filter)
+	}
+	return users, nil
+}
+
+func (c *Client) ScimPatchUser(
+	gtx context.Context,
+	id, version string,
+	ops ...*core.ScimPatchOp) (*core.ScimUser, error) {
+	apiRes := c.build().
+		Path("/scim/v2/Users", id).
+		HdrStr("If-Match", version).
+		Patch(gtx, &core.ScimPatch{
+			Schemas:    []string{core.ScimPatchSchema},
+			Operations: ops,
+		})
+	var out core.ScimUser
+	if err := apiRes.LoadClose(&out); err != nil {
+		return nil, errx.Errf(err, "failed to patch SCIM user '%s'", id)
+	}
+	return &out, nil
+}
+
+func (c *Client) ScimCreateGroup(
+	gtx context.Context, group *core.ScimGroup) (*core.ScimGroup, error) {
+	apiRes := c.build().Path("/scim/v2/Groups").Post(gtx, group)
+	var out core.ScimGroup
+	if err := apiRes.LoadClose(&out); err != nil {
+		return nil, errx.Errf(err,
+			"failed to provision group '%s' over SCIM", group.DisplayName)
+	}
+	return &out, nil
+}
+
+func (c *Client) ScimPatchGroup(
+	gtx context.Context,
+	id, version string,
+	ops ...*core.ScimPatchOp) (*core.ScimGroup, error) {
+	apiRes := c.build().
+		Path("/scim/v2/Groups", id).
+		HdrStr("If-Match", version).
+		Patch(gtx, &core.ScimPatch{
+			Schemas:    []string{core.ScimPatchSchema},
+			Operations: ops,
+		})
+	var out core.ScimGroup
+	if err := apiRes.LoadClose(&out); err != nil {
+		return nil, errx.Errf(err, "failed to patch SCIM group '%s'", id)
+	}
+	return &out, nil
+}
+
+func loadList(apiRes *httpx.ApiResult, out any) error {
+	var list struct {
+		Resources json.RawMessage `json:"Resources"`
+	}
+	if err := apiRes.LoadClose(&list); err != nil {
+		return err
+	}
+	return json.Unmarshal(list.Resources, out)
+}
@@ -0,0 +1,11 @@
+package scimdx
+
+import "errors"
+
+var (
+	ErrInvalidFilter   = errors.New("invalid SCIM filter")
+	ErrInvalidPath     = errors.New("invalid SCIM path")
+	ErrInvalidValue    = errors.New("invalid SCIM value")
+	ErrNoTarget        = errors.New("SCIM path did not match any value")
+	ErrVersionMismatch = errors.New("SCIM resource version mismatch")
+)
@@ -0,0 +1,579 @@
+package scimdx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+)
+
+// Filters as defined in RFC 7644 section 3.4.2.2. They are used for querying
+// resources, where they are translated to SQL, and in PATCH paths, where
+// they are evaluated against the elements of multi valued attributes
+
+type filterNode interface{}
+
+type logicalExpr struct {
+	op    string
+	left  filterNode
+	right filterNode
+}
+
+type notExpr struct {
+	inner filterNode
+}
+
+type attrExpr struct {
+	path  string
+	op    string
+	value any
+}
+
+type valuePathExpr struct {
+	attr   string
+	filter filterNode
+}
+
+var compareOps = map[string]bool{
+	"eq": true,
+	"ne": true,
+	"co": true,
+	"sw": true,
+	"ew": true,
+	"gt": true,
+	"ge": true,
+	"lt": true,
+	"le": true,
+	"pr": true,
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(in string) ([]token, error) {
+	tokens := make([]token, 0, 16)
+	for i := 0; i < len(in); {
+		c := in[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(in) && in[j] != '"'; j++ {
+				if in[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(in) {
+				return nil, errx.Errf(ErrInvalidFilter,
+					"unterminated string in filter '%s'", in)
+			}
+			var str string
+			if err := json.Unmarshal([]byte(in[i:j+1]), &str); err != nil {
+				return nil, errx.Errf(ErrInvalidFilter,
+					"invalid string literal %s in filter", in[i:j+1])
+			}
+			tokens = append(tokens, token{text: str, quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(in) && !strings.ContainsRune(" \t\r\n()[]\"", rune(in[j])); j++ {
+			}
+			tokens = append(tokens, token{text: in[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func parseFilter(in string) (filterNode, error) {
+	tokens, err := tokenize(in)
+	if err != nil {
+		return nil, err
+	}
+	fp := &filterParser{tokens: tokens}
+	node, err := fp.or()
+	if err != nil {
+		return nil, err
+	}
+	if fp.pos != len(fp.tokens) {
+		return nil, errx.Errf(ErrInvalidFilter,
+			"unexpected '%s' in filter '%s'", fp.tokens[fp.pos].text, in)
+	}
+	return node, nil
+}
+
+func (fp *filterParser) peek() (token, bool) {
+	if fp.pos >= len(fp.tokens) {
+		return token{}, false
+	}
+	return fp.tokens[fp.pos], true
+}
+
+func (fp *filterParser) next() (token, error) {
+	tok, ok := fp.peek()
+	if !ok {
+		return tok, errx.Errf(ErrInvalidFilter, "unexpected end of filter")
+	}
+	fp.pos++
+	return tok, nil
+}
+
+func (fp *filterParser) isKeyword(kw string) bool {
+	tok, ok := fp.peek()
+	return ok && !tok.quoted && strings.EqualFold(tok.text, kw)
+}
+
+func (fp *filterParser) expect(text string) error {
+	tok, err := fp.next()
+	if err != nil {
+		return err
+	}
+	if tok.quoted || tok.text != text {
+		return errx.Errf(ErrInvalidFilter,
+			"expected '%s' in filter, found '%s'", text, tok.text)
+	}
+	return nil
+}
+
+func (fp *filterParser) or() (filterNode, error) {
+	left, err := fp.and()
+	if err != nil {
+		return nil, err
+	}
+	for fp.isKeyword("or") {
+		fp.pos++
+		right, err := fp.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (fp *filterParser) and() (filterNode, error) {
+	left, err := fp.factor()
+	if err != nil {
+		return nil, err
+	}
+	for fp.isKeyword("and") {
+		fp.pos++
+		right, err := fp.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (fp *filterParser) factor() (filterNode, error) {
+	if fp.isKeyword("not") {
+		fp.pos++
+		if err := fp.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := fp.or()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{inner: inner}, fp.expect(")")
+	}
+
+	tok, err := fp.next()
+	if err != nil {
+		return nil, err
+	}
+	if !tok.quoted && tok.text == "(" {
+		inner, err := fp.or()
+		if err != nil {
+			return nil, err
+		}
+		return inner, fp.expect(")")
+	}
+	if tok.quoted || strings.ContainsAny(tok.text, "()[]") {
+		return nil, errx.Errf(ErrInvalidFilter,
+			"expected attribute in filter, found '%s'", tok.text)
+	}
+
+	path := tok.text
+	if nt, ok := fp.peek(); ok && !nt.quoted && nt.text == "[" {
+		fp.pos++
+		inner, err := fp.or()
+		if err != nil {
+			return nil, err
+		}
+		if err := fp.expect("]"); err != nil {
+			return nil, err
+		}
+		return &valuePathExpr{attr: path, filter: inner}, nil
+	}
+
+	opTok, err := fp.next()
+	if err != nil {
+		return nil, err
+	}
+	op := strings.ToLower(opTok.text)
+	if opTok.quoted || !compareOps[op] {
+		return nil, errx.Errf(ErrInvalidFilter,
+			"invalid operator '%s' in filter", opTok.text)
+	}
+	if op == "pr" {
+		return &attrExpr{path: path, op: op}, nil
+	}
+
+	valTok, err := fp.next()
+	if err != nil {
+		return nil, err
+	}
+	expr := &attrExpr{path: path, op: op, value: valTok.text}
+	if !valTok.quoted {
+		switch strings.ToLower(valTok.text) {
+		case "true":
+			expr.value = true
+		case "false":
+			expr.value = false
+		case "null":
+			expr.value = nil
+		default:
+			num, err := strconv.ParseFloat(valTok.text, 64)
+			if err != nil {
+				return nil, errx.Errf(ErrInvalidFilter,
+					"invalid value '%s' in filter", valTok.text)
+			}
+			expr.value = num
+		}
+	}
+	return expr, nil
+}
+
+// parsePath - parses a PATCH path of form attr, attr.sub, attr[filter] or
+// attr[filter].sub
+func parsePath(path string) (attr string, filter filterNode, sub string, err error) {
+	path = normalizePath(path)
+	open := strings.IndexByte(path, '[')
+	if open == -1 {
+		attr, sub, _ = strings.Cut(path, ".")
+		return attr, nil, sub, nil
+	}
+
+	closing := strings.LastIndexByte(path, ']')
+	if closing < open {
+		return "", nil, "", errx.Errf(ErrInvalidPath,
+			"invalid path '%s'", path)
+	}
+	attr = path[:open]
+	if filter, err = parseFilter(path[open+1 : closing]); err != nil {
+		return "", nil, "", errx.Errf(ErrInvalidPath,
+			"invalid filter in path '%s': %v", path, err)
+	}
+	rest := path[closing+1:]
+	if rest != "" {
+		if !strings.HasPrefix(rest, ".") {
+			return "", nil, "", errx.Errf(ErrInvalidPath,
+				"invalid path '%s'", path)
+		}
+		sub = rest[1:]
+	}
+	return attr, filter, sub, nil
+}
+
+// normalizePath - removes the schema URN prefix from fully qualified
+// attribute paths of the core schemas
+func normalizePath(path string) string {
+	for _, schema := range []string{core.ScimUserSchema, core.ScimGroupSchema} {
+		if len(path) > len(schema) &&
+			strings.EqualFold(path[:len(schema)+1], schema+":") {
+			return path[len(schema)+1:]
+		}
+	}
+	return path
+}
+
+type columnKind int
+
+const (
+	colString columnKind = iota
+	colCaseExact
+	colInt
+	colDate
+	colActive
+	colMembership
+)
+
+// column - SQL expression that a SCIM attribute maps to. For membership
+// columns the expression is a condition with a single placeholder
+type column struct {
+	expr string
+	kind columnKind
+}
+
+type notSql struct {
+	inner squirrel.Sqlizer
+}
+
+func (ns notSql) ToSql() (string, []any, error) {
+	sql, args, err := ns.inner.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+	return "NOT (" + sql + ")", args, nil
+}
+
+func toSql(
+	node filterNode,
+	columns map[string]column,
+	prefix string) (squirrel.Sqlizer, error) {
+	switch n := node.(type) {
+	case *logicalExpr:
+		left, err := toSql(n.left, columns, prefix)
+		if err != nil {
+			return nil, err
+		}
+		right, err := toSql(n.right, columns, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "and" {
+			return squirrel.And{left, right}, nil
+		}
+		return squirrel.Or{left, right}, nil
+	case *notExpr:
+		inner, err := toSql(n.inner, columns, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return notSql{inner: inner}, nil
+	case *valuePathExpr:
+		return toSql(n.filter, columns, normalizePath(n.attr)+".")
+	case *attrExpr:
+		return attrToSql(n, columns, prefix)
+	}
+	return nil, errx.Errf(ErrInvalidFilter, "invalid filter")
+}
+
+func attrToSql(
+	ae *attrExpr,
+	columns map[string]column,
+	prefix string) (squirrel.Sqlizer, error) {
+	path := strings.ToLower(prefix + normalizePath(ae.path))
+	col, found := columns[path]
+	if !found {
+		return nil, errx.Errf(ErrInvalidFilter,
+			"filtering on attribute '%s' is not supported", ae.path)
+	}
+
+	if ae.op == "pr" {
+		switch col.kind {
+		case colString, colCaseExact:
+			return squirrel.Expr(fmt.Sprintf(
+				"(%s IS NOT NULL AND %s <> '')", col.expr, col.expr)), nil
+		case colMembership:
+			return nil, errx.Errf(ErrInvalidFilter,
+				"operator 'pr' is not supported for '%s'", ae.path)
+		}
+		return squirrel.Expr(col.expr + " IS NOT NULL"), nil
+	}
+
+	switch col.kind {
+	case colString, colCaseExact:
+		str, ok := ae.value.(string)
+		if !ok {
+			return nil, errx.Errf(ErrInvalidFilter,
+				"expected string value for '%s'", ae.path)
+		}
+		expr := col.expr
+		if col.kind == colString {
+			expr = "lower(" + col.expr + ")"
+			str = strings.ToLower(str)
+		}
+		like := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(str)
+		switch ae.op {
+		case "co":
+			return squirrel.Expr(expr+" LIKE ?", "%"+like+"%"), nil
+		case "sw":
+			return squirrel.Expr(expr+" LIKE ?", like+"%"), nil
+		case "ew":
+			return squirrel.Expr(expr+" LIKE ?", "%"+like), nil
+		}
+		return compareSql(expr, ae.op, str)
+
+	case colInt:
+		var num int64
+		switch v := ae.value.(type) {
+		case string:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, errx.Errf(ErrInvalidFilter,
+					"expected integer value for '%s'", ae.path)
+			}
+			num = n
+		case float64:
+			num = int64(v)
+		default:
+			return nil, errx.Errf(ErrInvalidFilter,
+				"expected integer value for '%s'", ae.path)
+		}
+		return compareSql(col.expr, ae.op, num)
+
+	case colDate:
+		str, _ := ae.value.(string)
+		tm, err := time.Parse(time.RFC3339, str)
+		if err != nil {
+			return nil, errx.Errf(ErrInvalidFilter,
+				"expected RFC3339 date value for '%s'", ae.path)
+		}
+		return compareSql(col.expr, ae.op, tm)
+
+	case colActive:
+		active, ok := ae.value.(bool)
+		if !ok || (ae.op != "eq" && ae.op != "ne") {
+			return nil, errx.Errf(ErrInvalidFilter,
+				"only boolean 'eq' and 'ne' are supported for '%s'", ae.path)
+		}
+		if active == (ae.op == "eq") {
+			return squirrel.Expr(col.expr+" = ?", core.Active), nil
+		}
+		return squirrel.Expr(col.expr+" <> ?", core.Active), nil
+
+	case colMembership:
+		str, _ := ae.value.(string)
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil || ae.op != "eq" {
+			return nil, errx.Errf(ErrInvalidFilter,
+				"only 'eq' with an id is supported for '%s'", ae.path)
+		}
+		return squirrel.Expr(col.expr, id), nil
+	}
+	return nil, errx.Errf(ErrInvalidFilter, "invalid filter on '%s'", ae.path)
+}
+
+func compareSql(expr, op string, value any) (squirrel.Sqlizer, error) {
+	sqlOps := map[string]string{
+		"eq": "=",
+		"ne": "<>",
+		"gt": ">",
+		"ge": ">=",
+		"lt": "<",
+		"le": "<=",
+	}
+	sqlOp, found := sqlOps[op]
+	if !found {
+		return nil, errx.Errf(ErrInvalidFilter,
+			"operator '%s' is not supported for '%s'", op, expr)
+	}
+	return squirrel.Expr(expr+" "+sqlOp+" ?", value), nil
+}
+
+// matches - evaluates the filter against an element of a multi valued
+// attribute. Attribute names are matched case insensitively
+func matches(node filterNode, obj map[string]any) bool {
+	switch n := node.(type) {
+	case *logicalExpr:
+		if n.op == "and" {
+			return matches(n.left, obj) && matches(n.right, obj)
+		}
+		return matches(n.left, obj) || matches(n.right, obj)
+	case *notExpr:
+		return !matches(n.inner, obj)
+	case *valuePathExpr:
+		return false
+	case *attrExpr:
+		val, found := lookup(obj, n.path)
+		if n.op == "pr" {
+			return found && val != nil && val != ""
+		}
+		if !found {
+			return n.op == "ne"
+		}
+		return compareValues(val, n.op, n.value)
+	}
+	return false
+}
+
+func compareValues(actual any, op string, expected any) bool {
+	switch exp := expected.(type) {
+	case string:
+		act := strings.ToLower(fmt.Sprint(actual))
+		exp = strings.ToLower(exp)
+		switch op {
+		case "eq":
+			return act == exp
+		case "ne":
+			return act != exp
+		case "co":
+			return strings.Contains(act, exp)
+		case "sw":
+			return strings.HasPrefix(act, exp)
+		case "ew":
+			return strings.HasSuffix(act, exp)
+		case "gt":
+			return act > exp
+		case "ge":
+			return act >= exp
+		case "lt":
+			return act < exp
+		case "le":
+			return act <= exp
+		}
+	case bool:
+		act, ok := actual.(bool)
+		return ok && (op == "eq") == (act == exp)
+	case float64:
+		act, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return act == exp
+		case "ne":
+			return act != exp
+		case "gt":
+			return act > exp
+		case "ge":
+			return act >= exp
+		case "lt":
+			return act < exp
+		case "le":
+			return act <= exp
+		}
+	case nil:
+		return (op == "eq") == (actual == nil)
+	}
+	return false
+}
+
+func lookup(obj map[string]any, path string) (any, bool) {
+	first, rest, nested := strings.Cut(path, ".")
+	for key, val := range obj {
+		if !strings.EqualFold(key, first) {
+			continue
+		}
+		if !nested {
+			return val, true
+		}
+		sub, ok := val.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		return lookup(sub, rest)
+	}
+	return nil, false
+}
@@ -0,0 +1,295 @@
+package scimdx
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+)
+
+var testColumns = map[string]column{
+	"username":     {expr: "u.user_name", kind: colString},
+	"externalid":   {expr: "u.external_id", kind: colCaseExact},
+	"id":           {expr: "u.id", kind: colInt},
+	"meta.created": {expr: "u.created_on", kind: colDate},
+	"active":       {expr: "u.state", kind: colActive},
+	"groups.value": {
+		expr: "u.id IN (SELECT user_id FROM user_to_group WHERE group_id = ?)",
+		kind: colMembership,
+	},
+}
+
+func TestFilterToSql(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		filter string
+		sql    string
+		args   []any
+		err    error
+	}{
+		{
+			name:   "string equality is case insensitive",
+			filter: `userName eq "Bob"`,
+			sql:    "lower(u.user_name) = ?",
+			args:   []any{"bob"},
+		},
+		{
+			name:   "case exact string",
+			filter: `externalId eq "AbC"`,
+			sql:    "u.external_id = ?",
+			args:   []any{"AbC"},
+		},
+		{
+			name:   "schema qualified attribute",
+			filter: core.ScimUserSchema + `:userName sw "j"`,
+			sql:    "lower(u.user_name) LIKE ?",
+			args:   []any{"j%"},
+		},
+		{
+			name:   "like wildcards are escaped",
+			filter: `userName co "50%_x"`,
+			sql:    "lower(u.user_name) LIKE ?",
+			args:   []any{`%50\%\_x%`},
+		},
+		{
+			name:   "and binds tighter than or",
+			filter: `userName eq "a" or userName eq "b" and active eq true`,
+			sql: "(lower(u.user_name) = ? OR " +
+				"(lower(u.user_name) = ? AND u.state = ?))",
+			args: []any{"a", "b", core.Active},
+		},
+		{
+			name:   "parentheses override precedence",
+			filter: `(userName eq "a" or userName eq "b") and active eq false`,
+			sql: "((lower(u.user_name) = ? OR lower(u.user_name) = ?) " +
+				"AND u.state <> ?)",
+			args: []any{"a", "b", core.Active},
+		},
+		{
+			name:   "keywords are case insensitive",
+			filter: `userName EQ "a" AND NOT (id GT 10)`,
+			sql:    "(lower(u.user_name) = ? AND NOT (u.id > ?))",
+			args:   []any{"a", int64(10)},
+		},
+		{
+			name:   "present on string",
+			filter: `userName pr`,
+			sql:    "(u.user_name IS NOT NULL AND u.user_name <> '')",
+		},
+		{
+			name:   "integer from string",
+			filter: `id le "42"`,
+			sql:    "u.id <= ?",
+			args:   []any{int64(42)},
+		},
+		{
+			name:   "date",
+			filter: `meta.created ge "2026-01-02T03:04:05Z"`,
+			sql:    "u.created_on >= ?",
+			args:   []any{created},
+		},
+		{
+			name:   "membership through value path",
+			filter: `groups[value eq "12"]`,
+			sql: "u.id IN " +
+				"(SELECT user_id FROM user_to_group WHERE group_id = ?)",
+			args: []any{int64(12)},
+		},
+		{
+			name:   "unsupported attribute",
+			filter: `nickName eq "x"`,
+			err:    ErrInvalidFilter,
+		},
+		{
+			name:   "string operator on integer",
+			filter: `id eq "abc"`,
+			err:    ErrInvalidFilter,
+		},
+		{
+			name:   "invalid date",
+			filter: `meta.created gt "yesterday"`,
+			err:    ErrInvalidFilter,
+		},
+		{
+			name:   "ordering on active",
+			filter: `active gt true`,
+			err:    ErrInvalidFilter,
+		},
+		{
+			name:   "present on membership",
+			filter: `groups.value pr`,
+			err:    ErrInvalidFilter,
+		},
+		{
+			name:   "containment on integer",
+			filter: `id co 1`,
+			err:    ErrInvalidFilter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := parseFilter(test.filter)
+			if err != nil {
+				t.Fatalf("failed to parse '%s': %v", test.filter, err)
+			}
+			sqlizer, err := toSql(node, testColumns, "")
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected error '%v', got '%v'", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			sql, args, err := sqlizer.ToSql()
+			if err != nil {
+				t.Fatalf("failed to build SQL: %v", err)
+			}
+			if sql != test.sql {
+				t.Errorf("expected SQL '%s', got '%s'", test.sql, sql)
+			}
+			if len(args) != 0 || len(test.args) != 0 {
+				if !reflect.DeepEqual(args, test.args) {
+					t.Errorf("expected args %v, got %v", test.args, args)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+	}{
+		{"empty", ``},
+		{"unterminated string", `userName eq "abc`},
+		{"unknown operator", `userName like "abc"`},
+		{"missing value", `userName eq`},
+		{"bare word value", `userName eq abc`},
+		{"unbalanced parenthesis", `(userName eq "a"`},
+		{"trailing token", `userName eq "a" )`},
+		{"quoted attribute", `"userName" eq "a"`},
+		{"not without parenthesis", `not userName eq "a"`},
+		{"unclosed value path", `emails[type eq "work"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseFilter(test.filter)
+			if !errors.Is(err, ErrInvalidFilter) {
+				t.Fatalf("expected invalid filter error for '%s', got '%v'",
+					test.filter, err)
+			}
+		})
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	email := map[string]any{
+		"type":    "work",
+		"value":   "Bob@Example.com",
+		"primary": true,
+		"order":   float64(2),
+		"meta":    map[string]any{"source": "ldap"},
+	}
+	tests := []struct {
+		filter string
+		match  bool
+	}{
+		{`type eq "WORK"`, true},
+		{`Type eq "work"`, true},
+		{`type eq "home"`, false},
+		{`type ne "home"`, true},
+		{`value ew "example.com"`, true},
+		{`value sw "alice"`, false},
+		{`value co "@"`, true},
+		{`primary eq true`, true},
+		{`primary eq false`, false},
+		{`primary ne false`, true},
+		{`order gt 1`, true},
+		{`order le 1`, false},
+		{`display pr`, false},
+		{`display ne "x"`, true},
+		{`display eq "x"`, false},
+		{`meta.source eq "ldap"`, true},
+		{`type eq "work" and primary eq false`, false},
+		{`type eq "home" or primary eq true`, true},
+		{`not (type eq "work")`, false},
+		{`value eq "a \"quoted\" value"`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			node, err := parseFilter(test.filter)
+			if err != nil {
+				t.Fatalf("failed to parse '%s': %v", test.filter, err)
+			}
+			if got := matches(node, email); got != test.match {
+				t.Errorf("expected %v, got %v", test.match, got)
+			}
+		})
+	}
+}
+
+func TestTokenizeEscapes(t *testing.T) {
+	tokens, err := tokenize(`displayName eq "a \"b\" \\ c"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []token{
+		{text: "displayName"},
+		{text: "eq"},
+		{text: `a "b" \ c`, quoted: true},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("expected %v, got %v", expected, tokens)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path      string
+		attr      string
+		hasFilter bool
+		sub       string
+		err       error
+	}{
+		{path: "userName", attr: "userName"},
+		{path: "name.givenName", attr: "name", sub: "givenName"},
+		{path: core.ScimUserSchema + ":name.familyName",
+			attr: "name", sub: "familyName"},
+		{path: `emails[type eq "work"]`, attr: "emails", hasFilter: true},
+		{path: `emails[type eq "work"].value`,
+			attr: "emails", hasFilter: true, sub: "value"},
+		{path: `emails[type eq "work"]value`, err: ErrInvalidPath},
+		{path: `emails]type[`, err: ErrInvalidPath},
+		{path: `emails[type zz "work"]`, err: ErrInvalidPath},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			attr, filter, sub, err := parsePath(test.path)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected error '%v', got '%v'", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if attr != test.attr || sub != test.sub ||
+				(filter != nil) != test.hasFilter {
+				t.Errorf("expected (%s, %v, %s), got (%s, %v, %s)",
+					test.attr, test.hasFilter, test.sub,
+					attr, filter != nil, sub)
+			}
+		})
+	}
+}
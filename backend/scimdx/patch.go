@@ -0,0 +1,220 @@
+package scimdx
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+)
+
+// applyPatch - applies the PATCH operations to the JSON form of the resource
+// and loads the result into out. Attribute names are matched case
+// insensitively as required by SCIM
+func applyPatch(resource any, patch *core.ScimPatch, out any) error {
+	if len(patch.Operations) == 0 {
+		return errx.Errf(ErrInvalidValue, "no PATCH operations given")
+	}
+
+	raw, err := json.Marshal(resource)
+	if err != nil {
+		return errx.Errf(err, "failed to marshal SCIM resource")
+	}
+	doc := map[string]any{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return errx.Errf(err, "failed to unmarshal SCIM resource")
+	}
+
+	for _, op := range patch.Operations {
+		var value any
+		if len(op.Value) != 0 {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return errx.Errf(ErrInvalidValue,
+					"invalid value for PATCH operation on '%s'", op.Path)
+			}
+		}
+		if err := applyOp(doc, strings.ToLower(op.Op), op.Path, value); err != nil {
+			return err
+		}
+	}
+
+	// Some clients send booleans as strings
+	activeKey := findKey(doc, "active")
+	if str, ok := doc[activeKey].(string); ok {
+		doc[activeKey] = strings.EqualFold(str, "true")
+	}
+
+	raw, err = json.Marshal(doc)
+	if err != nil {
+		return errx.Errf(err, "failed to marshal patched SCIM resource")
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return errx.Errf(ErrInvalidValue,
+			"patched resource is not valid: %v", err)
+	}
+	return nil
+}
+
+func applyOp(doc map[string]any, op, path string, value any) error {
+	if !(op == "add" || op == "replace" || op == "remove") {
+		return errx.Errf(ErrInvalidValue, "invalid PATCH operation '%s'", op)
+	}
+
+	if path == "" {
+		if op == "remove" {
+			return errx.Errf(ErrNoTarget, "remove operation requires a path")
+		}
+		attrs, ok := value.(map[string]any)
+		if !ok {
+			return errx.Errf(ErrInvalidValue,
+				"%s operation without path requires an object value", op)
+		}
+		for name, val := range attrs {
+			if err := applyOp(doc, op, name, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	attr, filter, sub, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	key := findKey(doc, attr)
+
+	if filter == nil {
+		if sub == "" {
+			return patchAttr(doc, op, key, value)
+		}
+		obj, ok := doc[key].(map[string]any)
+		if !ok {
+			if op == "remove" {
+				return nil
+			}
+			obj = map[string]any{}
+			doc[key] = obj
+		}
+		return patchAttr(obj, op, findKey(obj, sub), value)
+	}
+
+	items, _ := doc[key].([]any)
+	found := false
+	out := make([]any, 0, len(items))
+	for _, item := range items {
+		elem, ok := item.(map[string]any)
+		if !ok || !matches(filter, elem) {
+			out = append(out, item)
+			continue
+		}
+		found = true
+
+		switch {
+		case sub != "":
+			if err := patchAttr(elem, op, findKey(elem, sub), value); err != nil {
+				return err
+			}
+			out = append(out, elem)
+		case op == "remove":
+			// Element is dropped
+		default:
+			vals, ok := value.(map[string]any)
+			if !ok {
+				return errx.Errf(ErrInvalidValue,
+					"expected object value for path '%s'", path)
+			}
+			for k, v := range vals {
+				elem[findKey(elem, k)] = v
+			}
+			out = append(out, elem)
+		}
+	}
+	if !found {
+		return errx.Errf(ErrNoTarget,
+			"path '%s' did not match any value", path)
+	}
+	doc[key] = out
+	return nil
+}
+
+func patchAttr(obj map[string]any, op, key string, value any) error {
+	existing, isList := obj[key].([]any)
+	values, valueIsList := value.([]any)
+
+	switch op {
+	case "remove":
+		// Some clients remove selected members by giving them as value
+		// instead of using a filter
+		if isList && valueIsList {
+			obj[key] = removeValues(existing, values)
+			return nil
+		}
+		delete(obj, key)
+	case "add":
+		if isList || valueIsList {
+			if !valueIsList {
+				values = []any{value}
+			}
+			obj[key] = appendValues(existing, values)
+			return nil
+		}
+		obj[key] = value
+	case "replace":
+		obj[key] = value
+	}
+	return nil
+}
+
+func appendValues(existing, values []any) []any {
+	out := append([]any{}, existing...)
+	for _, val := range values {
+		if indexOf(out, val) == -1 {
+			out = append(out, val)
+		}
+	}
+	return out
+}
+
+func removeValues(existing, values []any) []any {
+	out := make([]any, 0, len(existing))
+	for _, item := range existing {
+		if indexOf(values, item) == -1 {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// indexOf - finds item in list, elements of multi valued attributes are
+// considered equal if they have the same value
+func indexOf(list []any, item any) int {
+	itemVal, hasVal := lookup(asMap(item), "value")
+	for idx, cur := range list {
+		if hasVal {
+			if curVal, ok := lookup(asMap(cur), "value"); ok &&
+				reflect.DeepEqual(curVal, itemVal) {
+				return idx
+			}
+			continue
+		}
+		if reflect.DeepEqual(cur, item) {
+			return idx
+		}
+	}
+	return -1
+}
+
+func asMap(val any) map[string]any {
+	m, _ := val.(map[string]any)
+	return m
+}
+
+func findKey(obj map[string]any, name string) string {
+	for key := range obj {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
@@ -0,0 +1,5 @@
+package scimdx
+
+const (
+	PermScimProvision = "idx.scimProvision"
+)
@@ -0,0 +1,145 @@
+package scimdx
+
+import (
+	"context"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+type selection struct {
+	where   squirrel.Sqlizer
+	orderBy string
+	offset  uint64
+	limit   uint64
+}
+
+// memberRef - reference from a user to a group or from a group to a user
+type memberRef struct {
+	OwnerId int64  `db:"owner_id"`
+	Id      int64  `db:"id"`
+	Display string `db:"display"`
+}
+
+type PgScimStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewScimStorage(gd data.GetterDeleter) *PgScimStorage {
+	return &PgScimStorage{
+		gd: gd,
+	}
+}
+
+func (pss *PgScimStorage) FindUsers(
+	gtx context.Context, sel *selection) ([]*core.User, int64, error) {
+	users := make([]*core.User, 0, sel.limit)
+	total, err := pss.find(gtx, "idx_user", sel, &users)
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (pss *PgScimStorage) FindGroups(
+	gtx context.Context, sel *selection) ([]*core.Group, int64, error) {
+	groups := make([]*core.Group, 0, sel.limit)
+	total, err := pss.find(gtx, "idx_group", sel, &groups)
+	if err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
+}
+
+func (pss *PgScimStorage) find(
+	gtx context.Context, table string, sel *selection, out any) (int64, error) {
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	from := core.TenantTable(gtx, table)
+	countQuery := builder.Select("COUNT(*)").From(from)
+	selectQuery := builder.Select("*").From(from).
+		OrderBy(sel.orderBy).
+		Offset(sel.offset).
+		Limit(sel.limit)
+	if sel.where != nil {
+		countQuery = countQuery.Where(sel.where)
+		selectQuery = selectQuery.Where(sel.where)
+	}
+
+	query, args, err := countQuery.ToSql()
+	if err != nil {
+		return 0, errx.Errf(err, "failed to build SCIM count query")
+	}
+	var total int64
+	if err := pg.Conn().GetContext(gtx, &total, query, args...); err != nil {
+		return 0, errx.Errf(err, "failed to count SCIM resources in '%s'", table)
+	}
+
+	query, args, err = selectQuery.ToSql()
+	if err != nil {
+		return 0, errx.Errf(err, "failed to build SCIM query")
+	}
+	if err := pg.Conn().SelectContext(gtx, out, query, args...); err != nil {
+		return 0, errx.Errf(err, "failed to query SCIM resources in '%s'", table)
+	}
+	return total, nil
+}
+
+// GroupsOfUsers - groups of each of the given users keyed by user id
+func (pss *PgScimStorage) GroupsOfUsers(
+	gtx context.Context, userIds []int64) (map[int64][]*memberRef, error) {
+	query, args, err := squirrel.StatementBuilder.
+		PlaceholderFormat(squirrel.Dollar).
+		Select(
+			"ug.user_id AS owner_id",
+			"g.id AS id",
+			"g.display_name AS display").
+		From("user_to_group ug").
+		Join("idx_group g ON g.id = ug.group_id").
+		Where(squirrel.Eq{"ug.user_id": userIds}).
+		OrderBy("g.id").
+		ToSql()
+	if err != nil {
+		return nil, errx.Errf(err, "failed to build user groups query")
+	}
+	return pss.refs(gtx, query, args)
+}
+
+// MembersOfGroups - members of each of the given groups keyed by group id
+func (pss *PgScimStorage) MembersOfGroups(
+	gtx context.Context, groupIds []int64) (map[int64][]*memberRef, error) {
+	query, args, err := squirrel.StatementBuilder.
+		PlaceholderFormat(squirrel.Dollar).
+		Select(
+			"ug.group_id AS owner_id",
+			"u.id AS id",
+			"u.user_name AS display").
+		From("user_to_group ug").
+		Join("idx_user u ON u.id = ug.user_id").
+		Where(squirrel.Eq{"ug.group_id": groupIds}).
+		OrderBy("u.id").
+		ToSql()
+	if err != nil {
+		return nil, errx.Errf(err, "failed to build group members query")
+	}
+	return pss.refs(gtx, query, args)
+}
+
+func (pss *PgScimStorage) refs(
+	gtx context.Context,
+	query string,
+	args []any) (map[int64][]*memberRef, error) {
+	refs := make([]*memberRef, 0, 100)
+	if err := pg.Conn().SelectContext(gtx, &refs, query, args...); err != nil {
+		return nil, errx.Errf(err, "failed to get group memberships")
+	}
+
+	out := make(map[int64][]*memberRef, len(refs))
+	for _, ref := range refs {
+		out[ref.OwnerId] = append(out[ref.OwnerId], ref)
+	}
+	return out, nil
+}
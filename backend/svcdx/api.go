@@ -7,6 +7,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/auth"
 	"github.com/varunamachi/libx/data"
 	"github.com/varunamachi/libx/errx"
 	"github.com/varunamachi/libx/httpx"
@@ -29,7 +30,15 @@ func ServiceEndpoints(gtx context.Context) []*httpx.Endpoint {
 		removeAdminFromServiceEp(ss),
 		getServiceAdminsEp(ss),
 		isServiceAdminEp(ss),
+		grantAccessEp(ss),
+		revokeAccessEp(ss),
+		getAllowedUsersEp(ss),
 		getPermissionsForService(ss),
+		hasPermissionEp(ss),
+		checkEp(ss),
+		syncServiceEp(ss),
+		explainEp(ss),
+		whoHasEp(ss),
 	}
 }
 
@@ -65,6 +74,18 @@ func updateServiceEp(ss core.ServiceController) *httpx.Endpoint {
 			return errx.BadReq("failed to read service info from request", err)
 		}
 
+		prmg := httpx.NewParamGetter(etx)
+		if prmg.QueryBoolOr("dryRun", false) {
+			impact, err := ss.PreviewImpact(
+				etx.Request().Context(),
+				service.Id,
+				&core.AccessChange{Tree: &service.Permissions})
+			if err != nil {
+				return errx.Wrap(err)
+			}
+			return httpx.SendJSON(etx, impact)
+		}
+
 		if err := ss.Update(etx.Request().Context(), &service); err != nil {
 			return errx.Wrap(err)
 		}
@@ -376,6 +397,86 @@ func isServiceAdminEp(ss core.ServiceController) *httpx.Endpoint {
 	}
 }
 
+func grantAccessEp(ss core.ServiceController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		userId := prmg.Int64("userId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		err := ss.GrantAccess(etx.Request().Context(), serviceId, userId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/service/:serviceId/user/:userId",
+		Category:    "idx.service",
+		Desc:        "Allow an user to use a service",
+		Version:     "v1",
+		Permissions: []string{PermServiceManageAccess},
+		Handler:     handler,
+	}
+}
+
+func revokeAccessEp(ss core.ServiceController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		userId := prmg.Int64("userId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		err := ss.RevokeAccess(etx.Request().Context(), serviceId, userId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/service/:serviceId/user/:userId",
+		Category:    "idx.service",
+		Desc:        "Revoke access of an user to a service",
+		Version:     "v1",
+		Permissions: []string{PermServiceManageAccess},
+		Handler:     handler,
+	}
+}
+
+func getAllowedUsersEp(ss core.ServiceController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		users, err := ss.GetAllowedUsers(etx.Request().Context(), serviceId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, users)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/service/:serviceId/user",
+		Category:    "idx.service",
+		Desc:        "Get users allowed to use a service",
+		Version:     "v1",
+		Permissions: []string{PermGetService},
+		Handler:     handler,
+	}
+}
+
 func getPermissionsForService(gs core.ServiceController) *httpx.Endpoint {
 	handler := func(etx echo.Context) error {
 		prmg := httpx.NewParamGetter(etx)
@@ -404,3 +505,496 @@ func getPermissionsForService(gs core.ServiceController) *httpx.Endpoint {
 		Handler:     handler,
 	}
 }
+
+func hasPermissionEp(gs core.ServiceController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		userId := prmg.Int64("userId")
+		serviceId := prmg.Int64("serviceId")
+		perm := prmg.Str("perm")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		allowed, err := gs.HasPermission(
+			etx.Request().Context(), userId, serviceId, perm)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+
+		return httpx.SendJSON(etx, map[string]bool{
+			"allowed": allowed,
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/service/:serviceId/perms/:userId/:perm",
+		Category:    "idx.service",
+		Desc:        "Check if a user has a permission in a service",
+		Version:     "v1",
+		Permissions: []string{PermGetService},
+		Handler:     handler,
+	}
+}
+
+func checkEp(gs core.ServiceController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var req core.CheckRequest
+		if err := etx.Bind(&req); err != nil {
+			return errx.BadReqX(err, "failed to read check request")
+		}
+
+		results, err := gs.Check(etx.Request().Context(), serviceId, &req)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, results)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/service/:serviceId/check",
+		Category:    "idx.service",
+		Desc:        "Check multiple permissions of a user in a service",
+		Version:     "v1",
+		Permissions: []string{PermGetService},
+		Handler:     handler,
+	}
+}
+
+// syncServiceEp - admins of the service can sync it, controller limits
+// creating services through sync to admins of idx
+func syncServiceEp(ss core.ServiceController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		opts := core.SyncOptions{
+			DryRun: prmg.QueryBoolOr("dryRun", false),
+			Prune:  prmg.QueryBoolOr("prune", false),
+		}
+
+		var manifest core.ServiceManifest
+		if err := etx.Bind(&manifest); err != nil {
+			return errx.BadReqX(err, "failed to read service manifest")
+		}
+
+		res, err := ss.Sync(etx.Request().Context(), &manifest, &opts)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, res)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.POST,
+		Path:     "/service/sync",
+		Category: "idx.service",
+		Desc:     "Sync a service with its permission manifest",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+// explainEp - users can explain their own permissions, controller limits
+// explaining others to the admins of the service
+func explainEp(ss core.ServiceController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		userId := prmg.Int64("userId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		out, err := ss.Explain(etx.Request().Context(), serviceId, userId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, out)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/service/:serviceId/explain/:userId",
+		Category: "idx.service",
+		Desc:     "Explain where the permissions of a user in a service come from",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func whoHasEp(ss core.ServiceController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		perm := prmg.QueryStrOr("perm", "")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+		if perm == "" {
+			return errx.BadReq("permission to look for is not given")
+		}
+
+		out, err := ss.WhoHas(etx.Request().Context(), serviceId, perm)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, out)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/service/:serviceId/holders",
+		Category: "idx.service",
+		Desc:     "Get users who have a permission in a service",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func PolicyEndpoints(gtx context.Context) []*httpx.Endpoint {
+	pc := core.PolicyCtlr(gtx)
+	return []*httpx.Endpoint{
+		createPolicyEp(pc),
+		updatePolicyEp(pc),
+		getPolicyEp(pc),
+		deletePolicyEp(pc),
+		getPoliciesEp(pc),
+		dryRunPolicyEp(pc),
+	}
+}
+
+func createPolicyEp(pc core.PolicyController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var policy core.Policy
+		if err := etx.Bind(&policy); err != nil {
+			return errx.BadReqX(err, "failed to read policy from request")
+		}
+
+		id, err := pc.Save(etx.Request().Context(), &policy)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, data.M{
+			"policyId": id,
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/policy",
+		Category:    "idx.policy",
+		Desc:        "Create an access policy for a service",
+		Version:     "v1",
+		Permissions: []string{PermManagePolicy},
+		Handler:     handler,
+	}
+}
+
+func updatePolicyEp(pc core.PolicyController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var policy core.Policy
+		if err := etx.Bind(&policy); err != nil {
+			return errx.BadReqX(err, "failed to read policy from request")
+		}
+
+		if err := pc.Update(etx.Request().Context(), &policy); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/policy",
+		Category:    "idx.policy",
+		Desc:        "Update an access policy",
+		Version:     "v1",
+		Permissions: []string{PermManagePolicy},
+		Handler:     handler,
+	}
+}
+
+func getPolicyEp(pc core.PolicyController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		policy, err := pc.GetOne(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, policy)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/policy/:id",
+		Category:    "idx.policy",
+		Desc:        "Get an access policy",
+		Version:     "v1",
+		Permissions: []string{PermGetService},
+		Handler:     handler,
+	}
+}
+
+func deletePolicyEp(pc core.PolicyController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := pc.Remove(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return etx.String(http.StatusOK, strconv.FormatInt(id, 10))
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/policy/:id",
+		Category:    "idx.policy",
+		Desc:        "Delete an access policy",
+		Version:     "v1",
+		Permissions: []string{PermManagePolicy},
+		Handler:     handler,
+	}
+}
+
+func getPoliciesEp(pc core.PolicyController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		policies, err := pc.GetForService(etx.Request().Context(), serviceId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, policies)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/service/:serviceId/policy",
+		Category:    "idx.policy",
+		Desc:        "Get access policies of a service",
+		Version:     "v1",
+		Permissions: []string{PermGetService},
+		Handler:     handler,
+	}
+}
+
+func dryRunPolicyEp(pc core.PolicyController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		var req core.DryRunRequest
+		if err := etx.Bind(&req); err != nil {
+			return errx.BadReqX(err, "failed to read dry run request")
+		}
+
+		res, err := pc.DryRun(etx.Request().Context(), serviceId, &req)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, res)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/service/:serviceId/policy/dryrun",
+		Category:    "idx.policy",
+		Desc:        "Evaluate a policy against sample input without saving it",
+		Version:     "v1",
+		Permissions: []string{PermManagePolicy},
+		Handler:     handler,
+	}
+}
+
+func SodEndpoints(gtx context.Context) []*httpx.Endpoint {
+	sc := core.SodCtlr(gtx)
+	return []*httpx.Endpoint{
+		createSodEp(sc),
+		updateSodEp(sc),
+		getSodEp(sc),
+		deleteSodEp(sc),
+		getSodsEp(sc),
+		getSodViolationsEp(sc),
+	}
+}
+
+func createSodEp(sc core.SodController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var sod core.SodConstraint
+		if err := etx.Bind(&sod); err != nil {
+			return errx.BadReqX(err, "failed to read constraint from request")
+		}
+
+		id, err := sc.Save(etx.Request().Context(), &sod)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, data.M{
+			"constraintId": id,
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/sod",
+		Category:    "idx.sod",
+		Desc:        "Create a segregation of duties constraint for a service",
+		Version:     "v1",
+		Permissions: []string{PermManageSod},
+		Handler:     handler,
+	}
+}
+
+func updateSodEp(sc core.SodController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var sod core.SodConstraint
+		if err := etx.Bind(&sod); err != nil {
+			return errx.BadReqX(err, "failed to read constraint from request")
+		}
+
+		if err := sc.Update(etx.Request().Context(), &sod); err != nil {
+			return errx.Wrap(err)
+		}
+		return nil
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/sod",
+		Category:    "idx.sod",
+		Desc:        "Update a segregation of duties constraint",
+		Version:     "v1",
+		Permissions: []string{PermManageSod},
+		Handler:     handler,
+	}
+}
+
+func getSodEp(sc core.SodController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		sod, err := sc.GetOne(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, sod)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/sod/:id",
+		Category:    "idx.sod",
+		Desc:        "Get a segregation of duties constraint",
+		Version:     "v1",
+		Permissions: []string{PermGetService},
+		Handler:     handler,
+	}
+}
+
+func deleteSodEp(sc core.SodController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := sc.Remove(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return etx.String(http.StatusOK, strconv.FormatInt(id, 10))
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/sod/:id",
+		Category:    "idx.sod",
+		Desc:        "Delete a segregation of duties constraint",
+		Version:     "v1",
+		Permissions: []string{PermManageSod},
+		Handler:     handler,
+	}
+}
+
+func getSodsEp(sc core.SodController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		constraints, err := sc.GetForService(
+			etx.Request().Context(), serviceId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, constraints)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/service/:serviceId/sod",
+		Category:    "idx.sod",
+		Desc:        "Get segregation of duties constraints of a service",
+		Version:     "v1",
+		Permissions: []string{PermGetService},
+		Handler:     handler,
+	}
+}
+
+func getSodViolationsEp(sc core.SodController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		serviceId := prmg.Int64("serviceId")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		violations, err := sc.Violations(etx.Request().Context(), serviceId)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, violations)
+	}
+
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/service/:serviceId/sod/violation",
+		Category: "idx.sod",
+		Desc:     "Get users violating segregation of duties constraints",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
@@ -0,0 +1,693 @@
+package svcdx
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+var ErrInvalidCondition = errors.New("invalid policy condition")
+
+// Policy conditions are boolean expressions over the attributes of the user,
+// the request and the resource:
+//
+//	user.title == "Accountant" && user.props.department == "finance"
+//	inCidr(request.ip, "10.0.0.0/8", "192.168.1.0/24")
+//	hour(request.time, "Asia/Kolkata") >= 9 && weekday(request.time) <= 5
+//	resource.owner == user.userName || user.props.role in ["auditor", "admin"]
+//
+// Operators are ||, &&, !, ==, !=, <, <=, >, >= and in. Literals are strings
+// in single or double quotes, numbers, true, false, null and lists. Missing
+// attributes evaluate to null.
+
+type condEnv map[string]any
+
+var cmpOps = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+type condNode interface {
+	eval(env condEnv) (any, error)
+}
+
+type condFunc func(args []any) (any, error)
+
+var condFuncs = map[string]condFunc{
+	"inCidr":     inCidrFn,
+	"hour":       hourFn,
+	"weekday":    weekdayFn,
+	"startsWith": strFn(strings.HasPrefix),
+	"endsWith":   strFn(strings.HasSuffix),
+	"contains":   containsFn,
+}
+
+// compileCondition - parses the condition, an empty condition always holds
+func compileCondition(src string) (condNode, error) {
+	if strings.TrimSpace(src) == "" {
+		return literal{val: true}, nil
+	}
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &condParser{toks: toks}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errf("unexpected '%s'", p.peek().text)
+	}
+	return node, nil
+}
+
+// evalCondition - evaluates the compiled condition, the result should be a
+// boolean
+func evalCondition(node condNode, env condEnv) (bool, error) {
+	val, err := node.eval(env)
+	if err != nil {
+		return false, err
+	}
+	res, ok := val.(bool)
+	if !ok {
+		return false, errx.Errf(ErrInvalidCondition,
+			"condition evaluates to '%v' instead of a boolean", val)
+	}
+	return res, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func tokenize(src string) ([]token, error) {
+	toks := make([]token, 0, 32)
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(src) && rune(src[j]) != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, errx.Errf(ErrInvalidCondition,
+					"unterminated string at %d", i)
+			}
+			toks = append(toks, token{tokString, sb.String(), i})
+			i = j + 1
+
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(src) && strings.ContainsRune("0123456789.", rune(src[j])) {
+				j++
+			}
+			toks = append(toks, token{tokNumber, src[i:j], i})
+			i = j
+
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) {
+				r := rune(src[j])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) &&
+					r != '_' && r != '.' {
+					break
+				}
+				j++
+			}
+			toks = append(toks, token{tokIdent, src[i:j], i})
+			i = j
+
+		default:
+			op := ""
+			for _, o := range []string{
+				"&&", "||", "==", "!=", "<=", ">=",
+				"<", ">", "!", "(", ")", "[", "]", ",",
+			} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, errx.Errf(ErrInvalidCondition,
+					"unexpected character '%c' at %d", c, i)
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{tokEOF, "end of condition", len(src)}), nil
+}
+
+type condParser struct {
+	toks []token
+	pos  int
+}
+
+func (p *condParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *condParser) next() token {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *condParser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *condParser) expect(op string) error {
+	if !p.accept(op) {
+		return p.errf("expected '%s' but found '%s'", op, p.peek().text)
+	}
+	return nil
+}
+
+func (p *condParser) errf(msg string, args ...any) error {
+	return errx.Errf(ErrInvalidCondition,
+		"%s at %d", fmt.Sprintf(msg, args...), p.peek().pos)
+}
+
+func (p *condParser) parseOr() (condNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseAnd() (condNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseNot() (condNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return not{operand: operand}, nil
+	}
+	return p.parseCmp()
+}
+
+func (p *condParser) parseCmp() (condNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	isCmp := tok.kind == tokOp && cmpOps[tok.text]
+	isIn := tok.kind == tokIdent && tok.text == "in"
+	if !isCmp && !isIn {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compare{op: tok.text, left: left, right: right}, nil
+}
+
+func (p *condParser) parseOperand() (condNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return literal{val: tok.text}, nil
+
+	case tokNumber:
+		num, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, errx.Errf(ErrInvalidCondition,
+				"invalid number '%s' at %d", tok.text, tok.pos)
+		}
+		return literal{val: num}, nil
+
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return literal{val: true}, nil
+		case "false":
+			return literal{val: false}, nil
+		case "null":
+			return literal{val: nil}, nil
+		}
+		if p.accept("(") {
+			return p.parseCall(tok)
+		}
+		return attribute{path: strings.Split(tok.text, ".")}, nil
+
+	case tokOp:
+		switch tok.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return list{items: items}, nil
+		}
+	}
+	return nil, errx.Errf(ErrInvalidCondition,
+		"unexpected '%s' at %d", tok.text, tok.pos)
+}
+
+func (p *condParser) parseCall(name token) (condNode, error) {
+	fn, found := condFuncs[name.text]
+	if !found {
+		return nil, errx.Errf(ErrInvalidCondition,
+			"unknown function '%s' at %d", name.text, name.pos)
+	}
+	args, err := p.parseList(")")
+	if err != nil {
+		return nil, err
+	}
+	return call{name: name.text, fn: fn, args: args}, nil
+}
+
+func (p *condParser) parseList(end string) ([]condNode, error) {
+	items := make([]condNode, 0, 4)
+	if p.accept(end) {
+		return items, nil
+	}
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if p.accept(end) {
+			return items, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type literal struct {
+	val any
+}
+
+func (l literal) eval(_ condEnv) (any, error) {
+	return l.val, nil
+}
+
+type attribute struct {
+	path []string
+}
+
+func (a attribute) eval(env condEnv) (any, error) {
+	var cur any = map[string]any(env)
+	for _, key := range a.path {
+		obj, ok := asMap(cur)
+		if !ok {
+			return nil, nil
+		}
+		cur = obj[key]
+	}
+	return normalize(cur), nil
+}
+
+type list struct {
+	items []condNode
+}
+
+func (l list) eval(env condEnv) (any, error) {
+	out := make([]any, 0, len(l.items))
+	for _, item := range l.items {
+		val, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, val)
+	}
+	return out, nil
+}
+
+type call struct {
+	name string
+	fn   condFunc
+	args []condNode
+}
+
+func (c call) eval(env condEnv) (any, error) {
+	args := make([]any, 0, len(c.args))
+	for _, arg := range c.args {
+		val, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, val)
+	}
+	res, err := c.fn(args)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to evaluate '%s'", c.name)
+	}
+	return res, nil
+}
+
+type not struct {
+	operand condNode
+}
+
+func (n not) eval(env condEnv) (any, error) {
+	val, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := val.(bool)
+	if !ok {
+		return nil, errx.Errf(ErrInvalidCondition,
+			"'!' applied to non boolean '%v'", val)
+	}
+	return !b, nil
+}
+
+type logical struct {
+	or    bool
+	left  condNode
+	right condNode
+}
+
+func (l logical) eval(env condEnv) (any, error) {
+	for _, side := range []condNode{l.left, l.right} {
+		val, err := side.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := val.(bool)
+		if !ok {
+			return nil, errx.Errf(ErrInvalidCondition,
+				"logical operator applied to non boolean '%v'", val)
+		}
+		// Short circuit
+		if b == l.or {
+			return b, nil
+		}
+	}
+	return !l.or, nil
+}
+
+type compare struct {
+	op    string
+	left  condNode
+	right condNode
+}
+
+func (c compare) eval(env condEnv) (any, error) {
+	left, err := c.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		items, ok := right.([]any)
+		if !ok {
+			return nil, errx.Errf(ErrInvalidCondition,
+				"right side of 'in' is not a list")
+		}
+		for _, item := range items {
+			if equal(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	// Ordering comparisons against missing attributes do not hold
+	if left == nil || right == nil {
+		return false, nil
+	}
+	cmp := 0
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, mismatch(c.op, left, right)
+		}
+		cmp = compareOrdered(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, mismatch(c.op, left, right)
+		}
+		cmp = compareOrdered(l, r)
+	case time.Time:
+		r, ok := toTime(right)
+		if !ok {
+			return nil, mismatch(c.op, left, right)
+		}
+		cmp = l.Compare(r)
+	default:
+		return nil, mismatch(c.op, left, right)
+	}
+
+	switch c.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func compareOrdered[T float64 | string](l, r T) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+func mismatch(op string, left, right any) error {
+	return errx.Errf(ErrInvalidCondition,
+		"cannot apply '%s' to '%v' and '%v'", op, left, right)
+}
+
+func equal(left, right any) bool {
+	if lt, ok := left.(time.Time); ok {
+		rt, ok := toTime(right)
+		return ok && lt.Equal(rt)
+	}
+	switch left.(type) {
+	case []any, map[string]any:
+		return false
+	}
+	switch right.(type) {
+	case []any, map[string]any:
+		return false
+	}
+	return left == right
+}
+
+// normalize - converts values from the attributes to the types the
+// expressions work with
+func normalize(val any) any {
+	switch v := val.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case []string:
+		out := make([]any, 0, len(v))
+		for _, s := range v {
+			out = append(out, s)
+		}
+		return out
+	}
+	return val
+}
+
+func asMap(val any) (map[string]any, bool) {
+	switch v := val.(type) {
+	case map[string]any:
+		return v, true
+	case condEnv:
+		return v, true
+	case data.M:
+		return v, true
+	}
+	return nil, false
+}
+
+func toTime(val any) (time.Time, bool) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func inCidrFn(args []any) (any, error) {
+	if len(args) < 2 {
+		return nil, errors.New("expects an IP and one or more CIDRs")
+	}
+	ipStr, _ := args[0].(string)
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return false, nil
+	}
+	for _, arg := range args[1:] {
+		cidr, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("'%v' is not a CIDR", arg)
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		if network.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// timeArg - time from the first argument in the location given by the
+// optional second argument, UTC otherwise
+func timeArg(args []any) (time.Time, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return time.Time{}, errors.New("expects a time and optional location")
+	}
+	t, ok := toTime(args[0])
+	if !ok {
+		return time.Time{}, fmt.Errorf("'%v' is not a time", args[0])
+	}
+	loc := time.UTC
+	if len(args) == 2 {
+		name, _ := args[1].(string)
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return t.In(loc), nil
+}
+
+func hourFn(args []any) (any, error) {
+	t, err := timeArg(args)
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.Hour()), nil
+}
+
+// weekdayFn - ISO week day, 1 is Monday and 7 is Sunday
+func weekdayFn(args []any) (any, error) {
+	t, err := timeArg(args)
+	if err != nil {
+		return nil, err
+	}
+	day := int(t.Weekday())
+	if day == 0 {
+		day = 7
+	}
+	return float64(day), nil
+}
+
+func strFn(fn func(s, sub string) bool) condFunc {
+	return func(args []any) (any, error) {
+		if len(args) != 2 {
+			return nil, errors.New("expects two arguments")
+		}
+		s, ok1 := args[0].(string)
+		sub, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return false, nil
+		}
+		return fn(s, sub), nil
+	}
+}
+
+func containsFn(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, errors.New("expects two arguments")
+	}
+	if items, ok := args[0].([]any); ok {
+		for _, item := range items {
+			if equal(item, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return strFn(strings.Contains)(args)
+}
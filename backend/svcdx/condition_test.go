@@ -0,0 +1,241 @@
+package svcdx
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/varunamachi/libx/data"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		toks []token
+		err  bool
+	}{
+		{
+			name: "operators strings and lists",
+			src:  `a.b >= 10 && !("x\"y" in ['z'])`,
+			toks: []token{
+				{tokIdent, "a.b", 0},
+				{tokOp, ">=", 4},
+				{tokNumber, "10", 7},
+				{tokOp, "&&", 10},
+				{tokOp, "!", 13},
+				{tokOp, "(", 14},
+				{tokString, `x"y`, 15},
+				{tokIdent, "in", 22},
+				{tokOp, "[", 25},
+				{tokString, "z", 26},
+				{tokOp, "]", 29},
+				{tokOp, ")", 30},
+				{tokEOF, "end of condition", 31},
+			},
+		},
+		{
+			name: "two character operators are not split",
+			src:  "a<=b!=c",
+			toks: []token{
+				{tokIdent, "a", 0},
+				{tokOp, "<=", 1},
+				{tokIdent, "b", 3},
+				{tokOp, "!=", 4},
+				{tokIdent, "c", 6},
+				{tokEOF, "end of condition", 7},
+			},
+		},
+		{
+			name: "function call",
+			src:  `f(x, 1.5)`,
+			toks: []token{
+				{tokIdent, "f", 0},
+				{tokOp, "(", 1},
+				{tokIdent, "x", 2},
+				{tokOp, ",", 3},
+				{tokNumber, "1.5", 5},
+				{tokOp, ")", 8},
+				{tokEOF, "end of condition", 9},
+			},
+		},
+		{name: "unterminated string", src: `a == "abc`, err: true},
+		{name: "single equals", src: `a = b`, err: true},
+		{name: "single ampersand", src: `a & b`, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			toks, err := tokenize(test.src)
+			if test.err {
+				if !errors.Is(err, ErrInvalidCondition) {
+					t.Fatalf("expected invalid condition error, got '%v'", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(toks, test.toks) {
+				t.Errorf("expected %v, got %v", test.toks, toks)
+			}
+		})
+	}
+}
+
+func testEnv() condEnv {
+	return condEnv{
+		"user": data.M{
+			"userName": "bob",
+			"title":    "Accountant",
+			"age":      30,
+			"props": map[string]any{
+				"department": "finance",
+				"roles":      []string{"auditor", "viewer"},
+			},
+		},
+		"request": map[string]any{
+			"ip":   "10.1.2.3",
+			"time": time.Date(2026, 10, 19, 4, 30, 0, 0, time.UTC),
+		},
+		"resource": map[string]any{
+			"owner": "bob",
+		},
+	}
+}
+
+func TestEvalCondition(t *testing.T) {
+	tests := []struct {
+		name string
+		cond string
+		want bool
+	}{
+		{"empty condition holds", "  ", true},
+		{"string equality", `user.title == "Accountant"`, true},
+		{"single quoted string", `user.props.department == 'finance'`, true},
+		{"attribute to attribute", `resource.owner == user.userName`, true},
+		{"inequality", `user.title != "Manager"`, true},
+		{"integer attribute", `user.age >= 30 && user.age < 31`, true},
+		{"string ordering", `user.userName < "carol"`, true},
+		{"missing attribute is null", `user.manager == null`, true},
+		{"missing nested attribute", `user.props.x.y == null`, true},
+		{"ordering against null", `user.manager < 5`, false},
+		{"in list", `user.title in ["Auditor", "Accountant"]`, true},
+		{"not in list", `user.title in []`, false},
+		{"contains in list attribute", `contains(user.props.roles, "auditor")`,
+			true},
+		{"contains in string", `contains(user.title, "count")`, true},
+		{"starts with", `startsWith(user.title, "Acc")`, true},
+		{"ends with non string", `endsWith(user.age, "0")`, false},
+
+		{"and binds tighter than or", `true || false && false`, true},
+		{"parentheses", `(true || false) && false`, false},
+		{"not binds tighter than and", `!false && false`, false},
+		{"not of group", `!(false && false)`, true},
+		{"double not", `!!true`, true},
+		{"comparison binds tighter than and",
+			`user.age > 20 && user.title == "Accountant"`, true},
+		{"or short circuits", `true || user.title`, true},
+		{"and short circuits", `false && user.title`, false},
+
+		{"ip in cidr", `inCidr(request.ip, "10.0.0.0/8")`, true},
+		{"ip in one of the cidrs",
+			`inCidr(request.ip, "192.168.0.0/16", "10.1.2.0/24")`, true},
+		{"ip outside cidr", `inCidr(request.ip, "192.168.0.0/16")`, false},
+		{"invalid ip", `inCidr(user.title, "10.0.0.0/8")`, false},
+
+		{"hour in utc", `hour(request.time) == 4`, true},
+		{"hour in location",
+			`hour(request.time, "Asia/Kolkata") == 10`, true},
+		{"weekday", `weekday(request.time) == 1`, true},
+		{"weekday in location",
+			`weekday(request.time, "America/Los_Angeles") == 7`, true},
+		{"time against string",
+			`request.time > "2026-10-19T00:00:00Z"`, true},
+		{"time equality across zones",
+			`request.time == "2026-10-19T10:00:00+05:30"`, true},
+	}
+
+	env := testEnv()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := compileCondition(test.cond)
+			if err != nil {
+				t.Fatalf("failed to compile '%s': %v", test.cond, err)
+			}
+			got, err := evalCondition(node, env)
+			if err != nil {
+				t.Fatalf("failed to evaluate '%s': %v", test.cond, err)
+			}
+			if got != test.want {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestCompileConditionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cond string
+	}{
+		{"missing operand", `user.age ==`},
+		{"unclosed group", `(user.age == 1`},
+		{"unclosed list", `user.title in ["a"`},
+		{"missing comma", `inCidr(request.ip "10.0.0.0/8")`},
+		{"trailing operand", `user.title "x"`},
+		{"invalid number", `user.age == 1.2.3`},
+		{"unknown function", `lower(user.title) == "x"`},
+		{"dangling operator", `&& true`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := compileCondition(test.cond)
+			if !errors.Is(err, ErrInvalidCondition) {
+				t.Fatalf("expected invalid condition error, got '%v'", err)
+			}
+		})
+	}
+}
+
+func TestEvalConditionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cond string
+		err  error
+	}{
+		{"string against number", `user.title < 5`, ErrInvalidCondition},
+		{"number against string", `user.age >= "30"`, ErrInvalidCondition},
+		{"boolean ordering", `true < false`, ErrInvalidCondition},
+		{"time against number", `request.time > 5`, ErrInvalidCondition},
+		{"logical on string", `user.title && true`, ErrInvalidCondition},
+		{"not on number", `!user.age`, ErrInvalidCondition},
+		{"in on string", `"a" in user.title`, ErrInvalidCondition},
+		{"non boolean result", `user.title`, ErrInvalidCondition},
+		{"invalid cidr", `inCidr(request.ip, "10.0.0.0/33")`, nil},
+		{"cidr missing", `inCidr(request.ip)`, nil},
+		{"hour of non time", `hour(user.title) == 1`, nil},
+		{"unknown location", `hour(request.time, "Nowhere/City") == 1`, nil},
+		{"wrong argument count", `startsWith(user.title) == true`, nil},
+	}
+
+	env := testEnv()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := compileCondition(test.cond)
+			if err != nil {
+				t.Fatalf("failed to compile '%s': %v", test.cond, err)
+			}
+			_, err = evalCondition(node, env)
+			if err == nil {
+				t.Fatalf("expected '%s' to fail", test.cond)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Fatalf("expected error '%v', got '%v'", test.err, err)
+			}
+		})
+	}
+}
@@ -7,8 +7,11 @@ import (
 
 	"github.com/varunamachi/idx/core"
 	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
 )
 
+const maxChecks = 500
+
 // TODO - implement
 type svcCtl struct {
 	srvStore *PgServiceStorage
@@ -42,6 +45,19 @@ func (sc svcCtl) Save(
 		return -1, ev.Errf(core.ErrEntityExists,
 			"service '%d:%s' already exists", service.Id, service.Name)
 	}
+	if _, err := newEvaluator(service.Name, &service.Permissions); err != nil {
+		return -1, ev.Commit(err)
+	}
+	if err := checkAccessMode(service); err != nil {
+		return -1, ev.Commit(err)
+	}
+
+	// Groups of a service can only be created after the service
+	if len(service.DefaultGroups) != 0 {
+		return -1, ev.Errf(core.ErrInvalidState,
+			"new service '%s' cannot have default groups", service.Name)
+	}
+	service.DefaultGroups = data.Vec[int64]{}
 
 	service.CreatedBy, service.UpdatedBy = user.Id(), user.Id()
 
@@ -51,7 +67,7 @@ func (sc svcCtl) Save(
 	}
 
 	// Make the owner admin
-	if err = sc.srvStore.AddAdmin(gtx, service.Id, user.Id()); err != nil {
+	if err = sc.srvStore.AddAdmin(gtx, id, user.Id()); err != nil {
 		return id, ev.Commit(err)
 	}
 
@@ -64,16 +80,18 @@ func (sc svcCtl) Update(gtx context.Context, service *core.Service) error {
 	})
 	user := core.MustGetUser(gtx)
 
-	isAdmin, err := sc.srvStore.IsAdmin(gtx, service.Id, user.Id())
-	if err != nil {
+	if err := core.CheckServiceAdmin(gtx, service.Id); err != nil {
 		return ev.Commit(err)
 	}
 
-	if !isAdmin {
-		return ev.Errf(core.ErrUnauthorized,
-			"an user '%s' is not authorized to update service '%s'",
-			user.Username, service.Name,
-		)
+	if _, err := newEvaluator(service.Name, &service.Permissions); err != nil {
+		return ev.Commit(err)
+	}
+	if err := checkAccessMode(service); err != nil {
+		return ev.Commit(err)
+	}
+	if err := checkDefaultGroups(gtx, service); err != nil {
+		return ev.Commit(err)
 	}
 
 	service.UpdatedBy, service.UpdatedOn = user.Id(), time.Now()
@@ -164,26 +182,22 @@ func (sc *svcCtl) AddAdmin(
 		"adminId":   userId,
 	})
 
-	curUser, err := core.GetUser(gtx)
-	if err != nil {
+	if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
 		return ev.Commit(err)
 	}
 
-	isAdmin, err := sc.srvStore.IsAdmin(gtx, serviceId, curUser.Id())
+	// The permission is reserved to idx, the tree of the service can not have
+	// it
+	target, err := core.UserCtlr(gtx).GetOne(gtx, userId)
 	if err != nil {
 		return ev.Commit(err)
 	}
-	if !isAdmin {
-		return ev.Errf(core.ErrUnauthorized,
-			"user '%s' is not authorized modify service admin list")
-	}
-
-	perms, err := sc.srvStore.GetPermissionForService(gtx, userId, serviceId)
+	_, perms, err := core.IdxAccess(gtx, target)
 	if err != nil {
 		return ev.Commit(err)
 	}
 
-	if !slices.Contains(perms, PermServiceAdmin) {
+	if !perms.HasPerm(PermServiceAdmin) {
 		return ev.Errf(core.ErrUnauthorized,
 			"only user with 'idx.serviceAdmin' permission can be "+
 				"added as admin")
@@ -234,14 +248,251 @@ func (sc *svcCtl) IsAdmin(
 	return isAdmin, nil
 }
 
+func (sc *svcCtl) GrantAccess(
+	gtx context.Context, serviceId, userId int64) error {
+	ev := core.NewEventAdder(gtx, "service.grantAccess", data.M{
+		"serviceId": serviceId,
+		"userId":    userId,
+	})
+	if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+		return ev.Commit(err)
+	}
+	admin := core.MustGetUser(gtx)
+
+	err := sc.srvStore.GrantAccess(gtx, serviceId, userId, admin.Id())
+	if err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(nil)
+}
+
+func (sc *svcCtl) RevokeAccess(
+	gtx context.Context, serviceId, userId int64) error {
+	ev := core.NewEventAdder(gtx, "service.revokeAccess", data.M{
+		"serviceId": serviceId,
+		"userId":    userId,
+	})
+	if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+		return ev.Commit(err)
+	}
+
+	if err := sc.srvStore.RevokeAccess(gtx, serviceId, userId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(nil)
+}
+
+func (sc *svcCtl) GetAllowedUsers(
+	gtx context.Context, serviceId int64) ([]*core.User, error) {
+	users, err := sc.srvStore.GetAllowedUsers(gtx, serviceId)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "service.getAllowedUsers", data.M{
+			"serviceId": serviceId,
+		}).Commit(err)
+	}
+	return users, nil
+}
+
+func (sc *svcCtl) CheckAccess(
+	gtx context.Context, serviceId, userId int64) error {
+	allowed, err := sc.srvStore.HasAccess(gtx, serviceId, userId)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errx.Errf(core.ErrServiceAccessDenied,
+			"user '%d' is not allowed to use service '%d'", userId, serviceId)
+	}
+	return nil
+}
+
+func (sc *svcCtl) DefaultGroups(
+	gtx context.Context, tenantId int64) ([]int64, error) {
+	groups, err := sc.srvStore.DefaultGroups(gtx, tenantId)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "service.defaultGroups", data.M{
+			"tenantId": tenantId,
+		}).Commit(err)
+	}
+	return groups, nil
+}
+
 func (gc *svcCtl) GetPermissionForService(
 	gtx context.Context, userId, serviceId int64) ([]string, error) {
+	ev := core.NewEventAdder(gtx, "user.getPerms", data.M{
+		"userId":    userId,
+		"serviceId": serviceId,
+	})
+	if err := gc.CheckAccess(gtx, serviceId, userId); err != nil {
+		return nil, ev.Commit(err)
+	}
+
 	perms, err := gc.srvStore.GetPermissionForService(gtx, userId, serviceId)
 	if err != nil {
-		core.NewEventAdder(gtx, "user.getPerms", data.M{
-			"userId":    userId,
-			"serviceId": serviceId,
-		}).Commit(err)
+		return nil, ev.Commit(err)
+	}
+	return perms, nil
+}
+
+func (sc *svcCtl) HasPermission(
+	gtx context.Context, userId, serviceId int64, perm string) (bool, error) {
+	ev := core.NewEventAdder(gtx, "service.hasPerm", data.M{
+		"userId":    userId,
+		"serviceId": serviceId,
+		"perm":      perm,
+	})
+
+	results, err := sc.Check(gtx, serviceId, &core.CheckRequest{
+		UserId: userId,
+		Checks: []*core.PermCheck{{Perm: perm}},
+	})
+	if err != nil {
+		return false, ev.Commit(err)
+	}
+	return results[0].Allowed, nil
+}
+
+func (sc *svcCtl) ValidatePermissions(
+	gtx context.Context, serviceId int64, perms []string) error {
+	eval, err := sc.evaluator(gtx, serviceId)
+	if err != nil {
+		return err
+	}
+	return eval.validate(perms)
+}
+
+func (sc *svcCtl) Check(
+	gtx context.Context,
+	serviceId int64,
+	req *core.CheckRequest) ([]*core.CheckResult, error) {
+	ev := core.NewEventAdder(gtx, "service.check", data.M{
+		"userId":    req.UserId,
+		"serviceId": serviceId,
+		"numChecks": len(req.Checks),
+	})
+	if len(req.Checks) > maxChecks {
+		return nil, ev.Errf(core.ErrInvalidState,
+			"at most %d permissions can be checked at once, found %d",
+			maxChecks, len(req.Checks))
+	}
+
+	if err := sc.CheckAccess(gtx, serviceId, req.UserId); err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	eval, err := sc.evaluator(gtx, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	grants, err := sc.srvStore.PermissionGrants(gtx, req.UserId, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	perms := make([]string, 0, len(grants))
+	for _, g := range grants {
+		perms = append(perms, g.Perm)
+	}
+
+	results := make([]*core.CheckResult, 0, len(req.Checks))
+	for _, chk := range req.Checks {
+		res := &core.CheckResult{
+			Perm:     chk.Perm,
+			Resource: chk.Resource,
+		}
+		var grant string
+		grant, res.Allowed = eval.allows(perms, chk.Perm, chk.Resource)
+		if req.Explain && res.Allowed {
+			res.Grant = grant
+			for _, g := range grants {
+				if eval.implies(g.Perm, chk.Perm, chk.Resource) &&
+					!slices.Contains(res.Groups, g.GroupName) {
+					res.Groups = append(res.Groups, g.GroupName)
+				}
+			}
+		}
+		results = append(results, res)
+	}
+
+	if err := sc.applyPolicies(gtx, serviceId, req, results); err != nil {
+		return nil, ev.Commit(err)
+	}
+	return results, nil
+}
+
+// applyPolicies - attribute based policies can only take away permissions,
+// so they are evaluated only for the checks that are allowed by the groups
+func (sc *svcCtl) applyPolicies(
+	gtx context.Context,
+	serviceId int64,
+	req *core.CheckRequest,
+	results []*core.CheckResult) error {
+	allowed := make([]*core.PermCheck, 0, len(req.Checks))
+	indices := make([]int, 0, len(req.Checks))
+	for idx, res := range results {
+		if res.Allowed {
+			allowed = append(allowed, req.Checks[idx])
+			indices = append(indices, idx)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	user, err := core.UserCtlr(gtx).GetOne(gtx, req.UserId)
+	if err != nil {
+		return err
+	}
+	decisions, err := core.PolicyCtlr(gtx).Evaluate(
+		gtx, serviceId, user, allowed, req.Context)
+	if err != nil {
+		return err
+	}
+	for i, dec := range decisions {
+		res := results[indices[i]]
+		res.Allowed = dec.Allowed
+		if req.Explain {
+			res.Policy, res.Reason = dec.Policy, dec.Reason
+		}
+	}
+	return nil
+}
+
+func (sc *svcCtl) evaluator(
+	gtx context.Context, serviceId int64) (*evaluator, error) {
+	service, err := sc.srvStore.GetOne(gtx, serviceId)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get service '%d'", serviceId)
+	}
+	return newEvaluator(service.Name, &service.Permissions)
+}
+
+func checkAccessMode(service *core.Service) error {
+	switch service.AccessMode {
+	case "":
+		service.AccessMode = core.ServiceAccessOpen
+	case core.ServiceAccessOpen, core.ServiceAccessAllowlist:
+	default:
+		return errx.Errf(core.ErrInvalidState,
+			"invalid access mode '%s' for service '%s'",
+			service.AccessMode, service.Name)
+	}
+	return nil
+}
+
+func checkDefaultGroups(gtx context.Context, service *core.Service) error {
+	if service.DefaultGroups == nil {
+		service.DefaultGroups = data.Vec[int64]{}
+	}
+	for _, groupId := range service.DefaultGroups {
+		group, err := core.GroupCtlr(gtx).GetOne(gtx, groupId)
+		if err != nil {
+			return err
+		}
+		if int64(group.ServiceId) != service.Id {
+			return errx.Errf(core.ErrInvalidState,
+				"default group '%s' does not belong to service '%s'",
+				group.Name, service.Name)
+		}
 	}
-	return perms, err
+	return nil
 }
@@ -0,0 +1,169 @@
+package svcdx
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/errx"
+)
+
+var (
+	ErrInvalidPermission = errors.New("invalid permission")
+	ErrInvalidPermTree   = errors.New("invalid permission tree")
+)
+
+const (
+	wildcard = "*"
+	scopeSep = "@"
+
+	// idxPrefix - permissions of idx itself, other services can neither
+	// define nor grant them
+	idxPrefix = "idx."
+)
+
+// evaluator - resolves permissions against the permission tree of a service.
+// A grant implies every permission below it in the tree and a grant of the
+// form 'billing.*' implies every permission starting with 'billing.'
+type evaluator struct {
+	// parents - permission id to the id of the parent node, root nodes are
+	// mapped to an empty string
+	parents map[string]string
+
+	// service - name of the service the tree belongs to
+	service string
+}
+
+func newEvaluator(
+	service string, tree *auth.PermissionTree) (*evaluator, error) {
+	ev := &evaluator{
+		parents: map[string]string{},
+		service: service,
+	}
+	var walk func(parent string, nodes []*auth.PermissionNode) error
+	walk = func(parent string, nodes []*auth.PermissionNode) error {
+		for _, node := range nodes {
+			if node.PermId == "" || strings.Contains(node.PermId, wildcard) {
+				return errx.Errf(ErrInvalidPermTree,
+					"invalid permission id '%s' in node '%s'",
+					node.PermId, node.Name)
+			}
+			if ev.reserved(node.PermId) {
+				return errx.Errf(ErrInvalidPermTree,
+					"permission '%s' is reserved for idx", node.PermId)
+			}
+			if _, dup := ev.parents[node.PermId]; dup {
+				return errx.Errf(ErrInvalidPermTree,
+					"permission '%s' is defined more than once", node.PermId)
+			}
+			ev.parents[node.PermId] = parent
+			if err := walk(node.PermId, node.Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk("", tree.Permissions); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// allows - checks if any of the granted permissions implies the given
+// permission on the resource, gives back the grant that matched. Resource
+// is empty when the permission is checked without a resource
+func (ev *evaluator) allows(
+	granted []string, perm, resource string) (string, bool) {
+	for _, g := range granted {
+		if ev.implies(g, perm, resource) {
+			return g, true
+		}
+	}
+	return "", false
+}
+
+// implies - checks a single grant. Grants of the form 'perm@resource' apply
+// only to the given resource, resource may end with '*' to match a prefix
+func (ev *evaluator) implies(grant, perm, resource string) bool {
+	grantPerm, scope, scoped := strings.Cut(grant, scopeSep)
+	if scoped && !matchResource(scope, resource) {
+		return false
+	}
+
+	if grantPerm == wildcard {
+		return true
+	}
+	prefix, isWildcard := strings.CutSuffix(grantPerm, "."+wildcard)
+	if isWildcard {
+		return strings.HasPrefix(perm, prefix+".")
+	}
+
+	// Check the permission and its ancestors, visited map guards against
+	// trees that are invalid but got stored anyway
+	visited := map[string]bool{}
+	for cur := perm; cur != "" && !visited[cur]; cur = ev.parents[cur] {
+		if cur == grantPerm {
+			return true
+		}
+		visited[cur] = true
+	}
+	return false
+}
+
+func matchResource(scope, resource string) bool {
+	if resource == "" {
+		return false
+	}
+	if prefix, isWildcard := strings.CutSuffix(scope, wildcard); isWildcard {
+		return strings.HasPrefix(resource, prefix)
+	}
+	return scope == resource
+}
+
+// reserved - permission belongs to idx but the tree is of another service
+func (ev *evaluator) reserved(perm string) bool {
+	return ev.service != core.IdxService() &&
+		strings.HasPrefix(perm, idxPrefix)
+}
+
+// validate - checks that every permission is defined in the tree, wildcard
+// grants need to match at least one permission
+func (ev *evaluator) validate(grants []string) error {
+	for _, grant := range grants {
+		perm, scope, scoped := strings.Cut(grant, scopeSep)
+		if scoped && scope == "" {
+			return errx.Errf(ErrInvalidPermission,
+				"resource missing in scoped permission '%s'", grant)
+		}
+		if ev.reserved(perm) {
+			return errx.Errf(ErrInvalidPermission,
+				"permission '%s' is reserved for idx", perm)
+		}
+		if perm == wildcard {
+			continue
+		}
+		prefix, isWildcard := strings.CutSuffix(perm, "."+wildcard)
+		if !isWildcard {
+			if _, found := ev.parents[perm]; !found {
+				return errx.Errf(ErrInvalidPermission,
+					"permission '%s' is not defined by the service", perm)
+			}
+			continue
+		}
+
+		matched := false
+		for id := range ev.parents {
+			if strings.HasPrefix(id, prefix+".") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errx.Errf(ErrInvalidPermission,
+				"wildcard '%s' does not match any permission of the service",
+				perm)
+		}
+	}
+	return nil
+}
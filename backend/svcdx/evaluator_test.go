@@ -0,0 +1,271 @@
+package svcdx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/auth"
+)
+
+func node(
+	permId string, children ...*auth.PermissionNode) *auth.PermissionNode {
+	return &auth.PermissionNode{
+		PermId:   permId,
+		Name:     permId,
+		Children: children,
+	}
+}
+
+// testTree - billing with nested invoice permissions and a separate reports
+// permission
+func testTree() *auth.PermissionTree {
+	return &auth.PermissionTree{
+		Permissions: []*auth.PermissionNode{
+			node("billing",
+				node("billing.invoice",
+					node("billing.invoice.read"),
+					node("billing.invoice.write")),
+				node("billing.refund")),
+			node("reports"),
+		},
+	}
+}
+
+func TestEvaluatorAllows(t *testing.T) {
+	ev, err := newEvaluator("app", testTree())
+	if err != nil {
+		t.Fatalf("failed to create evaluator: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		granted  []string
+		perm     string
+		resource string
+		allowed  bool
+		grant    string
+	}{
+		{
+			name:    "exact grant",
+			granted: []string{"reports"},
+			perm:    "reports",
+			allowed: true,
+			grant:   "reports",
+		},
+		{
+			name:    "parent implies children",
+			granted: []string{"billing"},
+			perm:    "billing.invoice.write",
+			allowed: true,
+			grant:   "billing",
+		},
+		{
+			name:    "child does not imply parent",
+			granted: []string{"billing.invoice.read"},
+			perm:    "billing.invoice",
+		},
+		{
+			name:    "sibling is not implied",
+			granted: []string{"billing.invoice"},
+			perm:    "billing.refund",
+		},
+		{
+			name:    "wildcard matches prefix",
+			granted: []string{"billing.invoice.*"},
+			perm:    "billing.invoice.read",
+			allowed: true,
+			grant:   "billing.invoice.*",
+		},
+		{
+			name:    "wildcard does not match own prefix",
+			granted: []string{"billing.invoice.*"},
+			perm:    "billing.invoice",
+		},
+		{
+			name:    "wildcard needs a dot boundary",
+			granted: []string{"bill.*"},
+			perm:    "billing.refund",
+		},
+		{
+			name:    "global wildcard",
+			granted: []string{"*"},
+			perm:    "reports",
+			allowed: true,
+			grant:   "*",
+		},
+		{
+			name:     "scoped grant on matching resource",
+			granted:  []string{"billing@acme"},
+			perm:     "billing.refund",
+			resource: "acme",
+			allowed:  true,
+			grant:    "billing@acme",
+		},
+		{
+			name:     "scoped grant on other resource",
+			granted:  []string{"billing@acme"},
+			perm:     "billing.refund",
+			resource: "globex",
+		},
+		{
+			name:    "scoped grant without resource",
+			granted: []string{"billing@acme"},
+			perm:    "billing.refund",
+		},
+		{
+			name:     "scoped grant with resource prefix",
+			granted:  []string{"reports@team/*"},
+			perm:     "reports",
+			resource: "team/a",
+			allowed:  true,
+			grant:    "reports@team/*",
+		},
+		{
+			name:     "scoped wildcard grant",
+			granted:  []string{"billing.*@acme"},
+			perm:     "billing.invoice.read",
+			resource: "acme",
+			allowed:  true,
+			grant:    "billing.*@acme",
+		},
+		{
+			name:     "unscoped grant applies to any resource",
+			granted:  []string{"reports"},
+			perm:     "reports",
+			resource: "anything",
+			allowed:  true,
+			grant:    "reports",
+		},
+		{
+			name:     "first matching grant is reported",
+			granted:  []string{"reports@x", "billing.refund", "billing"},
+			perm:     "billing.refund",
+			resource: "y",
+			allowed:  true,
+			grant:    "billing.refund",
+		},
+		{
+			name: "no grants",
+			perm: "reports",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grant, allowed := ev.allows(test.granted, test.perm, test.resource)
+			if allowed != test.allowed || grant != test.grant {
+				t.Errorf("expected (%v, '%s'), got (%v, '%s')",
+					test.allowed, test.grant, allowed, grant)
+			}
+		})
+	}
+}
+
+func TestEvaluatorValidate(t *testing.T) {
+	ev, err := newEvaluator("app", testTree())
+	if err != nil {
+		t.Fatalf("failed to create evaluator: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		grants []string
+		valid  bool
+	}{
+		{"defined permissions", []string{"billing", "reports"}, true},
+		{"nested permission", []string{"billing.invoice.read"}, true},
+		{"wildcard", []string{"billing.*"}, true},
+		{"global wildcard", []string{"*"}, true},
+		{"scoped permission", []string{"billing@acme"}, true},
+		{"scoped wildcard", []string{"billing.*@acme*"}, true},
+		{"undefined permission", []string{"payroll"}, false},
+		{"wildcard without match", []string{"payroll.*"}, false},
+		{"wildcard of a leaf", []string{"reports.*"}, false},
+		{"scope without resource", []string{"billing@"}, false},
+		{"idx permission", []string{"idx.manageTenant"}, false},
+		{"idx wildcard", []string{"idx.*"}, false},
+		{"one invalid among valid", []string{"billing", "nope"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ev.validate(test.grants)
+			if test.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidPermission) {
+				t.Fatalf("expected invalid permission error, got '%v'", err)
+			}
+		})
+	}
+}
+
+func TestNewEvaluatorInvalidTrees(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		tree    *auth.PermissionTree
+		valid   bool
+	}{
+		{
+			name:    "empty tree",
+			service: "app",
+			tree:    &auth.PermissionTree{},
+			valid:   true,
+		},
+		{
+			name:    "missing permission id",
+			service: "app",
+			tree: &auth.PermissionTree{
+				Permissions: []*auth.PermissionNode{node("")},
+			},
+		},
+		{
+			name:    "wildcard in permission id",
+			service: "app",
+			tree: &auth.PermissionTree{
+				Permissions: []*auth.PermissionNode{node("billing.*")},
+			},
+		},
+		{
+			name:    "duplicate across branches",
+			service: "app",
+			tree: &auth.PermissionTree{
+				Permissions: []*auth.PermissionNode{
+					node("a", node("shared")),
+					node("b", node("shared")),
+				},
+			},
+		},
+		{
+			name:    "idx permission in another service",
+			service: "app",
+			tree: &auth.PermissionTree{
+				Permissions: []*auth.PermissionNode{
+					node("app", node("idx.manageTenant")),
+				},
+			},
+		},
+		{
+			name:    "idx permission in idx",
+			service: core.IdxService(),
+			tree: &auth.PermissionTree{
+				Permissions: []*auth.PermissionNode{node("idx.manageTenant")},
+			},
+			valid: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newEvaluator(test.service, test.tree)
+			if test.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidPermTree) {
+				t.Fatalf("expected invalid tree error, got '%v'", err)
+			}
+		})
+	}
+}
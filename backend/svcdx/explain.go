@@ -0,0 +1,159 @@
+package svcdx
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+)
+
+func (sc *svcCtl) Explain(
+	gtx context.Context, serviceId, userId int64) (*core.Explanation, error) {
+	ev := core.NewEventAdder(gtx, "service.explain", data.M{
+		"serviceId": serviceId,
+		"userId":    userId,
+	})
+
+	// Users can see where their own permissions come from
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if user.Id() != userId {
+		if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+			return nil, ev.Commit(err)
+		}
+	}
+
+	eval, err := sc.evaluator(gtx, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	grants, err := sc.srvStore.GrantPaths(gtx, serviceId, userId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	policies, err := enabledPolicies(gtx, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	out := &core.Explanation{
+		UserId:    userId,
+		ServiceId: serviceId,
+		Perms:     []*core.PermExplanation{},
+	}
+	for _, perm := range sortedKeys(eval.parents) {
+		pe := &core.PermExplanation{Perm: perm}
+		for _, g := range grants {
+			if eval.implies(g.Grant, perm, "") {
+				pe.Grants = append(pe.Grants, g)
+			}
+		}
+		if len(pe.Grants) != 0 {
+			pe.Policies = coveringPolicies(eval, policies, perm, "")
+			out.Perms = append(out.Perms, pe)
+		}
+	}
+
+	// Grants scoped to a resource only apply to that resource, so they are
+	// shown as they are given
+	for _, g := range grants {
+		perm, resource, scoped := strings.Cut(g.Grant, scopeSep)
+		if !scoped {
+			continue
+		}
+		idx := slices.IndexFunc(out.Perms, func(pe *core.PermExplanation) bool {
+			return pe.Perm == g.Grant
+		})
+		if idx == -1 {
+			out.Perms = append(out.Perms, &core.PermExplanation{
+				Perm:     g.Grant,
+				Policies: coveringPolicies(eval, policies, perm, resource),
+			})
+			idx = len(out.Perms) - 1
+		}
+		out.Perms[idx].Grants = append(out.Perms[idx].Grants, g)
+	}
+	return out, nil
+}
+
+func (sc *svcCtl) WhoHas(
+	gtx context.Context,
+	serviceId int64,
+	perm string) (*core.PermHolders, error) {
+	ev := core.NewEventAdder(gtx, "service.whoHas", data.M{
+		"serviceId": serviceId,
+		"perm":      perm,
+	})
+	if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	eval, err := sc.evaluator(gtx, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if err := eval.validate([]string{perm}); err != nil {
+		return nil, ev.Commit(err)
+	}
+	grants, err := sc.srvStore.GrantPaths(gtx, serviceId, 0)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	policies, err := enabledPolicies(gtx, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	base, resource, _ := strings.Cut(perm, scopeSep)
+	out := &core.PermHolders{
+		ServiceId: serviceId,
+		Perm:      perm,
+		Holders:   []*core.PermHolder{},
+		Policies:  coveringPolicies(eval, policies, base, resource),
+	}
+
+	// Grants are ordered by user
+	var holder *core.PermHolder
+	for _, g := range grants {
+		if !eval.implies(g.Grant, base, resource) {
+			continue
+		}
+		if holder == nil || holder.UserId != g.UserId {
+			holder = &core.PermHolder{
+				UserId:   g.UserId,
+				UserName: g.UserName,
+			}
+			out.Holders = append(out.Holders, holder)
+		}
+		holder.Grants = append(holder.Grants, g)
+	}
+	return out, nil
+}
+
+func enabledPolicies(
+	gtx context.Context, serviceId int64) ([]*core.Policy, error) {
+	policies, err := core.PolicyCtlr(gtx).GetForService(gtx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(policies, func(p *core.Policy) bool {
+		return !p.Enabled
+	}), nil
+}
+
+func coveringPolicies(
+	eval *evaluator,
+	policies []*core.Policy,
+	perm, resource string) []string {
+	names := make([]string, 0, len(policies))
+	for _, p := range policies {
+		if _, found := eval.allows(p.Perms, perm, resource); found {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
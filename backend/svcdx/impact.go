@@ -0,0 +1,247 @@
+package svcdx
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+func (sc *svcCtl) PreviewImpact(
+	gtx context.Context,
+	serviceId int64,
+	change *core.AccessChange) (*core.AccessImpact, error) {
+	ev := core.NewEventAdder(gtx, "service.previewImpact", data.M{
+		"serviceId": serviceId,
+		"change":    change,
+	})
+	if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	current, err := sc.evaluator(gtx, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	next := current
+	if change.Tree != nil {
+		if next, err = newEvaluator(current.service, change.Tree); err != nil {
+			return nil, ev.Commit(err)
+		}
+	}
+	if change.Perms != nil {
+		if err := next.validate(change.Perms); err != nil {
+			return nil, ev.Commit(err)
+		}
+	}
+
+	ag, err := sc.srvStore.accessGraph(gtx, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	before := map[int64]map[string]struct{}{}
+	for userId, grants := range ag.grants() {
+		before[userId] = current.effective(grants)
+	}
+	if err := ag.apply(change); err != nil {
+		return nil, ev.Commit(err)
+	}
+	after := map[int64]map[string]struct{}{}
+	for userId, grants := range ag.grants() {
+		after[userId] = next.effective(grants)
+	}
+
+	out := &core.AccessImpact{
+		ServiceId: serviceId,
+		Users:     []*core.UserImpact{},
+	}
+	for userId, name := range ag.users {
+		ui := &core.UserImpact{
+			UserId:   userId,
+			UserName: name,
+			Added:    missing(after[userId], before[userId]),
+			Removed:  missing(before[userId], after[userId]),
+		}
+		if len(ui.Added) != 0 || len(ui.Removed) != 0 {
+			out.Users = append(out.Users, ui)
+		}
+	}
+	slices.SortFunc(out.Users, func(a, b *core.UserImpact) int {
+		return strings.Compare(a.UserName, b.UserName)
+	})
+	if change.Tree != nil {
+		out.Orphaned = ag.orphaned(next)
+	}
+	return out, nil
+}
+
+// effective - permissions of the tree implied by the grants. Scoped grants
+// are kept as they are as long as the tree defines them
+func (ev *evaluator) effective(grants []string) map[string]struct{} {
+	out := map[string]struct{}{}
+	for perm := range ev.parents {
+		if _, found := ev.allows(grants, perm, ""); found {
+			out[perm] = struct{}{}
+		}
+	}
+	for _, g := range grants {
+		if strings.Contains(g, scopeSep) && ev.validate([]string{g}) == nil {
+			out[g] = struct{}{}
+		}
+	}
+	return out
+}
+
+// missing - sorted entries of a that are not in b
+func missing(a, b map[string]struct{}) []string {
+	out := []string{}
+	for _, perm := range sortedKeys(a) {
+		if _, found := b[perm]; !found {
+			out = append(out, perm)
+		}
+	}
+	return out
+}
+
+type accessGraph struct {
+	names map[int64]string
+	perms map[int64][]string
+
+	// parents - group to the groups it is a sub group of
+	parents map[int64][]int64
+
+	// members - group to its direct members
+	members map[int64][]int64
+	users   map[int64]string
+}
+
+func newAccessGraph() *accessGraph {
+	return &accessGraph{
+		names:   map[int64]string{},
+		perms:   map[int64][]string{},
+		parents: map[int64][]int64{},
+		members: map[int64][]int64{},
+		users:   map[int64]string{},
+	}
+}
+
+func (ag *accessGraph) addGroup(id int64, name string) {
+	ag.names[id] = name
+}
+
+// apply - applies the change to the group, the tree is left to the caller
+func (ag *accessGraph) apply(change *core.AccessChange) error {
+	groupId := change.GroupId
+	if groupId == 0 {
+		return nil
+	}
+	if _, found := ag.names[groupId]; !found {
+		return errx.Errf(core.ErrInvalidState,
+			"group '%d' does not belong to the service", groupId)
+	}
+	is := func(id int64) func(int64) bool {
+		return func(other int64) bool { return other == id }
+	}
+
+	if change.Perms != nil {
+		ag.perms[groupId] = slices.Clone(change.Perms)
+	}
+	for _, userId := range change.AddedUsers {
+		if !slices.Contains(ag.members[groupId], userId) {
+			ag.members[groupId] = append(ag.members[groupId], userId)
+		}
+		if _, found := ag.users[userId]; !found {
+			ag.users[userId] = ""
+		}
+	}
+	for _, userId := range change.RemovedUsers {
+		ag.members[groupId] = slices.DeleteFunc(
+			ag.members[groupId], is(userId))
+	}
+	for _, childId := range change.AddedSubGroups {
+		if !slices.Contains(ag.parents[childId], groupId) {
+			ag.parents[childId] = append(ag.parents[childId], groupId)
+		}
+	}
+	for _, childId := range change.RemovedSubGroups {
+		ag.parents[childId] = slices.DeleteFunc(
+			ag.parents[childId], is(groupId))
+	}
+	if change.RemoveGroup {
+		delete(ag.perms, groupId)
+		delete(ag.members, groupId)
+		delete(ag.parents, groupId)
+		for childId, parents := range ag.parents {
+			ag.parents[childId] = slices.DeleteFunc(parents, is(groupId))
+		}
+	}
+	return nil
+}
+
+// groups - groups each user is a member of along with the parents of those
+// groups at any depth
+func (ag *accessGraph) groups() map[int64]map[int64]bool {
+	direct := map[int64][]int64{}
+	for groupId, users := range ag.members {
+		for _, userId := range users {
+			direct[userId] = append(direct[userId], groupId)
+		}
+	}
+
+	out := make(map[int64]map[int64]bool, len(direct))
+	for userId, stack := range direct {
+		visited := map[int64]bool{}
+		for len(stack) != 0 {
+			groupId := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if visited[groupId] {
+				continue
+			}
+			visited[groupId] = true
+			stack = append(stack, ag.parents[groupId]...)
+		}
+		out[userId] = visited
+	}
+	return out
+}
+
+// grants - permissions given to each user by the groups of the user
+func (ag *accessGraph) grants() map[int64][]string {
+	groups := ag.groups()
+	out := make(map[int64][]string, len(groups))
+	for userId, ids := range groups {
+		grants := []string{}
+		for groupId := range ids {
+			grants = append(grants, ag.perms[groupId]...)
+		}
+		out[userId] = grants
+	}
+	return out
+}
+
+// orphaned - permissions of the groups that the tree of the evaluator does
+// not define
+func (ag *accessGraph) orphaned(ev *evaluator) []*core.OrphanedGrant {
+	out := []*core.OrphanedGrant{}
+	for groupId, perms := range ag.perms {
+		for _, perm := range perms {
+			if ev.validate([]string{perm}) != nil {
+				out = append(out, &core.OrphanedGrant{
+					GroupId:   groupId,
+					GroupName: ag.names[groupId],
+					Perm:      perm,
+				})
+			}
+		}
+	}
+	slices.SortFunc(out, func(a, b *core.OrphanedGrant) int {
+		if c := strings.Compare(a.GroupName, b.GroupName); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Perm, b.Perm)
+	})
+	return out
+}
@@ -0,0 +1,486 @@
+package svcdx
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+// groupSync - change to a group of the service, manifest is nil for groups
+// that are only pruned
+type groupSync struct {
+	manifest *core.GroupManifest
+	group    *core.Group
+	perms    []string
+	create   bool
+	save     bool
+	setPerms bool
+}
+
+// Sync - manifest is the source of truth for the permission tree, the groups
+// it lists and the default groups of the service. Groups missing from the
+// manifest are left alone apart from pruning their stale grants. Changes are
+// not applied in a single transaction, syncing again completes a sync that
+// failed midway
+func (sc *svcCtl) Sync(
+	gtx context.Context,
+	manifest *core.ServiceManifest,
+	opts *core.SyncOptions) (*core.SyncResult, error) {
+	ev := core.NewEventAdder(gtx, "service.sync", data.M{
+		"service": manifest.Name,
+		"dryRun":  opts.DryRun,
+		"prune":   opts.Prune,
+	})
+
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if err := validateManifest(manifest); err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	exists, err := sc.srvStore.Exists(gtx, manifest.Name)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	res := &core.SyncResult{
+		DryRun:  opts.DryRun,
+		Changes: make([]*core.SyncChange, 0, 20),
+	}
+	service := &core.Service{
+		Name:       manifest.Name,
+		AccessMode: core.ServiceAccessOpen,
+	}
+	groups := []*core.Group{}
+	if exists {
+		service, err = sc.srvStore.GetByName(gtx, manifest.Name)
+		if err != nil {
+			return nil, ev.Commit(err)
+		}
+		if err := core.CheckServiceAdmin(gtx, service.Id); err != nil {
+			return nil, ev.Commit(err)
+		}
+		groups, err = core.GroupCtlr(gtx).GetForService(gtx, service.Id)
+		if err != nil {
+			return nil, ev.Commit(err)
+		}
+		res.ServiceId = service.Id
+	} else if !auth.HasRole(user, auth.Admin) {
+		return nil, ev.Errf(core.ErrUnauthorized,
+			"user '%s' is not allowed to create service '%s'",
+			user.UName, manifest.Name)
+	} else {
+		res.Add(core.SyncCreate, "service", manifest.Name, "")
+	}
+
+	tree := mergeTree(
+		service.Permissions.Permissions, manifest.Permissions, opts.Prune)
+	eval, err := newEvaluator(manifest.Name, tree)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	serviceChanged := diffTree(
+		service.Permissions.Permissions,
+		manifest.Permissions,
+		tree.Permissions,
+		opts.Prune,
+		res)
+	if exists && service.DisplayName != manifest.DisplayName {
+		res.Add(core.SyncUpdate, "service", manifest.Name,
+			fmt.Sprintf("display name '%s'", manifest.DisplayName))
+		serviceChanged = true
+	}
+
+	syncs, err := sc.planGroups(gtx, service, groups, manifest, eval, res)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	pruned, err := planPrune(gtx, groups, manifest, eval, opts.Prune, res)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	syncs = append(syncs, pruned...)
+	defaultsChanged := diffDefaults(service, groups, manifest, res)
+
+	if opts.DryRun {
+		return res, ev.Commit(nil)
+	}
+
+	service.DisplayName = manifest.DisplayName
+	service.Permissions = *tree
+	if !exists {
+		id, err := sc.Save(gtx, service)
+		if err != nil {
+			return nil, ev.Commit(err)
+		}
+		service.Id, res.ServiceId = id, id
+	} else if serviceChanged {
+		if err := sc.Update(gtx, service); err != nil {
+			return nil, ev.Commit(err)
+		}
+	}
+
+	gctl := core.GroupCtlr(gtx)
+	for _, gs := range syncs {
+		switch {
+		case gs.create:
+			gs.group.ServiceId = int(service.Id)
+			gs.group.CreatedBy, gs.group.UpdatedBy = user.Id(), user.Id()
+			id, err := gctl.Save(gtx, gs.group)
+			if err != nil {
+				return nil, ev.Commit(err)
+			}
+			gs.group.Id = id
+		case gs.save:
+			gs.group.UpdatedBy = user.Id()
+			if err := gctl.Update(gtx, gs.group); err != nil {
+				return nil, ev.Commit(err)
+			}
+		}
+		if gs.setPerms {
+			err := gctl.SetPermissions(gtx, gs.group.Id, gs.perms)
+			if err != nil {
+				return nil, ev.Commit(err)
+			}
+		}
+	}
+
+	if defaultsChanged {
+		service.DefaultGroups = data.Vec[int64]{}
+		for _, gs := range syncs {
+			if gs.manifest != nil && gs.manifest.Default {
+				service.DefaultGroups = append(
+					service.DefaultGroups, gs.group.Id)
+			}
+		}
+		if err := sc.Update(gtx, service); err != nil {
+			return nil, ev.Commit(err)
+		}
+	}
+	return res, ev.Commit(nil)
+}
+
+// planGroups - creations and updates of the groups listed in the manifest
+func (sc *svcCtl) planGroups(
+	gtx context.Context,
+	service *core.Service,
+	groups []*core.Group,
+	manifest *core.ServiceManifest,
+	eval *evaluator,
+	res *core.SyncResult) ([]*groupSync, error) {
+
+	byName := make(map[string]*core.Group, len(groups))
+	for _, group := range groups {
+		byName[group.Name] = group
+	}
+
+	newNames := make([]string, 0, len(manifest.Groups))
+	for _, gm := range manifest.Groups {
+		if byName[gm.Name] == nil {
+			newNames = append(newNames, gm.Name)
+		}
+	}
+	if len(newNames) != 0 {
+		taken, err := sc.srvStore.GroupNamesTaken(gtx, service.Id, newNames)
+		if err != nil {
+			return nil, err
+		}
+		if len(taken) != 0 {
+			return nil, errx.Errf(core.ErrEntityExists,
+				"groups '%s' belong to other services",
+				strings.Join(taken, ", "))
+		}
+	}
+
+	syncs := make([]*groupSync, 0, len(manifest.Groups))
+	for _, gm := range manifest.Groups {
+		if err := eval.validate(gm.Perms); err != nil {
+			return nil, errx.Errf(err, "invalid permissions for group '%s'",
+				gm.Name)
+		}
+
+		gs := &groupSync{
+			manifest: gm,
+			group:    byName[gm.Name],
+			perms:    gm.Perms,
+		}
+		syncs = append(syncs, gs)
+
+		if gs.group == nil {
+			gs.group = &core.Group{
+				Name:        gm.Name,
+				DisplayName: gm.DisplayName,
+				Description: gm.Description,
+			}
+			gs.create, gs.setPerms = true, len(gm.Perms) != 0
+			res.Add(core.SyncCreate, "group", gm.Name,
+				strings.Join(gm.Perms, ", "))
+			continue
+		}
+
+		if gs.group.DisplayName != gm.DisplayName ||
+			gs.group.Description != gm.Description {
+			gs.group.DisplayName = gm.DisplayName
+			gs.group.Description = gm.Description
+			gs.save = true
+			res.Add(core.SyncUpdate, "group", gm.Name,
+				"display name or description")
+		}
+
+		current, err := core.GroupCtlr(gtx).GetPermissions(gtx, gs.group.Id)
+		if err != nil {
+			return nil, err
+		}
+		if !sameSet(current, gm.Perms) {
+			gs.setPerms = true
+			res.Add(core.SyncUpdate, "groupPerms", gm.Name,
+				strings.Join(gm.Perms, ", "))
+		}
+	}
+	return syncs, nil
+}
+
+// planPrune - groups missing from the manifest are reported as stale, while
+// pruning the grants that are no longer in the tree are removed from them
+func planPrune(
+	gtx context.Context,
+	groups []*core.Group,
+	manifest *core.ServiceManifest,
+	eval *evaluator,
+	prune bool,
+	res *core.SyncResult) ([]*groupSync, error) {
+
+	declared := make(map[string]bool, len(manifest.Groups))
+	for _, gm := range manifest.Groups {
+		declared[gm.Name] = true
+	}
+
+	syncs := make([]*groupSync, 0, len(groups))
+	for _, group := range groups {
+		if declared[group.Name] {
+			continue
+		}
+		if !prune {
+			res.Add(core.SyncStale, "group", group.Name, "not in manifest")
+			continue
+		}
+
+		current, err := core.GroupCtlr(gtx).GetPermissions(gtx, group.Id)
+		if err != nil {
+			return nil, err
+		}
+		kept := make([]string, 0, len(current))
+		removed := make([]string, 0, len(current))
+		for _, perm := range current {
+			if eval.validate([]string{perm}) == nil {
+				kept = append(kept, perm)
+			} else {
+				removed = append(removed, perm)
+			}
+		}
+		if len(removed) != 0 {
+			syncs = append(syncs, &groupSync{
+				group:    group,
+				perms:    kept,
+				setPerms: true,
+			})
+			res.Add(core.SyncRemove, "groupPerms", group.Name,
+				strings.Join(removed, ", "))
+		}
+	}
+	return syncs, nil
+}
+
+func diffDefaults(
+	service *core.Service,
+	groups []*core.Group,
+	manifest *core.ServiceManifest,
+	res *core.SyncResult) bool {
+	names := make(map[int64]string, len(groups))
+	for _, group := range groups {
+		names[group.Id] = group.Name
+	}
+
+	current := make([]string, 0, len(service.DefaultGroups))
+	for _, id := range service.DefaultGroups {
+		if name, found := names[id]; found {
+			current = append(current, name)
+		}
+	}
+	desired := make([]string, 0, len(manifest.Groups))
+	for _, gm := range manifest.Groups {
+		if gm.Default {
+			desired = append(desired, gm.Name)
+		}
+	}
+
+	if sameSet(current, desired) {
+		return false
+	}
+	res.Add(core.SyncUpdate, "defaultGroups", manifest.Name,
+		strings.Join(desired, ", "))
+	return true
+}
+
+func validateManifest(manifest *core.ServiceManifest) error {
+	if manifest.Name == "" {
+		return errx.Errf(core.ErrInvalidState,
+			"service name is missing in the manifest")
+	}
+	tree := &auth.PermissionTree{Permissions: manifest.Permissions}
+	if _, err := newEvaluator(manifest.Name, tree); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(manifest.Groups))
+	for _, gm := range manifest.Groups {
+		if gm.Name == "" {
+			return errx.Errf(core.ErrInvalidState,
+				"group without name in the manifest of '%s'", manifest.Name)
+		}
+		if names[gm.Name] {
+			return errx.Errf(core.ErrInvalidState,
+				"group '%s' is declared more than once", gm.Name)
+		}
+		names[gm.Name] = true
+	}
+	return nil
+}
+
+// mergeTree - permission tree declared in the manifest. Unless pruning, the
+// stored permissions missing from the manifest are kept under their original
+// parent or at the root if the parent is not in the tree
+func mergeTree(
+	stored, declared []*auth.PermissionNode,
+	prune bool) *auth.PermissionTree {
+	tree := &auth.PermissionTree{Permissions: cloneNodes(declared)}
+	if prune {
+		return tree
+	}
+
+	nodes := map[string]*auth.PermissionNode{}
+	var index func(list []*auth.PermissionNode)
+	index = func(list []*auth.PermissionNode) {
+		for _, node := range list {
+			nodes[node.PermId] = node
+			index(node.Children)
+		}
+	}
+	index(tree.Permissions)
+
+	var keep func(parent string, list []*auth.PermissionNode)
+	keep = func(parent string, list []*auth.PermissionNode) {
+		for _, node := range list {
+			if _, found := nodes[node.PermId]; !found {
+				kept := &auth.PermissionNode{
+					PermId:     node.PermId,
+					Name:       node.Name,
+					Predefined: node.Predefined,
+				}
+				if p := nodes[parent]; p != nil {
+					p.AddChild(kept)
+				} else {
+					tree.Permissions = append(tree.Permissions, kept)
+				}
+				nodes[node.PermId] = kept
+			}
+			keep(node.PermId, node.Children)
+		}
+	}
+	keep("", stored)
+	return tree
+}
+
+func cloneNodes(list []*auth.PermissionNode) []*auth.PermissionNode {
+	cloned := make([]*auth.PermissionNode, 0, len(list))
+	for _, node := range list {
+		cloned = append(cloned, &auth.PermissionNode{
+			Id:         node.Id,
+			PermId:     node.PermId,
+			Name:       node.Name,
+			Predefined: node.Predefined,
+			Children:   cloneNodes(node.Children),
+		})
+	}
+	return cloned
+}
+
+type permEntry struct {
+	parent string
+	name   string
+}
+
+func flattenTree(list []*auth.PermissionNode) map[string]permEntry {
+	entries := map[string]permEntry{}
+	var walk func(parent string, list []*auth.PermissionNode)
+	walk = func(parent string, list []*auth.PermissionNode) {
+		for _, node := range list {
+			entries[node.PermId] = permEntry{parent: parent, name: node.Name}
+			walk(node.PermId, node.Children)
+		}
+	}
+	walk("", list)
+	return entries
+}
+
+// diffTree - records the changes to the permissions, gives back true if the
+// stored tree has to be replaced with the result
+func diffTree(
+	stored, declared, result []*auth.PermissionNode,
+	prune bool,
+	res *core.SyncResult) bool {
+	before := flattenTree(stored)
+	inManifest := flattenTree(declared)
+	after := flattenTree(result)
+
+	changed := false
+	for _, id := range sortedKeys(after) {
+		old, found := before[id]
+		cur := after[id]
+		switch {
+		case !found:
+			res.Add(core.SyncCreate, "permission", id, cur.name)
+			changed = true
+		case old != cur:
+			res.Add(core.SyncUpdate, "permission", id,
+				fmt.Sprintf("name '%s', parent '%s'", cur.name, cur.parent))
+			changed = true
+		}
+	}
+	for _, id := range sortedKeys(before) {
+		if _, found := inManifest[id]; found {
+			continue
+		}
+		if prune {
+			res.Add(core.SyncRemove, "permission", id, "")
+			changed = true
+		} else {
+			res.Add(core.SyncStale, "permission", id, "not in manifest")
+		}
+	}
+	return changed
+}
+
+func sortedKeys[V any](entries map[string]V) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func sameSet(a, b []string) bool {
+	sa, sb := slices.Clone(a), slices.Clone(b)
+	slices.Sort(sa)
+	slices.Sort(sb)
+	return slices.Equal(slices.Compact(sa), slices.Compact(sb))
+}
@@ -7,4 +7,7 @@ const (
 	PermGetService            = "idx.getService"
 	PermModifyServicePermTree = "idx.modifyServicePermTree"
 	PermServiceAdmin          = "idx.serviceAdmin"
+	PermManagePolicy          = "idx.managePolicy"
+	PermManageSod             = "idx.manageSod"
+	PermServiceManageAccess   = "idx.serviceManageAccess"
 )
@@ -21,28 +21,37 @@ func NewServiceStorage(gd data.GetterDeleter) *PgServiceStorage {
 
 func (pss *PgServiceStorage) Save(
 	gtx context.Context, service *core.Service) (int64, error) {
+	service.TenantId = core.TenantFor(gtx, service.TenantId)
 	query := `
 		INSERT INTO idx_service (
+			tenant_id,
 			created_by,
 			updated_by,
 			name,
 			owner_id,
 			display_name,
-			permissions	
+			permissions,
+			access_mode,
+			default_groups
 		) VALUES (
+			:tenant_id,
 			:created_by,
 			:updated_by,
 			:name,
 			:owner_id,
 			:display_name,
-			:permissions	
+			:permissions,
+			:access_mode,
+			:default_groups
 		) ON CONFLICT (id) DO UPDATE SET
 				created_by = EXCLUDED.created_by,
 				updated_by = EXCLUDED.updated_by,
 				name = EXCLUDED.name,
 				owner_id = EXCLUDED.owner_id,
 				display_name = EXCLUDED.display_name,
-				permissions = EXCLUDED.permissions
+				permissions = EXCLUDED.permissions,
+				access_mode = EXCLUDED.access_mode,
+				default_groups = EXCLUDED.default_groups
 		RETURNING id;
 	`
 
@@ -74,9 +83,10 @@ func (pss *PgServiceStorage) Update(
 			name = :name,
 			owner_id = :owner_id,
 			display_name = :display_name,
-			permissions = :permissions	
-		WHERE id = :id	
-	`
+			permissions = :permissions,
+			access_mode = :access_mode,
+			default_groups = :default_groups
+		WHERE id = :id AND ` + core.TenantCond(gtx, "tenant_id")
 	if _, err := pg.Conn().NamedExecContext(gtx, query, service); err != nil {
 		return errx.Errf(
 			err, "failed to update user '%s' to database", service.Id)
@@ -88,7 +98,8 @@ func (pss *PgServiceStorage) GetOne(
 	gtx context.Context,
 	id int64) (*core.Service, error) {
 	var service core.Service
-	err := pss.gd.GetOne(gtx, "idx_service", "id", id, &service)
+	err := pss.gd.GetOne(
+		gtx, core.TenantTable(gtx, "idx_service"), "id", id, &service)
 	if err != nil {
 		return nil, err
 	}
@@ -98,8 +109,10 @@ func (pss *PgServiceStorage) GetOne(
 func (pss *PgServiceStorage) Remove(
 	gtx context.Context,
 	id int64) error {
-	if err := pss.gd.Delete(gtx, "idx_service", "id"); err != nil {
-		return errx.Wrap(err)
+	query := `DELETE FROM idx_service WHERE id = $1 AND ` +
+		core.TenantCond(gtx, "tenant_id")
+	if _, err := pg.Conn().ExecContext(gtx, query, id); err != nil {
+		return errx.Errf(err, "failed to remove service '%d'", id)
 	}
 	return nil
 }
@@ -109,12 +122,14 @@ func (pss *PgServiceStorage) Get(
 	params *data.CommonParams) ([]*core.Service, error) {
 	out := make([]*core.Service, 0, params.PageSize)
 
-	if err := pss.gd.Get(gtx, "idx_service", params, &out); err != nil {
+	table := core.TenantTable(gtx, "idx_service")
+	if err := pss.gd.Get(gtx, table, params, &out); err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
+// Exists - service names are unique across tenants, hence not scoped
 func (pss *PgServiceStorage) Exists(
 	gtx context.Context, name string) (bool, error) {
 	return pss.gd.Exists(gtx, "idx_service", "name", name)
@@ -122,13 +137,14 @@ func (pss *PgServiceStorage) Exists(
 
 func (pss *PgServiceStorage) Count(
 	gtx context.Context, filter *data.Filter) (int64, error) {
-	return pss.gd.Count(gtx, "idx_service", filter)
+	return pss.gd.Count(gtx, core.TenantTable(gtx, "idx_service"), filter)
 }
 
 func (pss *PgServiceStorage) GetByName(
 	gtx context.Context, name string) (*core.Service, error) {
 	var service core.Service
-	err := pss.gd.GetOne(gtx, "idx_service", "name", name, &service)
+	err := pss.gd.GetOne(
+		gtx, core.TenantTable(gtx, "idx_service"), "name", name, &service)
 	if err != nil {
 		return nil, errx.Errf(err, "failed to get service with name '%s'", name)
 	}
@@ -137,10 +153,10 @@ func (pss *PgServiceStorage) GetByName(
 
 func (pss *PgServiceStorage) GetForOwner(
 	gtx context.Context, ownerId string) ([]*core.Service, error) {
-	const query = `
+	query := `
 		SELECT * 
 		FROM idx_service
-		WHERE owner_id = $1
+		WHERE owner_id = $1 AND ` + core.TenantCond(gtx, "tenant_id") + `
 		ORDER BY updated_on DESC
 	`
 
@@ -154,10 +170,13 @@ func (pss *PgServiceStorage) GetForOwner(
 
 func (pss *PgServiceStorage) AddAdmin(
 	gtx context.Context, serviceId, userId int64) error {
+	if err := pss.checkSameTenant(gtx, serviceId, userId); err != nil {
+		return err
+	}
 	const query = `
 		INSERT INTO service_to_owner(
-			user_id,
-			group_id
+			service_id,
+			admin_id
 		) VALUES (
 			$1,
 			$2
@@ -174,11 +193,11 @@ func (pss *PgServiceStorage) AddAdmin(
 
 func (pss *PgServiceStorage) GetAdmins(
 	gtx context.Context, serviceId int64) ([]*core.User, error) {
-	const query = `
+	query := `
 		SELECT u.* 
 		FROM idx_user u
 		JOIN service_to_owner so ON u.id = so.admin_id
-		WHERE service_id = $1
+		WHERE service_id = $1 AND ` + core.TenantCond(gtx, "u.tenant_id") + `
 		ORDER BY admin_id DESC
 	`
 
@@ -188,14 +207,15 @@ func (pss *PgServiceStorage) GetAdmins(
 		return nil, errx.Errf(err, "failed to get admins for %d", serviceId)
 	}
 
-	return nil, nil
+	return admins, nil
 }
 
 func (pss *PgServiceStorage) RemoveAdmin(
 	gtx context.Context, serviceId, userId int64) error {
-	const query = `
-		DELETE FROM service_to_owner WHERE service_id = $1 AND admin_id = $2
-	`
+	query := `
+		DELETE FROM service_to_owner
+		WHERE service_id = $1 AND admin_id = $2 AND ` +
+		core.TenantServiceCond(gtx, "service_id")
 	_, err := pg.Conn().ExecContext(gtx, query, serviceId, userId)
 	if err != nil {
 		return errx.Errf(err,
@@ -216,33 +236,207 @@ func (pss *PgServiceStorage) IsAdmin(
 			FROM service_to_owner 
 			WHERE 
 				service_id = $1 AND
-				owner_id = $2
+				admin_id = $2
 		)
 	`
 
 	isAdmin := false
-	err := pg.Conn().SelectContext(gtx, &isAdmin, query, adminId)
+	err := pg.Conn().GetContext(gtx, &isAdmin, query, serviceId, adminId)
 	if err != nil {
 		return false, errx.Errf(err,
-			"failed to check if '%s' is an admin of service '%d'",
-			serviceId,
+			"failed to check if '%d' is an admin of service '%d'",
 			adminId,
+			serviceId,
 		)
 	}
 	return isAdmin, nil
 }
 
+func (pss *PgServiceStorage) GrantAccess(
+	gtx context.Context, serviceId, userId, grantedBy int64) error {
+	if err := pss.checkSameTenant(gtx, serviceId, userId); err != nil {
+		return err
+	}
+	const query = `
+		INSERT INTO user_to_service(
+			service_id,
+			user_id,
+			granted_by
+		) VALUES (
+			$1,
+			$2,
+			$3
+		) ON CONFLICT DO NOTHING
+	`
+	_, err := pg.Conn().ExecContext(gtx, query, serviceId, userId, grantedBy)
+	if err != nil {
+		return errx.Errf(err,
+			"failed to allow user '%d' to use service '%d'", userId, serviceId)
+	}
+	return nil
+}
+
+func (pss *PgServiceStorage) RevokeAccess(
+	gtx context.Context, serviceId, userId int64) error {
+	query := `
+		DELETE FROM user_to_service
+		WHERE service_id = $1 AND user_id = $2 AND ` +
+		core.TenantServiceCond(gtx, "service_id")
+	_, err := pg.Conn().ExecContext(gtx, query, serviceId, userId)
+	if err != nil {
+		return errx.Errf(err,
+			"failed to revoke access of user '%d' to service '%d'",
+			userId, serviceId)
+	}
+	return nil
+}
+
+func (pss *PgServiceStorage) GetAllowedUsers(
+	gtx context.Context, serviceId int64) ([]*core.User, error) {
+	query := `
+		SELECT u.*
+		FROM idx_user u
+		JOIN user_to_service u2s ON u.id = u2s.user_id
+		WHERE u2s.service_id = $1 AND ` + core.TenantCond(gtx, "u.tenant_id") + `
+		ORDER BY u.user_name
+	`
+	users := make([]*core.User, 0, 100)
+	err := pg.Conn().SelectContext(gtx, &users, query, serviceId)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get users allowed to use service '%d'", serviceId)
+	}
+	return users, nil
+}
+
+// HasAccess - any user of the tenant of the service has access to an open
+// service, for others the user should be in the allowlist or be an admin of
+// the service
+func (pss *PgServiceStorage) HasAccess(
+	gtx context.Context, serviceId, userId int64) (bool, error) {
+	const query = `
+		SELECT EXISTS(
+			SELECT 1
+			FROM idx_service s
+			JOIN idx_user u ON u.tenant_id = s.tenant_id
+			WHERE
+				s.id = $1 AND
+				u.id = $2 AND (
+					s.access_mode = 'open' OR
+					EXISTS(
+						SELECT 1 FROM user_to_service
+						WHERE service_id = s.id AND user_id = $2
+					) OR
+					EXISTS(
+						SELECT 1 FROM service_to_owner
+						WHERE service_id = s.id AND admin_id = $2
+					)
+				)
+		)
+	`
+	allowed := false
+	err := pg.Conn().GetContext(gtx, &allowed, query, serviceId, userId)
+	if err != nil {
+		return false, errx.Errf(err,
+			"failed to check access of user '%d' to service '%d'",
+			userId, serviceId)
+	}
+	return allowed, nil
+}
+
+// DefaultGroups - default groups of all the services of the tenant. Groups
+// that are removed or moved to another service after being made default are
+// skipped
+func (pss *PgServiceStorage) DefaultGroups(
+	gtx context.Context, tenantId int64) ([]int64, error) {
+	const query = `
+		SELECT DISTINCT g.id
+		FROM idx_service s
+		CROSS JOIN UNNEST(s.default_groups) AS dg(group_id)
+		JOIN idx_group g ON g.id = dg.group_id AND g.service_id = s.id
+		WHERE s.tenant_id = $1
+		ORDER BY g.id
+	`
+	groups := make([]int64, 0, 20)
+	err := pg.Conn().SelectContext(gtx, &groups, query, tenantId)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get default groups of services of tenant '%d'",
+			tenantId)
+	}
+	return groups, nil
+}
+
+// GroupNamesTaken - names among the given ones that are used by groups of
+// other services, group names are unique across services
+func (pss *PgServiceStorage) GroupNamesTaken(
+	gtx context.Context, serviceId int64, names []string) ([]string, error) {
+	const query = `
+		SELECT name FROM idx_group WHERE name = ANY($1) AND service_id <> $2
+	`
+	taken := make([]string, 0, len(names))
+	err := pg.Conn().SelectContext(
+		gtx, &taken, query, data.Vec[string](names), serviceId)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to check names of groups")
+	}
+	return taken, nil
+}
+
+// checkSameTenant - users can only be given roles in the services of their
+// own tenant
+func (pss *PgServiceStorage) checkSameTenant(
+	gtx context.Context, serviceId, userId int64) error {
+	const query = `
+		SELECT EXISTS(
+			SELECT 1
+			FROM idx_service s
+			JOIN idx_user u ON u.tenant_id = s.tenant_id
+			WHERE s.id = $1 AND u.id = $2
+		)
+	`
+	same := false
+	err := pg.Conn().GetContext(gtx, &same, query, serviceId, userId)
+	if err != nil {
+		return errx.Errf(err,
+			"failed to check tenant of user '%d' and service '%d'",
+			userId, serviceId)
+	}
+	if !same {
+		return errx.Errf(core.ErrInvalidState,
+			"user '%d' and service '%d' do not belong to the same tenant",
+			userId, serviceId)
+	}
+	return nil
+}
+
+// userGroupsCTE - groups the user given by the first argument is a member of,
+// directly or through nested groups. Only the memberships that are currently
+// valid are considered. UNION stops the recursion even if the group relations
+// form a cycle
+const userGroupsCTE = `
+	WITH RECURSIVE user_group(group_id) AS (
+		SELECT group_id FROM user_to_group
+		WHERE
+			user_id = $1 AND
+			valid_from <= NOW() AND
+			(valid_until IS NULL OR valid_until > NOW())
+		UNION
+		SELECT g2g.parent_id
+		FROM group_to_group g2g
+		JOIN user_group ug ON g2g.child_id = ug.group_id
+	)
+`
+
 func (pgs *PgServiceStorage) GetPermissionForService(
 	gtx context.Context, userId, serviceId int64) ([]string, error) {
-	query := `
-		SELECT
-			perm_id
+	query := userGroupsCTE + `
+		SELECT DISTINCT
+			g2p.perm_id
 		FROM group_to_perm g2p
 		JOIN idx_group g ON g.id = g2p.group_id
-		JOIN user_to_group u2g ON g.id = u2g.group_id
-		JOIN idx_user u ON u.id = u2g.id
-		JOIN service_to_group s2g ON s2g.group_id = g.id
-		WHERE u.user_id = $1 AND s2g.service_id = $2
+		JOIN user_group ug ON g.id = ug.group_id
+		WHERE g.service_id = $2
 	`
 
 	perms := make([]string, 0, 50)
@@ -251,9 +445,160 @@ func (pgs *PgServiceStorage) GetPermissionForService(
 		return nil,
 			errx.Errf(
 				err,
-				"failed to get permissions of user '%s' for service '%s'",
+				"failed to get permissions of user '%d' for service '%d'",
 				userId, serviceId)
 
 	}
 	return perms, nil
 }
+
+// PermissionGrants - permissions of the user in the service along with the
+// groups that grant them
+func (pgs *PgServiceStorage) PermissionGrants(
+	gtx context.Context, userId, serviceId int64) ([]*core.PermGrant, error) {
+	query := userGroupsCTE + `
+		SELECT
+			g.id AS group_id,
+			g.name AS group_name,
+			g2p.perm_id
+		FROM group_to_perm g2p
+		JOIN idx_group g ON g.id = g2p.group_id
+		JOIN user_group ug ON g.id = ug.group_id
+		WHERE g.service_id = $2
+		ORDER BY g.name, g2p.perm_id
+	`
+
+	grants := make([]*core.PermGrant, 0, 50)
+	err := pg.Conn().SelectContext(gtx, &grants, query, userId, serviceId)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get permission grants of user '%d' for service '%d'",
+			userId, serviceId)
+	}
+	return grants, nil
+}
+
+// GrantPaths - permissions given through the groups of the service along with
+// the chain of groups each of them is given through. Chains are built from
+// the granting groups down to the groups the users are members of, so that
+// only the relevant part of the group hierarchy is visited. Limited to the
+// given user unless the user id is zero
+func (pss *PgServiceStorage) GrantPaths(
+	gtx context.Context, serviceId, userId int64) ([]*core.GrantPath, error) {
+	const query = `
+		WITH RECURSIVE granting(group_id, path) AS (
+			SELECT g.id, ARRAY[g.id]
+			FROM idx_group g
+			WHERE
+				g.service_id = $1 AND
+				EXISTS(SELECT 1 FROM group_to_perm WHERE group_id = g.id)
+			UNION ALL
+			SELECT g2g.child_id, g2g.child_id || gr.path
+			FROM group_to_group g2g
+			JOIN granting gr ON g2g.parent_id = gr.group_id
+			WHERE NOT g2g.child_id = ANY(gr.path)
+		)
+		SELECT
+			u.id AS user_id,
+			u.user_name,
+			g2p.perm_id,
+			ARRAY(
+				SELECT pg.name
+				FROM idx_group pg
+				WHERE pg.id = ANY(gr.path)
+				ORDER BY array_position(gr.path, pg.id)
+			) AS groups
+		FROM granting gr
+		JOIN user_to_group u2g ON u2g.group_id = gr.group_id
+		JOIN idx_user u ON u.id = u2g.user_id
+		JOIN group_to_perm g2p ON g2p.group_id = gr.path[cardinality(gr.path)]
+		WHERE
+			($2 = 0 OR u2g.user_id = $2) AND
+			u2g.valid_from <= NOW() AND
+			(u2g.valid_until IS NULL OR u2g.valid_until > NOW())
+		ORDER BY u.user_name, g2p.perm_id, cardinality(gr.path)
+	`
+	paths := make([]*core.GrantPath, 0, 50)
+	err := pg.Conn().SelectContext(gtx, &paths, query, serviceId, userId)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get grants of service '%d'", serviceId)
+	}
+	return paths, nil
+}
+
+// accessGraph - groups of the service with their permissions, sub groups and
+// current members, everything needed to compute the effective permissions
+// of the users of the service without going back to the database
+func (pss *PgServiceStorage) accessGraph(
+	gtx context.Context, serviceId int64) (*accessGraph, error) {
+	grants := []struct {
+		GroupId   int64  `db:"group_id"`
+		GroupName string `db:"group_name"`
+		Perm      string `db:"perm_id"`
+	}{}
+	query := `
+		SELECT
+			g.id AS group_id,
+			g.name AS group_name,
+			COALESCE(g2p.perm_id, '') AS perm_id
+		FROM idx_group g
+		LEFT JOIN group_to_perm g2p ON g2p.group_id = g.id
+		WHERE g.service_id = $1
+	`
+	if err := pg.Conn().SelectContext(gtx, &grants, query, serviceId); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get group permissions of service '%d'", serviceId)
+	}
+
+	edges := []struct {
+		ParentId int64 `db:"parent_id"`
+		ChildId  int64 `db:"child_id"`
+	}{}
+	query = `
+		SELECT g2g.parent_id, g2g.child_id
+		FROM group_to_group g2g
+		JOIN idx_group g ON g.id = g2g.parent_id
+		WHERE g.service_id = $1
+	`
+	if err := pg.Conn().SelectContext(gtx, &edges, query, serviceId); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get sub groups of service '%d'", serviceId)
+	}
+
+	members := []struct {
+		GroupId  int64  `db:"group_id"`
+		UserId   int64  `db:"user_id"`
+		UserName string `db:"user_name"`
+	}{}
+	query = `
+		SELECT u2g.group_id, u.id AS user_id, u.user_name
+		FROM user_to_group u2g
+		JOIN idx_group g ON g.id = u2g.group_id
+		JOIN idx_user u ON u.id = u2g.user_id
+		WHERE
+			g.service_id = $1 AND
+			u2g.valid_from <= NOW() AND
+			(u2g.valid_until IS NULL OR u2g.valid_until > NOW())
+	`
+	if err := pg.Conn().SelectContext(gtx, &members, query, serviceId); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get group members of service '%d'", serviceId)
+	}
+
+	ag := newAccessGraph()
+	for _, g := range grants {
+		ag.addGroup(g.GroupId, g.GroupName)
+		if g.Perm != "" {
+			ag.perms[g.GroupId] = append(ag.perms[g.GroupId], g.Perm)
+		}
+	}
+	for _, e := range edges {
+		ag.parents[e.ChildId] = append(ag.parents[e.ChildId], e.ParentId)
+	}
+	for _, m := range members {
+		ag.users[m.UserId] = m.UserName
+		ag.members[m.GroupId] = append(ag.members[m.GroupId], m.UserId)
+	}
+	return ag, nil
+}
@@ -0,0 +1,442 @@
+package svcdx
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+type PgPolicyStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewPolicyStorage(gd data.GetterDeleter) *PgPolicyStorage {
+	return &PgPolicyStorage{
+		gd: gd,
+	}
+}
+
+func (pps *PgPolicyStorage) Save(
+	gtx context.Context, policy *core.Policy) (int64, error) {
+	query := `
+		INSERT INTO idx_policy (
+			created_by,
+			updated_by,
+			service_id,
+			name,
+			description,
+			effect,
+			perms,
+			condition,
+			enabled
+		) VALUES (
+			:created_by,
+			:updated_by,
+			:service_id,
+			:name,
+			:description,
+			:effect,
+			:perms,
+			:condition,
+			:enabled
+		) RETURNING id;
+	`
+
+	stmt, err := pg.Conn().PrepareNamed(query)
+	if err != nil {
+		return -1, errx.Errf(err, "failed to prepare query to save policy")
+	}
+
+	var id int64
+	if err = stmt.GetContext(gtx, &id, policy); err != nil {
+		return -1, errx.Errf(err,
+			"failed to insert policy '%s' to database", policy.Name)
+	}
+	return id, nil
+}
+
+func (pps *PgPolicyStorage) Update(
+	gtx context.Context, policy *core.Policy) error {
+	policy.UpdatedOn = time.Now()
+	query := `
+		UPDATE idx_policy SET
+			updated_by = :updated_by,
+			updated_on = :updated_on,
+			name = :name,
+			description = :description,
+			effect = :effect,
+			perms = :perms,
+			condition = :condition,
+			enabled = :enabled
+		WHERE id = :id
+	`
+	if _, err := pg.Conn().NamedExecContext(gtx, query, policy); err != nil {
+		return errx.Errf(err, "failed to update policy '%s'", policy.Name)
+	}
+	return nil
+}
+
+func (pps *PgPolicyStorage) GetOne(
+	gtx context.Context, id int64) (*core.Policy, error) {
+	var policy core.Policy
+	err := pps.gd.GetOne(gtx, "idx_policy", "id", id, &policy)
+	if err != nil {
+		return nil, errx.Wrap(err)
+	}
+	return &policy, nil
+}
+
+func (pps *PgPolicyStorage) Remove(gtx context.Context, id int64) error {
+	if err := pps.gd.Delete(gtx, "idx_policy", "id", id); err != nil {
+		return errx.Wrap(err)
+	}
+	return nil
+}
+
+func (pps *PgPolicyStorage) GetForService(
+	gtx context.Context,
+	serviceId int64,
+	enabledOnly bool) ([]*core.Policy, error) {
+	query := `
+		SELECT * FROM idx_policy
+		WHERE service_id = $1 AND (enabled OR NOT $2)
+		ORDER BY name
+	`
+	policies := make([]*core.Policy, 0, 20)
+	err := pg.Conn().SelectContext(
+		gtx, &policies, query, serviceId, enabledOnly)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get policies of service '%d'", serviceId)
+	}
+	return policies, nil
+}
+
+type policyCtl struct {
+	pstore *PgPolicyStorage
+}
+
+func NewPolicyController(pstore *PgPolicyStorage) core.PolicyController {
+	return &policyCtl{
+		pstore: pstore,
+	}
+}
+
+func (pc *policyCtl) Save(
+	gtx context.Context, policy *core.Policy) (int64, error) {
+	ev := core.NewEventAdder(gtx, "policy.save", data.M{
+		"policy": policy,
+	})
+	if err := core.CheckServiceAdmin(gtx, policy.ServiceId); err != nil {
+		return -1, ev.Commit(err)
+	}
+	if err := validatePolicy(gtx, policy); err != nil {
+		return -1, ev.Commit(err)
+	}
+
+	id, err := pc.pstore.Save(gtx, policy)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	return id, ev.Commit(nil)
+}
+
+func (pc *policyCtl) Update(gtx context.Context, policy *core.Policy) error {
+	ev := core.NewEventAdder(gtx, "policy.update", data.M{
+		"policy": policy,
+	})
+
+	// Policy cannot be moved to another service
+	existing, err := pc.pstore.GetOne(gtx, policy.Id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	policy.ServiceId = existing.ServiceId
+
+	if err := core.CheckServiceAdmin(gtx, policy.ServiceId); err != nil {
+		return ev.Commit(err)
+	}
+	if err := validatePolicy(gtx, policy); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(pc.pstore.Update(gtx, policy))
+}
+
+func (pc *policyCtl) GetOne(
+	gtx context.Context, id int64) (*core.Policy, error) {
+	policy, err := pc.pstore.GetOne(gtx, id)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "policy.getOne", data.M{
+			"policyId": id,
+		}).Commit(err)
+	}
+	return policy, nil
+}
+
+func (pc *policyCtl) Remove(gtx context.Context, id int64) error {
+	ev := core.NewEventAdder(gtx, "policy.remove", data.M{
+		"policyId": id,
+	})
+	policy, err := pc.pstore.GetOne(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if err := core.CheckServiceAdmin(gtx, policy.ServiceId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(pc.pstore.Remove(gtx, id))
+}
+
+func (pc *policyCtl) GetForService(
+	gtx context.Context, serviceId int64) ([]*core.Policy, error) {
+	policies, err := pc.pstore.GetForService(gtx, serviceId, false)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "policy.getForService", data.M{
+			"serviceId": serviceId,
+		}).Commit(err)
+	}
+	return policies, nil
+}
+
+func (pc *policyCtl) Evaluate(
+	gtx context.Context,
+	serviceId int64,
+	user *core.User,
+	checks []*core.PermCheck,
+	rctx *core.RequestContext) ([]*core.PolicyDecision, error) {
+
+	policies, err := pc.pstore.GetForService(gtx, serviceId, true)
+	if err != nil {
+		return nil, err
+	}
+	decisions := make([]*core.PolicyDecision, 0, len(checks))
+	if len(policies) == 0 {
+		for range checks {
+			decisions = append(decisions, &core.PolicyDecision{Allowed: true})
+		}
+		return decisions, nil
+	}
+
+	eval, err := serviceEvaluator(gtx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	compiled := compilePolicies(policies)
+	for _, chk := range checks {
+		env := policyEnv(user, chk, rctx)
+		decisions = append(decisions, decide(eval, compiled, chk, env))
+	}
+	return decisions, nil
+}
+
+func (pc *policyCtl) DryRun(
+	gtx context.Context,
+	serviceId int64,
+	req *core.DryRunRequest) (*core.DryRunResult, error) {
+	ev := core.NewEventAdder(gtx, "policy.dryRun", data.M{
+		"serviceId": serviceId,
+		"userId":    req.UserId,
+	})
+	if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+		return nil, ev.Commit(err)
+	}
+	if req.Policy == nil || req.Check == nil {
+		return nil, ev.Errf(core.ErrInvalidState,
+			"dry run needs a policy and a permission check")
+	}
+	req.Policy.ServiceId = serviceId
+	if err := validatePolicy(gtx, req.Policy); err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	user, err := core.UserCtlr(gtx).GetOne(gtx, req.UserId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	eval, err := serviceEvaluator(gtx, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	policies := []*core.Policy{}
+	if !req.Isolated {
+		policies, err = pc.pstore.GetForService(gtx, serviceId, true)
+		if err != nil {
+			return nil, ev.Commit(err)
+		}
+	}
+
+	// Candidate replaces the stored version of itself, if there is one
+	candidate := *req.Policy
+	candidate.Enabled = true
+	others := make([]*core.Policy, 0, len(policies)+1)
+	for _, p := range policies {
+		if p.Id != candidate.Id || candidate.Id == 0 {
+			others = append(others, p)
+		}
+	}
+	compiled := compilePolicies(append(others, &candidate))
+	cand := compiled[len(compiled)-1]
+
+	env := policyEnv(user, req.Check, req.Context)
+	res := &core.DryRunResult{
+		Applies:  cand.covers(eval, req.Check),
+		Decision: decide(eval, compiled, req.Check, env),
+	}
+	if res.Applies {
+		res.Matched, err = evalCondition(cand.cond, env)
+		if err != nil {
+			res.Error = err.Error()
+		}
+	}
+	return res, nil
+}
+
+type compiledPolicy struct {
+	*core.Policy
+	cond condNode
+	err  error
+}
+
+func compilePolicies(policies []*core.Policy) []*compiledPolicy {
+	out := make([]*compiledPolicy, 0, len(policies))
+	for _, p := range policies {
+		cond, err := compileCondition(p.Condition)
+		out = append(out, &compiledPolicy{Policy: p, cond: cond, err: err})
+	}
+	return out
+}
+
+func (cp *compiledPolicy) covers(eval *evaluator, chk *core.PermCheck) bool {
+	_, found := eval.allows(cp.Perms, chk.Perm, chk.Resource)
+	return found
+}
+
+// decide - deny policy whose condition holds denies the check. If allow
+// policies cover the check, at least one of them should hold. Policies that
+// cannot be evaluated are treated as holding for deny and as not holding for
+// allow, so that errors never grant access
+func decide(
+	eval *evaluator,
+	policies []*compiledPolicy,
+	chk *core.PermCheck,
+	env condEnv) *core.PolicyDecision {
+
+	allowBy, restricted := "", ""
+	for _, p := range policies {
+		if !p.covers(eval, chk) {
+			continue
+		}
+		holds, err := p.err == nil, p.err
+		if err == nil {
+			holds, err = evalCondition(p.cond, env)
+		}
+
+		if p.Effect == core.PolicyDeny {
+			if err != nil {
+				return &core.PolicyDecision{
+					Policy: p.Name,
+					Reason: "failed to evaluate deny policy: " + err.Error(),
+				}
+			}
+			if holds {
+				return &core.PolicyDecision{
+					Policy: p.Name,
+					Reason: "denied by policy",
+				}
+			}
+			continue
+		}
+
+		if restricted == "" {
+			restricted = p.Name
+		}
+		if holds && err == nil && allowBy == "" {
+			allowBy = p.Name
+		}
+	}
+
+	if restricted != "" && allowBy == "" {
+		return &core.PolicyDecision{
+			Policy: restricted,
+			Reason: "conditions of the allow policies do not hold",
+		}
+	}
+	return &core.PolicyDecision{Allowed: true, Policy: allowBy}
+}
+
+func policyEnv(
+	user *core.User,
+	chk *core.PermCheck,
+	rctx *core.RequestContext) condEnv {
+	req := core.RequestContext{}
+	if rctx != nil {
+		req = *rctx
+	}
+	if req.Time.IsZero() {
+		req.Time = time.Now()
+	}
+
+	props := data.M{}
+	if user.Props != nil {
+		props = user.Props
+	}
+	resource := map[string]any{}
+	for k, v := range chk.Attrs {
+		resource[k] = v
+	}
+	resource["id"] = chk.Resource
+
+	return condEnv{
+		"user": map[string]any{
+			"id":        user.Id(),
+			"userName":  user.UName,
+			"email":     user.EmailId,
+			"firstName": user.FirstName,
+			"lastName":  user.LastName,
+			"title":     user.Title,
+			"state":     string(user.State),
+			"props":     props,
+		},
+		"request": map[string]any{
+			"ip":   req.IP,
+			"time": req.Time,
+		},
+		"resource": resource,
+	}
+}
+
+func validatePolicy(gtx context.Context, policy *core.Policy) error {
+	if policy.Name == "" {
+		return errx.Errf(core.ErrInvalidState, "policy name is required")
+	}
+	if policy.Effect != core.PolicyAllow && policy.Effect != core.PolicyDeny {
+		return errx.Errf(core.ErrInvalidState,
+			"invalid effect '%s' for policy '%s'", policy.Effect, policy.Name)
+	}
+	if len(policy.Perms) == 0 {
+		return errx.Errf(core.ErrInvalidState,
+			"policy '%s' does not cover any permission", policy.Name)
+	}
+	if _, err := compileCondition(policy.Condition); err != nil {
+		return errx.Errf(err, "invalid condition in policy '%s'", policy.Name)
+	}
+	eval, err := serviceEvaluator(gtx, policy.ServiceId)
+	if err != nil {
+		return err
+	}
+	return eval.validate(policy.Perms)
+}
+
+func serviceEvaluator(
+	gtx context.Context, serviceId int64) (*evaluator, error) {
+	service, err := core.ServiceCtlr(gtx).GetOne(gtx, serviceId)
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get service '%d'", serviceId)
+	}
+	return newEvaluator(service.Name, &service.Permissions)
+}
@@ -22,9 +22,23 @@ func (c *Client) build() *httpx.RequestBuilder {
 	}
 	return builder
 }
-func (c *Client) GetPerms(
-	gtx context.Context, serviceId, userId int) ([]string, error) {
-	return nil, nil
+
+// Check - checks multiple permissions of an user in a service at once,
+// results are in the order of the checks in the request
+func (c *Client) Check(
+	gtx context.Context,
+	serviceId int64,
+	req *core.CheckRequest) ([]*core.CheckResult, error) {
+	apiRes := c.build().
+		Path("/api/v1/service/", serviceId, "check").
+		Post(gtx, req)
+	results := make([]*core.CheckResult, 0, len(req.Checks))
+	if err := apiRes.LoadClose(&results); err != nil {
+		return nil, errx.Errf(err,
+			"failed to check permissions of user '%d' for service '%d'",
+			req.UserId, serviceId)
+	}
+	return results, nil
 }
 
 func (c *Client) CreateService(
@@ -47,6 +61,22 @@ func (c *Client) UpdateService(
 	return nil
 }
 
+// PreviewServiceUpdate - users whose permissions change and the group
+// permissions orphaned if the permission tree of the service is replaced
+func (c *Client) PreviewServiceUpdate(
+	gtx context.Context, srv *core.Service) (*core.AccessImpact, error) {
+	apiRes := c.build().
+		Path("/api/v1/service").
+		QBool("dryRun", true).
+		Put(gtx, srv)
+	var impact core.AccessImpact
+	if err := apiRes.LoadClose(&impact); err != nil {
+		return nil, errx.Errf(err,
+			"failed to preview update of service: '%s'", srv.Name)
+	}
+	return &impact, nil
+}
+
 func (c *Client) GetService(
 	gtx context.Context, id int64) (*core.Service, error) {
 	apiRes := c.build().Path("/api/v1/service", id).Get(gtx)
@@ -197,8 +227,248 @@ func (c *Client) IsServiceAdmin(
 	return out["isAdmin"], nil
 }
 
+func (c *Client) GrantServiceAccess(
+	gtx context.Context, serviceId, userId int64) error {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "user", userId).
+		Put(gtx, nil)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to allow user '%d' to use service '%d'",
+			userId, serviceId)
+	}
+	return nil
+}
+
+func (c *Client) RevokeServiceAccess(
+	gtx context.Context, serviceId, userId int64) error {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "user", userId).
+		Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err,
+			"failed to revoke access of user '%d' to service '%d'",
+			userId, serviceId)
+	}
+	return nil
+}
+
+func (c *Client) GetServiceAllowedUsers(
+	gtx context.Context, serviceId int64) ([]*core.User, error) {
+	apiRes := c.build().Path("/api/v1/service", serviceId, "user").Get(gtx)
+	users := make([]*core.User, 0, 100)
+	if err := apiRes.LoadClose(&users); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get users allowed to use service '%d'", serviceId)
+	}
+	return users, nil
+}
+
 func (c *Client) GetUserPermsForService(
 	gtx context.Context, serviceId, userId int64) ([]string, error) {
-	// TODO - implement
-	return nil, nil
+	apiRes := c.build().
+		Path("/api/v1/service/", serviceId, "perms", userId).
+		Get(gtx)
+	perms := make([]string, 0, 50)
+	if err := apiRes.LoadClose(&perms); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get permissions of user '%d' for service '%d'",
+			userId, serviceId)
+	}
+	return perms, nil
+}
+
+func (c *Client) HasPermission(
+	gtx context.Context,
+	serviceId, userId int64,
+	perm string) (bool, error) {
+	apiRes := c.build().
+		Path("/api/v1/service/", serviceId, "perms", userId, perm).
+		Get(gtx)
+	out := map[string]bool{
+		"allowed": false,
+	}
+	if err := apiRes.LoadClose(&out); err != nil {
+		return false, errx.Errf(err,
+			"failed to check permission '%s' of user '%d' for service '%d'",
+			perm, userId, serviceId)
+	}
+	return out["allowed"], nil
+}
+
+func (c *Client) Explain(
+	gtx context.Context,
+	serviceId, userId int64) (*core.Explanation, error) {
+	var out core.Explanation
+	apiRes := c.build().
+		Path("/api/v1/service/", serviceId, "explain", userId).
+		Get(gtx)
+	if err := apiRes.LoadClose(&out); err != nil {
+		return nil, errx.Errf(err,
+			"failed to explain permissions of user '%d' for service '%d'",
+			userId, serviceId)
+	}
+	return &out, nil
+}
+
+func (c *Client) WhoHas(
+	gtx context.Context,
+	serviceId int64,
+	perm string) (*core.PermHolders, error) {
+	var out core.PermHolders
+	apiRes := c.build().
+		Path("/api/v1/service/", serviceId, "holders").
+		QStr("perm", perm).
+		Get(gtx)
+	if err := apiRes.LoadClose(&out); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get holders of permission '%s' in service '%d'",
+			perm, serviceId)
+	}
+	return &out, nil
+}
+
+func (c *Client) CreatePolicy(
+	gtx context.Context, policy *core.Policy) (int64, error) {
+	apiRes := c.build().Path("/api/v1/policy").Post(gtx, policy)
+	res := map[string]int64{"policyId": int64(-1)}
+	if err := apiRes.LoadClose(&res); err != nil {
+		return -1, errx.Errf(err, "failed to create policy: '%s'", policy.Name)
+	}
+	return res["policyId"], nil
+}
+
+func (c *Client) UpdatePolicy(
+	gtx context.Context, policy *core.Policy) error {
+	apiRes := c.build().Path("/api/v1/policy").Put(gtx, policy)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to update policy: '%s'", policy.Name)
+	}
+	return nil
+}
+
+func (c *Client) GetPolicy(
+	gtx context.Context, id int64) (*core.Policy, error) {
+	apiRes := c.build().Path("/api/v1/policy", id).Get(gtx)
+	var policy core.Policy
+	if err := apiRes.LoadClose(&policy); err != nil {
+		return nil, errx.Errf(err, "failed to get policy: '%d'", id)
+	}
+	return &policy, nil
+}
+
+func (c *Client) RemovePolicy(gtx context.Context, id int64) error {
+	apiRes := c.build().Path("/api/v1/policy", id).Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to delete policy: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) GetPolicies(
+	gtx context.Context, serviceId int64) ([]*core.Policy, error) {
+	apiRes := c.build().Path("/api/v1/service", serviceId, "policy").Get(gtx)
+	policies := make([]*core.Policy, 0, 20)
+	if err := apiRes.LoadClose(&policies); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get policies of service: '%d'", serviceId)
+	}
+	return policies, nil
+}
+
+// DryRunPolicy - evaluates the policy in the request against the sample input
+// without saving it
+func (c *Client) DryRunPolicy(
+	gtx context.Context,
+	serviceId int64,
+	req *core.DryRunRequest) (*core.DryRunResult, error) {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "policy", "dryrun").
+		Post(gtx, req)
+	var res core.DryRunResult
+	if err := apiRes.LoadClose(&res); err != nil {
+		return nil, errx.Errf(err,
+			"failed to dry run policy for service: '%d'", serviceId)
+	}
+	return &res, nil
+}
+
+func (c *Client) CreateSodConstraint(
+	gtx context.Context, sod *core.SodConstraint) (int64, error) {
+	apiRes := c.build().Path("/api/v1/sod").Post(gtx, sod)
+	res := map[string]int64{"constraintId": int64(-1)}
+	if err := apiRes.LoadClose(&res); err != nil {
+		return -1, errx.Errf(err, "failed to create constraint: '%s'", sod.Name)
+	}
+	return res["constraintId"], nil
+}
+
+func (c *Client) UpdateSodConstraint(
+	gtx context.Context, sod *core.SodConstraint) error {
+	apiRes := c.build().Path("/api/v1/sod").Put(gtx, sod)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to update constraint: '%s'", sod.Name)
+	}
+	return nil
+}
+
+func (c *Client) GetSodConstraint(
+	gtx context.Context, id int64) (*core.SodConstraint, error) {
+	apiRes := c.build().Path("/api/v1/sod", id).Get(gtx)
+	var sod core.SodConstraint
+	if err := apiRes.LoadClose(&sod); err != nil {
+		return nil, errx.Errf(err, "failed to get constraint: '%d'", id)
+	}
+	return &sod, nil
+}
+
+func (c *Client) RemoveSodConstraint(gtx context.Context, id int64) error {
+	apiRes := c.build().Path("/api/v1/sod", id).Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to delete constraint: '%d'", id)
+	}
+	return nil
+}
+
+func (c *Client) GetSodConstraints(
+	gtx context.Context, serviceId int64) ([]*core.SodConstraint, error) {
+	apiRes := c.build().Path("/api/v1/service", serviceId, "sod").Get(gtx)
+	constraints := make([]*core.SodConstraint, 0, 20)
+	if err := apiRes.LoadClose(&constraints); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get constraints of service: '%d'", serviceId)
+	}
+	return constraints, nil
+}
+
+// GetSodViolations - users who currently hold both sides of a constraint of
+// the service
+func (c *Client) GetSodViolations(
+	gtx context.Context, serviceId int64) ([]*core.SodViolation, error) {
+	apiRes := c.build().
+		Path("/api/v1/service", serviceId, "sod", "violation").
+		Get(gtx)
+	violations := make([]*core.SodViolation, 0, 20)
+	if err := apiRes.LoadClose(&violations); err != nil {
+		return nil, errx.Errf(err,
+			"failed to get constraint violations of service: '%d'", serviceId)
+	}
+	return violations, nil
+}
+
+// SyncService - syncs the service with the manifest, the changes are only
+// reported in dry run mode
+func (c *Client) SyncService(
+	gtx context.Context,
+	manifest *core.ServiceManifest,
+	opts *core.SyncOptions) (*core.SyncResult, error) {
+	apiRes := c.build().
+		Path("/api/v1/service/sync").
+		QBool("dryRun", opts.DryRun).
+		QBool("prune", opts.Prune).
+		Post(gtx, manifest)
+	var res core.SyncResult
+	if err := apiRes.LoadClose(&res); err != nil {
+		return nil, errx.Errf(err, "failed to sync service '%s'", manifest.Name)
+	}
+	return &res, nil
 }
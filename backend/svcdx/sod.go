@@ -0,0 +1,383 @@
+package svcdx
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+type PgSodStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewSodStorage(gd data.GetterDeleter) *PgSodStorage {
+	return &PgSodStorage{
+		gd: gd,
+	}
+}
+
+func (pss *PgSodStorage) Save(
+	gtx context.Context, sod *core.SodConstraint) (int64, error) {
+	query := `
+		INSERT INTO idx_sod_constraint (
+			created_by,
+			updated_by,
+			service_id,
+			name,
+			description,
+			kind,
+			group_ids,
+			perms,
+			enabled
+		) VALUES (
+			:created_by,
+			:updated_by,
+			:service_id,
+			:name,
+			:description,
+			:kind,
+			:group_ids,
+			:perms,
+			:enabled
+		) RETURNING id;
+	`
+
+	stmt, err := pg.Conn().PrepareNamed(query)
+	if err != nil {
+		return -1, errx.Errf(err, "failed to prepare query to save constraint")
+	}
+
+	var id int64
+	if err = stmt.GetContext(gtx, &id, sod); err != nil {
+		return -1, errx.Errf(err,
+			"failed to insert constraint '%s' to database", sod.Name)
+	}
+	return id, nil
+}
+
+func (pss *PgSodStorage) Update(
+	gtx context.Context, sod *core.SodConstraint) error {
+	sod.UpdatedOn = time.Now()
+	query := `
+		UPDATE idx_sod_constraint SET
+			updated_by = :updated_by,
+			updated_on = :updated_on,
+			name = :name,
+			description = :description,
+			kind = :kind,
+			group_ids = :group_ids,
+			perms = :perms,
+			enabled = :enabled
+		WHERE id = :id
+	`
+	if _, err := pg.Conn().NamedExecContext(gtx, query, sod); err != nil {
+		return errx.Errf(err, "failed to update constraint '%s'", sod.Name)
+	}
+	return nil
+}
+
+func (pss *PgSodStorage) GetOne(
+	gtx context.Context, id int64) (*core.SodConstraint, error) {
+	var sod core.SodConstraint
+	err := pss.gd.GetOne(gtx, "idx_sod_constraint", "id", id, &sod)
+	if err != nil {
+		return nil, errx.Wrap(err)
+	}
+	return &sod, nil
+}
+
+func (pss *PgSodStorage) Remove(gtx context.Context, id int64) error {
+	if err := pss.gd.Delete(gtx, "idx_sod_constraint", "id", id); err != nil {
+		return errx.Wrap(err)
+	}
+	return nil
+}
+
+func (pss *PgSodStorage) GetForService(
+	gtx context.Context,
+	serviceId int64,
+	enabledOnly bool) ([]*core.SodConstraint, error) {
+	query := `
+		SELECT * FROM idx_sod_constraint
+		WHERE service_id = $1 AND (enabled OR NOT $2)
+		ORDER BY name
+	`
+	constraints := make([]*core.SodConstraint, 0, 20)
+	err := pg.Conn().SelectContext(
+		gtx, &constraints, query, serviceId, enabledOnly)
+	if err != nil {
+		return nil, errx.Errf(err,
+			"failed to get constraints of service '%d'", serviceId)
+	}
+	return constraints, nil
+}
+
+type sodCtl struct {
+	sstore   *PgSodStorage
+	srvStore *PgServiceStorage
+}
+
+func NewSodController(
+	sstore *PgSodStorage, srvStore *PgServiceStorage) core.SodController {
+	return &sodCtl{
+		sstore:   sstore,
+		srvStore: srvStore,
+	}
+}
+
+func (sc *sodCtl) Save(
+	gtx context.Context, sod *core.SodConstraint) (int64, error) {
+	ev := core.NewEventAdder(gtx, "sod.save", data.M{
+		"constraint": sod,
+	})
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	if err := core.CheckServiceAdmin(gtx, sod.ServiceId); err != nil {
+		return -1, ev.Commit(err)
+	}
+	if err := validateSod(gtx, sod); err != nil {
+		return -1, ev.Commit(err)
+	}
+
+	sod.CreatedBy, sod.UpdatedBy = user.Id(), user.Id()
+	id, err := sc.sstore.Save(gtx, sod)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	return id, ev.Commit(nil)
+}
+
+func (sc *sodCtl) Update(gtx context.Context, sod *core.SodConstraint) error {
+	ev := core.NewEventAdder(gtx, "sod.update", data.M{
+		"constraint": sod,
+	})
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return ev.Commit(err)
+	}
+
+	// Constraint cannot be moved to another service
+	existing, err := sc.sstore.GetOne(gtx, sod.Id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	sod.ServiceId = existing.ServiceId
+
+	if err := core.CheckServiceAdmin(gtx, sod.ServiceId); err != nil {
+		return ev.Commit(err)
+	}
+	if err := validateSod(gtx, sod); err != nil {
+		return ev.Commit(err)
+	}
+	sod.UpdatedBy = user.Id()
+	return ev.Commit(sc.sstore.Update(gtx, sod))
+}
+
+func (sc *sodCtl) GetOne(
+	gtx context.Context, id int64) (*core.SodConstraint, error) {
+	sod, err := sc.sstore.GetOne(gtx, id)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "sod.getOne", data.M{
+			"constraintId": id,
+		}).Commit(err)
+	}
+	return sod, nil
+}
+
+func (sc *sodCtl) Remove(gtx context.Context, id int64) error {
+	ev := core.NewEventAdder(gtx, "sod.remove", data.M{
+		"constraintId": id,
+	})
+	sod, err := sc.sstore.GetOne(gtx, id)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if err := core.CheckServiceAdmin(gtx, sod.ServiceId); err != nil {
+		return ev.Commit(err)
+	}
+	return ev.Commit(sc.sstore.Remove(gtx, id))
+}
+
+func (sc *sodCtl) GetForService(
+	gtx context.Context, serviceId int64) ([]*core.SodConstraint, error) {
+	constraints, err := sc.sstore.GetForService(gtx, serviceId, false)
+	if err != nil {
+		return nil, core.NewEventAdder(gtx, "sod.getForService", data.M{
+			"serviceId": serviceId,
+		}).Commit(err)
+	}
+	return constraints, nil
+}
+
+func (sc *sodCtl) Check(
+	gtx context.Context,
+	serviceId int64,
+	changes ...*core.AccessChange) error {
+	constraints, err := sc.sstore.GetForService(gtx, serviceId, true)
+	if err != nil || len(constraints) == 0 {
+		return err
+	}
+	eval, err := serviceEvaluator(gtx, serviceId)
+	if err != nil {
+		return err
+	}
+	ag, err := sc.srvStore.accessGraph(gtx, serviceId)
+	if err != nil {
+		return err
+	}
+
+	type key struct{ constraintId, userId int64 }
+	existing := map[key]bool{}
+	for _, v := range ag.violations(eval, constraints) {
+		existing[key{v.ConstraintId, v.UserId}] = true
+	}
+	for _, change := range changes {
+		if err := ag.apply(change); err != nil {
+			return err
+		}
+	}
+	for _, v := range ag.violations(eval, constraints) {
+		if !existing[key{v.ConstraintId, v.UserId}] {
+			return errx.Errf(core.ErrSodViolation,
+				"user '%d' would hold both '%s' and '%s', "+
+					"which are exclusive as per constraint '%s'",
+				v.UserId, v.Items[0], v.Items[1], v.Constraint)
+		}
+	}
+	return nil
+}
+
+func (sc *sodCtl) Violations(
+	gtx context.Context, serviceId int64) ([]*core.SodViolation, error) {
+	ev := core.NewEventAdder(gtx, "sod.violations", data.M{
+		"serviceId": serviceId,
+	})
+	if err := core.CheckServiceAdmin(gtx, serviceId); err != nil {
+		return nil, ev.Commit(err)
+	}
+
+	constraints, err := sc.sstore.GetForService(gtx, serviceId, true)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if len(constraints) == 0 {
+		return []*core.SodViolation{}, nil
+	}
+	eval, err := serviceEvaluator(gtx, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	ag, err := sc.srvStore.accessGraph(gtx, serviceId)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return ag.violations(eval, constraints), nil
+}
+
+// violations - users holding both sides of any of the constraints, ordered
+// by the constraint and then by the user
+func (ag *accessGraph) violations(
+	eval *evaluator, constraints []*core.SodConstraint) []*core.SodViolation {
+	groups := ag.groups()
+	grants := ag.grants()
+
+	out := []*core.SodViolation{}
+	for _, sod := range constraints {
+		items := sod.Perms
+		if sod.Kind == core.SodGroups {
+			items = []string{
+				ag.names[sod.GroupIds[0]], ag.names[sod.GroupIds[1]],
+			}
+		}
+		for userId, ids := range groups {
+			held := false
+			switch sod.Kind {
+			case core.SodGroups:
+				held = ids[sod.GroupIds[0]] && ids[sod.GroupIds[1]]
+			case core.SodPerms:
+				_, first := eval.allows(grants[userId], sod.Perms[0], "")
+				_, second := eval.allows(grants[userId], sod.Perms[1], "")
+				held = first && second
+			}
+			if held {
+				out = append(out, &core.SodViolation{
+					ConstraintId: sod.Id,
+					Constraint:   sod.Name,
+					UserId:       userId,
+					UserName:     ag.users[userId],
+					Items:        items,
+				})
+			}
+		}
+	}
+	slices.SortFunc(out, func(a, b *core.SodViolation) int {
+		if c := strings.Compare(a.Constraint, b.Constraint); c != 0 {
+			return c
+		}
+		return strings.Compare(a.UserName, b.UserName)
+	})
+	return out
+}
+
+func validateSod(gtx context.Context, sod *core.SodConstraint) error {
+	if sod.Name == "" {
+		return errx.Errf(core.ErrInvalidState, "constraint name is required")
+	}
+
+	switch sod.Kind {
+	case core.SodGroups:
+		if len(sod.GroupIds) != 2 || sod.GroupIds[0] == sod.GroupIds[1] {
+			return errx.Errf(core.ErrInvalidState,
+				"constraint '%s' should have two distinct groups", sod.Name)
+		}
+		for _, groupId := range sod.GroupIds {
+			group, err := core.GroupCtlr(gtx).GetOne(gtx, groupId)
+			if err != nil {
+				return err
+			}
+			if int64(group.ServiceId) != sod.ServiceId {
+				return errx.Errf(core.ErrInvalidState,
+					"group '%s' does not belong to the service of "+
+						"constraint '%s'", group.Name, sod.Name)
+			}
+		}
+		sod.Perms = data.Vec[string]{}
+
+	case core.SodPerms:
+		if len(sod.Perms) != 2 || sod.Perms[0] == sod.Perms[1] {
+			return errx.Errf(core.ErrInvalidState,
+				"constraint '%s' should have two distinct permissions",
+				sod.Name)
+		}
+		// Constraints are on the permissions themselves, grants that imply
+		// them are resolved when the constraint is checked
+		for _, perm := range sod.Perms {
+			if strings.ContainsAny(perm, wildcard+scopeSep) {
+				return errx.Errf(ErrInvalidPermission,
+					"constraint '%s' cannot have wildcard or scoped "+
+						"permission '%s'", sod.Name, perm)
+			}
+		}
+		eval, err := serviceEvaluator(gtx, sod.ServiceId)
+		if err != nil {
+			return err
+		}
+		if err := eval.validate(sod.Perms); err != nil {
+			return err
+		}
+		sod.GroupIds = data.Vec[int64]{}
+
+	default:
+		return errx.Errf(core.ErrInvalidState,
+			"invalid kind '%s' for constraint '%s'", sod.Kind, sod.Name)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package tenantdx
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+func TenantEndpoints(gtx context.Context) []*httpx.Endpoint {
+	tc := core.TenantCtlr(gtx)
+	return []*httpx.Endpoint{
+		createTenantEp(tc),
+		updateTenantEp(tc),
+		getTenantEp(tc),
+		getTenantsEp(tc),
+		deleteTenantEp(tc),
+	}
+}
+
+func createTenantEp(tc core.TenantController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var tenant core.Tenant
+		if err := etx.Bind(&tenant); err != nil {
+			return errx.BadReqX(err, "failed to read tenant from request")
+		}
+
+		id, err := tc.Save(etx.Request().Context(), &tenant)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, data.M{
+			"tenantId": id,
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.POST,
+		Path:        "/tenant",
+		Category:    "idx.tenant",
+		Desc:        "Create a tenant",
+		Version:     "v1",
+		Permissions: []string{PermManageTenant},
+		Handler:     handler,
+	}
+}
+
+func updateTenantEp(tc core.TenantController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		var tenant core.Tenant
+		if err := etx.Bind(&tenant); err != nil {
+			return errx.BadReqX(err, "failed to read tenant from request")
+		}
+
+		if err := tc.Update(etx.Request().Context(), &tenant); err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, tenant)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.PUT,
+		Path:        "/tenant",
+		Category:    "idx.tenant",
+		Desc:        "Update a tenant",
+		Version:     "v1",
+		Permissions: []string{PermManageTenant},
+		Handler:     handler,
+	}
+}
+
+func getTenantEp(tc core.TenantController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		tenant, err := tc.GetOne(etx.Request().Context(), id)
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, tenant)
+	}
+
+	// Users can get their own tenant, the controller checks the scope
+	return &httpx.Endpoint{
+		Method:   echo.GET,
+		Path:     "/tenant/:id",
+		Category: "idx.tenant",
+		Desc:     "Get a tenant",
+		Version:  "v1",
+		Role:     auth.Normal,
+		Handler:  handler,
+	}
+}
+
+func getTenantsEp(tc core.TenantController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		tenants, err := tc.Get(etx.Request().Context())
+		if err != nil {
+			return errx.Wrap(err)
+		}
+		return httpx.SendJSON(etx, tenants)
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.GET,
+		Path:        "/tenant",
+		Category:    "idx.tenant",
+		Desc:        "Get all tenants",
+		Version:     "v1",
+		Permissions: []string{PermManageTenant},
+		Handler:     handler,
+	}
+}
+
+func deleteTenantEp(tc core.TenantController) *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		prmg := httpx.NewParamGetter(etx)
+		id := prmg.Int64("id")
+		if prmg.HasError() {
+			return prmg.BadReqError()
+		}
+
+		if err := tc.Remove(etx.Request().Context(), id); err != nil {
+			return errx.Wrap(err)
+		}
+		return etx.String(http.StatusOK, strconv.FormatInt(id, 10))
+	}
+
+	return &httpx.Endpoint{
+		Method:      echo.DELETE,
+		Path:        "/tenant/:id",
+		Category:    "idx.tenant",
+		Desc:        "Delete a tenant without users, services and groups",
+		Version:     "v1",
+		Permissions: []string{PermManageTenant},
+		Handler:     handler,
+	}
+}
@@ -0,0 +1,69 @@
+package tenantdx
+
+import (
+	"context"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+type Client struct {
+	*httpx.Client
+	Timeout time.Duration
+}
+
+func (c *Client) build() *httpx.RequestBuilder {
+	builder := c.Build()
+	if c.Timeout != 0 {
+		builder = builder.WithTimeout(c.Timeout)
+	}
+	return builder
+}
+
+func (c *Client) CreateTenant(
+	gtx context.Context, tenant *core.Tenant) (int64, error) {
+	apiRes := c.build().Path("/api/v1/tenant").Post(gtx, tenant)
+	res := map[string]int64{"tenantId": int64(-1)}
+	if err := apiRes.LoadClose(&res); err != nil {
+		return -1, errx.Errf(err, "failed to create tenant: '%s'", tenant.Name)
+	}
+	return res["tenantId"], nil
+}
+
+func (c *Client) UpdateTenant(
+	gtx context.Context, tenant *core.Tenant) error {
+	apiRes := c.build().Path("/api/v1/tenant").Put(gtx, tenant)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to update tenant: '%s'", tenant.Name)
+	}
+	return nil
+}
+
+func (c *Client) GetTenant(
+	gtx context.Context, id int64) (*core.Tenant, error) {
+	var tenant core.Tenant
+	apiRes := c.build().Path("/api/v1/tenant", id).Get(gtx)
+	if err := apiRes.LoadClose(&tenant); err != nil {
+		return nil, errx.Errf(err, "failed to get tenant: '%d'", id)
+	}
+	return &tenant, nil
+}
+
+func (c *Client) GetTenants(gtx context.Context) ([]*core.Tenant, error) {
+	tenants := make([]*core.Tenant, 0, 20)
+	apiRes := c.build().Path("/api/v1/tenant").Get(gtx)
+	if err := apiRes.LoadClose(&tenants); err != nil {
+		return nil, errx.Errf(err, "failed to get tenants")
+	}
+	return tenants, nil
+}
+
+func (c *Client) RemoveTenant(gtx context.Context, id int64) error {
+	apiRes := c.build().Path("/api/v1/tenant", id).Delete(gtx)
+	if err := apiRes.Close(); err != nil {
+		return errx.Errf(err, "failed to delete tenant: '%d'", id)
+	}
+	return nil
+}
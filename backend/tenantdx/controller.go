@@ -0,0 +1,117 @@
+package tenantdx
+
+import (
+	"context"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+)
+
+type tenantCtl struct {
+	tstore *PgTenantStorage
+}
+
+func NewTenantController(tstore *PgTenantStorage) core.TenantController {
+	return &tenantCtl{
+		tstore: tstore,
+	}
+}
+
+func (tc *tenantCtl) Save(
+	gtx context.Context, tenant *core.Tenant) (int64, error) {
+	ev := core.NewEventAdder(gtx, "tenant.save", data.M{
+		"tenant": tenant,
+	})
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return -1, ev.Commit(err)
+	}
+	if _, scoped := core.TenantScope(gtx); scoped {
+		return -1, ev.Errf(core.ErrUnauthorized,
+			"tenant scoped users cannot create tenants")
+	}
+	if err := validateTenant(tenant); err != nil {
+		return -1, ev.Commit(err)
+	}
+
+	tenant.CreatedBy, tenant.UpdatedBy = user.Id(), user.Id()
+	id, err := tc.tstore.Save(gtx, tenant)
+	return id, ev.Commit(err)
+}
+
+func (tc *tenantCtl) Update(gtx context.Context, tenant *core.Tenant) error {
+	ev := core.NewEventAdder(gtx, "tenant.update", data.M{
+		"tenant": tenant,
+	})
+	user, err := core.GetUser(gtx)
+	if err != nil {
+		return ev.Commit(err)
+	}
+	if err := validateTenant(tenant); err != nil {
+		return ev.Commit(err)
+	}
+
+	tenant.UpdatedBy = user.Id()
+	return ev.Commit(tc.tstore.Update(gtx, tenant))
+}
+
+func (tc *tenantCtl) GetOne(
+	gtx context.Context, id int64) (*core.Tenant, error) {
+	ev := core.NewEventAdder(gtx, "tenant.getOne", data.M{
+		"id": id,
+	})
+	if err := core.CheckTenant(gtx, id); err != nil {
+		return nil, ev.Commit(err)
+	}
+	tenant, err := tc.tstore.GetOne(gtx, id)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	return tenant, nil
+}
+
+func (tc *tenantCtl) GetByName(
+	gtx context.Context, name string) (*core.Tenant, error) {
+	ev := core.NewEventAdder(gtx, "tenant.getByName", data.M{
+		"name": name,
+	})
+	tenant, err := tc.tstore.GetByName(gtx, name)
+	if err != nil {
+		return nil, ev.Commit(err)
+	}
+	if err := core.CheckTenant(gtx, tenant.Id); err != nil {
+		return nil, ev.Commit(err)
+	}
+	return tenant, nil
+}
+
+func (tc *tenantCtl) Get(gtx context.Context) ([]*core.Tenant, error) {
+	tenants, err := tc.tstore.Get(gtx)
+	if err != nil {
+		return nil, core.NewEventAdder(
+			gtx, "tenant.get", data.M{}).Commit(err)
+	}
+	return tenants, nil
+}
+
+func (tc *tenantCtl) Remove(gtx context.Context, id int64) error {
+	ev := core.NewEventAdder(gtx, "tenant.remove", data.M{
+		"id": id,
+	})
+	if id == core.DefaultTenant {
+		return ev.Errf(core.ErrInvalidState,
+			"default tenant cannot be removed")
+	}
+	return ev.Commit(tc.tstore.Remove(gtx, id))
+}
+
+func validateTenant(tenant *core.Tenant) error {
+	if tenant.Name == "" {
+		return errx.Errf(core.ErrInvalidState, "tenant requires a name")
+	}
+	if tenant.DisplayName == "" {
+		tenant.DisplayName = tenant.Name
+	}
+	return nil
+}
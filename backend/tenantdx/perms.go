@@ -0,0 +1,5 @@
+package tenantdx
+
+const (
+	PermManageTenant = "idx.manageTenant"
+)
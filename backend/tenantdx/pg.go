@@ -0,0 +1,117 @@
+package tenantdx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/data/pg"
+	"github.com/varunamachi/libx/errx"
+)
+
+type PgTenantStorage struct {
+	gd data.GetterDeleter
+}
+
+func NewTenantStorage(gd data.GetterDeleter) *PgTenantStorage {
+	return &PgTenantStorage{
+		gd: gd,
+	}
+}
+
+func (pts *PgTenantStorage) Save(
+	gtx context.Context, tenant *core.Tenant) (int64, error) {
+	query := `
+		INSERT INTO idx_tenant (
+			created_by,
+			updated_by,
+			name,
+			display_name,
+			description
+		) VALUES (
+			:created_by,
+			:updated_by,
+			:name,
+			:display_name,
+			:description
+		) RETURNING id
+	`
+
+	stmt, err := pg.Conn().PrepareNamed(query)
+	if err != nil {
+		return -1, errx.Errf(err, "failed to prepare query to save tenant")
+	}
+
+	var id int64
+	if err = stmt.GetContext(gtx, &id, tenant); err != nil {
+		return -1, errx.Errf(err, "failed to insert tenant '%s'", tenant.Name)
+	}
+	return id, nil
+}
+
+func (pts *PgTenantStorage) Update(
+	gtx context.Context, tenant *core.Tenant) error {
+	tenant.UpdatedOn = time.Now()
+	query := `
+		UPDATE idx_tenant SET
+			updated_by = :updated_by,
+			updated_on = :updated_on,
+			name = :name,
+			display_name = :display_name,
+			description = :description
+		WHERE id = :id AND ` + core.TenantCond(gtx, "id")
+	if _, err := pg.Conn().NamedExecContext(gtx, query, tenant); err != nil {
+		return errx.Errf(err, "failed to update tenant '%s'", tenant.Name)
+	}
+	return nil
+}
+
+func (pts *PgTenantStorage) GetOne(
+	gtx context.Context, id int64) (*core.Tenant, error) {
+	query := `SELECT * FROM idx_tenant WHERE id = $1 AND ` +
+		core.TenantCond(gtx, "id")
+	var tenant core.Tenant
+	if err := pg.Conn().GetContext(gtx, &tenant, query, id); err != nil {
+		return nil, errx.Errf(err, "failed to get tenant '%d'", id)
+	}
+	return &tenant, nil
+}
+
+func (pts *PgTenantStorage) GetByName(
+	gtx context.Context, name string) (*core.Tenant, error) {
+	query := `SELECT * FROM idx_tenant WHERE name = $1 AND ` +
+		core.TenantCond(gtx, "id")
+	var tenant core.Tenant
+	err := pg.Conn().GetContext(gtx, &tenant, query, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errx.Errf(core.ErrInvalidState,
+			"tenant '%s' does not exist", name)
+	}
+	if err != nil {
+		return nil, errx.Errf(err, "failed to get tenant '%s'", name)
+	}
+	return &tenant, nil
+}
+
+func (pts *PgTenantStorage) Get(gtx context.Context) ([]*core.Tenant, error) {
+	query := `SELECT * FROM idx_tenant WHERE ` +
+		core.TenantCond(gtx, "id") + ` ORDER BY name`
+	tenants := make([]*core.Tenant, 0, 20)
+	if err := pg.Conn().SelectContext(gtx, &tenants, query); err != nil {
+		return nil, errx.Errf(err, "failed to get tenants")
+	}
+	return tenants, nil
+}
+
+// Remove - only a tenant without users, services and groups can be removed
+func (pts *PgTenantStorage) Remove(gtx context.Context, id int64) error {
+	query := `DELETE FROM idx_tenant WHERE id = $1 AND ` +
+		core.TenantCond(gtx, "id")
+	if _, err := pg.Conn().ExecContext(gtx, query, id); err != nil {
+		return errx.Errf(err, "failed to remove tenant '%d'", id)
+	}
+	return nil
+}
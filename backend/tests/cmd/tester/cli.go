@@ -10,6 +10,7 @@ import (
 	"github.com/urfave/cli/v2"
 	"github.com/varunamachi/idx/pg/schema"
 	"github.com/varunamachi/idx/tests"
+	"github.com/varunamachi/idx/tests/federated"
 	"github.com/varunamachi/idx/tests/simple"
 	"github.com/varunamachi/libx/data/pg"
 	"github.com/varunamachi/libx/errx"
@@ -37,6 +38,7 @@ func runCmd(gtx context.Context) *cli.Command {
 		},
 		Subcommands: []*cli.Command{
 			simpleTestCmd(),
+			federatedTestCmd(),
 		},
 		Before: func(ctx *cli.Context) error {
 
@@ -90,6 +92,17 @@ func simpleTestCmd() *cli.Command {
 	}
 }
 
+func federatedTestCmd() *cli.Command {
+	return &cli.Command{
+		Name:        "federated",
+		Description: "Run upstream identity federation test",
+		Usage:       "Run upstream identity federation test",
+		Action: func(ctx *cli.Context) error {
+			return federated.Run(ctx.Context)
+		},
+	}
+}
+
 func checkPgConnCmd(gtx context.Context) *cli.Command {
 	procMan := proc.NewManager(gtx)
 
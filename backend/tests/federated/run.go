@@ -0,0 +1,114 @@
+package federated
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/idx/client"
+	"github.com/varunamachi/idx/core"
+	"github.com/varunamachi/idx/tests/oidcsrv"
+	"github.com/varunamachi/libx/auth"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/netx"
+)
+
+var super = &core.User{
+	UName:     "super",
+	EmailId:   "super@example.com",
+	AuthzRole: auth.Super,
+	State:     core.Active,
+	FirstName: "Super",
+	LastName:  "User",
+	Title:     "Dr",
+}
+
+const superPassword = "onetwothree"
+
+var provider = &core.UpstreamProvider{
+	Name:         "mock",
+	DisplayName:  "Mock Provider",
+	Issuer:       oidcsrv.Issuer,
+	ClientId:     oidcsrv.ClientId,
+	ClientSecret: oidcsrv.ClientSecret,
+	Scopes:       []string{"openid", "profile", "email"},
+	Enabled:      true,
+	ClaimMapping: core.ClaimMapping{
+		Props: map[string]string{
+			"department": "department",
+		},
+	},
+	ApprovalRules: core.ApprovalRules{
+		{
+			Claim:  "groups",
+			Values: []string{"staff"},
+			Role:   auth.Normal,
+		},
+	},
+}
+
+func Run(gtx context.Context) error {
+	err := netx.WaitForPorts(gtx, "localhost:8888", 10*time.Second)
+	if err != nil {
+		return errx.Wrap(err)
+	}
+
+	cnt := client.New("http://localhost:8888").WithTimeout(5 * time.Minute)
+	if _, err = cnt.Register(gtx, super, superPassword); err != nil {
+		return errx.Wrap(err)
+	}
+	if _, err = cnt.Login(gtx, super.UName, superPassword); err != nil {
+		return errx.Wrap(err)
+	}
+
+	if _, err := cnt.CreateProvider(gtx, provider); err != nil {
+		return errx.Wrap(err)
+	}
+
+	// Staff members are approved by the provider's approval rule
+	oidcsrv.GetProvider().SetIdentity(data.M{
+		"sub":                "fed-1",
+		"preferred_username": "fed_staff",
+		"email":              "fed_staff@example.com",
+		"given_name":         "Fed",
+		"family_name":        "Staff",
+		"department":         "finance",
+		"groups":             []string{"staff"},
+	})
+
+	fc := client.New("http://localhost:8888").WithTimeout(5 * time.Minute)
+	user, err := fc.UpstreamLogin(gtx, provider.Name)
+	if err != nil {
+		return errx.Wrap(err)
+	}
+	if user.State != core.Active {
+		return errx.Fmt("expected federated user to be active, found '%s'",
+			user.State)
+	}
+	log.Info().Str("user", user.UName).Msg("federated user created")
+
+	// Second login should be linked to the same user
+	again, err := fc.UpstreamLogin(gtx, provider.Name)
+	if err != nil {
+		return errx.Wrap(err)
+	}
+	if again.Id() != user.Id() {
+		return errx.Fmt("expected federated login to link to user '%d', "+
+			"found '%d'", user.Id(), again.Id())
+	}
+
+	// Users not matching any rule should wait for approval
+	oidcsrv.GetProvider().SetIdentity(data.M{
+		"sub":                "fed-2",
+		"preferred_username": "fed_guest",
+		"email":              "fed_guest@example.com",
+	})
+	gc := client.New("http://localhost:8888").WithTimeout(5 * time.Minute)
+	if _, err := gc.UpstreamLogin(gtx, provider.Name); err == nil {
+		return errx.Fmt("expected login of unapproved federated user to fail")
+	}
+
+	log.Info().Msg("federated test successful")
+	return nil
+}
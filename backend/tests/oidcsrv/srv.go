@@ -0,0 +1,220 @@
+package oidcsrv
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/varunamachi/libx/data"
+	"github.com/varunamachi/libx/errx"
+	"github.com/varunamachi/libx/httpx"
+)
+
+const (
+	Port         = 9998
+	Issuer       = "http://localhost:9998/api/v1/oidc"
+	ClientId     = "idx-test"
+	ClientSecret = "idx-test-secret"
+	keyId        = "mock-key-1"
+)
+
+var mp = &MockProvider{
+	codes: make(map[string]*authCode),
+}
+
+// GetProvider - gives the mock OIDC provider. The provider does not
+// authenticate anyone, it issues tokens for whatever identity was set last
+// using SetIdentity
+func GetProvider() *MockProvider {
+	return mp
+}
+
+type authCode struct {
+	nonce  string
+	claims data.M
+}
+
+type MockProvider struct {
+	key      *rsa.PrivateKey
+	identity data.M
+	codes    map[string]*authCode
+	mutex    sync.Mutex
+}
+
+func (mp *MockProvider) SetIdentity(claims data.M) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.identity = claims
+}
+
+func (mp *MockProvider) discoveryEp() *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		return httpx.SendJSON(etx, data.M{
+			"issuer":                 Issuer,
+			"authorization_endpoint": Issuer + "/authorize",
+			"token_endpoint":         Issuer + "/token",
+			"jwks_uri":               Issuer + "/jwks",
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:  echo.GET,
+		Path:    "/oidc/.well-known/openid-configuration",
+		Version: "v1",
+		Handler: handler,
+	}
+}
+
+func (mp *MockProvider) jwksEp() *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		pub := mp.key.PublicKey
+		return httpx.SendJSON(etx, data.M{
+			"keys": []data.M{
+				{
+					"kid": keyId,
+					"kty": "RSA",
+					"alg": "RS256",
+					"use": "sig",
+					"n": base64.RawURLEncoding.EncodeToString(
+						pub.N.Bytes()),
+					"e": base64.RawURLEncoding.EncodeToString(
+						big.NewInt(int64(pub.E)).Bytes()),
+				},
+			},
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:  echo.GET,
+		Path:    "/oidc/jwks",
+		Version: "v1",
+		Handler: handler,
+	}
+}
+
+func (mp *MockProvider) authorizeEp() *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		if etx.QueryParam("client_id") != ClientId {
+			return errx.BadReq("unknown client")
+		}
+
+		redirect, err := url.Parse(etx.QueryParam("redirect_uri"))
+		if err != nil {
+			return errx.BadReqX(err, "invalid redirect uri")
+		}
+
+		mp.mutex.Lock()
+		if mp.identity == nil {
+			mp.mutex.Unlock()
+			return errx.BadReq("no identity set in mock provider")
+		}
+		code := uuid.NewString()
+		mp.codes[code] = &authCode{
+			nonce:  etx.QueryParam("nonce"),
+			claims: mp.identity,
+		}
+		mp.mutex.Unlock()
+
+		q := redirect.Query()
+		q.Set("code", code)
+		q.Set("state", etx.QueryParam("state"))
+		redirect.RawQuery = q.Encode()
+		return etx.Redirect(http.StatusFound, redirect.String())
+	}
+
+	return &httpx.Endpoint{
+		Method:  echo.GET,
+		Path:    "/oidc/authorize",
+		Version: "v1",
+		Handler: handler,
+	}
+}
+
+func (mp *MockProvider) tokenEp() *httpx.Endpoint {
+	handler := func(etx echo.Context) error {
+		cid, secret, ok := etx.Request().BasicAuth()
+		if !ok || cid != ClientId || secret != ClientSecret {
+			return echo.NewHTTPError(
+				http.StatusUnauthorized, "invalid client credentials")
+		}
+
+		mp.mutex.Lock()
+		ac, found := mp.codes[etx.FormValue("code")]
+		delete(mp.codes, etx.FormValue("code"))
+		mp.mutex.Unlock()
+		if !found {
+			return errx.BadReq("invalid authorization code")
+		}
+
+		claims := jwt.MapClaims{}
+		for k, v := range ac.claims {
+			claims[k] = v
+		}
+		claims["iss"] = Issuer
+		claims["aud"] = ClientId
+		claims["nonce"] = ac.nonce
+		claims["iat"] = time.Now().Unix()
+		claims["exp"] = time.Now().Add(5 * time.Minute).Unix()
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = keyId
+		signed, err := token.SignedString(mp.key)
+		if err != nil {
+			return errx.Errf(err, "failed to sign id token")
+		}
+
+		return httpx.SendJSON(etx, data.M{
+			"access_token": uuid.NewString(),
+			"token_type":   "Bearer",
+			"id_token":     signed,
+			"expires_in":   300,
+		})
+	}
+
+	return &httpx.Endpoint{
+		Method:  echo.POST,
+		Path:    "/oidc/token",
+		Version: "v1",
+		Handler: handler,
+	}
+}
+
+func (mp *MockProvider) Start(gtx context.Context) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return errx.Errf(err, "failed to generate key for mock oidc provider")
+	}
+	mp.key = key
+
+	go func() {
+		server := httpx.NewServer(nil, nil).WithAPIs(
+			mp.discoveryEp(),
+			mp.jwksEp(),
+			mp.authorizeEp(),
+			mp.tokenEp(),
+		)
+
+		go func() {
+			<-gtx.Done()
+			server.Close()
+		}()
+
+		if err := server.Start(Port); err != nil {
+			if err != http.ErrServerClosed {
+				log.Error().Err(err).Msg("mock oidc provider exited with error")
+			}
+			log.Error().Err(err).Msg("mock oidc provider stopped")
+		}
+	}()
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/varunamachi/idx/pg/schema"
+	"github.com/varunamachi/idx/tests/oidcsrv"
 	"github.com/varunamachi/idx/tests/smsrv"
 	"github.com/varunamachi/libx/data"
 	"github.com/varunamachi/libx/data/pg"
@@ -32,6 +33,10 @@ const pgPassword = "idxp"
 const pgDb = "idx-test"
 const pgPort = "5432"
 
+// testMasterKey - fixed master key so that secrets stay readable across test
+// server restarts
+const testMasterKey = "1:aWR4LXRlc3QtbWFzdGVyLWtleS0wMTIzNDU2Nzg5YWI="
+
 var pgUrl = fmt.Sprintf("postgresql://%s:%s@localhost:%s/%s?sslmode=disable",
 	pgUser, pgPassword, pgPort, pgDb)
 
@@ -64,6 +69,9 @@ func Setup(
 	}
 
 	smsrv.GetMailService().Start(gtx)
+	if err := oidcsrv.GetProvider().Start(gtx); err != nil {
+		return nil, errx.Wrap(err)
+	}
 
 	if !testConfig.SkipAppServer {
 		process, err := BuildAndRunServer(gtx, procMan)
@@ -184,7 +192,9 @@ func BuildAndRunServer(
 		WithArgs("serve", "--pg-url", pgUrl).
 		WithEnv("IDX_MAIL_PROVIDER", "IDX_SIMPLE_MAIL_SERVICE_CLIENT_PROVIDER").
 		WithEnv("IDX_SIMPLE_SRV_SEND_URL", "http://localhost:9999/api/v1/send").
-		WithEnv("IDX_ROLE_MAPPING", "super:Super")
+		WithEnv("IDX_ROLE_MAPPING", "super:Super").
+		WithEnv("IDX_BASE_URL", "http://localhost:8888").
+		WithEnv("IDX_MASTER_KEY", testMasterKey)
 
 	// Wait for fake mail service
 	err := netx.WaitForPorts(gtx, "localhost:9999", 2*time.Minute)
@@ -66,7 +66,7 @@ func Run(gtx context.Context) error {
 
 		log.Info().Str("user", up.user.UName).Msg("verified")
 
-		err = cnt.Approve(gtx, up.user.Id(), up.user.Role())
+		err = cnt.Approve(gtx, up.user.Id(), up.user.Role(), nil)
 		if err != nil {
 			return errx.Wrap(err)
 		}
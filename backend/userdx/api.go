@@ -331,17 +331,17 @@ func approveEp(us core.UserController) *httpx.Endpoint {
 			return pmg.BadReqError()
 		}
 
-		groupIds := make([]int64, 0, 100)
-		if err := etx.Bind(&groupIds); err != nil {
+		var approval core.Approval
+		if err := etx.Bind(&approval); err != nil {
 			return errx.BadReqX(
-				err, "failed to get groupIds for user '%s'", user)
+				err, "failed to get groups and templates for user '%d'", user)
 		}
 
-		if !data.OneOf(role, auth.ValidRoles...) {
+		if !data.OneOf(role, core.ValidRoles...) {
 			return errx.BadReq("invalid role '%s' provided", role)
 		}
 
-		err := us.Approve(etx.Request().Context(), user, role)
+		err := us.Approve(etx.Request().Context(), user, role, &approval)
 		if err != nil {
 			return errx.Wrap(err)
 		}
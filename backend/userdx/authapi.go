@@ -2,6 +2,7 @@ package userdx
 
 import (
 	"context"
+	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -39,19 +40,11 @@ func authenticateEp(athr auth.UserAuthenticator) *httpx.Endpoint {
 			return errx.Errf(err, "failed to retrieve user")
 		}
 
-		token := jwt.New(jwt.SigningMethodHS256)
-		claims := token.Claims.(jwt.MapClaims)
-		claims["username"] = user.Username()
-		claims["id"] = user.Id()
-
-		// TODO - get from application configuration
-		claims["exp"] = time.Now().Add(auth.UserSessionTimeout).Unix()
-		claims["type"] = "user"
-
-		signed, err := token.SignedString(auth.GetJWTKey())
+		signed, err := NewSessionToken(user)
 		if err != nil {
-			return errx.Errf(err, "failed to generate session token")
+			return errx.Wrap(err)
 		}
+		SetSessionCookie(etx, signed)
 
 		return httpx.SendJSON(etx, data.M{
 			"user":  user,
@@ -70,6 +63,75 @@ func authenticateEp(athr auth.UserAuthenticator) *httpx.Endpoint {
 	}
 }
 
+// NewSessionToken - creates a signed session token for the given user, used
+// by both local and federated logins
+func NewSessionToken(user auth.User) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["username"] = user.Username()
+	claims["id"] = user.Id()
+
+	// TODO - get from application configuration
+	claims["exp"] = time.Now().Add(auth.UserSessionTimeout).Unix()
+	claims["type"] = "user"
+	if u, ok := user.(*core.User); ok {
+		claims["tenant"] = u.TenantId
+	}
+
+	signed, err := token.SignedString(auth.GetJWTKey())
+	if err != nil {
+		return "", errx.Errf(err, "failed to generate session token")
+	}
+	return signed, nil
+}
+
+// SessionCookie - carries the session token for the browser based flows like
+// SAML single sign on, where the user agent cannot send a bearer token. It is
+// limited to those paths, the APIs only accept the bearer token
+const SessionCookie = "idx_session"
+
+func SetSessionCookie(etx echo.Context, token string) {
+	etx.SetCookie(&http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/saml",
+		Expires:  time.Now().Add(auth.UserSessionTimeout),
+		HttpOnly: true,
+		Secure:   true,
+		// SP initiated POST binding is a cross site POST
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+// CookieUser - user of the session cookie in the request, ErrUnauthorized if
+// there is no valid session
+func CookieUser(etx echo.Context) (*core.User, error) {
+	cookie, err := etx.Cookie(SessionCookie)
+	if err != nil {
+		return nil, errx.Errf(core.ErrUnauthorized, "no session cookie")
+	}
+
+	token, err := jwt.Parse(cookie.Value, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errx.Fmt("unexpected signing method '%v'",
+				t.Header["alg"])
+		}
+		return auth.GetJWTKey(), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errx.Errf(core.ErrUnauthorized, "invalid session cookie")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["type"] != "user" {
+		return nil, errx.Errf(core.ErrUnauthorized, "invalid session cookie")
+	}
+	userName, ok := claims["username"].(string)
+	if !ok || userName == "" {
+		return nil, errx.Errf(core.ErrUnauthorized, "invalid session cookie")
+	}
+	return core.SessionUser(etx.Request().Context(), userName)
+}
+
 func logout(athr auth.Authenticator) *httpx.Endpoint {
 	handler := func(etx echo.Context) error {
 		// var creds auth.AuthData
@@ -80,6 +142,14 @@ func logout(athr auth.Authenticator) *httpx.Endpoint {
 		// if err != nil {
 		// 	return errx.Wrap(err)
 		// }
+		etx.SetCookie(&http.Cookie{
+			Name:     SessionCookie,
+			Path:     "/saml",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteNoneMode,
+		})
 		return nil
 	}
 	return &httpx.Endpoint{
@@ -115,10 +115,13 @@ func (c *Client) Approve(
 	gtx context.Context,
 	userId int64,
 	role auth.Role,
-	groupIds ...int64) error {
+	approval *core.Approval) error {
+	if approval == nil {
+		approval = &core.Approval{}
+	}
 	apiRes := c.build().
 		Path("/api/v1/user", userId, "approve", string(role)).
-		Patch(gtx, groupIds)
+		Patch(gtx, approval)
 	if err := apiRes.Close(); err != nil {
 		return errx.Errf(err, "failed to set approve user '%d'", userId)
 	}
@@ -34,7 +34,7 @@ func mappedRole(userId string) auth.Role {
 			u := asocs[0]
 			r := asocs[1]
 
-			role := auth.ToRole(r)
+			role := core.ToRole(r)
 			if role == auth.None {
 				log.Error().Str("roleStr", r).
 					Msg("invalid role association")
@@ -108,6 +108,7 @@ func (uc *userCtl) Register(
 	if err != nil {
 		return id, evAdder.Commit(err)
 	}
+	user.DbItem.Id = id
 
 	creds := &core.Creds{
 		UniqueName: user.UName,
@@ -120,11 +121,14 @@ func (uc *userCtl) Register(
 
 	// No need to verify auto approved accounts
 	if user.State == core.Active {
-		return id, nil
+		if err := addInitialGroups(gtx, user, nil); err != nil {
+			return id, evAdder.Commit(err)
+		}
+		return id, evAdder.Commit(nil)
 	}
 
 	if !autoApproved {
-		tok := core.NewToken(user.UName, "verfiy_account", "idx_user")
+		tok := core.NewToken(user.UName, core.TokVerifyAccount, "idx_user")
 		if err := uc.credStore.StoreToken(gtx, tok); err != nil {
 			err = errx.Errf(err, "failed to store user verification token")
 			return id, evAdder.Commit(err)
@@ -153,7 +157,8 @@ func (uc *userCtl) Verify(
 		"username": userName,
 	})
 
-	err := uc.credStore.VerifyToken(gtx, userName, "verify_account", verToken)
+	err := uc.credStore.ConsumeToken(
+		gtx, userName, core.TokVerifyAccount, verToken)
 	if err != nil {
 		return errx.Wrap(evtAdder.Commit(err))
 	}
@@ -176,12 +181,13 @@ func (uc *userCtl) Approve(
 	gtx context.Context,
 	userId int64,
 	role auth.Role,
-	groups ...int64) error {
+	approval *core.Approval) error {
 
 	approver, err := core.GetUser(gtx)
 	ev := core.NewEventAdder(gtx, "user.approve", data.M{
 		"approver": data.Qop(approver != nil, approver.DbItem.Id, -1),
 		"userId":   userId,
+		"approval": approval,
 	})
 	if err != nil {
 		err := errx.Errf(err, "failed to get approver information")
@@ -201,6 +207,11 @@ func (uc *userCtl) Approve(
 			approver.Role())
 		return ev.Commit(err)
 	}
+	if role == core.TenantAdmin && !approver.TenantAdmin() {
+		err = errx.Errf(core.ErrUnauthorized,
+			"role '%s' can only be assigned by tenant admins", role)
+		return ev.Commit(err)
+	}
 
 	user, err := uc.ustore.GetOne(gtx, userId)
 	if err != nil {
@@ -214,15 +225,26 @@ func (uc *userCtl) Approve(
 		return ev.Commit(err)
 	}
 
+	// Resolve the groups before activating, so that an unknown template does
+	// not leave behind an active user without the expected groups
+	groups, err := core.InitialGroups(gtx, user.TenantId, approval)
+	if err != nil {
+		return ev.Commit(errx.Errf(err, "failed to resolve groups for user"))
+	}
+
 	user.State = core.Active
 	user.AuthzRole = role
 	if err := uc.ustore.Update(gtx, user); err != nil {
 		return ev.Commit(errx.Errf(err, "failed to approve user"))
 	}
+	core.NotifyProvisioning(gtx, core.ProvUser, userId)
 
-	// if err := uc.ustore.AddToGroups(gtx, user.SeqId(), groups...); err != nil {
-	// 	return ev.Commit(errx.Errf(err, "failed to approve user with groups"))
-	// }
+	if len(groups) != 0 {
+		err := core.GroupCtlr(gtx).AddToGroups(gtx, userId, groups...)
+		if err != nil {
+			return ev.Commit(errx.Errf(err, "failed to approve user with groups"))
+		}
+	}
 
 	// mt, err := mailtmpl.UserAccountApprovedTemplate()
 	// if err != nil {
@@ -238,6 +260,21 @@ func (uc *userCtl) Approve(
 	return ev.Commit(nil)
 }
 
+// addInitialGroups - adds an user who became active to the default groups of
+// the services of the user's tenant along with the groups given in the
+// approval
+func addInitialGroups(
+	gtx context.Context, user *core.User, approval *core.Approval) error {
+	groups, err := core.InitialGroups(gtx, user.TenantId, approval)
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+	return core.GroupCtlr(gtx).AddToGroups(gtx, user.Id(), groups...)
+}
+
 func (uc *userCtl) InitResetPassword(
 	gtx context.Context, userName string) error {
 	ev := core.NewEventAdder(gtx, "user.pwReset.init", data.M{
@@ -259,7 +296,7 @@ func (uc *userCtl) InitResetPassword(
 	}
 
 	// Generate a password reset token
-	tok := core.NewToken(user.UName, "password_reset", "idx_user")
+	tok := core.NewToken(user.UName, core.TokPasswordReset, "idx_user")
 	if err := uc.credStore.StoreToken(gtx, tok); err != nil {
 		return ev.Errf(err, "failed to store user password reset token")
 	}
@@ -293,7 +330,8 @@ func (uc *userCtl) ResetPassword(
 		"userId": userName,
 	})
 
-	err := uc.credStore.VerifyToken(gtx, userName, "password_reset", token)
+	err := uc.credStore.ConsumeToken(
+		gtx, userName, core.TokPasswordReset, token)
 	if err != nil {
 		return evtAdder.Commit(err)
 	}
@@ -347,8 +385,11 @@ func (uc *userCtl) Save(gtx context.Context, user *core.User) (int64, error) {
 
 func (uc *userCtl) Update(gtx context.Context, user *core.User) error {
 	adr := core.NewEventAdder(gtx, "user.update", data.M{"user": user})
-	err := uc.ustore.Update(gtx, user)
-	return adr.Commit(err)
+	if err := uc.ustore.Update(gtx, user); err != nil {
+		return adr.Commit(err)
+	}
+	core.NotifyProvisioning(gtx, core.ProvUser, user.Id())
+	return adr.Commit(nil)
 }
 
 func (uc *userCtl) GetOne(
@@ -391,6 +432,9 @@ func (uc *userCtl) GetId(
 func (uc *userCtl) SetState(
 	gtx context.Context, id int64, state core.UserState) error {
 	err := uc.ustore.SetState(gtx, id, state)
+	if err == nil {
+		core.NotifyProvisioning(gtx, core.ProvUser, id)
+	}
 	return core.NewEventAdder(gtx, "user.setState", data.M{
 		"userId": id,
 		"state":  state,
@@ -400,6 +444,9 @@ func (uc *userCtl) SetState(
 
 func (uc *userCtl) Remove(gtx context.Context, id int64) error {
 	err := uc.ustore.Remove(gtx, id)
+	if err == nil {
+		core.NotifyProvisioning(gtx, core.ProvUser, id)
+	}
 	return core.NewEventAdder(gtx, "user.delete", data.M{
 		"userId": id,
 	}).Commit(err)
@@ -2,6 +2,7 @@ package userdx
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"slices"
 	"sync"
@@ -27,9 +28,18 @@ var (
 	ErrInvalidCreds     = "invalid credential provided"
 )
 
+// tokenRetention - expired tokens are kept for a while, so that their use is
+// reported as expired instead of unknown
+const tokenRetention = 24 * time.Hour
+
+type policyKey struct {
+	tenantId int64
+	itemType core.AuthEntity
+}
+
 type SecretStorage struct {
 	hasher     core.Hasher
-	pwPolicy   map[core.AuthEntity]*core.CredentialPolicy
+	pwPolicy   map[policyKey]*core.CredentialPolicy
 	policyLock sync.RWMutex
 }
 
@@ -37,14 +47,14 @@ func NewCredentialStorage(
 	hasher core.Hasher) core.SecretStorage {
 	return &SecretStorage{
 		hasher:   hasher,
-		pwPolicy: make(map[core.AuthEntity]*core.CredentialPolicy),
+		pwPolicy: make(map[policyKey]*core.CredentialPolicy),
 	}
 }
 
 func (pcs *SecretStorage) CreatePassword(
 	gtx context.Context, creds *core.Creds) error {
 
-	policy, err := pcs.CredentialPolicy(gtx, creds.Type)
+	policy, err := pcs.policyOf(gtx, creds.UniqueName, creds.Type)
 	if err != nil {
 		return errx.Wrap(err)
 	}
@@ -85,7 +95,7 @@ func (pcs *SecretStorage) UpdatePassword(
 	gtx context.Context, creds *core.Creds) error {
 
 	// check if password matches the policy
-	polocy, err := pcs.CredentialPolicy(gtx, creds.Type)
+	polocy, err := pcs.policyOf(gtx, creds.UniqueName, creds.Type)
 	if err != nil {
 		return errx.Wrap(err)
 	}
@@ -154,7 +164,7 @@ func (pcs *SecretStorage) Authenticate(
 		return errx.Wrap(err)
 	}
 
-	policy, err := pcs.CredentialPolicy(gtx, secret.Type)
+	policy, err := pcs.policyOf(gtx, in.UniqueName, secret.Type)
 	if err != nil {
 		return errx.Wrap(err)
 	}
@@ -208,6 +218,34 @@ func (pcs *SecretStorage) Authenticate(
 			in.UniqueName, in.Type)
 	}
 
+	// Login succeeds even if the hash could not be replaced, it is retried on
+	// the next login
+	if pcs.hasher.NeedsRehash(secret.PasswordHash) {
+		if err := pcs.rehash(gtx, in); err != nil {
+			log.Error().Err(err).
+				Str("uniqueName", in.UniqueName).
+				Msg("failed to rehash password")
+		}
+	}
+	return nil
+}
+
+// rehash - replaces the hash of a verified password without affecting the
+// password history or the expiry
+func (pcs *SecretStorage) rehash(gtx context.Context, in *core.Creds) error {
+	hash, err := pcs.hasher.Hash(in.Password)
+	if err != nil {
+		return err
+	}
+	const query = `
+		UPDATE credential SET password_hash = $1
+		WHERE unique_name = $2 AND item_type = $3
+	`
+	_, err = pg.Conn().ExecContext(gtx, query, hash, in.UniqueName, in.Type)
+	if err != nil {
+		return errx.Errf(err, "failed to update password hash of '%s (%s)'",
+			in.UniqueName, in.Type)
+	}
 	return nil
 }
 
@@ -235,16 +273,20 @@ func (pcs *SecretStorage) StoreToken(
 	gtx context.Context, token *core.Token) error {
 	const query = `
 		INSERT INTO idx_token(
-			token,
+			token_hash,
 			unique_name,
 			assoc_type,
-			operation		
+			operation,
+			created_on,
+			expires_on
 		) VALUES (
-			:token,
+			:token_hash,
 			:unique_name,
 			:assoc_type,
-			:operation
-		) 
+			:operation,
+			:created_on,
+			:expires_on
+		)
 	`
 
 	if _, err := pg.Conn().NamedExecContext(gtx, query, token); err != nil {
@@ -254,92 +296,177 @@ func (pcs *SecretStorage) StoreToken(
 	return nil
 }
 
-func (pcs *SecretStorage) VerifyToken(
+func (pcs *SecretStorage) ConsumeToken(
 	gtx context.Context, un, operation, token string) error {
+	// Single statement so that concurrent requests cannot use the same token
 	const query = `
-		SELECT EXISTS( 
-			SELECT 1 
-			FROM idx_token 
-			WHERE 
-				token = $1 AND 
-				unique_name = $2 AND 
-				operation = $3
-			)
+		UPDATE idx_token SET used_on = NOW()
+		WHERE
+			token_hash = $1 AND
+			unique_name = $2 AND
+			operation = $3 AND
+			used_on IS NULL AND
+			expires_on > NOW()
 	`
-	exists := false
-	err := pg.Conn().GetContext(gtx, &exists, query, token, un, operation)
+	hash := core.HashToken(token)
+	res, err := pg.Conn().ExecContext(gtx, query, hash, un, operation)
 	if err != nil {
-		return errx.Errf(err,
-			"failed to verify toke for %s (%s)", un, operation)
+		return errx.Errf(err, "failed to consume token for %s (%s)",
+			un, operation)
+	}
+	if num, err := res.RowsAffected(); err == nil && num == 1 {
+		return nil
 	}
 
-	const dquery = `
-		DELETE FROM idx_token 
-		WHERE 
-			token = $1 AND 
-			unique_name = $2 AND 
-			operation = $3`
-	_, err = pg.Conn().ExecContext(gtx, dquery, token, un, operation)
+	// Find out why the token was rejected
+	const squery = `
+		SELECT * FROM idx_token
+		WHERE
+			token_hash = $1 AND
+			unique_name = $2 AND
+			operation = $3
+	`
+	var tok core.Token
+	err = pg.Conn().GetContext(gtx, &tok, squery, hash, un, operation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errx.Errf(core.ErrTokenUnknown,
+			"unknown token for %s (%s)", un, operation)
+	}
 	if err != nil {
-		id := un + ":" + operation
-		log.Error().Str("token", id).Msg("failed to delete verified token")
+		return errx.Errf(err, "failed to get token for %s (%s)", un, operation)
 	}
+	if tok.UsedOn != nil {
+		return errx.Errf(core.ErrTokenUsed,
+			"token for %s (%s) is already used", un, operation)
+	}
+	return errx.Errf(core.ErrTokenExpired,
+		"token for %s (%s) has expired", un, operation)
+}
 
-	return nil
+func (pcs *SecretStorage) PurgeTokens(
+	gtx context.Context, expiredBefore time.Time) (int64, error) {
+	const query = `DELETE FROM idx_token WHERE expires_on < $1`
+	res, err := pg.Conn().ExecContext(gtx, query, expiredBefore)
+	if err != nil {
+		return 0, errx.Errf(err, "failed to purge expired tokens")
+	}
+	num, _ := res.RowsAffected()
+	return num, nil
 }
 
 func (pcs *SecretStorage) CredentialPolicy(
 	gtx context.Context,
+	tenantId int64,
 	credType core.AuthEntity) (*core.CredentialPolicy, error) {
+	key := policyKey{tenantId: tenantId, itemType: credType}
 	pcs.policyLock.RLock()
-	defer pcs.policyLock.RUnlock()
-
-	if policy, found := pcs.pwPolicy[credType]; found {
+	policy, found := pcs.pwPolicy[key]
+	pcs.policyLock.RUnlock()
+	if found {
 		return policy, nil
 	}
 
-	const query = `SELECT * FROM credential_policy WHERE item_type = $1`
-	var policy core.CredentialPolicy
-	err := pg.Conn().SelectContext(gtx, &policy, query, credType)
+	// Falls back to the policy of the default tenant
+	const query = `
+		SELECT * FROM credential_policy
+		WHERE
+			item_type = $1 AND
+			tenant_id IN ($2, $3)
+		ORDER BY tenant_id = $2 DESC
+		LIMIT 1
+	`
+	policy = &core.CredentialPolicy{}
+	err := pg.Conn().GetContext(
+		gtx, policy, query, credType, tenantId, core.DefaultTenant)
 	if err != nil {
 		return nil, errx.Errf(err, "failed to retrieve cred policy from DB")
 	}
 
-	pcs.pwPolicy[credType] = &policy
-	return &policy, nil
+	pcs.policyLock.Lock()
+	defer pcs.policyLock.Unlock()
+	pcs.pwPolicy[key] = policy
+	return policy, nil
 }
 
 func (pcs *SecretStorage) SetCredentialPolicy(
 	gtx context.Context,
 	cp *core.CredentialPolicy) error {
 
+	cp.TenantId = core.TenantFor(gtx, cp.TenantId)
 	const query = `INSERT INTO 
 		credential_policy (
+			tenant_id,
 			item_type,
 			pattern,
 			expiry,
 			max_retries,
 			max_reuse	
 		) VALUES (
+			:tenant_id,
 			:item_type,
 			:pattern,
 			:expiry,
 			:max_retries,
 			:max_reuse
-		) ON CONFLICT(item_type) DO UPDATE SET 
-		 	item_type = EXCLUDED.item_type,
+		) ON CONFLICT(tenant_id, item_type) DO UPDATE SET 
 			pattern = EXCLUDED.pattern,
 			expiry = EXCLUDED.expiry,
 			max_retries = EXCLUDED.max_retries,
 			max_reuse = EXCLUDED.max_reuse
 		;`
 
-	if _, err := pg.Conn().NamedExecContext(gtx, query, &cp); err != nil {
+	if _, err := pg.Conn().NamedExecContext(gtx, query, cp); err != nil {
 		return errx.Errf(err, "failed to create/update creds policy")
 	}
 
+	// Tenants without their own policy use the one of the default tenant, so
+	// a change to it can affect any cached entry
 	pcs.policyLock.Lock()
 	defer pcs.policyLock.Unlock()
-	pcs.pwPolicy[cp.ItemType] = cp
+	if cp.TenantId == core.DefaultTenant {
+		clear(pcs.pwPolicy)
+	}
+	pcs.pwPolicy[policyKey{tenantId: cp.TenantId, itemType: cp.ItemType}] = cp
 	return nil
 }
+
+// policyOf - credential policy of the tenant the credentials belong to
+func (pcs *SecretStorage) policyOf(
+	gtx context.Context,
+	uniqueName string,
+	credType core.AuthEntity) (*core.CredentialPolicy, error) {
+	query := `SELECT tenant_id FROM idx_user WHERE user_name = $1`
+	if credType == core.AuthService {
+		query = `SELECT tenant_id FROM idx_service WHERE name = $1`
+	}
+
+	tenantId := core.DefaultTenant
+	err := pg.Conn().GetContext(gtx, &tenantId, query, uniqueName)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, errx.Errf(err,
+			"failed to get tenant of '%s (%s)'", uniqueName, credType)
+	}
+	return pcs.CredentialPolicy(gtx, tenantId, credType)
+}
+
+// RunTokenPurge - periodically deletes the expired tokens until the context
+// is done
+func RunTokenPurge(gtx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gtx.Done():
+			return
+		case <-ticker.C:
+			num, err := core.UserCtlr(gtx).CredentialStorage().PurgeTokens(
+				gtx, time.Now().Add(-tokenRetention))
+			if err != nil {
+				log.Error().Err(err).Msg("failed to purge expired tokens")
+				continue
+			}
+			log.Debug().Int64("count", num).Msg("purged expired tokens")
+		}
+	}
+}
@@ -2,6 +2,7 @@ package userdx
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/varunamachi/idx/core"
@@ -23,8 +24,10 @@ func NewUserStorage(gd data.GetterDeleter) *PgUserStorage {
 func (pgu *PgUserStorage) Save(
 	gtx context.Context, user *core.User) (int64, error) {
 
+	user.TenantId = core.TenantFor(gtx, user.TenantId)
 	query := `
 		INSERT INTO idx_user (
+			tenant_id,
 			created_at,
 			created_by,
 			updated_on,
@@ -38,6 +41,7 @@ func (pgu *PgUserStorage) Save(
 			title,
 			props			
 		) VALUES (
+			:tenant_id,
 			:created_at,
 			:created_by,
 			:updated_on,
@@ -84,10 +88,28 @@ func (pgu *PgUserStorage) Save(
 	// return 0, nil
 }
 
+// Update - updates the user, the credential of the user is renamed along
+// with the user since credentials are identified by the user name
 func (pgu *PgUserStorage) Update(
 	gtx context.Context, user *core.User) error {
 
 	user.UpdatedOn = time.Now()
+	tx, err := pg.Conn().BeginTxx(gtx, &sql.TxOptions{})
+	if err != nil {
+		return errx.Errf(err, "failed to initilize DB transaction")
+	}
+	defer tx.Rollback()
+
+	oldName := ""
+	err = tx.GetContext(gtx, &oldName, `
+		SELECT user_name FROM idx_user
+		WHERE id = $1 AND `+core.TenantCond(gtx, "tenant_id")+`
+		FOR UPDATE
+	`, user.Id())
+	if err != nil {
+		return errx.Errf(err, "failed to get user '%d'", user.Id())
+	}
+
 	query := `
 		UPDATE idx_user SET
 			updated_by = :updated_by,
@@ -100,20 +122,35 @@ func (pgu *PgUserStorage) Update(
 			last_name = :last_name,
 			title = :title,
 			props = :props
-		WHERE id = :id	
-	`
-	if _, err := pg.Conn().NamedExecContext(gtx, query, user); err != nil {
+		WHERE id = :id AND ` + core.TenantCond(gtx, "tenant_id")
+	if _, err := tx.NamedExecContext(gtx, query, user); err != nil {
 		return errx.Errf(
-			err, "failed to update user '%s' to database", user.Id())
+			err, "failed to update user '%d' to database", user.Id())
+	}
+
+	if oldName != user.UName {
+		_, err := tx.ExecContext(gtx, `
+			UPDATE credential SET unique_name = $1
+			WHERE unique_name = $2 AND item_type = $3
+		`, user.UName, oldName, core.AuthUser)
+		if err != nil {
+			return errx.Errf(err,
+				"failed to rename credential of user '%s'", oldName)
+		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return errx.Errf(err,
+			"failed to commit update of user '%d'", user.Id())
+	}
 	return nil
 }
 
 func (pgu *PgUserStorage) GetOne(
 	gtx context.Context, id int64) (*core.User, error) {
 	var user core.User
-	err := pgu.gd.GetOne(gtx, "idx_user", "id", id, &user)
+	err := pgu.gd.GetOne(
+		gtx, core.TenantTable(gtx, "idx_user"), "id", id, &user)
 	if err != nil {
 		return nil, errx.Wrap(err)
 	}
@@ -123,7 +160,8 @@ func (pgu *PgUserStorage) GetOne(
 func (pgu *PgUserStorage) ByUsername(
 	gtx context.Context, un string) (*core.User, error) {
 	var user core.User
-	err := pgu.gd.GetOne(gtx, "idx_user", "user_name", un, &user)
+	err := pgu.gd.GetOne(
+		gtx, core.TenantTable(gtx, "idx_user"), "user_name", un, &user)
 	if err != nil {
 		return nil, errx.Wrap(err)
 	}
@@ -135,8 +173,7 @@ func (pgu *PgUserStorage) SetState(
 	query := `
 		UPDATE idx_user SET
 			state = $2
-		WHERE id = $1	
-	`
+		WHERE id = $1 AND ` + core.TenantCond(gtx, "tenant_id")
 
 	_, err := pg.Conn().ExecContext(gtx, query, id, state)
 	if err != nil {
@@ -148,7 +185,8 @@ func (pgu *PgUserStorage) SetState(
 }
 
 func (pgu *PgUserStorage) Remove(gtx context.Context, id int64) error {
-	query := `DELETE FROM idx_user WHERE id = $2`
+	query := `DELETE FROM idx_user WHERE id = $1 AND ` +
+		core.TenantCond(gtx, "tenant_id")
 
 	_, err := pg.Conn().ExecContext(gtx, query, id)
 	if err != nil {
@@ -164,7 +202,8 @@ func (pgu *PgUserStorage) Get(
 
 	out := make([]*core.User, 0, params.PageSize)
 
-	if err := pgu.gd.Get(gtx, "idx_user", params, &out); err != nil {
+	table := core.TenantTable(gtx, "idx_user")
+	if err := pgu.gd.Get(gtx, table, params, &out); err != nil {
 		return nil, errx.Wrap(err)
 	}
 
@@ -173,6 +212,7 @@ func (pgu *PgUserStorage) Get(
 	return out, nil
 }
 
+// Exists - user names are unique across tenants, hence not scoped
 func (pgu *PgUserStorage) Exists(
 	gtx context.Context, username string) (bool, error) {
 	return pgu.gd.Exists(gtx, "idx_user", "user_name", username)
@@ -180,12 +220,13 @@ func (pgu *PgUserStorage) Exists(
 
 func (pgu *PgUserStorage) Count(
 	gtx context.Context, filter *data.Filter) (int64, error) {
-	return pgu.gd.Count(gtx, "idx_user", filter)
+	return pgu.gd.Count(gtx, core.TenantTable(gtx, "idx_user"), filter)
 }
 
 func (pgu *PgUserStorage) GetId(
 	gtx context.Context, username string) (int64, error) {
-	query := `SELECT id FROM idx_user WHERE user_name =$1`
+	query := `SELECT id FROM idx_user WHERE user_name =$1 AND ` +
+		core.TenantCond(gtx, "tenant_id")
 	id := int64(0)
 	err := pg.Conn().GetContext(gtx, &id, query, username)
 	if err != nil {